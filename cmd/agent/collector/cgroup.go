@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// CgroupRoot точка монтирования cgroup v2
+const CgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUStat счетчики cpu.stat и имена метрик для них
+var cgroupCPUStat = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_throttled":   "CgroupCPUThrottledPeriods",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+// cgroupIOStat счетчики io.stat и имена метрик для них
+var cgroupIOStat = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReadOps",
+	"wios":   "CgroupIOWriteOps",
+}
+
+// CgroupCollector метрики cgroup v2 выбранных контейнеров и сервисов
+type CgroupCollector struct {
+	deltas *deltaTracker
+	root   string
+	paths  []string
+	mu     sync.Mutex
+}
+
+// NewCgroupCollector создает сборщик метрик cgroup без целей
+func NewCgroupCollector() *CgroupCollector {
+	return &CgroupCollector{
+		deltas: newDeltaTracker(),
+		root:   CgroupRoot,
+	}
+}
+
+// Name имя сборщика
+func (c *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Configure задает пути cgroup для наблюдения
+func (c *CgroupCollector) Configure(cfg config.CollectorConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths = append([]string(nil), cfg.Cgroups...)
+	return nil
+}
+
+// Collect собирает по каждой cgroup счетчики cpu.stat, память memory.current
+// и счетчики io.stat по устройствам с меткой cgroup,
+// файлы не включенных в cgroup контроллеров пропускаются
+func (c *CgroupCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]models.Metrics, 0, len(c.paths)*10)
+	for _, path := range c.paths {
+		dir := c.dir(path)
+		if _, err := os.Stat(dir); err != nil {
+			// контейнер мог быть остановлен, остальные cgroup собираем
+			logger.WriteErrorLog(err.Error(), "cgroup "+path)
+			continue
+		}
+		labels := map[string]string{"cgroup": path}
+
+		stat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, key := range models.SortedKeys(cgroupCPUStat) {
+			if value, ok := stat[key]; ok {
+				metrics = c.deltas.appendCounter(metrics, cgroupCPUStat[key], labels, value)
+			}
+		}
+
+		memory, err := readUintFile(filepath.Join(dir, "memory.current"))
+		if err == nil {
+			metrics = append(metrics, labeledGauge("CgroupMemoryCurrent", labels, float64(memory)))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		devices, err := readIOStat(filepath.Join(dir, "io.stat"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, device := range models.SortedKeys(devices) {
+			deviceLabels := map[string]string{"cgroup": path, "device": device}
+			for _, key := range models.SortedKeys(cgroupIOStat) {
+				if value, ok := devices[device][key]; ok {
+					metrics = c.deltas.appendCounter(metrics, cgroupIOStat[key], deviceLabels, value)
+				}
+			}
+		}
+	}
+	return metrics, nil
+}
+
+// dir полный путь до директории cgroup
+func (c *CgroupCollector) dir(path string) string {
+	if strings.HasPrefix(path, c.root) {
+		return path
+	}
+	return filepath.Join(c.root, path)
+}
+
+// readKeyValueFile чтение файла из строк вида "ключ значение"
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		result[fields[0]] = value
+	}
+	return result, scanner.Err()
+}
+
+// readUintFile чтение файла с одним числом
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// readIOStat чтение io.stat, строки вида "8:0 rbytes=1 wbytes=2 rios=3 wios=4"
+func readIOStat(path string) (map[string]map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		stat := make(map[string]uint64, len(fields)-1)
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			stat[key] = value
+		}
+		result[fields[0]] = stat
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+)
+
+// writeCgroup создает файлы статистики cgroup
+func writeCgroup(t *testing.T, dir string, usage, memory, rbytes string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	cpuStat := "usage_usec " + usage + "\nuser_usec 10\nsystem_usec 5\nnr_periods 0\nnr_throttled 0\nthrottled_usec 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(cpuStat), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.current"), []byte(memory+"\n"), 0o644))
+	ioStat := "8:0 rbytes=" + rbytes + " wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "io.stat"), []byte(ioStat), 0o644))
+}
+
+func TestCgroupCollector_Collect(t *testing.T) {
+	root := t.TempDir()
+	service := "system.slice/api.service"
+	writeCgroup(t, filepath.Join(root, service), "1000", "4096", "100")
+	// cgroup без контроллеров cpu и io
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "memory-only"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "memory-only", "memory.current"), []byte("2048"), 0o644))
+
+	c := NewCgroupCollector()
+	c.root = root
+	assert.Equal(t, "cgroup", c.Name())
+	require.NoError(t, c.Configure(config.CollectorConfig{Cgroups: []string{service, "memory-only", "stopped"}}))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "CgroupMemoryCurrent", metrics[0].ID)
+	assert.Equal(t, 4096.0, *metrics[0].Value)
+	assert.Equal(t, map[string]string{"cgroup": service}, metrics[0].Labels)
+	assert.Equal(t, 2048.0, *metrics[1].Value)
+
+	writeCgroup(t, filepath.Join(root, service), "1600", "8192", "350")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	deltas := make(map[string]int64)
+	for _, m := range metrics {
+		if m.MType == "counter" {
+			deltas[m.Key()] = *m.Delta
+		}
+	}
+	assert.Equal(t, int64(600), deltas[`CgroupCPUUsageUsec{cgroup="system.slice/api.service"}`])
+	assert.Equal(t, int64(0), deltas[`CgroupCPUUserUsec{cgroup="system.slice/api.service"}`])
+	assert.Equal(t, int64(250), deltas[`CgroupIOReadBytes{cgroup="system.slice/api.service",device="8:0"}`])
+	assert.Equal(t, int64(0), deltas[`CgroupIOReadOps{cgroup="system.slice/api.service",device="8:0"}`])
+
+	// полный путь от точки монтирования тоже принимается
+	assert.Equal(t, filepath.Join(root, service), c.dir(filepath.Join(root, service)))
+}
+
+func TestCgroupCollector_CollectBrokenFile(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "broken"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "broken", "memory.current"), []byte("max"), 0o644))
+
+	c := NewCgroupCollector()
+	c.root = root
+	require.NoError(t, c.Configure(config.CollectorConfig{Cgroups: []string{"broken"}}))
+	_, err := c.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func Test_readIOStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "io.stat")
+	require.NoError(t, os.WriteFile(path, []byte("8:0 rbytes=1 wbytes=2 rios=3 wios=4\n259:0 rbytes=5\n"), 0o644))
+
+	got, err := readIOStat(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]uint64{
+		"8:0":   {"rbytes": 1, "wbytes": 2, "rios": 3, "wios": 4},
+		"259:0": {"rbytes": 5},
+	}, got)
+}
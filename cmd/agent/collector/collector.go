@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Collector источник метрик агента
+type Collector interface {
+	// Name уникальное имя сборщика, по нему сборщик настраивается в конфигурации
+	Name() string
+	// Collect собирает текущие значения метрик, counter метрики возвращаются
+	// приращением с прошлого вызова Collect
+	Collect(ctx context.Context) ([]models.Metrics, error)
+}
+
+// Configurable сборщик, которому нужны цели из конфигурации агента (процессы, cgroup)
+type Configurable interface {
+	Configure(cfg config.CollectorConfig) error
+}
+
+// gauge метрика типа gauge
+func gauge(id string, value float64) models.Metrics {
+	return models.Metrics{
+		ID:    id,
+		MType: "gauge",
+		Value: &value,
+	}
+}
+
+// labeledGauge метрика типа gauge с метками
+func labeledGauge(id string, labels map[string]string, value float64) models.Metrics {
+	metric := gauge(id, value)
+	metric.Labels = labels
+	return metric
+}
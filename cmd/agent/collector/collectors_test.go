@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeCollector_Collect(t *testing.T) {
+	c := NewRuntimeCollector()
+	assert.Equal(t, "runtime", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metrics, 27)
+	ids := make(map[string]bool, len(metrics))
+	for _, m := range metrics {
+		assert.Equal(t, "gauge", m.MType)
+		require.NotNil(t, m.Value)
+		ids[m.ID] = true
+	}
+	assert.True(t, ids["Alloc"])
+	assert.True(t, ids["GCCPUFraction"])
+	assert.True(t, ids["NumGC"])
+}
+
+func TestRandomCollector_Collect(t *testing.T) {
+	c := NewRandomCollector()
+	assert.Equal(t, "random", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "RandomValue", metrics[0].ID)
+	assert.GreaterOrEqual(t, *metrics[0].Value, 0.0)
+	assert.Less(t, *metrics[0].Value, 1.0)
+}
+
+func TestGopsutilCollector_Collect(t *testing.T) {
+	c := NewGopsutilCollector()
+	assert.Equal(t, "gopsutil", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(metrics), 3)
+	assert.Equal(t, "TotalMemory", metrics[0].ID)
+	assert.Equal(t, "FreeMemory", metrics[1].ID)
+	assert.True(t, strings.HasPrefix(metrics[2].ID, "CPUutilization"))
+}
+
+func TestDiskCollector_Collect(t *testing.T) {
+	c := NewDiskCollector()
+	assert.Equal(t, "disk", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	for _, m := range metrics {
+		if m.MType == "gauge" {
+			assert.Contains(t, m.Labels, "mountpoint")
+		} else {
+			t.Errorf("first disk poll must not report counters, got %s", m.ID)
+		}
+	}
+
+	// со второго опроса ввод-вывод приходит приращениями
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	for _, m := range metrics {
+		if m.MType == "counter" {
+			assert.Contains(t, m.Labels, "device")
+			assert.GreaterOrEqual(t, *m.Delta, int64(0))
+		}
+	}
+}
+
+func TestNetCollector_Collect(t *testing.T) {
+	c := NewNetCollector()
+	assert.Equal(t, "net", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	for _, m := range metrics {
+		assert.Equal(t, "counter", m.MType)
+		assert.Contains(t, m.Labels, "interface")
+		assert.True(t, strings.HasPrefix(m.ID, "Net"))
+	}
+}
+
+func TestLoadCollector_Collect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("load average is not supported")
+	}
+	c := NewLoadCollector()
+	assert.Equal(t, "load", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "Load1", metrics[0].ID)
+	assert.Equal(t, "Load15", metrics[2].ID)
+}
+
+func TestSwapCollector_Collect(t *testing.T) {
+	c := NewSwapCollector()
+	assert.Equal(t, "swap", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+	assert.Equal(t, "SwapTotal", metrics[0].ID)
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 6)
+	assert.Equal(t, "SwapIn", metrics[4].ID)
+	assert.Equal(t, "counter", metrics[4].MType)
+}
+
+func TestFDCollector_Collect(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptors are counted through procfs")
+	}
+	path := filepath.Join(t.TempDir(), "file-nr")
+	require.NoError(t, os.WriteFile(path, []byte("1024\t0\t9223372036854775807\n"), 0o644))
+
+	c := &FDCollector{fileNrPath: path}
+	assert.Equal(t, "fd", c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "ProcessOpenFDs", metrics[0].ID)
+	assert.Greater(t, *metrics[0].Value, 0.0)
+	assert.Equal(t, 1024.0, *metrics[1].Value)
+
+	// без procfs остается только количество дескрипторов агента
+	c.fileNrPath = filepath.Join(t.TempDir(), "missing")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
+
+func Test_readFileNr(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid")
+	invalid := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(valid, []byte("2048 0 4096"), 0o644))
+	require.NoError(t, os.WriteFile(invalid, []byte("broken"), 0o644))
+
+	allocated, maximum, err := readFileNr(valid)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2048), allocated)
+	assert.Equal(t, uint64(4096), maximum)
+
+	_, _, err = readFileNr(invalid)
+	assert.Error(t, err)
+	_, _, err = readFileNr(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
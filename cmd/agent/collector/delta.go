@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// deltaTracker переводит накопительные значения системы (байты, пакеты, операции)
+// в приращения с прошлого опроса, чтобы отправлять их как counter
+type deltaTracker struct {
+	previous map[string]uint64
+	mu       sync.Mutex
+}
+
+// newDeltaTracker создает пустой трекер приращений
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{
+		previous: make(map[string]uint64),
+	}
+}
+
+// counter возвращает приращение накопительного значения с прошлого опроса,
+// первое значение только запоминается, при сбросе счетчика (перезапуск, переполнение)
+// приращением считается текущее значение
+func (t *deltaTracker) counter(id string, labels map[string]string, value uint64) (models.Metrics, bool) {
+	metric := models.Metrics{ID: id, MType: "counter", Labels: labels}
+	key := metric.Key()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, seen := t.previous[key]
+	t.previous[key] = value
+	if !seen {
+		return metric, false
+	}
+	delta := int64(value - previous)
+	if value < previous {
+		delta = int64(value)
+	}
+	metric.Delta = &delta
+	return metric, true
+}
+
+// appendCounter добавляет приращение в список метрик, если оно уже известно
+func (t *deltaTracker) appendCounter(metrics []models.Metrics, id string, labels map[string]string, value uint64) []models.Metrics {
+	if metric, ok := t.counter(id, labels, value); ok {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_deltaTracker_counter(t *testing.T) {
+	tracker := newDeltaTracker()
+	labels := map[string]string{"interface": "eth0"}
+
+	tests := []struct {
+		name   string
+		value  uint64
+		want   int64
+		wantOk bool
+	}{
+		{name: "first value is baseline", value: 100, wantOk: false},
+		{name: "growth", value: 150, want: 50, wantOk: true},
+		{name: "no change", value: 150, want: 0, wantOk: true},
+		{name: "counter reset", value: 20, want: 20, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, ok := tracker.counter("NetBytesSent", labels, tt.value)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, "counter", metric.MType)
+			assert.Equal(t, labels, metric.Labels)
+			if tt.wantOk {
+				require.NotNil(t, metric.Delta)
+				assert.Equal(t, tt.want, *metric.Delta)
+			}
+		})
+	}
+
+	// одинаковые имена с разными метками считаются отдельно
+	_, ok := tracker.counter("NetBytesSent", map[string]string{"interface": "lo"}, 1)
+	assert.False(t, ok)
+}
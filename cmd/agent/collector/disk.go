@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v4/disk"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// DiskCollector заполненность дисков по точкам монтирования и ввод-вывод по устройствам
+type DiskCollector struct {
+	deltas *deltaTracker
+}
+
+// NewDiskCollector создает сборщик метрик дисков
+func NewDiskCollector() *DiskCollector {
+	return &DiskCollector{deltas: newDeltaTracker()}
+}
+
+// Name имя сборщика
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+// Collect собирает DiskTotal, DiskUsed, DiskFree, DiskUsedPercent с меткой mountpoint
+// и счетчики DiskReadBytes, DiskWriteBytes, DiskReadCount, DiskWriteCount с меткой device
+func (c *DiskCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metrics, 0, len(partitions)*4)
+	for _, partition := range partitions {
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil {
+			// точка монтирования может быть недоступна агенту, остальные собираем
+			continue
+		}
+		labels := map[string]string{"mountpoint": partition.Mountpoint}
+		metrics = append(metrics,
+			labeledGauge("DiskTotal", labels, float64(usage.Total)),
+			labeledGauge("DiskUsed", labels, float64(usage.Used)),
+			labeledGauge("DiskFree", labels, float64(usage.Free)),
+			labeledGauge("DiskUsedPercent", labels, usage.UsedPercent),
+		)
+	}
+
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for device, stat := range counters {
+		labels := map[string]string{"device": device}
+		metrics = c.deltas.appendCounter(metrics, "DiskReadBytes", labels, stat.ReadBytes)
+		metrics = c.deltas.appendCounter(metrics, "DiskWriteBytes", labels, stat.WriteBytes)
+		metrics = c.deltas.appendCounter(metrics, "DiskReadCount", labels, stat.ReadCount)
+		metrics = c.deltas.appendCounter(metrics, "DiskWriteCount", labels, stat.WriteCount)
+	}
+	return metrics, nil
+}
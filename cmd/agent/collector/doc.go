@@ -0,0 +1,22 @@
+// Package collector источники метрик агента
+//
+// Каждый источник реализует интерфейс Collector и регистрируется в Registry.
+// Реестр опрашивает включенные сборщики с их собственным интервалом и хранит
+// последние собранные значения до отправки на сервер.
+// Встроенные сборщики:
+// - runtime метрики runtime.MemStats
+// - gopsutil загрузка CPU по ядрам и память системы
+// - random случайное значение RandomValue
+// - disk заполненность точек монтирования и ввод-вывод устройств
+// - net трафик, пакеты и ошибки сетевых интерфейсов
+// - load средняя загрузка системы
+// - swap использование файла подкачки
+// - fd открытые файловые дескрипторы
+// - process CPU, память, потоки, дескрипторы и перезапуски выбранных процессов
+// - cgroup статистика cgroup v2 выбранных контейнеров и сервисов
+//
+// Накопительные значения системы (байты, пакеты, операции) отправляются как counter
+// с приращением с прошлой отправки, реестр суммирует их между опросами,
+// пока CommitCounters не вычтет доставленные на сервер приращения. Приращения пачки,
+// которую так и не удалось доставить, возвращает RestoreCounters.
+package collector
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/shirou/gopsutil/v4/process"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// fileNrPath счетчики открытых файлов ядра Linux
+const fileNrPath = "/proc/sys/fs/file-nr"
+
+// FDCollector открытые файловые дескрипторы агента и системы
+type FDCollector struct {
+	fileNrPath string
+}
+
+// NewFDCollector создает сборщик файловых дескрипторов
+func NewFDCollector() *FDCollector {
+	return &FDCollector{fileNrPath: fileNrPath}
+}
+
+// Name имя сборщика
+func (c *FDCollector) Name() string {
+	return "fd"
+}
+
+// Collect собирает ProcessOpenFDs агента, а на Linux еще HostOpenFDs и HostMaxFDs
+func (c *FDCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	proc, err := process.NewProcessWithContext(ctx, int32(os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	fds, err := proc.NumFDsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []models.Metrics{gauge("ProcessOpenFDs", float64(fds))}
+
+	allocated, maximum, err := readFileNr(c.fileNrPath)
+	if err == nil {
+		metrics = append(metrics,
+			gauge("HostOpenFDs", float64(allocated)),
+			gauge("HostMaxFDs", float64(maximum)),
+		)
+	}
+	return metrics, nil
+}
+
+// readFileNr читает количество выделенных и максимальное количество дескрипторов,
+// формат файла: выделено, свободно, максимум
+func readFileNr(path string) (allocated, maximum uint64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free uint64
+	if _, err = fmt.Sscan(string(data), &allocated, &free, &maximum); err != nil {
+		return 0, 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return allocated, maximum, nil
+}
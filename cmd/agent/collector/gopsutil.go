@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// cpuSampleInterval время замера загрузки CPU
+const cpuSampleInterval = 10 * time.Millisecond
+
+// GopsutilCollector загрузка CPU по ядрам и память системы через gopsutil
+type GopsutilCollector struct{}
+
+// NewGopsutilCollector создает сборщик метрик gopsutil
+func NewGopsutilCollector() *GopsutilCollector {
+	return &GopsutilCollector{}
+}
+
+// Name имя сборщика
+func (c *GopsutilCollector) Name() string {
+	return "gopsutil"
+}
+
+// Collect собирает TotalMemory, FreeMemory и CPUutilization для каждого ядра
+func (c *GopsutilCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	vmStat, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cpuPercent, err := cpu.PercentWithContext(ctx, cpuSampleInterval, true)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metrics, 0, len(cpuPercent)+2)
+	metrics = append(metrics,
+		gauge("TotalMemory", float64(vmStat.Total)),
+		gauge("FreeMemory", float64(vmStat.Free)),
+	)
+	for core, percent := range cpuPercent {
+		metrics = append(metrics, gauge("CPUutilization"+strconv.Itoa(core), percent))
+	}
+	return metrics, nil
+}
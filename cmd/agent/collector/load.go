@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v4/load"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// LoadCollector средняя загрузка системы
+type LoadCollector struct{}
+
+// NewLoadCollector создает сборщик средней загрузки
+func NewLoadCollector() *LoadCollector {
+	return &LoadCollector{}
+}
+
+// Name имя сборщика
+func (c *LoadCollector) Name() string {
+	return "load"
+}
+
+// Collect собирает Load1, Load5 и Load15
+func (c *LoadCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []models.Metrics{
+		gauge("Load1", avg.Load1),
+		gauge("Load5", avg.Load5),
+		gauge("Load15", avg.Load15),
+	}, nil
+}
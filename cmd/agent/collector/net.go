@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v4/net"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// NetCollector трафик, пакеты и ошибки по сетевым интерфейсам
+type NetCollector struct {
+	deltas *deltaTracker
+}
+
+// NewNetCollector создает сборщик сетевых метрик
+func NewNetCollector() *NetCollector {
+	return &NetCollector{deltas: newDeltaTracker()}
+}
+
+// Name имя сборщика
+func (c *NetCollector) Name() string {
+	return "net"
+}
+
+// Collect собирает счетчики NetBytesSent, NetBytesRecv, NetPacketsSent, NetPacketsRecv,
+// NetErrIn, NetErrOut, NetDropIn, NetDropOut с меткой interface
+func (c *NetCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metrics, 0, len(counters)*8)
+	for _, stat := range counters {
+		labels := map[string]string{"interface": stat.Name}
+		metrics = c.deltas.appendCounter(metrics, "NetBytesSent", labels, stat.BytesSent)
+		metrics = c.deltas.appendCounter(metrics, "NetBytesRecv", labels, stat.BytesRecv)
+		metrics = c.deltas.appendCounter(metrics, "NetPacketsSent", labels, stat.PacketsSent)
+		metrics = c.deltas.appendCounter(metrics, "NetPacketsRecv", labels, stat.PacketsRecv)
+		metrics = c.deltas.appendCounter(metrics, "NetErrIn", labels, stat.Errin)
+		metrics = c.deltas.appendCounter(metrics, "NetErrOut", labels, stat.Errout)
+		metrics = c.deltas.appendCounter(metrics, "NetDropIn", labels, stat.Dropin)
+		metrics = c.deltas.appendCounter(metrics, "NetDropOut", labels, stat.Dropout)
+	}
+	return metrics, nil
+}
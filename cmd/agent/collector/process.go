@@ -0,0 +1,237 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// processTarget отслеживаемый процесс и способ его поиска
+type processTarget struct {
+	cmdline     *regexp.Regexp
+	name        string
+	processName string
+	pidFile     string
+}
+
+// processInstance экземпляр процесса, PID может быть переиспользован системой,
+// поэтому экземпляр отличается еще и временем запуска
+type processInstance struct {
+	pid        int32
+	createTime int64
+}
+
+// cpuSample суммарное процессорное время процесса в момент замера
+type cpuSample struct {
+	at    time.Time
+	total float64
+}
+
+// ProcessCollector метрики выбранных процессов: CPU%, RSS, потоки, дескрипторы и перезапуски
+type ProcessCollector struct {
+	instances map[string]map[processInstance]struct{}
+	samples   map[processInstance]cpuSample
+	targets   []processTarget
+	mu        sync.Mutex
+}
+
+// NewProcessCollector создает сборщик метрик процессов без целей
+func NewProcessCollector() *ProcessCollector {
+	return &ProcessCollector{
+		instances: make(map[string]map[processInstance]struct{}),
+		samples:   make(map[processInstance]cpuSample),
+	}
+}
+
+// Name имя сборщика
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+// Configure задает отслеживаемые процессы, у каждого должен быть ровно один способ поиска
+func (c *ProcessCollector) Configure(cfg config.CollectorConfig) error {
+	targets := make([]processTarget, 0, len(cfg.Processes))
+	for _, p := range cfg.Processes {
+		target, err := newProcessTarget(p)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = targets
+	return nil
+}
+
+// newProcessTarget проверка настроек процесса
+func newProcessTarget(p config.ProcessConfig) (processTarget, error) {
+	target := processTarget{name: p.Name, processName: p.ProcessName, pidFile: p.PIDFile}
+	matchers := 0
+	for _, value := range []string{p.ProcessName, p.PIDFile, p.Cmdline} {
+		if value != "" {
+			matchers++
+			if target.name == "" {
+				target.name = value
+			}
+		}
+	}
+	if matchers != 1 {
+		return target, fmt.Errorf("process %q: exactly one of process_name, pidfile, cmdline is required", p.Name)
+	}
+	if p.Cmdline != "" {
+		re, err := regexp.Compile(p.Cmdline)
+		if err != nil {
+			return target, fmt.Errorf("process %q cmdline: %w", target.name, err)
+		}
+		target.cmdline = re
+	}
+	return target, nil
+}
+
+// Collect собирает для каждого процесса ProcessCount, ProcessCPUPercent, ProcessRSS,
+// ProcessThreads, ProcessFDs и счетчик ProcessRestarts с меткой process,
+// если под условие подходит несколько процессов, значения суммируются
+func (c *ProcessCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.targets) == 0 {
+		return nil, nil
+	}
+
+	var all []*process.Process
+	for _, target := range c.targets {
+		if target.pidFile == "" && all == nil {
+			var err error
+			if all, err = process.ProcessesWithContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now()
+	samples := make(map[processInstance]cpuSample)
+	metrics := make([]models.Metrics, 0, len(c.targets)*6)
+	for _, target := range c.targets {
+		labels := map[string]string{"process": target.name}
+		var cpuPercent, rss, threads, fds float64
+		instances := make(map[processInstance]struct{})
+
+		for _, p := range target.find(ctx, all) {
+			createTime, err := p.CreateTimeWithContext(ctx)
+			if err != nil {
+				// процесс завершился во время опроса
+				continue
+			}
+			instance := processInstance{pid: p.Pid, createTime: createTime}
+			instances[instance] = struct{}{}
+
+			if times, err := p.TimesWithContext(ctx); err == nil {
+				sample := cpuSample{at: now, total: times.User + times.System}
+				if previous, ok := c.samples[instance]; ok {
+					cpuPercent += processCPUPercent(previous, sample)
+				}
+				samples[instance] = sample
+			}
+			if memory, err := p.MemoryInfoWithContext(ctx); err == nil {
+				rss += float64(memory.RSS)
+			}
+			if n, err := p.NumThreadsWithContext(ctx); err == nil {
+				threads += float64(n)
+			}
+			if n, err := p.NumFDsWithContext(ctx); err == nil {
+				fds += float64(n)
+			}
+		}
+
+		metrics = append(metrics,
+			labeledGauge("ProcessCount", labels, float64(len(instances))),
+			labeledGauge("ProcessCPUPercent", labels, cpuPercent),
+			labeledGauge("ProcessRSS", labels, rss),
+			labeledGauge("ProcessThreads", labels, threads),
+			labeledGauge("ProcessFDs", labels, fds),
+		)
+
+		previous, seen := c.instances[target.name]
+		c.instances[target.name] = instances
+		if seen {
+			// новые экземпляры после первого опроса - перезапуски процесса
+			restarts := int64(0)
+			for instance := range instances {
+				if _, ok := previous[instance]; !ok {
+					restarts++
+				}
+			}
+			metrics = append(metrics, models.Metrics{ID: "ProcessRestarts", MType: "counter", Labels: labels, Delta: &restarts})
+		}
+	}
+	c.samples = samples
+	return metrics, nil
+}
+
+// find поиск процессов цели среди всех процессов системы
+func (t processTarget) find(ctx context.Context, all []*process.Process) []*process.Process {
+	if t.pidFile != "" {
+		pid, err := readPIDFile(t.pidFile)
+		if err != nil {
+			return nil
+		}
+		p, err := process.NewProcessWithContext(ctx, pid)
+		if err != nil {
+			return nil
+		}
+		return []*process.Process{p}
+	}
+
+	found := make([]*process.Process, 0, 1)
+	for _, p := range all {
+		if t.processName != "" {
+			if name, err := p.NameWithContext(ctx); err == nil && name == t.processName {
+				found = append(found, p)
+			}
+			continue
+		}
+		if cmdline, err := p.CmdlineWithContext(ctx); err == nil && cmdline != "" && t.cmdline.MatchString(cmdline) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// readPIDFile чтение PID процесса из файла
+func readPIDFile(path string) (int32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse pidfile %s: %w", path, err)
+	}
+	if pid <= 0 {
+		return 0, errors.New("invalid pid in " + path)
+	}
+	return int32(pid), nil
+}
+
+// processCPUPercent загрузка CPU процессом между двумя замерами в процентах одного ядра
+func processCPUPercent(previous, current cpuSample) float64 {
+	elapsed := current.at.Sub(previous.at).Seconds()
+	if elapsed <= 0 || current.total < previous.total {
+		return 0
+	}
+	return (current.total - previous.total) / elapsed * 100
+}
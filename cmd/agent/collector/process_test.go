@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// metricsByID метрики по имени для проверок
+func metricsByID(metrics []models.Metrics) map[string]models.Metrics {
+	result := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		result[m.ID] = m
+	}
+	return result
+}
+
+func Test_newProcessTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ProcessConfig
+		wantName string
+		wantErr  bool
+	}{
+		{name: "by name", cfg: config.ProcessConfig{ProcessName: "nginx"}, wantName: "nginx"},
+		{name: "custom label", cfg: config.ProcessConfig{Name: "api", PIDFile: "/run/api.pid"}, wantName: "api"},
+		{name: "by cmdline", cfg: config.ProcessConfig{Cmdline: "python .*worker"}, wantName: "python .*worker"},
+		{name: "no matcher", cfg: config.ProcessConfig{Name: "api"}, wantErr: true},
+		{name: "two matchers", cfg: config.ProcessConfig{ProcessName: "nginx", PIDFile: "/run/nginx.pid"}, wantErr: true},
+		{name: "bad regexp", cfg: config.ProcessConfig{Cmdline: "worker("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := newProcessTarget(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, target.name)
+		})
+	}
+}
+
+func Test_readPIDFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    int32
+		wantErr bool
+	}{
+		{name: "valid", content: "1234\n", want: 1234},
+		{name: "garbage", content: "abc", wantErr: true},
+		{name: "zero", content: "0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".pid")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+			got, err := readPIDFile(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := readPIDFile(filepath.Join(dir, "missing.pid"))
+	assert.Error(t, err)
+}
+
+func Test_processCPUPercent(t *testing.T) {
+	at := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	previous := cpuSample{at: at, total: 10}
+
+	assert.InDelta(t, 50.0, processCPUPercent(previous, cpuSample{at: at.Add(2 * time.Second), total: 11}), 0.001)
+	assert.InDelta(t, 200.0, processCPUPercent(previous, cpuSample{at: at.Add(time.Second), total: 12}), 0.001)
+	assert.Equal(t, 0.0, processCPUPercent(previous, cpuSample{at: at, total: 12}))
+	assert.Equal(t, 0.0, processCPUPercent(previous, cpuSample{at: at.Add(time.Second), total: 5}))
+}
+
+func TestProcessCollector_Collect(t *testing.T) {
+	self, err := process.NewProcess(int32(os.Getpid()))
+	require.NoError(t, err)
+	name, err := self.Name()
+	require.NoError(t, err)
+
+	pidFile := filepath.Join(t.TempDir(), "agent.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0o644))
+
+	c := NewProcessCollector()
+	assert.Equal(t, "process", c.Name())
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	require.NoError(t, c.Configure(config.CollectorConfig{Processes: []config.ProcessConfig{
+		{Name: "self", PIDFile: pidFile},
+		{ProcessName: name},
+		{Name: "cmdline", Cmdline: regexp.QuoteMeta(name)},
+		{Name: "missing", PIDFile: filepath.Join(t.TempDir(), "missing.pid")},
+	}}))
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	// первый опрос запоминает экземпляры, перезапуски считаются со второго
+	for _, m := range metrics {
+		assert.Equal(t, "gauge", m.MType, m.ID)
+	}
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byTarget := make(map[string][]models.Metrics)
+	for _, m := range metrics {
+		byTarget[m.Labels["process"]] = append(byTarget[m.Labels["process"]], m)
+	}
+	require.Len(t, byTarget, 4)
+
+	for _, target := range []string{"self", name, "cmdline"} {
+		got := metricsByID(byTarget[target])
+		assert.GreaterOrEqual(t, *got["ProcessCount"].Value, 1.0, target)
+		assert.Greater(t, *got["ProcessRSS"].Value, 0.0, target)
+		assert.GreaterOrEqual(t, *got["ProcessThreads"].Value, 1.0, target)
+		assert.GreaterOrEqual(t, *got["ProcessCPUPercent"].Value, 0.0, target)
+		require.NotNil(t, got["ProcessRestarts"].Delta, target)
+		assert.Equal(t, int64(0), *got["ProcessRestarts"].Delta, target)
+	}
+
+	missing := metricsByID(byTarget["missing"])
+	assert.Equal(t, 0.0, *missing["ProcessCount"].Value)
+
+	// процесс появился после первого опроса - это перезапуск
+	c.instances["self"] = map[processInstance]struct{}{{pid: 1, createTime: 1}: {}}
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	for _, m := range metrics {
+		if m.ID == "ProcessRestarts" && m.Labels["process"] == "self" {
+			assert.Equal(t, int64(1), *m.Delta)
+		}
+	}
+}
+
+func TestProcessCollector_ConfigureError(t *testing.T) {
+	c := NewProcessCollector()
+	err := c.Configure(config.CollectorConfig{Processes: []config.ProcessConfig{{Name: "empty"}}})
+	assert.Error(t, err)
+}
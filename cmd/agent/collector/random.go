@@ -0,0 +1,26 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// RandomCollector случайное значение RandomValue
+type RandomCollector struct{}
+
+// NewRandomCollector создает сборщик случайного значения
+func NewRandomCollector() *RandomCollector {
+	return &RandomCollector{}
+}
+
+// Name имя сборщика
+func (c *RandomCollector) Name() string {
+	return "random"
+}
+
+// Collect возвращает новое случайное значение
+func (c *RandomCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	return []models.Metrics{gauge("RandomValue", rand.Float64())}, nil
+}
@@ -0,0 +1,325 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// ErrUnknownCollector сборщик с таким именем не зарегистрирован
+var ErrUnknownCollector = errors.New("unknown collector")
+
+// Settings настройки сборщика
+// Enabled включен ли сборщик
+// Interval интервал сбора, 0 - на каждом опросе агента
+type Settings struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
+// entry зарегистрированный сборщик, его последние gauge значения
+// и приращения counter метрик, накопленные с прошлой отправки
+type entry struct {
+	collector Collector
+	lastRun   time.Time
+	counters  map[string]int
+	metrics   []models.Metrics
+	deltas    []models.Metrics
+	settings  Settings
+}
+
+// Registry реестр сборщиков метрик агента
+type Registry struct {
+	entries []*entry
+	owners  map[string]*entry
+	mu      sync.RWMutex
+}
+
+// NewRegistry создает пустой реестр
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewDefaultRegistry создает реестр со встроенными сборщиками
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	enabled := Settings{Enabled: true}
+	_ = r.Register(NewRuntimeCollector(), enabled)
+	_ = r.Register(NewGopsutilCollector(), enabled)
+	_ = r.Register(NewRandomCollector(), enabled)
+	_ = r.Register(NewDiskCollector(), enabled)
+	_ = r.Register(NewNetCollector(), enabled)
+	_ = r.Register(NewLoadCollector(), enabled)
+	_ = r.Register(NewSwapCollector(), enabled)
+	_ = r.Register(NewFDCollector(), enabled)
+	// процессы и cgroup включаются, когда в конфигурации указаны цели
+	_ = r.Register(NewProcessCollector(), Settings{})
+	_ = r.Register(NewCgroupCollector(), Settings{})
+	return r
+}
+
+// Register добавляет сборщик в реестр, имена сборщиков не должны повторяться
+func (r *Registry) Register(c Collector, settings Settings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.collector.Name() == c.Name() {
+			return fmt.Errorf("collector %s already registered", c.Name())
+		}
+	}
+	r.entries = append(r.entries, &entry{collector: c, settings: settings})
+	return nil
+}
+
+// Configure применяет настройки сборщиков из конфигурации агента,
+// не указанные в конфигурации сборщики сохраняют настройки по умолчанию,
+// ошибочные настройки пропускаются и возвращаются одной ошибкой
+func (r *Registry) Configure(collectors map[string]config.CollectorConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for name, cfg := range collectors {
+		e := r.find(name)
+		if e == nil {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownCollector, name))
+			continue
+		}
+		if cfg.Interval != "" {
+			seconds, err := strconv.Atoi(cfg.Interval)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("collector %s interval: %w", name, err))
+				continue
+			}
+			e.settings.Interval = time.Duration(seconds) * time.Second
+		}
+		if c, ok := e.collector.(Configurable); ok {
+			if err := c.Configure(cfg); err != nil {
+				errs = append(errs, fmt.Errorf("collector %s: %w", name, err))
+				continue
+			}
+			if cfg.HasTargets() {
+				e.settings.Enabled = true
+			}
+		}
+		if cfg.Enabled != nil {
+			e.settings.Enabled = *cfg.Enabled
+		}
+		if !e.settings.Enabled {
+			e.metrics = nil
+			e.resetDeltas()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Settings получение настроек сборщика по имени
+func (r *Registry) Settings(name string) (Settings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e := r.find(name)
+	if e == nil {
+		return Settings{}, fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+	}
+	return e.settings, nil
+}
+
+// Names имена зарегистрированных сборщиков в порядке регистрации
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		names = append(names, e.collector.Name())
+	}
+	return names
+}
+
+// Poll опрашивает включенные сборщики, у которых истек интервал сбора,
+// сборщики работают параллельно, при ошибке сохраняются предыдущие значения
+func (r *Registry) Poll(ctx context.Context, now time.Time) {
+	r.mu.RLock()
+	due := make([]*entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.settings.Enabled && (e.lastRun.IsZero() || now.Sub(e.lastRun) >= e.settings.Interval) {
+			due = append(due, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range due {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			metrics, err := e.collector.Collect(ctx)
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			e.lastRun = now
+			if err != nil {
+				logger.WriteErrorLog(err.Error(), "collector "+e.collector.Name())
+				return
+			}
+			e.store(metrics)
+			r.own(e, metrics)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Metrics последние gauge значения и накопленные приращения counter метрик
+// всех включенных сборщиков в порядке регистрации
+func (r *Registry) Metrics() []models.Metrics {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]models.Metrics, 0, 64)
+	for _, e := range r.entries {
+		if !e.settings.Enabled {
+			continue
+		}
+		result = append(result, e.metrics...)
+		for _, metric := range e.deltas {
+			delta := *metric.Delta
+			metric.Delta = &delta
+			result = append(result, metric)
+		}
+	}
+	return result
+}
+
+// ResetCounters обнуляет накопленные приращения counter метрик, вызывается после отправки
+func (r *Registry) ResetCounters() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		e.resetDeltas()
+	}
+}
+
+// CommitCounters вычитает из накопленных приращений counter метрик доставленные на сервер,
+// приращения, накопленные после снимка отправленной пачки, остаются до следующей отправки
+func (r *Registry) CommitCounters(sent []models.Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, metric := range sent {
+		if metric.Delta == nil {
+			continue
+		}
+		for _, e := range r.entries {
+			if e.commitDelta(metric.Key(), *metric.Delta) {
+				break
+			}
+		}
+	}
+}
+
+// RestoreCounters возвращает в накопленные приращения counter метрик пачку, вычтенную при отправке,
+// но так и не доставленную на сервер, чтобы отправить ее приращения со следующей пачкой
+func (r *Registry) RestoreCounters(lost []models.Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, metric := range lost {
+		if metric.Delta == nil {
+			continue
+		}
+		if e, ok := r.owners[metric.Key()]; ok {
+			e.addDelta(metric)
+		}
+	}
+}
+
+// own запоминает, какой сборщик копит приращения counter метрик, вызывается под мьютексом
+func (r *Registry) own(e *entry, metrics []models.Metrics) {
+	for _, metric := range metrics {
+		if metric.Delta == nil {
+			continue
+		}
+		if r.owners == nil {
+			r.owners = make(map[string]*entry)
+		}
+		r.owners[metric.Key()] = e
+	}
+}
+
+// find поиск сборщика по имени, вызывается под мьютексом
+func (r *Registry) find(name string) *entry {
+	for _, e := range r.entries {
+		if e.collector.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// store сохраняет собранные значения, приращения counter метрик суммируются
+// до отправки, чтобы не потерять их при нескольких опросах между отправками,
+// вызывается под мьютексом
+func (e *entry) store(metrics []models.Metrics) {
+	e.metrics = make([]models.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.Delta == nil {
+			e.metrics = append(e.metrics, metric)
+			continue
+		}
+		e.addDelta(metric)
+	}
+}
+
+// addDelta добавляет приращение counter метрики к накопленному, вызывается под мьютексом
+func (e *entry) addDelta(metric models.Metrics) {
+	if e.counters == nil {
+		e.counters = make(map[string]int)
+	}
+	key := metric.Key()
+	if i, ok := e.counters[key]; ok {
+		*e.deltas[i].Delta += *metric.Delta
+		return
+	}
+	delta := *metric.Delta
+	metric.Delta = &delta
+	e.counters[key] = len(e.deltas)
+	e.deltas = append(e.deltas, metric)
+}
+
+// commitDelta вычитает доставленное приращение метрики, полностью доставленное приращение удаляется,
+// false - сборщик не копил приращения этой метрики, вызывается под мьютексом
+func (e *entry) commitDelta(key string, delta int64) bool {
+	i, ok := e.counters[key]
+	if !ok {
+		return false
+	}
+	*e.deltas[i].Delta -= delta
+	if *e.deltas[i].Delta != 0 {
+		return true
+	}
+	e.deltas = slices.Delete(e.deltas, i, i+1)
+	for k, j := range e.counters {
+		if j > i {
+			e.counters[k] = j - 1
+		}
+	}
+	delete(e.counters, key)
+	return true
+}
+
+// resetDeltas удаляет накопленные приращения, вызывается под мьютексом
+func (e *entry) resetDeltas() {
+	e.counters = nil
+	e.deltas = nil
+}
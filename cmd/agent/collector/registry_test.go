@@ -0,0 +1,239 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// fakeCollector сборщик, считающий количество вызовов
+type fakeCollector struct {
+	err   error
+	name  string
+	calls atomic.Int64
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	calls := c.calls.Add(1)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return []models.Metrics{gauge(c.name, float64(calls))}, nil
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(&fakeCollector{name: "a"}, Settings{Enabled: true}))
+	require.NoError(t, r.Register(&fakeCollector{name: "b"}, Settings{}))
+	assert.Error(t, r.Register(&fakeCollector{name: "a"}, Settings{}))
+	assert.Equal(t, []string{"a", "b"}, r.Names())
+}
+
+func TestRegistry_Poll(t *testing.T) {
+	fast := &fakeCollector{name: "fast"}
+	slow := &fakeCollector{name: "slow"}
+	off := &fakeCollector{name: "off"}
+	r := NewRegistry()
+	require.NoError(t, r.Register(fast, Settings{Enabled: true}))
+	require.NoError(t, r.Register(slow, Settings{Enabled: true, Interval: 10 * time.Second}))
+	require.NoError(t, r.Register(off, Settings{}))
+
+	start := time.Now()
+	r.Poll(context.Background(), start)
+	r.Poll(context.Background(), start.Add(2*time.Second))
+	r.Poll(context.Background(), start.Add(10*time.Second))
+
+	assert.Equal(t, int64(3), fast.calls.Load())
+	assert.Equal(t, int64(2), slow.calls.Load())
+	assert.Equal(t, int64(0), off.calls.Load())
+
+	got := r.Metrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, "fast", got[0].ID)
+	assert.Equal(t, 3.0, *got[0].Value)
+	assert.Equal(t, "slow", got[1].ID)
+	assert.Equal(t, 2.0, *got[1].Value)
+}
+
+func TestRegistry_PollKeepsValuesOnError(t *testing.T) {
+	c := &fakeCollector{name: "flaky"}
+	r := NewRegistry()
+	require.NoError(t, r.Register(c, Settings{Enabled: true}))
+
+	r.Poll(context.Background(), time.Now())
+	c.err = errors.New("collect failed")
+	r.Poll(context.Background(), time.Now())
+
+	got := r.Metrics()
+	require.Len(t, got, 1)
+	assert.Equal(t, 1.0, *got[0].Value)
+}
+
+// deltaCollector сборщик, возвращающий приращение счетчика на каждом опросе
+type deltaCollector struct {
+	delta int64
+}
+
+func (c *deltaCollector) Name() string {
+	return "delta"
+}
+
+func (c *deltaCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	delta := c.delta
+	return []models.Metrics{
+		gauge("Level", float64(delta)),
+		{ID: "Bytes", MType: "counter", Delta: &delta, Labels: map[string]string{"device": "sda"}},
+	}, nil
+}
+
+func TestRegistry_CountersAccumulate(t *testing.T) {
+	c := &deltaCollector{delta: 5}
+	r := NewRegistry()
+	require.NoError(t, r.Register(c, Settings{Enabled: true}))
+
+	r.Poll(context.Background(), time.Now())
+	c.delta = 7
+	r.Poll(context.Background(), time.Now())
+
+	got := r.Metrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, 7.0, *got[0].Value)
+	assert.Equal(t, int64(12), *got[1].Delta)
+
+	// снимок не меняется при следующих опросах
+	r.Poll(context.Background(), time.Now())
+	assert.Equal(t, int64(12), *got[1].Delta)
+
+	r.ResetCounters()
+	got = r.Metrics()
+	require.Len(t, got, 1)
+	assert.Equal(t, "Level", got[0].ID)
+}
+
+func TestRegistry_CommitCounters(t *testing.T) {
+	c := &deltaCollector{delta: 5}
+	r := NewRegistry()
+	require.NoError(t, r.Register(c, Settings{Enabled: true}))
+
+	r.Poll(context.Background(), time.Now())
+	sent := r.Metrics()
+	// опрос между снимком и подтверждением отправки
+	c.delta = 7
+	r.Poll(context.Background(), time.Now())
+
+	r.CommitCounters(sent)
+	got := r.Metrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(7), *got[1].Delta, "delta polled after snapshot is kept")
+
+	r.CommitCounters(got)
+	got = r.Metrics()
+	require.Len(t, got, 1)
+	assert.Equal(t, "Level", got[0].ID)
+
+	// приращения чужих метрик игнорируются
+	r.CommitCounters([]models.Metrics{{ID: "PollCount", MType: "counter", Delta: &c.delta}})
+	assert.Len(t, r.Metrics(), 1)
+}
+
+func TestRegistry_RestoreCounters(t *testing.T) {
+	c := &deltaCollector{delta: 5}
+	r := NewRegistry()
+	require.NoError(t, r.Register(c, Settings{Enabled: true}))
+
+	r.Poll(context.Background(), time.Now())
+	sent := r.Metrics()
+	r.CommitCounters(sent)
+	require.Len(t, r.Metrics(), 1)
+
+	// пачка не доставлена, ее приращения отправляются со следующей
+	c.delta = 7
+	r.Poll(context.Background(), time.Now())
+	r.RestoreCounters(sent)
+	got := r.Metrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(12), *got[1].Delta)
+
+	// возвращается и полностью вычтенное приращение
+	r.CommitCounters(got)
+	r.RestoreCounters(sent)
+	got = r.Metrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(5), *got[1].Delta)
+
+	// приращения чужих метрик игнорируются
+	r.RestoreCounters([]models.Metrics{{ID: "PollCount", MType: "counter", Delta: &c.delta}})
+	assert.Len(t, r.Metrics(), 2)
+}
+
+func TestRegistry_Configure(t *testing.T) {
+	enabled := true
+	disabled := false
+	r := NewRegistry()
+	require.NoError(t, r.Register(&fakeCollector{name: "a"}, Settings{Enabled: true}))
+	require.NoError(t, r.Register(&fakeCollector{name: "b"}, Settings{}))
+	r.Poll(context.Background(), time.Now())
+	require.Len(t, r.Metrics(), 1)
+
+	err := r.Configure(map[string]config.CollectorConfig{
+		"a":       {Enabled: &disabled},
+		"b":       {Enabled: &enabled, Interval: "30"},
+		"unknown": {Enabled: &enabled},
+	})
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+	assert.Empty(t, r.Metrics())
+
+	settings, err := r.Settings("b")
+	require.NoError(t, err)
+	assert.Equal(t, Settings{Enabled: true, Interval: 30 * time.Second}, settings)
+
+	_, err = r.Settings("unknown")
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+
+	assert.Error(t, r.Configure(map[string]config.CollectorConfig{"a": {Interval: "1m"}}))
+	assert.NoError(t, r.Configure(nil))
+}
+
+func TestNewDefaultRegistry(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.Equal(t, []string{"runtime", "gopsutil", "random", "disk", "net", "load", "swap", "fd", "process", "cgroup"}, r.Names())
+	for _, name := range r.Names() {
+		settings, err := r.Settings(name)
+		require.NoError(t, err)
+		assert.Equal(t, name != "process" && name != "cgroup", settings.Enabled, name)
+	}
+}
+
+func TestRegistry_ConfigureTargets(t *testing.T) {
+	disabled := false
+	r := NewDefaultRegistry()
+	err := r.Configure(map[string]config.CollectorConfig{
+		"process": {Processes: []config.ProcessConfig{{ProcessName: "nginx"}}},
+		"cgroup":  {Cgroups: []string{"system.slice/api.service"}, Enabled: &disabled},
+	})
+	require.NoError(t, err)
+
+	settings, err := r.Settings("process")
+	require.NoError(t, err)
+	assert.True(t, settings.Enabled)
+	settings, err = r.Settings("cgroup")
+	require.NoError(t, err)
+	assert.False(t, settings.Enabled)
+
+	err = r.Configure(map[string]config.CollectorConfig{
+		"process": {Processes: []config.ProcessConfig{{Name: "no matcher"}}},
+	})
+	assert.Error(t, err)
+}
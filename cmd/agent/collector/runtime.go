@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// RuntimeCollector метрики памяти и сборщика мусора из runtime.MemStats
+type RuntimeCollector struct{}
+
+// NewRuntimeCollector создает сборщик runtime метрик
+func NewRuntimeCollector() *RuntimeCollector {
+	return &RuntimeCollector{}
+}
+
+// Name имя сборщика
+func (c *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+// Collect читает runtime.MemStats
+func (c *RuntimeCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	var rtm runtime.MemStats
+	runtime.ReadMemStats(&rtm)
+
+	return []models.Metrics{
+		gauge("Alloc", float64(rtm.Alloc)),
+		gauge("BuckHashSys", float64(rtm.BuckHashSys)),
+		gauge("Frees", float64(rtm.Frees)),
+		gauge("GCCPUFraction", rtm.GCCPUFraction),
+		gauge("GCSys", float64(rtm.GCSys)),
+		gauge("HeapAlloc", float64(rtm.HeapAlloc)),
+		gauge("HeapIdle", float64(rtm.HeapIdle)),
+		gauge("HeapInuse", float64(rtm.HeapInuse)),
+		gauge("HeapObjects", float64(rtm.HeapObjects)),
+		gauge("HeapReleased", float64(rtm.HeapReleased)),
+		gauge("HeapSys", float64(rtm.HeapSys)),
+		gauge("LastGC", float64(rtm.LastGC)),
+		gauge("Lookups", float64(rtm.Lookups)),
+		gauge("MCacheInuse", float64(rtm.MCacheInuse)),
+		gauge("MCacheSys", float64(rtm.MCacheSys)),
+		gauge("MSpanInuse", float64(rtm.MSpanInuse)),
+		gauge("MSpanSys", float64(rtm.MSpanSys)),
+		gauge("Mallocs", float64(rtm.Mallocs)),
+		gauge("NextGC", float64(rtm.NextGC)),
+		gauge("NumForcedGC", float64(rtm.NumForcedGC)),
+		gauge("NumGC", float64(rtm.NumGC)),
+		gauge("OtherSys", float64(rtm.OtherSys)),
+		gauge("PauseTotalNs", float64(rtm.PauseTotalNs)),
+		gauge("StackInuse", float64(rtm.StackInuse)),
+		gauge("StackSys", float64(rtm.StackSys)),
+		gauge("Sys", float64(rtm.Sys)),
+		gauge("TotalAlloc", float64(rtm.TotalAlloc)),
+	}, nil
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// SwapCollector использование файла подкачки
+type SwapCollector struct {
+	deltas *deltaTracker
+}
+
+// NewSwapCollector создает сборщик метрик подкачки
+func NewSwapCollector() *SwapCollector {
+	return &SwapCollector{deltas: newDeltaTracker()}
+}
+
+// Name имя сборщика
+func (c *SwapCollector) Name() string {
+	return "swap"
+}
+
+// Collect собирает SwapTotal, SwapUsed, SwapFree, SwapUsedPercent
+// и счетчики SwapIn, SwapOut
+func (c *SwapCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	swap, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []models.Metrics{
+		gauge("SwapTotal", float64(swap.Total)),
+		gauge("SwapUsed", float64(swap.Used)),
+		gauge("SwapFree", float64(swap.Free)),
+		gauge("SwapUsedPercent", swap.UsedPercent),
+	}
+	metrics = c.deltas.appendCounter(metrics, "SwapIn", nil, swap.Sin)
+	metrics = c.deltas.appendCounter(metrics, "SwapOut", nil, swap.Sout)
+	return metrics, nil
+}
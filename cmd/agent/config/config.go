@@ -27,6 +27,54 @@ type AgentConfig struct {
 	HashKey        string `json:"hash_key"`
 	RateLimit      string `json:"rate_limit"`
 	CryptoKey      string `json:"crypto_key"`
+	Stream         bool   `json:"stream"`
+
+	SpoolDir         string `json:"spool_dir"`
+	SpoolSegmentSize string `json:"spool_segment_size"`
+	SpoolMaxSize     string `json:"spool_max_size"`
+	SpoolMaxAge      string `json:"spool_max_age"`
+
+	RelayStatsdAddress string `json:"relay_statsd_address"`
+	RelayHTTPAddress   string `json:"relay_http_address"`
+
+	TLSCACert     string `json:"tls_ca_cert"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+	TLSServerName string `json:"tls_server_name"`
+
+	AgentID    string `json:"agent_id"`
+	AgentToken string `json:"agent_token"`
+
+	Collectors map[string]CollectorConfig `json:"collectors"`
+}
+
+// CollectorConfig настройки сборщика метрик
+// Enabled включен ли сборщик, если не указано - остается значение по умолчанию
+// Interval интервал сбора, например "10s", после подготовки конфигурации хранится в секундах
+// Processes отслеживаемые процессы для сборщика process
+// Cgroups пути cgroup v2 относительно /sys/fs/cgroup для сборщика cgroup
+type CollectorConfig struct {
+	Enabled   *bool           `json:"enabled"`
+	Interval  string          `json:"interval"`
+	Processes []ProcessConfig `json:"processes"`
+	Cgroups   []string        `json:"cgroups"`
+}
+
+// HasTargets указаны ли в настройках процессы или cgroup для наблюдения
+func (c CollectorConfig) HasTargets() bool {
+	return len(c.Processes) > 0 || len(c.Cgroups) > 0
+}
+
+// ProcessConfig отслеживаемый процесс, задается одним из способов поиска
+// Name имя процесса в метке process, по умолчанию значение способа поиска
+// ProcessName точное имя исполняемого файла
+// PIDFile путь до файла с PID процесса
+// Cmdline регулярное выражение для командной строки процесса
+type ProcessConfig struct {
+	Name        string `json:"name"`
+	ProcessName string `json:"process_name"`
+	PIDFile     string `json:"pidfile"`
+	Cmdline     string `json:"cmdline"`
 }
 
 // loadConfig загружает конфигурацию из файла
@@ -57,6 +105,26 @@ func (cfg *AgentConfig) prepareConfig() error {
 	}
 	cfg.PollInterval = strconv.FormatFloat(pollInterval.Seconds(), 'f', 0, 64)
 
+	if cfg.SpoolMaxAge != "" {
+		spoolMaxAge, err := time.ParseDuration(cfg.SpoolMaxAge)
+		if err != nil {
+			return fmt.Errorf("failed to parse SpoolMaxAge: %w", err)
+		}
+		cfg.SpoolMaxAge = strconv.FormatFloat(spoolMaxAge.Seconds(), 'f', 0, 64)
+	}
+
+	for name, collector := range cfg.Collectors {
+		if collector.Interval == "" {
+			continue
+		}
+		interval, err := time.ParseDuration(collector.Interval)
+		if err != nil {
+			return fmt.Errorf("failed to parse interval of collector %s: %w", name, err)
+		}
+		collector.Interval = strconv.FormatFloat(interval.Seconds(), 'f', 0, 64)
+		cfg.Collectors[name] = collector
+	}
+
 	return nil
 }
 
@@ -65,6 +65,7 @@ func TestAgentConfig_prepareConfig(t *testing.T) {
 		HashKey        string
 		RateLimit      string
 		CryptoKey      string
+		SpoolMaxAge    string
 	}
 	tests := []struct {
 		name string
@@ -79,6 +80,7 @@ func TestAgentConfig_prepareConfig(t *testing.T) {
 				HashKey:        "test",
 				RateLimit:      "1",
 				CryptoKey:      "/test/test/test.pem",
+				SpoolMaxAge:    "1h",
 			},
 		},
 	}
@@ -91,6 +93,7 @@ func TestAgentConfig_prepareConfig(t *testing.T) {
 				HashKey:        tt.conf.HashKey,
 				RateLimit:      tt.conf.RateLimit,
 				CryptoKey:      tt.conf.CryptoKey,
+				SpoolMaxAge:    tt.conf.SpoolMaxAge,
 			}
 			err := cfg.prepareConfig()
 			assert.NoError(t, err)
@@ -100,6 +103,7 @@ func TestAgentConfig_prepareConfig(t *testing.T) {
 			assert.Equal(t, tt.conf.HashKey, cfg.HashKey)
 			assert.Equal(t, tt.conf.RateLimit, cfg.RateLimit)
 			assert.Equal(t, tt.conf.CryptoKey, cfg.CryptoKey)
+			assert.Equal(t, "3600", cfg.SpoolMaxAge)
 		})
 	}
 }
@@ -149,3 +153,29 @@ func TestGetConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentConfig_prepareConfig_Collectors(t *testing.T) {
+	disabled := false
+	cfg := &AgentConfig{
+		ReportInterval: "10s",
+		PollInterval:   "2s",
+		Collectors: map[string]CollectorConfig{
+			"runtime":  {Interval: "1m"},
+			"gopsutil": {Enabled: &disabled},
+		},
+	}
+	assert.NoError(t, cfg.prepareConfig())
+	assert.Equal(t, "60", cfg.Collectors["runtime"].Interval)
+	assert.Equal(t, "", cfg.Collectors["gopsutil"].Interval)
+	assert.False(t, *cfg.Collectors["gopsutil"].Enabled)
+
+	cfg.Collectors = map[string]CollectorConfig{"random": {Interval: "often"}}
+	cfg.ReportInterval, cfg.PollInterval = "10s", "2s"
+	assert.Error(t, cfg.prepareConfig())
+}
+
+func TestCollectorConfig_HasTargets(t *testing.T) {
+	assert.False(t, CollectorConfig{Interval: "10"}.HasTargets())
+	assert.True(t, CollectorConfig{Processes: []ProcessConfig{{ProcessName: "nginx"}}}.HasTargets())
+	assert.True(t, CollectorConfig{Cgroups: []string{"system.slice/api.service"}}.HasTargets())
+}
@@ -55,3 +55,112 @@ func (cfg *AgentConfig) GetCryptoKey(defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetStream получение параметра Stream
+func (cfg *AgentConfig) GetStream(defaultValue bool) bool {
+	if cfg.Stream {
+		return cfg.Stream
+	}
+	return defaultValue
+}
+
+// GetSpoolDir получение параметра SpoolDir
+func (cfg *AgentConfig) GetSpoolDir(defaultValue string) string {
+	if cfg.SpoolDir != "" {
+		return cfg.SpoolDir
+	}
+	return defaultValue
+}
+
+// GetSpoolSegmentSize получение параметра SpoolSegmentSize
+func (cfg *AgentConfig) GetSpoolSegmentSize(defaultValue int64) int64 {
+	if val, err := strconv.ParseInt(cfg.SpoolSegmentSize, 10, 64); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetSpoolMaxSize получение параметра SpoolMaxSize
+func (cfg *AgentConfig) GetSpoolMaxSize(defaultValue int64) int64 {
+	if val, err := strconv.ParseInt(cfg.SpoolMaxSize, 10, 64); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetSpoolMaxAge получение параметра SpoolMaxAge
+func (cfg *AgentConfig) GetSpoolMaxAge(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.SpoolMaxAge); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetRelayStatsdAddress получение параметра RelayStatsdAddress
+func (cfg *AgentConfig) GetRelayStatsdAddress(defaultValue string) string {
+	if cfg.RelayStatsdAddress != "" {
+		return cfg.RelayStatsdAddress
+	}
+	return defaultValue
+}
+
+// GetRelayHTTPAddress получение параметра RelayHTTPAddress
+func (cfg *AgentConfig) GetRelayHTTPAddress(defaultValue string) string {
+	if cfg.RelayHTTPAddress != "" {
+		return cfg.RelayHTTPAddress
+	}
+	return defaultValue
+}
+
+// GetCollectors получение настроек сборщиков метрик
+func (cfg *AgentConfig) GetCollectors() map[string]CollectorConfig {
+	return cfg.Collectors
+}
+
+// GetTLSCACert получение параметра TLSCACert
+func (cfg *AgentConfig) GetTLSCACert(defaultValue string) string {
+	if cfg.TLSCACert != "" {
+		return cfg.TLSCACert
+	}
+	return defaultValue
+}
+
+// GetTLSCert получение параметра TLSCert
+func (cfg *AgentConfig) GetTLSCert(defaultValue string) string {
+	if cfg.TLSCert != "" {
+		return cfg.TLSCert
+	}
+	return defaultValue
+}
+
+// GetTLSKey получение параметра TLSKey
+func (cfg *AgentConfig) GetTLSKey(defaultValue string) string {
+	if cfg.TLSKey != "" {
+		return cfg.TLSKey
+	}
+	return defaultValue
+}
+
+// GetTLSServerName получение параметра TLSServerName
+func (cfg *AgentConfig) GetTLSServerName(defaultValue string) string {
+	if cfg.TLSServerName != "" {
+		return cfg.TLSServerName
+	}
+	return defaultValue
+}
+
+// GetAgentID получение параметра AgentID
+func (cfg *AgentConfig) GetAgentID(defaultValue string) string {
+	if cfg.AgentID != "" {
+		return cfg.AgentID
+	}
+	return defaultValue
+}
+
+// GetAgentToken получение параметра AgentToken
+func (cfg *AgentConfig) GetAgentToken(defaultValue string) string {
+	if cfg.AgentToken != "" {
+		return cfg.AgentToken
+	}
+	return defaultValue
+}
@@ -14,6 +14,7 @@ func TestAgentConfig_Get(t *testing.T) {
 		HashKey        string
 		RateLimit      string
 		CryptoKey      string
+		Stream         bool
 	}
 	type wantConf struct {
 		Address        string
@@ -22,6 +23,7 @@ func TestAgentConfig_Get(t *testing.T) {
 		ReportInterval int
 		PollInterval   int
 		RateLimit      int
+		Stream         bool
 	}
 	tests := []struct {
 		name               string
@@ -39,6 +41,7 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:        "testhashkey",
 				RateLimit:      "1",
 				CryptoKey:      "testcryptokey",
+				Stream:         true,
 			},
 			wantConf: wantConf{
 				Address:        "localhost:8080",
@@ -47,6 +50,7 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:        "testhashkey",
 				RateLimit:      1,
 				CryptoKey:      "testcryptokey",
+				Stream:         true,
 			},
 			defaultStringValue: "default",
 			defaultIntValue:    100,
@@ -75,13 +79,61 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:        tt.conf.HashKey,
 				RateLimit:      tt.conf.RateLimit,
 				CryptoKey:      tt.conf.CryptoKey,
+				Stream:         tt.conf.Stream,
 			}
 			assert.Equalf(t, tt.wantConf.Address, cfg.GetAddress(tt.defaultStringValue), "GetAddress(%v)", tt.defaultStringValue)
 			assert.Equalf(t, tt.wantConf.CryptoKey, cfg.GetCryptoKey(tt.defaultStringValue), "GetCryptoKey(%v)", tt.defaultStringValue)
 			assert.Equalf(t, tt.wantConf.HashKey, cfg.GetHashKey(tt.defaultStringValue), "GetHashKey(%v)", tt.defaultStringValue)
 			assert.Equalf(t, tt.wantConf.PollInterval, cfg.GetPollInterval(tt.defaultIntValue), "GetPollInterval(%v)", tt.defaultIntValue)
 			assert.Equalf(t, tt.wantConf.RateLimit, cfg.GetRateLimit(tt.defaultIntValue), "GetRateLimit(%v)", tt.defaultIntValue)
+			assert.Equalf(t, tt.wantConf.Stream, cfg.GetStream(false), "GetStream(false)")
 			assert.Equalf(t, tt.wantConf.ReportInterval, cfg.GetReportInterval(tt.defaultIntValue), "GetReportInterval(%v)", tt.defaultIntValue)
 		})
 	}
 }
+
+func TestAgentConfig_GetSpool(t *testing.T) {
+	cfg := &AgentConfig{
+		SpoolDir:         "/var/spool/agent",
+		SpoolSegmentSize: "1024",
+		SpoolMaxSize:     "4096",
+		SpoolMaxAge:      "60",
+	}
+	assert.Equal(t, "/var/spool/agent", cfg.GetSpoolDir("default"))
+	assert.Equal(t, int64(1024), cfg.GetSpoolSegmentSize(1))
+	assert.Equal(t, int64(4096), cfg.GetSpoolMaxSize(1))
+	assert.Equal(t, 60, cfg.GetSpoolMaxAge(1))
+
+	empty := &AgentConfig{SpoolSegmentSize: "bad"}
+	assert.Equal(t, "default", empty.GetSpoolDir("default"))
+	assert.Equal(t, int64(1), empty.GetSpoolSegmentSize(1))
+	assert.Equal(t, int64(1), empty.GetSpoolMaxSize(1))
+	assert.Equal(t, 1, empty.GetSpoolMaxAge(1))
+}
+
+func TestAgentConfig_GetCollectors(t *testing.T) {
+	enabled := true
+	cfg := &AgentConfig{Collectors: map[string]CollectorConfig{"random": {Enabled: &enabled, Interval: "5"}}}
+	assert.Equal(t, cfg.Collectors, cfg.GetCollectors())
+	assert.Nil(t, (&AgentConfig{}).GetCollectors())
+}
+
+func TestAgentConfig_GetRelay(t *testing.T) {
+	cfg := &AgentConfig{RelayStatsdAddress: "127.0.0.1:8125"}
+	assert.Equal(t, "127.0.0.1:8125", cfg.GetRelayStatsdAddress("default"))
+	assert.Equal(t, "default", cfg.GetRelayHTTPAddress("default"))
+}
+
+func TestAgentConfig_GetTLS(t *testing.T) {
+	cfg := &AgentConfig{TLSCACert: "ca.pem", TLSCert: "agent.pem", TLSKey: "agent-key.pem"}
+	assert.Equal(t, "ca.pem", cfg.GetTLSCACert("default"))
+	assert.Equal(t, "agent.pem", cfg.GetTLSCert("default"))
+	assert.Equal(t, "agent-key.pem", cfg.GetTLSKey("default"))
+	assert.Equal(t, "default", cfg.GetTLSServerName("default"))
+}
+
+func TestAgentConfig_GetAgent(t *testing.T) {
+	cfg := &AgentConfig{AgentID: "agent-1"}
+	assert.Equal(t, "agent-1", cfg.GetAgentID("default"))
+	assert.Equal(t, "default", cfg.GetAgentToken("default"))
+}
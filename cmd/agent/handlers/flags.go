@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 // SystemConfigFlags содержит переменные флагов
@@ -15,6 +17,19 @@ import (
 // HashKey ключ для шифрования и дешифровки передаваемых данных
 // RateLimit количество одновременных запросов отправляемых на удаленный сервис
 // CryptoKey путь до публичного ключа шифрования
+// SpoolDir директория очереди неотправленных пачек, пустая строка - очередь выключена
+// SpoolSegmentSize размер сегмента очереди в байтах
+// SpoolMaxSize максимальный размер очереди в байтах, при превышении удаляются самые старые пачки
+// SpoolMaxAge время хранения пачек в очереди в секундах
+// RelayStatsdAddress адрес UDP для приема метрик приложений в формате StatsD, пустой отключает прием
+// RelayHTTPAddress адрес для приема метрик приложений запросом POST /push, пустой отключает прием
+// TLSCACert путь до CA для проверки сертификата сервера, пустой - системные корневые сертификаты
+// TLSCert путь до сертификата агента для mTLS
+// TLSKey путь до приватного ключа сертификата агента
+// TLSServerName имя сервера для проверки сертификата, пустое - берется из адреса
+// AgentID идентификатор агента в реестре сервера, пустой - сервер проверяет общий ключ
+// AgentToken API токен агента, с токеном запросы не подписываются
+// Collectors настройки сборщиков метрик из файла конфигурации
 type SystemConfigFlags struct {
 	Address        string `env:"ADDRESS"`
 	HashKey        string `env:"KEY"`
@@ -22,6 +37,24 @@ type SystemConfigFlags struct {
 	ReportInterval int    `env:"REPORT_INTERVAL"`
 	PollInterval   int    `env:"POLL_INTERVAL"`
 	RateLimit      int    `env:"RATE_LIMIT"`
+
+	SpoolDir         string `env:"SPOOL_DIR"`
+	SpoolSegmentSize int64  `env:"SPOOL_SEGMENT_SIZE"`
+	SpoolMaxSize     int64  `env:"SPOOL_MAX_SIZE"`
+	SpoolMaxAge      int    `env:"SPOOL_MAX_AGE"`
+
+	RelayStatsdAddress string `env:"RELAY_STATSD_ADDRESS"`
+	RelayHTTPAddress   string `env:"RELAY_HTTP_ADDRESS"`
+
+	TLSCACert     string `env:"TLS_CA_CERT"`
+	TLSCert       string `env:"TLS_CERT"`
+	TLSKey        string `env:"TLS_KEY"`
+	TLSServerName string `env:"TLS_SERVER_NAME"`
+
+	AgentID    string `env:"AGENT_ID"`
+	AgentToken string `env:"AGENT_TOKEN"`
+
+	Collectors map[string]config.CollectorConfig
 }
 
 // GetFlags парсит глобальные переменные системы, или парсит флаги, или подменяет их значениями по умолчанию
@@ -33,6 +66,12 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 		PollInterval:   2,
 		ReportInterval: 10,
 		RateLimit:      1,
+
+		SpoolSegmentSize: 1 << 20,
+		SpoolMaxSize:     64 << 20,
+		SpoolMaxAge:      86400,
+
+		Collectors: config.GetCollectors(),
 	}
 
 	var (
@@ -42,6 +81,22 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 		reportInterval int
 		pollInterval   int
 		rateLimit      int
+
+		spoolDir         string
+		spoolSegmentSize int64
+		spoolMaxSize     int64
+		spoolMaxAge      int
+
+		relayStatsdAddress string
+		relayHTTPAddress   string
+
+		tlsCACert     string
+		tlsCert       string
+		tlsKey        string
+		tlsServerName string
+
+		agentID    string
+		agentToken string
 	)
 
 	flag.StringVar(&address, "a", config.GetAddress(flags.Address), "address and port to run server")
@@ -50,6 +105,18 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 	flag.StringVar(&hashKey, "k", config.GetHashKey(flags.HashKey), "key for hash")
 	flag.IntVar(&rateLimit, "l", config.GetRateLimit(flags.RateLimit), "limit requests")
 	flag.StringVar(&cryptoKey, "crypto-key", config.GetCryptoKey(flags.CryptoKey), "key for encryption")
+	flag.StringVar(&spoolDir, "spool-dir", config.GetSpoolDir(flags.SpoolDir), "directory of unsent metrics queue")
+	flag.Int64Var(&spoolSegmentSize, "spool-segment-size", config.GetSpoolSegmentSize(flags.SpoolSegmentSize), "spool segment size in bytes")
+	flag.Int64Var(&spoolMaxSize, "spool-max-size", config.GetSpoolMaxSize(flags.SpoolMaxSize), "spool max size in bytes")
+	flag.IntVar(&spoolMaxAge, "spool-max-age", config.GetSpoolMaxAge(flags.SpoolMaxAge), "spool max age in seconds")
+	flag.StringVar(&relayStatsdAddress, "relay-statsd-address", config.GetRelayStatsdAddress(flags.RelayStatsdAddress), "udp address to accept statsd metrics from local apps")
+	flag.StringVar(&relayHTTPAddress, "relay-http-address", config.GetRelayHTTPAddress(flags.RelayHTTPAddress), "address to accept POST /push metrics from local apps")
+	flag.StringVar(&tlsCACert, "tls-ca-cert", config.GetTLSCACert(flags.TLSCACert), "CA to verify server certificate")
+	flag.StringVar(&tlsCert, "tls-cert", config.GetTLSCert(flags.TLSCert), "agent certificate for mutual tls")
+	flag.StringVar(&tlsKey, "tls-key", config.GetTLSKey(flags.TLSKey), "agent certificate private key")
+	flag.StringVar(&tlsServerName, "tls-server-name", config.GetTLSServerName(flags.TLSServerName), "server name to verify certificate")
+	flag.StringVar(&agentID, "agent-id", config.GetAgentID(flags.AgentID), "agent id in the server registry")
+	flag.StringVar(&agentToken, "agent-token", config.GetAgentToken(flags.AgentToken), "agent api token")
 	flag.Parse()
 
 	var envVars SystemConfigFlags
@@ -59,6 +126,10 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 	}
 
 	applyFlags(flags, address, reportInterval, pollInterval, hashKey, rateLimit, cryptoKey)
+	applySpoolFlags(flags, spoolDir, spoolSegmentSize, spoolMaxSize, spoolMaxAge)
+	applyRelayFlags(flags, relayStatsdAddress, relayHTTPAddress)
+	applyTLSFlags(flags, tlsCACert, tlsCert, tlsKey, tlsServerName)
+	applyAgentFlags(flags, agentID, agentToken)
 	applyEnvVars(flags, envVars)
 
 	return flags, nil
@@ -86,6 +157,79 @@ func applyFlags(flags *SystemConfigFlags, address string, reportInterval, pollIn
 	}
 }
 
+// applySpoolFlags присваивание флагов очереди неотправленных пачек
+func applySpoolFlags(flags *SystemConfigFlags, dir string, segmentSize, maxSize int64, maxAge int) {
+	if dir != "" {
+		flags.SpoolDir = dir
+	}
+	if segmentSize > 0 {
+		flags.SpoolSegmentSize = segmentSize
+	}
+	if maxSize > 0 {
+		flags.SpoolMaxSize = maxSize
+	}
+	if maxAge > 0 {
+		flags.SpoolMaxAge = maxAge
+	}
+}
+
+// applyRelayFlags присваивание флагов локального приема метрик приложений
+func applyRelayFlags(flags *SystemConfigFlags, statsdAddress, httpAddress string) {
+	if statsdAddress != "" {
+		flags.RelayStatsdAddress = statsdAddress
+	}
+	if httpAddress != "" {
+		flags.RelayHTTPAddress = httpAddress
+	}
+}
+
+// applyTLSFlags присваивание флагов TLS
+func applyTLSFlags(flags *SystemConfigFlags, caCert, cert, key, serverName string) {
+	if caCert != "" {
+		flags.TLSCACert = caCert
+	}
+	if cert != "" {
+		flags.TLSCert = cert
+	}
+	if key != "" {
+		flags.TLSKey = key
+	}
+	if serverName != "" {
+		flags.TLSServerName = serverName
+	}
+}
+
+// applyAgentFlags присваивание флагов учетных данных агента
+func applyAgentFlags(flags *SystemConfigFlags, agentID, agentToken string) {
+	if agentID != "" {
+		flags.AgentID = agentID
+	}
+	if agentToken != "" {
+		flags.AgentToken = agentToken
+	}
+}
+
+// TLSEnabled включено ли TLS соединение с сервером, включается заданием CA или сертификата агента
+func (flags *SystemConfigFlags) TLSEnabled() bool {
+	return flags.TLSCACert != "" || flags.TLSCert != ""
+}
+
+// URL адрес метода сервера, при включенном TLS запросы идут по https
+func (flags *SystemConfigFlags) URL(path string) string {
+	if flags.TLSEnabled() {
+		return "https://" + flags.Address + path
+	}
+	return "http://" + flags.Address + path
+}
+
+// TLSConfig настройки TLS клиента, nil если TLS выключено
+func (flags *SystemConfigFlags) TLSConfig() (*tls.Config, error) {
+	if !flags.TLSEnabled() {
+		return nil, nil
+	}
+	return mtls.NewClientConfig(flags.TLSCACert, flags.TLSCert, flags.TLSKey, flags.TLSServerName)
+}
+
 // applyEnvVars присваивание переменных окружения
 func applyEnvVars(flags *SystemConfigFlags, envVars SystemConfigFlags) {
 	if envVars.Address != "" {
@@ -106,4 +250,40 @@ func applyEnvVars(flags *SystemConfigFlags, envVars SystemConfigFlags) {
 	if envVars.CryptoKey != "" {
 		flags.CryptoKey = envVars.CryptoKey
 	}
+	if envVars.SpoolDir != "" {
+		flags.SpoolDir = envVars.SpoolDir
+	}
+	if envVars.SpoolSegmentSize != 0 {
+		flags.SpoolSegmentSize = envVars.SpoolSegmentSize
+	}
+	if envVars.SpoolMaxSize != 0 {
+		flags.SpoolMaxSize = envVars.SpoolMaxSize
+	}
+	if envVars.SpoolMaxAge != 0 {
+		flags.SpoolMaxAge = envVars.SpoolMaxAge
+	}
+	if envVars.RelayStatsdAddress != "" {
+		flags.RelayStatsdAddress = envVars.RelayStatsdAddress
+	}
+	if envVars.RelayHTTPAddress != "" {
+		flags.RelayHTTPAddress = envVars.RelayHTTPAddress
+	}
+	if envVars.TLSCACert != "" {
+		flags.TLSCACert = envVars.TLSCACert
+	}
+	if envVars.TLSCert != "" {
+		flags.TLSCert = envVars.TLSCert
+	}
+	if envVars.TLSKey != "" {
+		flags.TLSKey = envVars.TLSKey
+	}
+	if envVars.TLSServerName != "" {
+		flags.TLSServerName = envVars.TLSServerName
+	}
+	if envVars.AgentID != "" {
+		flags.AgentID = envVars.AgentID
+	}
+	if envVars.AgentToken != "" {
+		flags.AgentToken = envVars.AgentToken
+	}
 }
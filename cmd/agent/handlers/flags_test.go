@@ -215,3 +215,66 @@ func Test_applyEnvVars(t *testing.T) {
 		})
 	}
 }
+
+func Test_applySpoolFlags(t *testing.T) {
+	flags := &SystemConfigFlags{
+		SpoolSegmentSize: 1,
+		SpoolMaxSize:     2,
+		SpoolMaxAge:      3,
+	}
+
+	applySpoolFlags(flags, "", 0, 0, 0)
+	assert.Equal(t, &SystemConfigFlags{SpoolSegmentSize: 1, SpoolMaxSize: 2, SpoolMaxAge: 3}, flags)
+
+	applySpoolFlags(flags, "/tmp/spool", 10, 20, 30)
+	assert.Equal(t, &SystemConfigFlags{SpoolDir: "/tmp/spool", SpoolSegmentSize: 10, SpoolMaxSize: 20, SpoolMaxAge: 30}, flags)
+}
+
+func Test_applyRelayFlags(t *testing.T) {
+	flags := &SystemConfigFlags{RelayHTTPAddress: "localhost:8090"}
+
+	applyRelayFlags(flags, "", "")
+	assert.Equal(t, &SystemConfigFlags{RelayHTTPAddress: "localhost:8090"}, flags)
+
+	applyRelayFlags(flags, "127.0.0.1:8125", "127.0.0.1:8091")
+	assert.Equal(t, &SystemConfigFlags{RelayStatsdAddress: "127.0.0.1:8125", RelayHTTPAddress: "127.0.0.1:8091"}, flags)
+}
+
+func Test_applyTLSFlags(t *testing.T) {
+	flags := &SystemConfigFlags{TLSServerName: "metrics.local"}
+
+	applyTLSFlags(flags, "", "", "", "")
+	assert.Equal(t, &SystemConfigFlags{TLSServerName: "metrics.local"}, flags)
+	assert.False(t, flags.TLSEnabled())
+
+	applyTLSFlags(flags, "ca.pem", "agent.pem", "agent-key.pem", "")
+	assert.Equal(t, &SystemConfigFlags{TLSCACert: "ca.pem", TLSCert: "agent.pem", TLSKey: "agent-key.pem", TLSServerName: "metrics.local"}, flags)
+	assert.True(t, flags.TLSEnabled())
+}
+
+func Test_applyAgentFlags(t *testing.T) {
+	flags := &SystemConfigFlags{AgentID: "agent-1"}
+
+	applyAgentFlags(flags, "", "")
+	assert.Equal(t, &SystemConfigFlags{AgentID: "agent-1"}, flags)
+
+	applyAgentFlags(flags, "agent-2", "token")
+	assert.Equal(t, &SystemConfigFlags{AgentID: "agent-2", AgentToken: "token"}, flags)
+}
+
+func TestSystemConfigFlags_URL(t *testing.T) {
+	flags := &SystemConfigFlags{Address: "localhost:8080"}
+	assert.Equal(t, "http://localhost:8080/updates", flags.URL("/updates"))
+
+	flags.TLSCACert = "ca.pem"
+	assert.Equal(t, "https://localhost:8080/updates", flags.URL("/updates"))
+}
+
+func TestSystemConfigFlags_TLSConfig(t *testing.T) {
+	cfg, err := (&SystemConfigFlags{}).TLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = (&SystemConfigFlags{TLSCACert: "missing.pem"}).TLSConfig()
+	assert.Error(t, err)
+}
@@ -2,11 +2,17 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"strconv"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
@@ -16,20 +22,71 @@ import (
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
 )
 
+// MaxPendingBatches количество отправленных в поток пачек, после которого поток закрывается,
+// чтобы сервер подтвердил их получение
+var MaxPendingBatches = 10
+
 type Client struct {
 	conn   *grpc.ClientConn
 	client pb.MetricsClient
-	once   sync.Once
+	stream pb.Metrics_StreamUpdatesClient
+	cancel context.CancelFunc
+	// streamMD метаданные открытого потока
+	streamMD metadata.MD
+	// pending пачки, отправленные в поток, получение которых сервер еще не подтвердил
+	pending []PendingRequest
+	mu      sync.Mutex
+	once    sync.Once
+}
+
+// PendingRequest пачка, отправленная в поток
+type PendingRequest struct {
+	*pb.ListMetricsRequest
+	// Lost возвращает в реестр агента приращения пачки, если сервер ее так и не получил
+	Lost func()
+}
+
+// lose возвращает приращения недоставленной пачки
+func (r PendingRequest) lose() {
+	lose(r.Lost)
+}
+
+// UnconfirmedError ошибка потока с пачками, получение которых сервер не подтвердил
+type UnconfirmedError struct {
+	Err error
+	// MD метаданные потока, в котором отправлялись пачки
+	MD       metadata.MD
+	Requests []PendingRequest
+}
+
+func (e *UnconfirmedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnconfirmedError) Unwrap() error {
+	return e.Err
+}
+
+// unconfirmedFromError пачки потока, которые нужно отправить повторно
+func unconfirmedFromError(err error) (*UnconfirmedError, bool) {
+	var unconfirmed *UnconfirmedError
+	ok := errors.As(err, &unconfirmed)
+	return unconfirmed, ok
 }
 
-func NewGRPCClient(serverAddr string) (*Client, error) {
-	credentials := insecure.NewCredentials()
+// NewGRPCClient создает клиента, без настроек TLS соединение не шифруется
+func NewGRPCClient(serverAddr string, tlsConfig *tls.Config) (*Client, error) {
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
 	conn, err := grpc.NewClient(
 		serverAddr,
-		grpc.WithTransportCredentials(credentials),
+		grpc.WithTransportCredentials(transportCredentials),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("NewGRPCClient error: %w", err)
@@ -43,27 +100,55 @@ func NewGRPCClient(serverAddr string) (*Client, error) {
 
 func (c *Client) Close() error {
 	c.once.Do(func() {
+		c.mu.Lock()
+		if c.stream != nil {
+			if err := c.closeStream(nil); err != nil {
+				logger.WriteErrorLog(err.Error(), "CloseAndRecv")
+				if unconfirmed, ok := unconfirmedFromError(err); ok {
+					// при завершении работы повторяем отправку один раз
+					for _, req := range unconfirmed.Requests {
+						ctx := requestContext(unconfirmed.MD, req.ListMetricsRequest)
+						if sendErr := c.SendMetrics(ctx, req.GetMetrics(), req.GetCryptoMetrics()); sendErr != nil {
+							logger.WriteErrorLog(sendErr.Error(), "Error in sending unconfirmed metrics")
+							req.lose()
+						}
+					}
+				}
+			}
+		}
+		c.mu.Unlock()
 		c.conn.Close()
 	})
 	return nil
 }
 
+// setHashByMetrics создает контекст с метаданными пачки и учетными данными агента,
+// при указанном ключе добавляет подпись, время подписи и одноразовое значение
 func setHashByMetrics(r request, metrics []*pb.Metric, flags *SystemConfigFlags) (context.Context, error) {
 	// Создаем метаданные gRPC
 	md := metadata.New(map[string]string{
 		"x-real-ip": r.IP,
 	})
+	if flags.AgentID != "" {
+		md.Set(agents.AgentIDMetadataKey, flags.AgentID)
+	}
+	if flags.AgentToken != "" {
+		md.Set(agents.AuthorizationMetadataKey, "Bearer "+flags.AgentToken)
+	}
 
-	// Добавляем хеш, если указан ключ
-	if flags.HashKey != "" {
-		// Сериализуем метрики в байты для хеширования
-		body, err := proto.Marshal(&pb.ListMetricsRequest{Metrics: metrics})
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal metrics: %w", err)
+	// Добавляем хеш, если указан ключ, с токеном время и одноразовое значение передаются без подписи
+	if flags.HashKey != "" || flags.AgentToken != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := hash.NewNonce()
+		if flags.HashKey != "" {
+			hashSha256, err := hash.CreateSignedMetricsSha256(metrics, flags.HashKey, timestamp, nonce)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal metrics: %w", err)
+			}
+			md.Set("hashsha256", hashSha256) // Добавляем хеш в метаданные
 		}
-
-		hashSha256 := hash.CreateSha256(body, flags.HashKey)
-		md.Set("hashsha256", hashSha256) // Добавляем хеш в метаданные
+		md.Set(hash.TimestampMetadataKey, timestamp)
+		md.Set(hash.NonceMetadataKey, nonce)
 	}
 
 	// Создаем контекст с метаданными
@@ -74,23 +159,61 @@ func setHashByMetrics(r request, metrics []*pb.Metric, flags *SystemConfigFlags)
 	return ctx, nil
 }
 
-func encryptMetrics(metrics []*pb.Metric, manager *crypto.Manager) ([]*pb.Metric, []byte, error) {
+// encryptMetrics шифрует пачку метрик, возвращает идентификатор ключа, если шифровальщик его сообщает
+func encryptMetrics(metrics []*pb.Metric, manager *crypto.Manager) ([]*pb.Metric, []byte, string, error) {
 	var encryptedData []byte
+	keyID := ""
 	encryptor := manager.GetGRPCEncryptor()
 	if encryptor != nil {
 		// Сериализуем метрики в байты для хеширования
 		body, err := proto.Marshal(&pb.ListMetricsRequest{Metrics: metrics})
 		if err != nil {
-			return metrics, []byte{}, fmt.Errorf("failed to marshal metrics: %w", err)
+			return metrics, []byte{}, "", fmt.Errorf("failed to marshal metrics: %w", err)
 		}
 
-		encryptedData, err = encryptor.Encrypt(body)
+		encryptedData, keyID, err = crypto.EncryptWithKeyID(encryptor, body)
 		if err != nil {
-			return metrics, []byte{}, fmt.Errorf("failed to encrypt metrics: %w", err)
+			return metrics, []byte{}, "", fmt.Errorf("failed to encrypt metrics: %w", err)
 		}
 		metrics = []*pb.Metric{}
 	}
-	return metrics, encryptedData, nil
+	return metrics, encryptedData, keyID, nil
+}
+
+// keyIDFromContext идентификатор ключа шифрования из исходящих метаданных
+func keyIDFromContext(ctx context.Context) string {
+	return outgoingValue(ctx, crypto.KeyIDMetadataKey)
+}
+
+// outgoingValue первое значение исходящих метаданных по ключу
+func outgoingValue(ctx context.Context, key string) string {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(key)) > 0 {
+		return md.Get(key)[0]
+	}
+	return ""
+}
+
+// signatureFromContext время подписи и одноразовое значение пачки из исходящих метаданных
+func signatureFromContext(ctx context.Context) (int64, string) {
+	timestamp, _ := strconv.ParseInt(outgoingValue(ctx, hash.TimestampMetadataKey), 10, 64)
+	return timestamp, outgoingValue(ctx, hash.NonceMetadataKey)
+}
+
+// requestContext контекст для отправки пачки потока обычным запросом:
+// метаданные потока и подпись, время, одноразовое значение и ключ шифрования из самой пачки
+func requestContext(md metadata.MD, req *pb.ListMetricsRequest) context.Context {
+	md = md.Copy()
+	if req.GetHashsha256() != "" {
+		md.Set("hashsha256", req.GetHashsha256())
+	}
+	if req.GetNonce() != "" {
+		md.Set(hash.TimestampMetadataKey, strconv.FormatInt(req.GetTimestamp(), 10))
+		md.Set(hash.NonceMetadataKey, req.GetNonce())
+	}
+	if req.GetKeyId() != "" {
+		md.Set(crypto.KeyIDMetadataKey, req.GetKeyId())
+	}
+	return metadata.NewOutgoingContext(context.Background(), md)
 }
 
 // SendMetrics отправляет массив метрик на сервер
@@ -98,6 +221,7 @@ func (c *Client) SendMetrics(ctx context.Context, metrics []*pb.Metric, encrypte
 	resp, err := c.client.UpdateMetrics(ctx, &pb.ListMetricsRequest{
 		Metrics:       metrics,
 		CryptoMetrics: encryptedMetrics,
+		KeyId:         keyIDFromContext(ctx),
 	})
 
 	if err != nil {
@@ -109,6 +233,108 @@ func (c *Client) SendMetrics(ctx context.Context, metrics []*pb.Metric, encrypte
 	return err
 }
 
+// StreamMetrics отправляет массив метрик в открытый поток, поток открывается при первой отправке
+// и переоткрывается после ошибки. Пачка считается доставленной только после подтверждения сервером
+// при закрытии потока, поэтому каждые MaxPendingBatches пачек поток закрывается. При ошибке
+// возвращается UnconfirmedError с пачками, которые сервер не сохранил, включая текущую.
+// lost хранится вместе с пачкой до подтверждения и вызывается, если пачку так и не удалось доставить
+func (c *Client) StreamMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte, hashSHA256 string, lost func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timestamp, nonce := signatureFromContext(ctx)
+	req := PendingRequest{
+		ListMetricsRequest: &pb.ListMetricsRequest{
+			Metrics:       metrics,
+			CryptoMetrics: encryptedMetrics,
+			Hashsha256:    hashSHA256,
+			KeyId:         keyIDFromContext(ctx),
+			Timestamp:     timestamp,
+			Nonce:         nonce,
+		},
+		Lost: lost,
+	}
+
+	if c.stream == nil {
+		// поток живет дольше одной отправки, поэтому берем из контекста только метаданные
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		md.Delete("hashsha256")
+		md.Delete(crypto.KeyIDMetadataKey)
+		md.Delete(hash.TimestampMetadataKey)
+		md.Delete(hash.NonceMetadataKey)
+		streamCtx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), md))
+		stream, err := c.client.StreamUpdates(streamCtx)
+		if err != nil {
+			cancel()
+			return &UnconfirmedError{
+				Err:      fmt.Errorf("StreamMetrics open error: %w", err),
+				MD:       md,
+				Requests: []PendingRequest{req},
+			}
+		}
+		c.stream = stream
+		c.cancel = cancel
+		c.streamMD = md
+	}
+
+	c.pending = append(c.pending, req)
+	if err := c.stream.Send(req.ListMetricsRequest); err != nil {
+		return c.closeStream(err)
+	}
+	if len(c.pending) >= MaxPendingBatches {
+		return c.closeStream(nil)
+	}
+	return nil
+}
+
+// closeStream закрывает поток и ждет подтверждения сервера, вызывается под мьютексом.
+// Сервер сообщает в трейлере, сколько пачек успел сохранить, остальные возвращаются в UnconfirmedError.
+// Если трейлера нет (поток оборван), неподтвержденными считаются все пачки потока
+func (c *Client) closeStream(sendErr error) error {
+	_, err := c.stream.CloseAndRecv()
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err == nil {
+		err = sendErr
+	}
+
+	applied := 0
+	if values := c.stream.Trailer().Get(pb.AppliedBatchesMetadataKey); len(values) > 0 {
+		applied, _ = strconv.Atoi(values[0])
+	} else if err == nil {
+		applied = len(c.pending)
+	}
+	applied = min(max(applied, 0), len(c.pending))
+	unconfirmed := c.pending[applied:]
+	md := c.streamMD
+	c.resetStream()
+
+	if len(unconfirmed) == 0 {
+		return nil
+	}
+	if err == nil {
+		err = errors.New("server did not confirm batches")
+	}
+	return &UnconfirmedError{
+		Err:      fmt.Errorf("StreamMetrics error: %w", err),
+		MD:       md,
+		Requests: unconfirmed,
+	}
+}
+
+// resetStream закрывает текущий поток, вызывается под мьютексом
+func (c *Client) resetStream() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stream = nil
+	c.cancel = nil
+	c.streamMD = nil
+	c.pending = nil
+}
+
 // StartClient запуск gRPC клиента
 func StartClient(ctxGrSh context.Context, serversWg *sync.WaitGroup) {
 	defer serversWg.Done()
@@ -136,15 +362,26 @@ func StartClient(ctxGrSh context.Context, serversWg *sync.WaitGroup) {
 
 	manager := crypto.NewCryptoManager()
 	if flagsGRPC != nil && flagsGRPC.CryptoKey != "" {
-		grpcEncryptor, grpcEncryptorErr := crypto.NewRSAEncryptor(flagsGRPC.CryptoKey)
+		grpcEncryptor, grpcEncryptorErr := crypto.NewReloadingEncryptor(flagsGRPC.CryptoKey)
 
 		if grpcEncryptorErr != nil {
 			logger.WriteErrorLog(grpcEncryptorErr.Error(), "Failed to create encryptor")
+		} else {
+			manager.SetGRPCEncryptor(grpcEncryptor)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if flagsGRPC != nil {
+		tlsConfig, err = flagsGRPC.TLSConfig()
+		if err != nil {
+			// без шифрования метрики не отправляем
+			logger.WriteErrorLog(err.Error(), "Failed to create tls config")
+			return
 		}
-		manager.SetGRPCEncryptor(grpcEncryptor)
 	}
 
-	grpcClient, err := NewGRPCClient(address)
+	grpcClient, err := NewGRPCClient(address, tlsConfig)
 	if err != nil {
 		log.Println("NewGRPCClient error:", err)
 	}
@@ -10,13 +10,18 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/protobuf/proto"
 
+	serverHandlers "github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/handlers/grpc/interceptors"
 	"github.com/ramil063/gometrics/cmd/server/handlers/grpc/server"
+	serverStorage "github.com/ramil063/gometrics/cmd/server/handlers/server"
 	metrics "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/hash"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
 )
 
 func TestClient_Close(t *testing.T) {
@@ -28,7 +33,7 @@ func TestClient_Close(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c, err := NewGRPCClient(":3202")
+			c, err := NewGRPCClient(":3202", nil)
 			assert.NoError(t, err)
 			err = c.Close()
 			assert.NoError(t, err)
@@ -38,7 +43,7 @@ func TestClient_Close(t *testing.T) {
 
 // Mock для gRPC клиента
 type mockMetricsServiceClient struct {
-	metrics.UnimplementedMetricsServer
+	metrics.MetricsClient
 	updateMetricsFunc func(context.Context, *metrics.ListMetricsRequest) (*metrics.ListMetricsResponse, error)
 }
 
@@ -67,8 +72,10 @@ func TestClient_SendMetrics(t *testing.T) {
 
 			// Проверяем хеш, если нужно
 			if testHashKey != "" {
-				body, _ := proto.Marshal(&metrics.ListMetricsRequest{Metrics: testMetrics})
-				expectedHash := hash.CreateSha256(body, testHashKey)
+				require.Len(t, md.Get(hash.TimestampMetadataKey), 1)
+				require.Len(t, md.Get(hash.NonceMetadataKey), 1)
+				expectedHash, err := hash.CreateSignedMetricsSha256(testMetrics, testHashKey, md.Get(hash.TimestampMetadataKey)[0], md.Get(hash.NonceMetadataKey)[0])
+				require.NoError(t, err)
 				assert.Equal(t, []string{expectedHash}, md.Get("hashsha256"))
 			}
 
@@ -112,7 +119,7 @@ func TestNewGRPCClient(t *testing.T) {
 	defer s.Stop()
 
 	// Вызываем тестируемую функцию с адресом тестового сервера
-	client, err := NewGRPCClient(lis.Addr().String())
+	client, err := NewGRPCClient(lis.Addr().String(), nil)
 
 	// Проверяем результаты
 	assert.NoError(t, err)
@@ -179,3 +186,200 @@ func Test_setHashByMetrics(t *testing.T) {
 		})
 	}
 }
+
+func Test_setHashByMetrics_Agent(t *testing.T) {
+	ctx, err := setHashByMetrics(request{IP: "127.0.0.1"}, nil, &SystemConfigFlags{AgentID: "agent-1", AgentToken: "token"})
+	require.NoError(t, err)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, []string{"agent-1"}, md.Get(agents.AgentIDMetadataKey))
+	assert.Equal(t, []string{"Bearer token"}, md.Get(agents.AuthorizationMetadataKey))
+	assert.Empty(t, md.Get("hashsha256"))
+}
+
+func TestClient_StreamMetrics(t *testing.T) {
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	metrics.RegisterMetricsServer(s, server.NewMetricsServer(serverStorage.NewMemStorage()))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	client, err := NewGRPCClient(lis.Addr().String(), nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.client.WatchMetrics(watchCtx, &metrics.MetricsFilter{Ids: []string{"PollCount"}})
+	require.NoError(t, err)
+	// даем серверу зарегистрировать подписчика
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, err := setHashByMetrics(request{IP: "127.0.0.1"}, nil, &SystemConfigFlags{})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		err = client.StreamMetrics(ctx, []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 5}}, nil, "", nil)
+		require.NoError(t, err)
+	}
+	firstStream := client.stream
+
+	for _, want := range []int64{5, 10} {
+		got, recvErr := watch.Recv()
+		require.NoError(t, recvErr)
+		assert.Equal(t, want, got.GetDelta())
+	}
+
+	// после ошибки на сервере поток переоткрывается при следующей отправке
+	_ = client.StreamMetrics(ctx, []*metrics.Metric{{Id: "bad", Type: metrics.Metric_MetricType(5)}}, nil, "", nil)
+	assert.Eventually(t, func() bool {
+		return client.StreamMetrics(ctx, []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 1}}, nil, "", nil) == nil &&
+			client.stream != firstStream
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClient_StreamMetrics_Unconfirmed(t *testing.T) {
+	originalPending := MaxPendingBatches
+	MaxPendingBatches = 3
+	defer func() {
+		MaxPendingBatches = originalPending
+	}()
+
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	storage := serverStorage.NewMemStorage()
+	metrics.RegisterMetricsServer(s, server.NewMetricsServer(storage))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	client, err := NewGRPCClient(lis.Addr().String(), nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, err := setHashByMetrics(request{IP: "127.0.0.1"}, nil, &SystemConfigFlags{})
+	require.NoError(t, err)
+	require.NoError(t, client.StreamMetrics(ctx, []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 5}}, nil, "", nil))
+	// сервер закрывает поток на второй пачке, ошибка приходит только при подтверждении
+	lost := false
+	require.NoError(t, client.StreamMetrics(ctx, []*metrics.Metric{{Id: "bad", Type: metrics.Metric_MetricType(5)}}, nil, "", func() { lost = true }))
+	err = client.StreamMetrics(ctx, []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 1}}, nil, "", nil)
+
+	unconfirmed, ok := unconfirmedFromError(err)
+	require.True(t, ok, "error must carry unconfirmed batches: %v", err)
+	require.Len(t, unconfirmed.Requests, 2, "first batch is confirmed by server")
+	assert.Equal(t, "bad", unconfirmed.Requests[0].GetMetrics()[0].GetId())
+	assert.Equal(t, int64(1), unconfirmed.Requests[1].GetMetrics()[0].GetDelta())
+	// возврат приращений хранится вместе с неподтвержденной пачкой
+	unconfirmed.Requests[0].lose()
+	assert.True(t, lost)
+	assert.Equal(t, []string{"127.0.0.1"}, unconfirmed.MD.Get("x-real-ip"))
+	assert.Nil(t, client.stream)
+
+	counter, err := storage.GetCounter("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), int64(counter))
+
+	// после подтверждения неподтвержденных пачек не остается
+	for i := 0; i < MaxPendingBatches; i++ {
+		require.NoError(t, client.StreamMetrics(ctx, []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 1}}, nil, "", nil))
+	}
+	assert.Empty(t, client.pending)
+	counter, err = storage.GetCounter("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), int64(counter))
+}
+
+func TestClient_StreamMetrics_Signed(t *testing.T) {
+	originalHashKey := serverHandlers.HashKey
+	originalGuard := hash.DefaultReplayGuard
+	serverHandlers.HashKey = "secret"
+	hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 100)
+	defer func() {
+		serverHandlers.HashKey = originalHashKey
+		hash.DefaultReplayGuard = originalGuard
+	}()
+
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.HashCheckUnaryInterceptor),
+		grpc.ChainStreamInterceptor(interceptors.HashCheckStreamInterceptor),
+	)
+	metrics.RegisterMetricsServer(s, server.NewMetricsServer(serverStorage.NewMemStorage()))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	client, err := NewGRPCClient(lis.Addr().String(), nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.client.WatchMetrics(watchCtx, &metrics.MetricsFilter{Ids: []string{"PollCount"}})
+	require.NoError(t, err)
+	// даем серверу зарегистрировать подписчика
+	time.Sleep(100 * time.Millisecond)
+
+	flags := &SystemConfigFlags{HashKey: "secret"}
+	batch := []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 5}}
+	firstCtx, err := setHashByMetrics(request{IP: "127.0.0.1"}, batch, flags)
+	require.NoError(t, err)
+	secondCtx, err := setHashByMetrics(request{IP: "127.0.0.1"}, batch, flags)
+	require.NoError(t, err)
+	require.NoError(t, client.StreamMetrics(firstCtx, batch, nil, outgoingValue(firstCtx, "hashsha256"), nil))
+	require.NoError(t, client.StreamMetrics(secondCtx, batch, nil, outgoingValue(secondCtx, "hashsha256"), nil))
+
+	for _, want := range []int64{5, 10} {
+		got, recvErr := watch.Recv()
+		require.NoError(t, recvErr)
+		assert.Equal(t, want, got.GetDelta())
+	}
+
+	// повтор пачки отклоняется и поток закрывается, следующая пачка с новой подписью учитывается один раз
+	_ = client.StreamMetrics(firstCtx, batch, nil, outgoingValue(firstCtx, "hashsha256"), nil)
+	next := []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 1}}
+	nextCtx, err := setHashByMetrics(request{IP: "127.0.0.1"}, next, flags)
+	require.NoError(t, err)
+	require.NoError(t, client.SendMetrics(nextCtx, next, nil))
+	assert.Error(t, client.SendMetrics(nextCtx, next, nil))
+
+	got, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), got.GetDelta())
+}
+
+func TestClient_SendMetrics_Throttled(t *testing.T) {
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	limiter := ratelimit.NewLimiter(1, 1)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.NewRateLimitInterceptor(limiter, nil)),
+		grpc.ChainStreamInterceptor(interceptors.NewRateLimitStreamInterceptor(limiter, nil)),
+	)
+	metrics.RegisterMetricsServer(s, server.NewMetricsServer(serverStorage.NewMemStorage()))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	client, err := NewGRPCClient(lis.Addr().String(), nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	batch := []*metrics.Metric{{Id: "PollCount", Type: metrics.Metric_counter, Delta: 5}}
+	require.NoError(t, client.SendMetrics(context.Background(), batch, nil))
+
+	// подсказка сервера о паузе доходит до агента
+	err = client.SendMetrics(context.Background(), batch, nil)
+	retryAfter, ok := ratelimit.RetryAfterFromError(err)
+	assert.True(t, ok)
+	assert.Greater(t, retryAfter, time.Duration(0))
+	assert.LessOrEqual(t, retryAfter, time.Second)
+}
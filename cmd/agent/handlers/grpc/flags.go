@@ -1,11 +1,13 @@
 package grpc
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 // SystemConfigFlags содержит переменные флагов
@@ -15,6 +17,14 @@ import (
 // HashKey ключ для шифрования и дешифровки передаваемых данных
 // RateLimit количество одновременных запросов отправляемых на удаленный сервис
 // CryptoKey путь до публичного ключа шифрования
+// Stream отправлять метрики через один открытый поток вместо запроса на каждую пачку
+// TLSCACert путь до CA для проверки сертификата сервера, пустой - системные корневые сертификаты
+// TLSCert путь до сертификата агента для mTLS
+// TLSKey путь до приватного ключа сертификата агента
+// TLSServerName имя сервера для проверки сертификата, пустое - берется из адреса
+// AgentID идентификатор агента в реестре сервера, пустой - сервер проверяет общий ключ
+// AgentToken API токен агента, с токеном запросы не подписываются
+// Collectors настройки сборщиков метрик из файла конфигурации
 type SystemConfigFlags struct {
 	Address        string `env:"GRPC_ADDRESS"`
 	HashKey        string `env:"GRPC_KEY"`
@@ -22,6 +32,17 @@ type SystemConfigFlags struct {
 	ReportInterval int    `env:"GRPC_REPORT_INTERVAL"`
 	PollInterval   int    `env:"GRPC_POLL_INTERVAL"`
 	RateLimit      int    `env:"GRPC_RATE_LIMIT"`
+	Stream         bool   `env:"GRPC_STREAM"`
+
+	TLSCACert     string `env:"GRPC_TLS_CA_CERT"`
+	TLSCert       string `env:"GRPC_TLS_CERT"`
+	TLSKey        string `env:"GRPC_TLS_KEY"`
+	TLSServerName string `env:"GRPC_TLS_SERVER_NAME"`
+
+	AgentID    string `env:"GRPC_AGENT_ID"`
+	AgentToken string `env:"GRPC_AGENT_TOKEN"`
+
+	Collectors map[string]config.CollectorConfig
 }
 
 // GetFlags парсит глобальные переменные системы, или парсит флаги, или подменяет их значениями по умолчанию
@@ -33,6 +54,8 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 		PollInterval:   2,
 		ReportInterval: 10,
 		RateLimit:      1,
+
+		Collectors: config.GetCollectors(),
 	}
 
 	var (
@@ -42,6 +65,15 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 		reportInterval int
 		pollInterval   int
 		rateLimit      int
+		stream         bool
+
+		tlsCACert     string
+		tlsCert       string
+		tlsKey        string
+		tlsServerName string
+
+		agentID    string
+		agentToken string
 	)
 
 	flag.StringVar(&address, "grpc-a", config.GetAddress(flags.Address), "address and port to run server")
@@ -50,6 +82,13 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 	flag.StringVar(&hashKey, "grpc-k", config.GetHashKey(flags.HashKey), "key for hash")
 	flag.IntVar(&rateLimit, "grpc-l", config.GetRateLimit(flags.RateLimit), "limit requests")
 	flag.StringVar(&cryptoKey, "grpc-crypto-key", config.GetCryptoKey(flags.CryptoKey), "key for encryption")
+	flag.BoolVar(&stream, "grpc-stream", config.GetStream(flags.Stream), "send metrics through one open stream")
+	flag.StringVar(&tlsCACert, "grpc-tls-ca-cert", config.GetTLSCACert(flags.TLSCACert), "CA to verify server certificate")
+	flag.StringVar(&tlsCert, "grpc-tls-cert", config.GetTLSCert(flags.TLSCert), "agent certificate for mutual tls")
+	flag.StringVar(&tlsKey, "grpc-tls-key", config.GetTLSKey(flags.TLSKey), "agent certificate private key")
+	flag.StringVar(&tlsServerName, "grpc-tls-server-name", config.GetTLSServerName(flags.TLSServerName), "server name to verify certificate")
+	flag.StringVar(&agentID, "grpc-agent-id", config.GetAgentID(flags.AgentID), "agent id in the server registry")
+	flag.StringVar(&agentToken, "grpc-agent-token", config.GetAgentToken(flags.AgentToken), "agent api token")
 	flag.Parse()
 
 	var envVars SystemConfigFlags
@@ -58,14 +97,16 @@ func GetFlags(config *config.AgentConfig) (*SystemConfigFlags, error) {
 		return flags, fmt.Errorf("error parsing environment variables: %w", err)
 	}
 
-	applyFlags(flags, address, reportInterval, pollInterval, hashKey, rateLimit, cryptoKey)
+	applyFlags(flags, address, reportInterval, pollInterval, hashKey, rateLimit, cryptoKey, stream)
+	applyTLSFlags(flags, tlsCACert, tlsCert, tlsKey, tlsServerName)
+	applyAgentFlags(flags, agentID, agentToken)
 	applyEnvVars(flags, envVars)
 
 	return flags, nil
 }
 
 // applyFlags присваивание флагов переданных в командной строке
-func applyFlags(flags *SystemConfigFlags, address string, reportInterval, pollInterval int, hashKey string, rateLimit int, cryptoKey string) {
+func applyFlags(flags *SystemConfigFlags, address string, reportInterval, pollInterval int, hashKey string, rateLimit int, cryptoKey string, stream bool) {
 	if address != "" && address != flags.Address {
 		flags.Address = address
 	}
@@ -84,6 +125,48 @@ func applyFlags(flags *SystemConfigFlags, address string, reportInterval, pollIn
 	if cryptoKey != "" && cryptoKey != flags.CryptoKey {
 		flags.CryptoKey = cryptoKey
 	}
+	if stream {
+		flags.Stream = stream
+	}
+}
+
+// applyTLSFlags присваивание флагов TLS
+func applyTLSFlags(flags *SystemConfigFlags, caCert, cert, key, serverName string) {
+	if caCert != "" {
+		flags.TLSCACert = caCert
+	}
+	if cert != "" {
+		flags.TLSCert = cert
+	}
+	if key != "" {
+		flags.TLSKey = key
+	}
+	if serverName != "" {
+		flags.TLSServerName = serverName
+	}
+}
+
+// applyAgentFlags присваивание флагов учетных данных агента
+func applyAgentFlags(flags *SystemConfigFlags, agentID, agentToken string) {
+	if agentID != "" {
+		flags.AgentID = agentID
+	}
+	if agentToken != "" {
+		flags.AgentToken = agentToken
+	}
+}
+
+// TLSEnabled включено ли TLS соединение с сервером, включается заданием CA или сертификата агента
+func (flags *SystemConfigFlags) TLSEnabled() bool {
+	return flags.TLSCACert != "" || flags.TLSCert != ""
+}
+
+// TLSConfig настройки TLS клиента, nil если TLS выключено
+func (flags *SystemConfigFlags) TLSConfig() (*tls.Config, error) {
+	if !flags.TLSEnabled() {
+		return nil, nil
+	}
+	return mtls.NewClientConfig(flags.TLSCACert, flags.TLSCert, flags.TLSKey, flags.TLSServerName)
 }
 
 // applyEnvVars присваивание переменных окружения
@@ -106,4 +189,25 @@ func applyEnvVars(flags *SystemConfigFlags, envVars SystemConfigFlags) {
 	if envVars.CryptoKey != "" {
 		flags.CryptoKey = envVars.CryptoKey
 	}
+	if envVars.Stream {
+		flags.Stream = envVars.Stream
+	}
+	if envVars.TLSCACert != "" {
+		flags.TLSCACert = envVars.TLSCACert
+	}
+	if envVars.TLSCert != "" {
+		flags.TLSCert = envVars.TLSCert
+	}
+	if envVars.TLSKey != "" {
+		flags.TLSKey = envVars.TLSKey
+	}
+	if envVars.TLSServerName != "" {
+		flags.TLSServerName = envVars.TLSServerName
+	}
+	if envVars.AgentID != "" {
+		flags.AgentID = envVars.AgentID
+	}
+	if envVars.AgentToken != "" {
+		flags.AgentToken = envVars.AgentToken
+	}
 }
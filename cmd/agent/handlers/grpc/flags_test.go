@@ -135,6 +135,7 @@ func Test_applyFlags(t *testing.T) {
 		reportInterval int
 		pollInterval   int
 		rateLimit      int
+		stream         bool
 	}
 	tests := []struct {
 		name string
@@ -157,12 +158,14 @@ func Test_applyFlags(t *testing.T) {
 				reportInterval: 10,
 				pollInterval:   20,
 				rateLimit:      30,
+				stream:         true,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			applyFlags(tt.args.flags, tt.args.address, tt.args.reportInterval, tt.args.pollInterval, tt.args.hashKey, tt.args.rateLimit, tt.args.cryptoKey)
+			applyFlags(tt.args.flags, tt.args.address, tt.args.reportInterval, tt.args.pollInterval, tt.args.hashKey, tt.args.rateLimit, tt.args.cryptoKey, tt.args.stream)
+			assert.Equal(t, tt.args.stream, tt.args.flags.Stream)
 			assert.Equal(t, tt.args.flags.Address, tt.args.address)
 			assert.Equal(t, tt.args.hashKey, tt.args.hashKey)
 			assert.Equal(t, tt.args.reportInterval, tt.args.reportInterval)
@@ -215,3 +218,25 @@ func Test_applyEnvVars(t *testing.T) {
 		})
 	}
 }
+
+func Test_applyTLSFlags(t *testing.T) {
+	flags := &SystemConfigFlags{}
+
+	applyTLSFlags(flags, "", "", "", "")
+	assert.Equal(t, &SystemConfigFlags{}, flags)
+	assert.False(t, flags.TLSEnabled())
+
+	applyTLSFlags(flags, "ca.pem", "agent.pem", "agent-key.pem", "metrics.local")
+	assert.Equal(t, &SystemConfigFlags{TLSCACert: "ca.pem", TLSCert: "agent.pem", TLSKey: "agent-key.pem", TLSServerName: "metrics.local"}, flags)
+	assert.True(t, flags.TLSEnabled())
+}
+
+func Test_applyAgentFlags(t *testing.T) {
+	flags := &SystemConfigFlags{AgentID: "agent-1"}
+
+	applyAgentFlags(flags, "", "")
+	assert.Equal(t, &SystemConfigFlags{AgentID: "agent-1"}, flags)
+
+	applyAgentFlags(flags, "agent-2", "token")
+	assert.Equal(t, &SystemConfigFlags{AgentID: "agent-2", AgentToken: "token"}, flags)
+}
@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,12 +11,14 @@ import (
 	"sync"
 	"time"
 
+	"google.golang.org/grpc/metadata"
+
 	metricsHandler "github.com/ramil063/gometrics/cmd/agent/handlers/metrics"
-	"github.com/ramil063/gometrics/cmd/agent/storage"
-	"github.com/ramil063/gometrics/internal/errors"
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
 	"github.com/ramil063/gometrics/internal/security/crypto"
 )
 
@@ -23,6 +26,7 @@ import (
 type Clienter interface {
 	Close() error
 	SendMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte) error
+	StreamMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte, hashSHA256 string, lost func()) error
 }
 
 // Requester отправляет данные
@@ -62,12 +66,12 @@ func (r request) SendMetricsProcess(c Clienter, maxCount int, ctxGrSh context.Co
 	var reportInterval = time.Duration(flags.ReportInterval) * time.Second
 	count := 0
 
-	var monitor storage.Monitor
+	registry := metricsHandler.NewRegistry(flags.Collectors)
 	tickerPool := time.NewTicker(pollInterval)
 	tickerReport := time.NewTicker(reportInterval)
 
-	var sendMonitor = make(chan *storage.Monitor, 1)
-	defer close(sendMonitor)
+	var sendMetrics = make(chan []models.Metrics, 1)
+	defer close(sendMetrics)
 
 	var mu sync.Mutex
 	var shutdown = false
@@ -84,15 +88,15 @@ func (r request) SendMetricsProcess(c Clienter, maxCount int, ctxGrSh context.Co
 			mu.Unlock()
 
 			log.Println("get metrics grpc start")
-			var collectWg sync.WaitGroup
-			metricsHandler.CollectMonitorMetrics(count, &monitor, &collectWg)
-			metricsHandler.CollectGopsutilMetrics(&monitor, &collectWg)
-			collectWg.Wait()
+			registry.Poll(ctxGrSh, time.Now())
+			mu.Lock()
+			metrics := metricsHandler.GetMetricsCollection(registry, int64(count))
+			mu.Unlock()
 
-			sendMonitor <- &monitor
+			sendMetrics <- metrics
 			log.Println("get metrics grpc end")
-			if len(sendMonitor) == 1 {
-				<-sendMonitor
+			if len(sendMetrics) == 1 {
+				<-sendMetrics
 			}
 		}
 	}()
@@ -103,17 +107,35 @@ func (r request) SendMetricsProcess(c Clienter, maxCount int, ctxGrSh context.Co
 			<-tickerReport.C
 
 			log.Println("send metrics grpc start")
-			mon := <-sendMonitor
-			log.Println("send metrics grpc count value=", mon.GetCountValue())
+			metrics := metricsHandler.AppendRelayed(<-sendMetrics)
+			log.Println("send metrics grpc count=", len(metrics))
 
-			for worker := 0; worker < flags.RateLimit; worker++ {
+			// каждый воркер отправляет свою часть пачки, приращения счетчиков вычитаются
+			// из реестра до отправки и возвращаются, если часть так и не удалось доставить,
+			// пачка потока может оказаться недоставленной и после следующих отправок
+			batches := metricsHandler.SplitBatch(metrics, flags.RateLimit)
+			var wg sync.WaitGroup
+			for worker, batch := range batches {
 				log.Println("send metrics grpc worker=", worker)
-				go SendMetricsByGRPC(r, c, mon, flags, manager)
+				sent := metricsHandler.CommitSent(registry, batch)
+				mu.Lock()
+				count -= int(sent)
+				mu.Unlock()
+				lost := func() {
+					restored := metricsHandler.RestoreSent(registry, batch)
+					mu.Lock()
+					count += int(restored)
+					mu.Unlock()
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := SendMetricsByGRPC(r, c, batch, flags, manager, lost); err != nil {
+						logger.WriteErrorLog(err.Error(), "SendMetricsByGRPC")
+					}
+				}()
 			}
-
-			mu.Lock()
-			count = 0
-			mu.Unlock()
+			wg.Wait()
 			log.Println("send metrics grpc end")
 
 			select {
@@ -135,6 +157,9 @@ func (r request) SendMetricsProcess(c Clienter, maxCount int, ctxGrSh context.Co
 	}
 }
 
+// serverBackoff пауза, которую сервер попросил выдержать перед следующей отправкой
+var serverBackoff ratelimit.Backoff
+
 func retryToSendMetrics(c Clienter, ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte, tries []int) error {
 	var err error
 	for try := 0; try < len(tries); try++ {
@@ -144,30 +169,134 @@ func retryToSendMetrics(c Clienter, ctx context.Context, metrics []*pb.Metric, e
 			break
 		}
 		logger.WriteErrorLog("Error in request by try:"+strconv.Itoa(try), err.Error())
+		if backoffOnThrottle(err) {
+			// дальше повторять раньше паузы, которую попросил сервер, бессмысленно
+			break
+		}
 	}
 	return err
 }
 
-// SendMetricsByGRPC отправляет метрики(несколько раз в случае неудачной отправки)
-func SendMetricsByGRPC(r request, c Clienter, monitor *storage.Monitor, flags *SystemConfigFlags, manager *crypto.Manager) {
-	metrics := metricsHandler.GetMetricsCollection(monitor)
+// backoffOnThrottle запоминает паузу, если сервер отклонил запрос из-за ограничения частоты
+func backoffOnThrottle(err error) bool {
+	retryAfter, ok := ratelimit.RetryAfterFromError(err)
+	if ok {
+		serverBackoff.Set(retryAfter)
+	}
+	return ok
+}
+
+// SendMetricsByGRPC отправляет метрики(несколько раз в случае неудачной отправки),
+// пока не истекла пауза, которую попросил сервер, пачка не отправляется.
+// lost вызывается для каждой пачки, которую не удалось доставить: для текущей сразу,
+// для пачки потока - когда сервер не подтвердил ее получение и повторная отправка не удалась.
+// Возвращаются все ошибки доставки
+func SendMetricsByGRPC(r request, c Clienter, metrics []models.Metrics, flags *SystemConfigFlags, manager *crypto.Manager, lost func()) error {
+	if wait := serverBackoff.Remaining(); wait > 0 {
+		logger.WriteInfoLog("server asked to retry after", wait.String())
+		lose(lost)
+		return fmt.Errorf("server asked to retry after %s", wait)
+	}
 	pbMetrics := ConvertToProto(metrics)
 	ctx, err := setHashByMetrics(r, pbMetrics, flags)
 	if err != nil {
 		logger.WriteErrorLog(err.Error(), "SetHashByMetrics")
 	}
-	pbMetrics, encryptedMetrics, err := encryptMetrics(pbMetrics, manager)
+	// в потоке подпись передается в сообщении вместе с временем и одноразовым значением из метаданных
+	hashSHA256 := ""
+	if flags.Stream {
+		hashSHA256 = outgoingValue(ctx, "hashsha256")
+	}
+	pbMetrics, encryptedMetrics, keyID, err := encryptMetrics(pbMetrics, manager)
 	if err != nil {
 		logger.WriteErrorLog(err.Error(), "EncryptMetrics")
 	}
-	err = c.SendMetrics(ctx, pbMetrics, encryptedMetrics)
+	if len(encryptedMetrics) > 0 {
+		if scheme := crypto.EncryptorScheme(manager.GetGRPCEncryptor()); scheme != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, crypto.SchemeMetadataKey, scheme)
+		}
+		if keyID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, crypto.KeyIDMetadataKey, keyID)
+		}
+	}
+	if flags.Stream {
+		err = c.StreamMetrics(ctx, pbMetrics, encryptedMetrics, hashSHA256, lost)
+		if err == nil {
+			return nil
+		}
+		// при ошибке потока отправляем обычными запросами все пачки, которые сервер не подтвердил
+		logger.WriteErrorLog(err.Error(), "Error in streaming metrics")
+		if unconfirmed, ok := unconfirmedFromError(err); ok {
+			if backoffOnThrottle(err) {
+				return loseUnconfirmed(unconfirmed.Requests, err)
+			}
+			return resendUnconfirmed(c, unconfirmed)
+		}
+		if backoffOnThrottle(err) {
+			lose(lost)
+			return err
+		}
+	}
+	err = sendWithRetry(c, ctx, pbMetrics, encryptedMetrics)
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "Error in sending metrics")
-		err = retryToSendMetrics(c, ctx, pbMetrics, encryptedMetrics, errors.TriesTimes)
-		if err != nil {
-			logger.WriteErrorLog(err.Error(), "Error in sending metrics by retry")
+		lose(lost)
+	}
+	return err
+}
+
+// resendUnconfirmed отправляет обычными запросами пачки потока, которые сервер не подтвердил,
+// приращения недоставленных пачек возвращаются в реестр, возвращаются ошибки всех недоставленных пачек
+func resendUnconfirmed(c Clienter, unconfirmed *UnconfirmedError) error {
+	var errs []error
+	for i, req := range unconfirmed.Requests {
+		err := sendWithRetry(c, requestContext(unconfirmed.MD, req.ListMetricsRequest), req.GetMetrics(), req.GetCryptoMetrics())
+		if err == nil {
+			continue
 		}
+		req.lose()
+		errs = append(errs, err)
+		if _, throttled := ratelimit.RetryAfterFromError(err); throttled {
+			// до окончания паузы остальные пачки отправлять бессмысленно
+			errs = append(errs, loseUnconfirmed(unconfirmed.Requests[i+1:], nil))
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loseUnconfirmed возвращает в реестр приращения пачек потока, которые не будут отправлены повторно
+func loseUnconfirmed(requests []PendingRequest, err error) error {
+	for _, req := range requests {
+		req.lose()
+	}
+	if err == nil && len(requests) > 0 {
+		err = fmt.Errorf("%d unconfirmed batches were not resent", len(requests))
 	}
+	return err
+}
+
+// lose возвращает в реестр приращения недоставленной пачки
+func lose(lost func()) {
+	if lost != nil {
+		lost()
+	}
+}
+
+// sendWithRetry отправляет пачку обычным запросом с повторами
+func sendWithRetry(c Clienter, ctx context.Context, pbMetrics []*pb.Metric, encryptedMetrics []byte) error {
+	err := c.SendMetrics(ctx, pbMetrics, encryptedMetrics)
+	if err == nil {
+		return nil
+	}
+	logger.WriteErrorLog(err.Error(), "Error in sending metrics")
+	if backoffOnThrottle(err) {
+		return err
+	}
+	err = retryToSendMetrics(c, ctx, pbMetrics, encryptedMetrics, internalErrors.TriesTimes)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Error in sending metrics by retry")
+	}
+	return err
 }
 
 // ConvertToProto преобразует ваши models.Metrics в protobuf Metric
@@ -176,8 +305,9 @@ func ConvertToProto(metrics []models.Metrics) []*pb.Metric {
 
 	for _, m := range metrics {
 		pbMetric := &pb.Metric{
-			Id:   m.ID,
-			Type: pb.Metric_gauge,
+			Id:     m.ID,
+			Type:   pb.Metric_gauge,
+			Labels: m.Labels,
 		}
 
 		switch m.MType {
@@ -2,16 +2,22 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
 	"github.com/ramil063/gometrics/cmd/server/handlers/grpc/server"
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
 	"github.com/ramil063/gometrics/internal/security/crypto"
 )
 
@@ -36,6 +42,17 @@ func TestConvertToProto(t *testing.T) {
 				{Id: "met1", Type: pb.Metric_gauge, Value: 1.1},
 			},
 		},
+		{
+			name: "test labels",
+			args: args{
+				metrics: []models.Metrics{
+					{ID: "met1", MType: "gauge", Value: &gaugeVal, Labels: map[string]string{"host": "a"}},
+				},
+			},
+			want: []*pb.Metric{
+				{Id: "met1", Type: pb.Metric_gauge, Value: 1.1, Labels: map[string]string{"host": "a"}},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -67,11 +84,11 @@ func TestSendMetricsByGRPC(t *testing.T) {
 	type args struct {
 		c       Clienter
 		flags   *SystemConfigFlags
-		monitor *storage.Monitor
+		metrics []models.Metrics
 		r       request
 	}
 	manager := crypto.NewCryptoManager()
-	client, err := NewGRPCClient(":3202")
+	client, err := NewGRPCClient(":3202", nil)
 	assert.NoError(t, err)
 	tests := []struct {
 		args args
@@ -84,14 +101,14 @@ func TestSendMetricsByGRPC(t *testing.T) {
 					IP: "127.0.1.1",
 				},
 				c:       client,
-				monitor: &storage.Monitor{},
+				metrics: []models.Metrics{},
 				flags:   &SystemConfigFlags{},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			SendMetricsByGRPC(tt.args.r, tt.args.c, tt.args.monitor, tt.args.flags, manager)
+			SendMetricsByGRPC(tt.args.r, tt.args.c, tt.args.metrics, tt.args.flags, manager, nil)
 		})
 	}
 }
@@ -107,7 +124,7 @@ func Test_request_SendMetricsProcess(t *testing.T) {
 		maxCount int
 	}
 	manager := crypto.NewCryptoManager()
-	client, err := NewGRPCClient(":3202")
+	client, err := NewGRPCClient(":3202", nil)
 	assert.NoError(t, err)
 	tests := []struct {
 		args   args
@@ -194,7 +211,7 @@ func Test_retryToSendMetrics(t *testing.T) {
 		tries   []int
 	}
 	ctx := context.Background()
-	client, err := NewGRPCClient(":3202")
+	client, err := NewGRPCClient(":3202", nil)
 	assert.NoError(t, err)
 	tests := []struct {
 		name    string
@@ -221,3 +238,138 @@ func Test_retryToSendMetrics(t *testing.T) {
 		})
 	}
 }
+
+// throttledClient клиент, которому сервер отвечает ResourceExhausted с подсказкой паузы
+type throttledClient struct {
+	err      error
+	sends    int
+	streams  int
+	received int
+}
+
+func (c *throttledClient) Close() error { return nil }
+
+func (c *throttledClient) SendMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte) error {
+	c.sends++
+	if c.err != nil {
+		return c.err
+	}
+	c.received++
+	return nil
+}
+
+func (c *throttledClient) StreamMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte, hashSHA256 string, lost func()) error {
+	c.streams++
+	return c.err
+}
+
+func TestSendMetricsByGRPC_Throttled(t *testing.T) {
+	defer serverBackoff.Reset()
+	manager := crypto.NewCryptoManager()
+	c := &throttledClient{err: ratelimit.ThrottledError("rate limit exceeded", time.Minute)}
+
+	// после отказа потока запрос не повторяется обычным вызовом, приращения пачки возвращаются
+	lost := 0
+	err := SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{Stream: true}, manager, func() { lost++ })
+	assert.Error(t, err)
+	assert.Equal(t, 1, lost)
+	assert.Equal(t, 1, c.streams)
+	assert.Equal(t, 0, c.sends)
+	assert.Greater(t, serverBackoff.Remaining(), 50*time.Second)
+
+	// до окончания паузы пачки не отправляются
+	c.err = nil
+	err = SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{}, manager, func() { lost++ })
+	assert.Error(t, err)
+	assert.Equal(t, 2, lost)
+	assert.Equal(t, 0, c.sends)
+
+	serverBackoff.Reset()
+	err = SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{}, manager, func() { lost++ })
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lost)
+	assert.Equal(t, 1, c.received)
+}
+
+type unconfirmedClient struct {
+	throttledClient
+	sent []*pb.ListMetricsRequest
+	// fail ошибки повторной отправки пачек по одноразовому значению
+	fail map[string]error
+	lost []string
+}
+
+func (c *unconfirmedClient) SendMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	nonce := md.Get(hash.NonceMetadataKey)[0]
+	if err := c.fail[nonce]; err != nil {
+		return err
+	}
+	c.sent = append(c.sent, &pb.ListMetricsRequest{Metrics: metrics, Nonce: nonce})
+	return nil
+}
+
+func (c *unconfirmedClient) StreamMetrics(ctx context.Context, metrics []*pb.Metric, encryptedMetrics []byte, hashSHA256 string, lost func()) error {
+	return &UnconfirmedError{
+		Err: errors.New("stream closed"),
+		MD:  metadata.Pairs("x-real-ip", "127.0.0.1"),
+		Requests: []PendingRequest{
+			{
+				ListMetricsRequest: &pb.ListMetricsRequest{Metrics: []*pb.Metric{{Id: "first"}}, Hashsha256: "h1", Nonce: "n1"},
+				Lost:               func() { c.lost = append(c.lost, "first") },
+			},
+			{
+				ListMetricsRequest: &pb.ListMetricsRequest{Metrics: []*pb.Metric{{Id: "second"}}, Hashsha256: "h2", Nonce: "n2"},
+				Lost:               func() { c.lost = append(c.lost, "second") },
+			},
+		},
+	}
+}
+
+func TestSendMetricsByGRPC_Unconfirmed(t *testing.T) {
+	c := &unconfirmedClient{}
+
+	// все пачки, которые сервер не подтвердил, отправляются обычными запросами со своей подписью
+	err := SendMetricsByGRPC(request{}, c, []models.Metrics{{ID: "current", MType: "gauge"}}, &SystemConfigFlags{Stream: true}, crypto.NewCryptoManager(), nil)
+	assert.NoError(t, err)
+	require.Len(t, c.sent, 2)
+	assert.Equal(t, "first", c.sent[0].GetMetrics()[0].GetId())
+	assert.Equal(t, "n1", c.sent[0].GetNonce())
+	assert.Equal(t, "second", c.sent[1].GetMetrics()[0].GetId())
+	assert.Equal(t, "n2", c.sent[1].GetNonce())
+	assert.Empty(t, c.lost)
+}
+
+func TestSendMetricsByGRPC_UnconfirmedLost(t *testing.T) {
+	tries := internalErrors.TriesTimes
+	internalErrors.TriesTimes = []int{0}
+	defer func() {
+		internalErrors.TriesTimes = tries
+		serverBackoff.Reset()
+	}()
+	manager := crypto.NewCryptoManager()
+	firstErr := errors.New("first failed")
+	secondErr := errors.New("second failed")
+
+	// приращения недоставленной пачки возвращаются, остальные пачки все равно отправляются
+	c := &unconfirmedClient{fail: map[string]error{"n1": firstErr}}
+	err := SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{Stream: true}, manager, nil)
+	assert.ErrorIs(t, err, firstErr)
+	assert.Equal(t, []string{"first"}, c.lost)
+	require.Len(t, c.sent, 1)
+	assert.Equal(t, "second", c.sent[0].GetMetrics()[0].GetId())
+
+	// возвращаются ошибки всех недоставленных пачек
+	c = &unconfirmedClient{fail: map[string]error{"n1": firstErr, "n2": secondErr}}
+	err = SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{Stream: true}, manager, nil)
+	assert.ErrorIs(t, err, firstErr)
+	assert.ErrorIs(t, err, secondErr)
+	assert.Equal(t, []string{"first", "second"}, c.lost)
+
+	// после отказа из-за ограничения частоты остальные пачки не отправляются, но их приращения возвращаются
+	c = &unconfirmedClient{fail: map[string]error{"n1": ratelimit.ThrottledError("rate limit exceeded", time.Minute)}}
+	err = SendMetricsByGRPC(request{}, c, []models.Metrics{}, &SystemConfigFlags{Stream: true}, manager, nil)
+	assert.Error(t, err)
+	assert.Empty(t, c.sent)
+	assert.Equal(t, []string{"first", "second"}, c.lost)
+}
@@ -2,91 +2,86 @@ package metrics
 
 import (
 	"encoding/json"
-	"fmt"
-	"reflect"
-	"strconv"
-	"sync"
+	"slices"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
+	"github.com/ramil063/gometrics/cmd/agent/collector"
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/cmd/agent/relay"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
 )
 
-// CollectMetricsRequestBodies сбор метрик в тела для отправки на сторонний сервис
-func CollectMetricsRequestBodies(monitor *storage.Monitor) []byte {
-	allMetrics := GetMetricsCollection(monitor)
-	body, err := json.Marshal(allMetrics)
+// PollCountID имя счетчика опросов агента
+const PollCountID = "PollCount"
+
+// NewRegistry создает реестр встроенных сборщиков с настройками из конфигурации агента
+func NewRegistry(collectors map[string]config.CollectorConfig) *collector.Registry {
+	registry := collector.NewDefaultRegistry()
+	if err := registry.Configure(collectors); err != nil {
+		logger.WriteErrorLog(err.Error(), "Error in collectors config")
+	}
+	return registry
+}
+
+// CollectMetricsRequestBodies сбор метрик в тело для отправки на сторонний сервис
+func CollectMetricsRequestBodies(metrics []models.Metrics) []byte {
+	body, err := json.Marshal(metrics)
 	if err != nil {
 		logger.WriteErrorLog("Error marshal metrics", err.Error())
 	}
 	return body
 }
 
-// GetMetricsCollection сбор метрик для отправки на сторонний сервис
-func GetMetricsCollection(monitor *storage.Monitor) []models.Metrics {
-	v := reflect.ValueOf(monitor).Elem()
-	typeOfS := v.Type()
-	allMetrics := make([]models.Metrics, 0, 100)
-
-	for i := 0; i < v.NumField(); i++ {
-		metricID := typeOfS.Field(i).Name
-
-		if metricID == "mx" {
-			continue
-		}
-
-		metricValue, _ := strconv.ParseFloat(fmt.Sprintf("%v", v.Field(i).Interface()), 64)
-		delta := int64(monitor.GetCountValue())
+// GetMetricsCollection сбор метрик для отправки на сторонний сервис,
+// к последним значениям сборщиков добавляется количество опросов с прошлой отправки
+func GetMetricsCollection(registry *collector.Registry, pollCount int64) []models.Metrics {
+	allMetrics := registry.Metrics()
+	return append(allMetrics, models.Metrics{
+		ID:    PollCountID,
+		MType: "counter",
+		Delta: &pollCount,
+	})
+}
 
-		if metricID == "CPUutilization" {
-			CPUutilization := monitor.GetAllCPUutilization()
-			for j, value := range CPUutilization {
-				valuePtr := float64(value)
-				metrics := models.Metrics{
-					ID:    "CPUutilization" + strconv.Itoa(j),
-					MType: "gauge",
-					Delta: nil,
-					Value: &valuePtr,
-				}
-				allMetrics = append(allMetrics, metrics)
-			}
-			continue
-		}
-		metrics := models.Metrics{
-			ID:    metricID,
-			MType: "gauge",
-			Delta: nil,
-			Value: &metricValue,
-		}
+// AppendRelayed добавляет в пачку метрики приложений, принятые агентом локально с прошлой отправки
+func AppendRelayed(metrics []models.Metrics) []models.Metrics {
+	if relay.DefaultRelay == nil {
+		return metrics
+	}
+	return append(slices.Clip(metrics), relay.DefaultRelay.Drain()...)
+}
 
-		if typeOfS.Field(i).Name == "PollCount" {
-			metrics.MType = "counter"
-			metrics.Delta = &delta
-			metrics.Value = nil
-		}
-		allMetrics = append(allMetrics, metrics)
+// SplitBatch делит пачку на части для параллельной отправки, каждая метрика попадает ровно в одну часть
+func SplitBatch(metrics []models.Metrics, parts int) [][]models.Metrics {
+	parts = min(max(parts, 1), max(len(metrics), 1))
+	size := (len(metrics) + parts - 1) / parts
+	batches := make([][]models.Metrics, 0, parts)
+	for start := 0; start < len(metrics) || len(batches) == 0; start += size {
+		batches = append(batches, metrics[start:min(start+size, len(metrics))])
 	}
-	return allMetrics
+	return batches
+}
+
+// CommitSent вычитает доставленные приращения counter метрик из реестра,
+// возвращает доставленное количество опросов
+func CommitSent(registry *collector.Registry, sent []models.Metrics) int64 {
+	registry.CommitCounters(sent)
+	return pollCount(sent)
 }
 
-// CollectMonitorMetrics собирает метрики монитора
-func CollectMonitorMetrics(count int, monitor *storage.Monitor, wg *sync.WaitGroup) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		storage.SetMetricsToMonitor(monitor)
-		monitor.StoreCountValue(count)
-	}()
+// RestoreSent возвращает в реестр приращения counter метрик пачки, вычтенные при отправке,
+// если пачку так и не удалось доставить, возвращает количество опросов в пачке
+func RestoreSent(registry *collector.Registry, lost []models.Metrics) int64 {
+	registry.RestoreCounters(lost)
+	return pollCount(lost)
 }
 
-// CollectGopsutilMetrics собирает метрики через gopsutil
-func CollectGopsutilMetrics(monitor *storage.Monitor, wg *sync.WaitGroup) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := storage.SetGopsutilMetricsToMonitor(monitor)
-		if err != nil {
-			logger.WriteErrorLog(err.Error(), "Error in set gopsutil metrics")
+// pollCount количество опросов в пачке
+func pollCount(metrics []models.Metrics) int64 {
+	for _, metric := range metrics {
+		if metric.ID == PollCountID && metric.Labels == nil && metric.Delta != nil {
+			return *metric.Delta
 		}
-	}()
+	}
+	return 0
 }
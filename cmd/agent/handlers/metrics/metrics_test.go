@@ -1,57 +1,173 @@
 package metrics
 
 import (
-	"sync"
+	"context"
+	"strconv"
 	"testing"
+	"time"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/agent/collector"
+	"github.com/ramil063/gometrics/cmd/agent/config"
+	"github.com/ramil063/gometrics/cmd/agent/relay"
+	"github.com/ramil063/gometrics/internal/models"
 )
 
-func BenchmarkCollectMetricsRequestBodies(b *testing.B) {
-	var m storage.Monitor
+// staticCollector сборщик с постоянными значениями
+type staticCollector struct {
+	metrics []models.Metrics
+}
 
-	for i := 0; i < b.N; i++ {
-		CollectMetricsRequestBodies(&m)
-	}
+func (c staticCollector) Name() string {
+	return "static"
 }
 
-func BenchmarkCollectMonitorMetrics(b *testing.B) {
-	var m storage.Monitor
-	var wg sync.WaitGroup
+func (c staticCollector) Collect(_ context.Context) ([]models.Metrics, error) {
+	return c.metrics, nil
+}
+
+func BenchmarkCollectMetricsRequestBodies(b *testing.B) {
+	registry := collector.NewDefaultRegistry()
+	registry.Poll(context.Background(), time.Now())
+	metrics := GetMetricsCollection(registry, 1)
+	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		CollectMonitorMetrics(1, &m, &wg)
+		CollectMetricsRequestBodies(metrics)
 	}
 }
 
-func BenchmarkCollectGopsutilMetrics(b *testing.B) {
-	var m storage.Monitor
-	var wg sync.WaitGroup
-	storage.SetMetricsToMonitor(&m)
+func BenchmarkGetMetricsCollection(b *testing.B) {
+	registry := collector.NewDefaultRegistry()
+	registry.Poll(context.Background(), time.Now())
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		CollectGopsutilMetrics(&m, &wg)
+		GetMetricsCollection(registry, 1)
 	}
 }
 
 func TestCollectMetricsRequestBodies(t *testing.T) {
+	value := 1.5
+	delta := int64(2)
 	tests := []struct {
 		name    string
-		monitor *storage.Monitor
+		metrics []models.Metrics
 		want    []byte
 	}{
 		{
-			name:    "test 1",
-			monitor: &storage.Monitor{},
-			want:    []byte("[{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":0},{\"id\":\"BuckHashSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"Frees\",\"type\":\"gauge\",\"value\":0},{\"id\":\"GCSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapAlloc\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapIdle\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapInuse\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapObjects\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapReleased\",\"type\":\"gauge\",\"value\":0},{\"id\":\"HeapSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"LastGC\",\"type\":\"gauge\",\"value\":0},{\"id\":\"Lookups\",\"type\":\"gauge\",\"value\":0},{\"id\":\"MCacheInuse\",\"type\":\"gauge\",\"value\":0},{\"id\":\"MCacheSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"Mallocs\",\"type\":\"gauge\",\"value\":0},{\"id\":\"NextGC\",\"type\":\"gauge\",\"value\":0},{\"id\":\"OtherSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"PauseTotalNs\",\"type\":\"gauge\",\"value\":0},{\"id\":\"StackInuse\",\"type\":\"gauge\",\"value\":0},{\"id\":\"Sys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"StackSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"MSpanInuse\",\"type\":\"gauge\",\"value\":0},{\"id\":\"MSpanSys\",\"type\":\"gauge\",\"value\":0},{\"id\":\"TotalMemory\",\"type\":\"gauge\",\"value\":0},{\"id\":\"FreeMemory\",\"type\":\"gauge\",\"value\":0},{\"id\":\"TotalAlloc\",\"type\":\"gauge\",\"value\":0},{\"id\":\"GCCPUFraction\",\"type\":\"gauge\",\"value\":0},{\"id\":\"NumForcedGC\",\"type\":\"gauge\",\"value\":0},{\"id\":\"NumGC\",\"type\":\"gauge\",\"value\":0},{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":0},{\"id\":\"RandomValue\",\"type\":\"gauge\",\"value\":0}]"),
+			name:    "empty",
+			metrics: []models.Metrics{},
+			want:    []byte("[]"),
+		},
+		{
+			name: "gauge and counter",
+			metrics: []models.Metrics{
+				{ID: "Alloc", MType: "gauge", Value: &value},
+				{ID: "PollCount", MType: "counter", Delta: &delta},
+			},
+			want: []byte("[{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1.5},{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":2}]"),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			bodies := CollectMetricsRequestBodies(tt.monitor)
-			assert.Equal(t, tt.want, bodies)
+			assert.Equal(t, tt.want, CollectMetricsRequestBodies(tt.metrics))
 		})
 	}
 }
+
+func TestGetMetricsCollection(t *testing.T) {
+	value := 3.0
+	registry := collector.NewRegistry()
+	require.NoError(t, registry.Register(staticCollector{
+		metrics: []models.Metrics{{ID: "Static", MType: "gauge", Value: &value}},
+	}, collector.Settings{Enabled: true}))
+
+	got := GetMetricsCollection(registry, 4)
+	require.Len(t, got, 1)
+	assert.Equal(t, PollCountID, got[0].ID)
+	assert.Equal(t, int64(4), *got[0].Delta)
+
+	registry.Poll(context.Background(), time.Now())
+	got = GetMetricsCollection(registry, 5)
+	require.Len(t, got, 2)
+	assert.Equal(t, "Static", got[0].ID)
+	assert.Equal(t, "counter", got[1].MType)
+	assert.Equal(t, int64(5), *got[1].Delta)
+}
+
+func TestNewRegistry(t *testing.T) {
+	disabled := false
+	registry := NewRegistry(map[string]config.CollectorConfig{
+		"gopsutil": {Enabled: &disabled},
+		"unknown":  {Interval: "5"},
+	})
+	assert.Equal(t, []string{"runtime", "gopsutil", "random", "disk", "net", "load", "swap", "fd", "process", "cgroup"}, registry.Names())
+	settings, err := registry.Settings("gopsutil")
+	require.NoError(t, err)
+	assert.False(t, settings.Enabled)
+}
+
+func TestAppendRelayed(t *testing.T) {
+	delta := int64(1)
+	batch := []models.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}
+	assert.Equal(t, batch, AppendRelayed(batch))
+
+	relay.DefaultRelay = relay.NewRelay()
+	defer func() { relay.DefaultRelay = nil }()
+
+	value := 2.0
+	require.NoError(t, relay.DefaultRelay.Add(models.Metrics{ID: "queue", MType: "gauge", Value: &value}))
+	got := AppendRelayed(batch)
+	require.Len(t, got, 2)
+	assert.Equal(t, "queue", got[1].ID)
+	assert.Len(t, batch, 1)
+	assert.Len(t, AppendRelayed(batch), 1)
+}
+
+func TestSplitBatch(t *testing.T) {
+	metrics := make([]models.Metrics, 5)
+	for i := range metrics {
+		metrics[i] = models.Metrics{ID: strconv.Itoa(i), MType: "gauge"}
+	}
+	tests := []struct {
+		name  string
+		parts int
+		want  []int
+	}{
+		{name: "one worker", parts: 1, want: []int{5}},
+		{name: "two workers", parts: 2, want: []int{3, 2}},
+		{name: "more workers than metrics", parts: 10, want: []int{1, 1, 1, 1, 1}},
+		{name: "no workers", parts: 0, want: []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := SplitBatch(metrics, tt.parts)
+			sizes := make([]int, 0, len(batches))
+			sent := make([]models.Metrics, 0, len(metrics))
+			for _, batch := range batches {
+				sizes = append(sizes, len(batch))
+				sent = append(sent, batch...)
+			}
+			assert.Equal(t, tt.want, sizes)
+			assert.Equal(t, metrics, sent)
+		})
+	}
+	assert.Len(t, SplitBatch(nil, 3), 1, "empty batch is still sent once")
+}
+
+func TestCommitSent(t *testing.T) {
+	registry := NewRegistry(nil)
+	pollCount := int64(3)
+	assert.Equal(t, int64(3), CommitSent(registry, []models.Metrics{{ID: PollCountID, MType: "counter", Delta: &pollCount}}))
+	assert.Equal(t, int64(0), CommitSent(registry, []models.Metrics{{ID: "Alloc", MType: "gauge"}}))
+}
+
+func TestRestoreSent(t *testing.T) {
+	registry := NewRegistry(nil)
+	pollCount := int64(3)
+	assert.Equal(t, int64(3), RestoreSent(registry, []models.Metrics{{ID: PollCountID, MType: "counter", Delta: &pollCount}}))
+	assert.Equal(t, int64(0), RestoreSent(registry, []models.Metrics{{ID: "Alloc", MType: "gauge"}}))
+}
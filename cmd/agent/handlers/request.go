@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"reflect"
 	"strconv"
 	"sync"
 	"syscall"
@@ -18,11 +18,13 @@ import (
 
 	"github.com/ramil063/gometrics/cmd/agent/handlers/gzip"
 	metricsHandler "github.com/ramil063/gometrics/cmd/agent/handlers/metrics"
-	"github.com/ramil063/gometrics/cmd/agent/storage"
+	"github.com/ramil063/gometrics/cmd/agent/storage/spool"
 	internalErrors "github.com/ramil063/gometrics/internal/errors"
 	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
 )
 
@@ -70,6 +72,15 @@ func NewJSONClient() JSONClienter {
 	}
 }
 
+// NewTLSJSONClient клиент для отправки метрик по https с настройками TLS агента
+func NewTLSJSONClient(tlsConfig *tls.Config) JSONClienter {
+	return client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
 func NewRequest() Requester {
 	req := request{}
 	ip, err := req.getOutboundIP()
@@ -109,9 +120,10 @@ func (c client) SendPostRequestWithBody(r request, url string, body []byte, flag
 	var err error
 	data := body
 
+	keyID := ""
 	encryptor := manager.GetDefaultEncryptor()
 	if encryptor != nil {
-		data, err = encryptor.Encrypt(data)
+		data, keyID, err = crypto.EncryptWithKeyID(encryptor, data)
 		if err != nil {
 			return err
 		}
@@ -127,10 +139,31 @@ func (c client) SendPostRequestWithBody(r request, url string, body []byte, flag
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Header.Set("Accept-Encoding", "gzip")
 	req.Header.Set("X-Real-IP", r.IP)
+	if encryptor != nil {
+		if scheme := crypto.EncryptorScheme(encryptor); scheme != "" {
+			req.Header.Set(crypto.SchemeHeader, scheme)
+		}
+		if keyID != "" {
+			req.Header.Set(crypto.KeyIDHeader, keyID)
+		}
+	}
 
-	if flags.HashKey != "" {
-		hashSha256 := hash.CreateSha256(body, flags.HashKey)
-		req.Header.Set("HashSHA256", hashSha256)
+	if flags.AgentID != "" {
+		req.Header.Set(agents.AgentIDHeader, flags.AgentID)
+	}
+	if flags.AgentToken != "" {
+		req.Header.Set(agents.AuthorizationHeader, "Bearer "+flags.AgentToken)
+	}
+	if flags.HashKey != "" || flags.AgentToken != "" {
+		// каждая отправка получает новые время и одноразовое значение, чтобы сервер не принял
+		// повторную отправку за перехваченный запрос, с токеном они передаются без подписи
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := hash.NewNonce()
+		if flags.HashKey != "" {
+			req.Header.Set("HashSHA256", hash.CreateSignedSha256(body, flags.HashKey, timestamp, nonce))
+		}
+		req.Header.Set(hash.TimestampHeader, timestamp)
+		req.Header.Set(hash.NonceHeader, nonce)
 	}
 
 	res, err := c.httpClient.Do(req)
@@ -141,6 +174,10 @@ func (c client) SendPostRequestWithBody(r request, url string, body []byte, flag
 
 	var b []byte
 	res.Body.Read(b)
+	if res.StatusCode == http.StatusTooManyRequests {
+		retryAfter := ratelimit.ParseRetryAfter(res.Header.Get(ratelimit.RetryAfterHeader), time.Now())
+		return internalErrors.NewRetryAfterError(res.Status, res.StatusCode, retryAfter)
+	}
 	if res.StatusCode != http.StatusOK {
 		return internalErrors.NewRequestError(res.Status, res.StatusCode)
 	}
@@ -158,34 +195,24 @@ func (r request) SendMetrics(c Clienter, maxCount int, flags *SystemConfigFlags)
 	var interval = 1 * time.Second
 	count := 0
 	seconds := 0
-	var m *storage.Monitor
+	registry := metricsHandler.NewRegistry(flags.Collectors)
+	var metrics []models.Metrics
 
 	for count < maxCount {
 		<-time.After(interval)
 		seconds++
 		if (seconds % flags.PollInterval) == 0 {
 			log.Println("get metrics")
-			m = storage.NewMonitor()
-			m.PollCount = models.Counter(count)
+			registry.Poll(context.Background(), time.Now())
+			metrics = metricsHandler.GetMetricsCollection(registry, int64(count))
 			count++
 		}
 
 		if (seconds % flags.ReportInterval) == 0 {
-			v := reflect.ValueOf(m).Elem()
-			typeOfS := v.Type()
 			log.Println("send metrics")
 
-			for i := 0; i < v.NumField(); i++ {
-				metricType := "gauge"
-				name := typeOfS.Field(i).Name
-				if name == "mx" {
-					continue
-				}
-				if name == "PollCount" {
-					metricType = "counter"
-				}
-				metricValue := fmt.Sprintf("%v", v.Field(i).Interface())
-				url := "http://" + flags.Address + "/update/" + metricType + "/" + name + "/" + metricValue
+			for _, metric := range metrics {
+				url := flags.URL("/update/" + metric.MType + "/" + metric.ID + "/" + metricValue(metric))
 
 				err := c.SendPostRequest(url)
 				if err != nil {
@@ -194,57 +221,48 @@ func (r request) SendMetrics(c Clienter, maxCount int, flags *SystemConfigFlags)
 					return err
 				}
 			}
+			registry.ResetCounters()
 		}
 	}
 	return nil
 }
 
+// metricValue значение метрики в виде строки для передачи в урле
+func metricValue(metric models.Metrics) string {
+	if metric.Delta != nil {
+		return strconv.FormatInt(*metric.Delta, 10)
+	}
+	if metric.Value != nil {
+		return strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	}
+	return "0"
+}
+
 // SendMetricsJSON отправка метрик
 func (r request) SendMetricsJSON(c JSONClienter, maxCount int, flags *SystemConfigFlags, manager *crypto.Manager) error {
 	var interval = 1 * time.Second
 	count := 0
 	seconds := 0
-	var m *storage.Monitor
+	registry := metricsHandler.NewRegistry(flags.Collectors)
+	var metrics []models.Metrics
 
 	for seconds < maxCount {
 		<-time.After(interval)
 		seconds++
 		if (seconds % flags.PollInterval) == 0 {
 			log.Println("get metrics json")
-			m = storage.NewMonitor()
-			m.PollCount = models.Counter(count)
+			registry.Poll(context.Background(), time.Now())
+			metrics = metricsHandler.GetMetricsCollection(registry, int64(count))
 			count++
 		}
 
 		if (seconds % flags.ReportInterval) == 0 {
-			v := reflect.ValueOf(m).Elem()
-			typeOfS := v.Type()
 			log.Println("send metrics json")
 
-			for i := 0; i < v.NumField(); i++ {
-				metricID := typeOfS.Field(i).Name
-				if metricID == "mx" {
-					continue
-				}
-
-				metricValue, _ := strconv.ParseFloat(fmt.Sprintf("%v", v.Field(i).Interface()), 64)
-				delta := int64(m.PollCount)
-
-				metrics := models.Metrics{
-					ID:    metricID,
-					MType: "gauge",
-					Delta: nil,
-					Value: &metricValue,
-				}
-
-				if typeOfS.Field(i).Name == "PollCount" {
-					metrics.MType = "counter"
-					metrics.Delta = &delta
-					metrics.Value = nil
-				}
-
-				url := "http://" + flags.Address + "/update"
-				body, err := json.Marshal(metrics)
+			sent := make([]models.Metrics, 0, len(metrics))
+			for _, metric := range metrics {
+				url := flags.URL("/update")
+				body, err := json.Marshal(metric)
 				if err != nil {
 					logger.WriteErrorLog("Error marshal metrics", err.Error())
 				}
@@ -252,8 +270,12 @@ func (r request) SendMetricsJSON(c JSONClienter, maxCount int, flags *SystemConf
 				err = c.SendPostRequestWithBody(r, url, body, flags, manager)
 				if err != nil {
 					logger.WriteErrorLog("Error in request", err.Error())
+					continue
 				}
+				sent = append(sent, metric)
 			}
+			// недоставленные приращения счетчиков уйдут со следующей отправкой
+			registry.CommitCounters(sent)
 		}
 	}
 	return nil
@@ -272,14 +294,14 @@ func (r request) SendMultipleMetricsJSON(
 	var pollInterval = time.Duration(flags.PollInterval) * time.Second
 	var reportInterval = time.Duration(flags.ReportInterval) * time.Second
 	count := 0
-	url := "http://" + flags.Address + "/updates"
+	url := flags.URL("/updates")
 
-	var monitor storage.Monitor
+	registry := metricsHandler.NewRegistry(flags.Collectors)
 	tickerPool := time.NewTicker(pollInterval)
 	tickerReport := time.NewTicker(reportInterval)
 
-	var sendMonitor = make(chan *storage.Monitor, 1)
-	defer close(sendMonitor)
+	var sendMetrics = make(chan []models.Metrics, 1)
+	defer close(sendMetrics)
 
 	var mu sync.Mutex
 	var shutdown = false
@@ -296,15 +318,15 @@ func (r request) SendMultipleMetricsJSON(
 			mu.Unlock()
 
 			log.Println("get metrics json start")
-			var collectWg sync.WaitGroup
-			metricsHandler.CollectMonitorMetrics(count, &monitor, &collectWg)
-			metricsHandler.CollectGopsutilMetrics(&monitor, &collectWg)
-			collectWg.Wait()
+			registry.Poll(ctxGrSh, time.Now())
+			mu.Lock()
+			metrics := metricsHandler.GetMetricsCollection(registry, int64(count))
+			mu.Unlock()
 
-			sendMonitor <- &monitor
+			sendMetrics <- metrics
 			log.Println("get metrics json end")
-			if len(sendMonitor) == 1 {
-				<-sendMonitor
+			if len(sendMetrics) == 1 {
+				<-sendMetrics
 			}
 		}
 	}()
@@ -315,16 +337,32 @@ func (r request) SendMultipleMetricsJSON(
 			<-tickerReport.C
 
 			log.Println("send metrics json start")
-			mon := <-sendMonitor
-			log.Println("send metrics json count value=", mon.GetCountValue())
-
-			for worker := 0; worker < flags.RateLimit; worker++ {
-				go SendMetrics(r, c, url, mon, flags, manager)
+			metrics := metricsHandler.AppendRelayed(<-sendMetrics)
+			log.Println("send metrics json count=", len(metrics))
+
+			// каждый воркер отправляет свою часть пачки, приращения счетчиков
+			// вычитаются только из доставленных частей
+			batches := metricsHandler.SplitBatch(metrics, flags.RateLimit)
+			delivered := make([]bool, len(batches))
+			var wg sync.WaitGroup
+			for worker, batch := range batches {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					delivered[worker] = SendMetrics(r, c, url, batch, flags, manager) == nil
+				}()
 			}
+			wg.Wait()
 
-			mu.Lock()
-			count = 0
-			mu.Unlock()
+			for worker, batch := range batches {
+				if !delivered[worker] {
+					continue
+				}
+				sent := metricsHandler.CommitSent(registry, batch)
+				mu.Lock()
+				count -= int(sent)
+				mu.Unlock()
+			}
 			log.Println("send metrics json end")
 
 			select {
@@ -346,6 +384,9 @@ func (r request) SendMultipleMetricsJSON(
 	}
 }
 
+// serverBackoff пауза, которую сервер попросил выдержать перед следующей отправкой
+var serverBackoff ratelimit.Backoff
+
 func retryToSendMetrics(r request, c JSONClienter, url string, body []byte, tries []int, flags *SystemConfigFlags, manager *crypto.Manager) error {
 	var err error
 	for try := 0; try < len(tries); try++ {
@@ -355,23 +396,112 @@ func retryToSendMetrics(r request, c JSONClienter, url string, body []byte, trie
 			break
 		}
 		logger.WriteErrorLog("Error in request by try:"+strconv.Itoa(try), err.Error())
+		if backoffOnThrottle(err) {
+			// дальше повторять раньше паузы, которую попросил сервер, бессмысленно
+			break
+		}
 	}
 	return err
 }
 
-// SendMetrics отправляет метрики(несколько раз в случае неудачной отправки)
-func SendMetrics(r request, c JSONClienter, url string, monitor *storage.Monitor, flags *SystemConfigFlags, manager *crypto.Manager) {
+// backoffOnThrottle запоминает паузу, если сервер отклонил запрос из-за ограничения частоты
+func backoffOnThrottle(err error) bool {
+	var reqErr *internalErrors.RequestError
+	if !errors.As(err, &reqErr) || reqErr.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	serverBackoff.Set(reqErr.RetryAfter)
+	return true
+}
+
+// SendMetrics отправляет метрики(несколько раз в случае неудачной отправки),
+// неотправленная пачка сохраняется в очередь на диске и отправляется позже,
+// ошибка возвращается, если пачка не доставлена и не сохранена в очередь
+func SendMetrics(r request, c JSONClienter, url string, metrics []models.Metrics, flags *SystemConfigFlags, manager *crypto.Manager) error {
 	var err error
-	body := metricsHandler.CollectMetricsRequestBodies(monitor)
+	body := metricsHandler.CollectMetricsRequestBodies(metrics)
+
+	if wait := serverBackoff.Remaining(); wait > 0 {
+		// сервер просил подождать, пачка дожидается своей очереди на диске
+		logger.WriteInfoLog("server asked to retry after", wait.String())
+		if spool.DefaultSpool == nil {
+			return fmt.Errorf("server asked to retry after %s", wait)
+		}
+		return appendToSpool(body)
+	}
+
+	if spool.DefaultSpool != nil && !spool.DefaultSpool.Empty() {
+		// пока в очереди есть пачки, новые встают за ними, чтобы сервер получил значения по порядку
+		if err = appendToSpool(body); err != nil {
+			return err
+		}
+		ReplaySpool(r, c, url, flags, manager)
+		return nil
+	}
 
 	if err = c.SendPostRequestWithBody(r, url, body, flags, manager); err != nil {
 		logger.WriteErrorLog(err.Error(), "Error in request")
 		var reqErr *internalErrors.RequestError
-		if errors.Is(err, reqErr) || errors.Is(err, syscall.ECONNREFUSED) {
+		// при ограничении частоты пачка не повторяется сразу, а ждет в очереди окончания паузы
+		if !backoffOnThrottle(err) && (errors.Is(err, reqErr) || errors.Is(err, syscall.ECONNREFUSED)) {
 			err = retryToSendMetrics(r, c, url, body, internalErrors.TriesTimes, flags, manager)
 			if err != nil {
 				logger.WriteErrorLog(err.Error(), "Error in retry request")
 			}
 		}
 	}
+
+	if err != nil && spool.DefaultSpool != nil && !isRejected(err) {
+		return appendToSpool(body)
+	}
+	return err
+}
+
+// appendToSpool сохраняет пачку в очередь на диске
+func appendToSpool(body []byte) error {
+	err := spool.DefaultSpool.Append(body)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Error in spool append")
+	}
+	return err
+}
+
+// spoolReplayer владелец повтора очереди на диске: пока один воркер отправляет пачки из очереди,
+// остальные только дописывают в нее свои, их отправит следующий повтор
+var spoolReplayer sync.Mutex
+
+// ReplaySpool отправляет пачки из очереди на диске в порядке их сохранения,
+// если очередь уже повторяет другой воркер, ничего не делает
+func ReplaySpool(r request, c JSONClienter, url string, flags *SystemConfigFlags, manager *crypto.Manager) {
+	if spool.DefaultSpool == nil || serverBackoff.Remaining() > 0 {
+		return
+	}
+	if !spoolReplayer.TryLock() {
+		return
+	}
+	defer spoolReplayer.Unlock()
+	err := spool.DefaultSpool.Replay(func(batch []byte) error {
+		err := c.SendPostRequestWithBody(r, url, batch, flags, manager)
+		backoffOnThrottle(err)
+		if isRejected(err) {
+			// пачку, которую сервер отклонил, повторять бессмысленно
+			logger.WriteErrorLog(err.Error(), "Spooled batch rejected")
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Error in spool replay")
+	}
+}
+
+// isRejected проверяет, что сервер отклонил пачку и повторная отправка не поможет
+func isRejected(err error) bool {
+	var reqErr *internalErrors.RequestError
+	if !errors.As(err, &reqErr) {
+		return false
+	}
+	return reqErr.StatusCode >= http.StatusBadRequest &&
+		reqErr.StatusCode < http.StatusInternalServerError &&
+		reqErr.StatusCode != http.StatusTooManyRequests
 }
@@ -3,20 +3,33 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
+	metricsHandler "github.com/ramil063/gometrics/cmd/agent/handlers/metrics"
+	"github.com/ramil063/gometrics/cmd/agent/storage/spool"
 	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/hash"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
 )
 
 type RequestMock struct {
@@ -312,14 +325,296 @@ func TestSendMetrics_SuccessWithMock(t *testing.T) {
 
 	// 2. Тестовые данные
 	r := request{}
-	monitor := &storage.Monitor{} // Заполните данными, которые вернут ожидаемый body
+	metrics := []models.Metrics{} // Заполните данными, которые вернут ожидаемый body
 	flags := &SystemConfigFlags{}
 	manager := crypto.NewCryptoManager()
 	// 3. Запуск
-	SendMetrics(r, mockClient, mockClient.ExpectedURL, monitor, flags, manager)
+	SendMetrics(r, mockClient, mockClient.ExpectedURL, metrics, flags, manager)
 
 	// 4. Проверки
 	if mockClient.Attempts != 1 {
 		t.Errorf("Expected 1 attempt, got %d", mockClient.Attempts)
 	}
 }
+
+// spoolClient сервер, который можно выключить, запоминает принятые пачки
+type spoolClient struct {
+	MockClient
+	received   [][]byte
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (c *spoolClient) SendPostRequestWithBody(r request, url string, body []byte, flags *SystemConfigFlags, manager *crypto.Manager) error {
+	c.Attempts++
+	if c.statusCode == http.StatusTooManyRequests {
+		return internalErrors.NewRetryAfterError(http.StatusText(c.statusCode), c.statusCode, c.retryAfter)
+	}
+	if c.statusCode != http.StatusOK {
+		return internalErrors.NewRequestError(http.StatusText(c.statusCode), c.statusCode)
+	}
+	c.received = append(c.received, body)
+	return nil
+}
+
+// pollCountBatch пачка метрик со значением PollCount
+func pollCountBatch(count int64) []models.Metrics {
+	return []models.Metrics{{ID: "PollCount", MType: "counter", Delta: &count}}
+}
+
+// pollCountOf значение PollCount из тела пачки
+func pollCountOf(t *testing.T, body []byte) int64 {
+	var metrics []models.Metrics
+	require.NoError(t, json.Unmarshal(body, &metrics))
+	for _, m := range metrics {
+		if m.ID == "PollCount" {
+			return *m.Delta
+		}
+	}
+	t.Fatal("PollCount not found")
+	return 0
+}
+
+func TestSendMetrics_Spool(t *testing.T) {
+	var err error
+	spool.DefaultSpool, err = spool.Open(t.TempDir(), spool.Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	defer func() {
+		_ = spool.DefaultSpool.Close()
+		spool.DefaultSpool = nil
+	}()
+
+	r := request{}
+	flags := &SystemConfigFlags{}
+	manager := crypto.NewCryptoManager()
+	c := &spoolClient{statusCode: http.StatusServiceUnavailable}
+
+	// сервер недоступен, пачки уходят в очередь и считаются сохраненными
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, SendMetrics(r, c, "http://test", pollCountBatch(int64(i)), flags, manager))
+	}
+	assert.Empty(t, c.received)
+	assert.False(t, spool.DefaultSpool.Empty())
+
+	// после восстановления пачки отправляются по порядку перед новой
+	c.statusCode = http.StatusOK
+	SendMetrics(r, c, "http://test", pollCountBatch(3), flags, manager)
+	require.Len(t, c.received, 3)
+	for i, body := range c.received {
+		assert.Equal(t, int64(i+1), pollCountOf(t, body))
+	}
+	assert.True(t, spool.DefaultSpool.Empty())
+
+	// отклоненная сервером пачка в очередь не попадает
+	c.statusCode = http.StatusBadRequest
+	assert.Error(t, SendMetrics(r, c, "http://test", pollCountBatch(4), flags, manager))
+	assert.True(t, spool.DefaultSpool.Empty())
+}
+
+// blockingSpoolClient сервер, который отвечает только после release
+type blockingSpoolClient struct {
+	spoolClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingSpoolClient) SendPostRequestWithBody(r request, url string, body []byte, flags *SystemConfigFlags, manager *crypto.Manager) error {
+	c.started <- struct{}{}
+	<-c.release
+	return c.spoolClient.SendPostRequestWithBody(r, url, body, flags, manager)
+}
+
+func TestSendMetrics_SpoolSingleReplayer(t *testing.T) {
+	var err error
+	spool.DefaultSpool, err = spool.Open(t.TempDir(), spool.Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	defer func() {
+		_ = spool.DefaultSpool.Close()
+		spool.DefaultSpool = nil
+	}()
+
+	r := request{}
+	flags := &SystemConfigFlags{}
+	manager := crypto.NewCryptoManager()
+	body := metricsHandler.CollectMetricsRequestBodies(pollCountBatch(1))
+	require.NoError(t, spool.DefaultSpool.Append(body))
+
+	c := &blockingSpoolClient{
+		spoolClient: spoolClient{statusCode: http.StatusOK},
+		started:     make(chan struct{}, 2),
+		release:     make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ReplaySpool(r, c, "http://test", flags, manager)
+	}()
+	<-c.started
+
+	// пока очередь повторяет другой воркер, пачка только дописывается в очередь
+	SendMetrics(r, c, "http://test", pollCountBatch(2), flags, manager)
+	assert.Empty(t, c.started)
+
+	close(c.release)
+	<-done
+	require.Len(t, c.received, 1)
+	assert.Equal(t, int64(1), pollCountOf(t, c.received[0]))
+
+	// дописанная пачка отправляется следующим повтором
+	ReplaySpool(r, c, "http://test", flags, manager)
+	require.Len(t, c.received, 2)
+	assert.Equal(t, int64(2), pollCountOf(t, c.received[1]))
+	assert.True(t, spool.DefaultSpool.Empty())
+}
+
+func TestSendMetrics_Throttled(t *testing.T) {
+	var err error
+	spool.DefaultSpool, err = spool.Open(t.TempDir(), spool.Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	defer func() {
+		_ = spool.DefaultSpool.Close()
+		spool.DefaultSpool = nil
+		serverBackoff.Reset()
+	}()
+
+	r := request{}
+	flags := &SystemConfigFlags{}
+	manager := crypto.NewCryptoManager()
+	c := &spoolClient{statusCode: http.StatusTooManyRequests, retryAfter: time.Minute}
+
+	// сервер попросил подождать, пачка не повторяется сразу и уходит в очередь
+	SendMetrics(r, c, "http://test", pollCountBatch(1), flags, manager)
+	assert.Equal(t, 1, c.Attempts)
+	assert.Greater(t, serverBackoff.Remaining(), 50*time.Second)
+	assert.False(t, spool.DefaultSpool.Empty())
+
+	// до окончания паузы запросы не отправляются
+	c.statusCode = http.StatusOK
+	SendMetrics(r, c, "http://test", pollCountBatch(2), flags, manager)
+	assert.Equal(t, 1, c.Attempts)
+	assert.Empty(t, c.received)
+
+	// после паузы очередь отправляется по порядку
+	serverBackoff.Reset()
+	SendMetrics(r, c, "http://test", pollCountBatch(3), flags, manager)
+	require.Len(t, c.received, 3)
+	for i, body := range c.received {
+		assert.Equal(t, int64(i+1), pollCountOf(t, body))
+	}
+}
+
+// oversizedSpoolClient сервер, отклоняющий пачку со значением PollCount oversized как слишком большую
+type oversizedSpoolClient struct {
+	spoolClient
+	t         *testing.T
+	oversized int64
+}
+
+func (c *oversizedSpoolClient) SendPostRequestWithBody(r request, url string, body []byte, flags *SystemConfigFlags, manager *crypto.Manager) error {
+	if pollCountOf(c.t, body) == c.oversized {
+		c.Attempts++
+		return internalErrors.NewRequestError(http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	}
+	return c.spoolClient.SendPostRequestWithBody(r, url, body, flags, manager)
+}
+
+func TestReplaySpool_DropsOversizedBatch(t *testing.T) {
+	var err error
+	spool.DefaultSpool, err = spool.Open(t.TempDir(), spool.Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	defer func() {
+		_ = spool.DefaultSpool.Close()
+		spool.DefaultSpool = nil
+	}()
+
+	r := request{}
+	flags := &SystemConfigFlags{}
+	manager := crypto.NewCryptoManager()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, spool.DefaultSpool.Append(metricsHandler.CollectMetricsRequestBodies(pollCountBatch(int64(i)))))
+	}
+
+	// слишком большая пачка не станет меньше, она отбрасывается и не задерживает следующие
+	c := &oversizedSpoolClient{spoolClient: spoolClient{statusCode: http.StatusOK}, t: t, oversized: 1}
+	ReplaySpool(r, c, "http://test", flags, manager)
+	assert.Equal(t, 3, c.Attempts)
+	require.Len(t, c.received, 2)
+	assert.Equal(t, int64(2), pollCountOf(t, c.received[0]))
+	assert.Equal(t, int64(3), pollCountOf(t, c.received[1]))
+	assert.True(t, spool.DefaultSpool.Empty())
+	assert.Zero(t, serverBackoff.Remaining())
+}
+
+func Test_client_SendPostRequestWithBody_Throttled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ratelimit.RetryAfterHeader, "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := NewJSONClient()
+	err := c.SendPostRequestWithBody(request{}, server.URL, []byte(`[]`), &SystemConfigFlags{}, crypto.NewCryptoManager())
+
+	var reqErr *internalErrors.RequestError
+	require.ErrorAs(t, err, &reqErr)
+	assert.Equal(t, http.StatusTooManyRequests, reqErr.StatusCode)
+	assert.Equal(t, 7*time.Second, reqErr.RetryAfter)
+}
+
+func Test_client_SendPostRequestWithBody_KeyID(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicFile := filepath.Join(t.TempDir(), "agent.pub")
+	require.NoError(t, os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}), 0600))
+	wantKeyID, err := crypto.KeyID(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	var gotKeyID, gotScheme string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKeyID = r.Header.Get(crypto.KeyIDHeader)
+		gotScheme = r.Header.Get(crypto.SchemeHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	encryptor, err := crypto.NewReloadingEncryptor(publicFile)
+	require.NoError(t, err)
+	manager := crypto.NewCryptoManager()
+	manager.SetDefaultEncryptor(encryptor)
+
+	c := client{httpClient: &http.Client{}}
+	err = c.SendPostRequestWithBody(request{IP: "127.0.0.1"}, ts.URL, []byte("a"), &SystemConfigFlags{}, manager)
+	require.NoError(t, err)
+	assert.Equal(t, wantKeyID, gotKeyID)
+	assert.Equal(t, crypto.SchemeEnvelope, gotScheme)
+}
+
+func Test_client_SendPostRequestWithBody_Signed(t *testing.T) {
+	var headers []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	c := client{httpClient: &http.Client{}}
+	flags := &SystemConfigFlags{HashKey: "test", AgentID: "agent-1", AgentToken: "token"}
+	body := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+	require.NoError(t, c.SendPostRequestWithBody(request{IP: "127.0.0.1"}, ts.URL, body, flags, crypto.NewCryptoManager()))
+	require.NoError(t, c.SendPostRequestWithBody(request{IP: "127.0.0.1"}, ts.URL, body, flags, crypto.NewCryptoManager()))
+
+	require.Len(t, headers, 2)
+	for _, h := range headers {
+		timestamp := h.Get(hash.TimestampHeader)
+		nonce := h.Get(hash.NonceHeader)
+		require.NotEmpty(t, timestamp)
+		require.NotEmpty(t, nonce)
+		assert.Equal(t, hash.CreateSignedSha256(body, "test", timestamp, nonce), h.Get("HashSHA256"))
+		assert.Equal(t, "agent-1", h.Get(agents.AgentIDHeader))
+		assert.Equal(t, "Bearer token", h.Get(agents.AuthorizationHeader))
+	}
+	// повторная отправка того же тела подписывается новым одноразовым значением
+	assert.NotEqual(t, headers[0].Get(hash.NonceHeader), headers[1].Get(hash.NonceHeader))
+}
@@ -7,10 +7,13 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	agentConfig "github.com/ramil063/gometrics/cmd/agent/config"
 	"github.com/ramil063/gometrics/cmd/agent/handlers"
 	"github.com/ramil063/gometrics/cmd/agent/handlers/grpc"
+	"github.com/ramil063/gometrics/cmd/agent/relay"
+	"github.com/ramil063/gometrics/cmd/agent/storage/spool"
 	"github.com/ramil063/gometrics/internal/constants"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/security/crypto"
@@ -39,12 +42,38 @@ func main() {
 
 	manager := crypto.NewCryptoManager()
 	if flags != nil && flags.CryptoKey != "" {
-		encryptor, err := crypto.NewRSAEncryptor(flags.CryptoKey)
+		// публичный ключ перечитывается при замене файла, агент переходит на новый ключ без перезапуска
+		encryptor, err := crypto.NewReloadingEncryptor(flags.CryptoKey)
 
 		if err != nil {
 			logger.WriteErrorLog(err.Error(), "Failed to create encryptor")
+		} else {
+			manager.SetDefaultEncryptor(encryptor)
 		}
-		manager.SetDefaultEncryptor(encryptor)
+	}
+
+	if flags != nil && flags.SpoolDir != "" {
+		spool.DefaultSpool, err = spool.Open(flags.SpoolDir, spool.Options{
+			SegmentSize: flags.SpoolSegmentSize,
+			MaxSize:     flags.SpoolMaxSize,
+			MaxAge:      time.Duration(flags.SpoolMaxAge) * time.Second,
+		})
+		if err != nil {
+			logger.WriteErrorLog(err.Error(), "Failed to open spool")
+		} else {
+			defer spool.DefaultSpool.Close()
+		}
+	}
+
+	c := handlers.NewJSONClient()
+	if flags != nil && flags.TLSEnabled() {
+		tlsConfig, tlsErr := flags.TLSConfig()
+		if tlsErr != nil {
+			// без шифрования метрики не отправляем
+			logger.WriteErrorLog(tlsErr.Error(), "Failed to create tls config")
+			return
+		}
+		c = handlers.NewTLSJSONClient(tlsConfig)
 	}
 
 	fmt.Printf("Build version: %s\n", buildVersion)
@@ -54,13 +83,26 @@ func main() {
 	ctxGrSh, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
+	if flags != nil && (flags.RelayStatsdAddress != "" || flags.RelayHTTPAddress != "") {
+		relay.DefaultRelay = relay.NewRelay()
+		if flags.RelayStatsdAddress != "" {
+			if err = relay.DefaultRelay.ListenStatsd(ctxGrSh, flags.RelayStatsdAddress); err != nil {
+				logger.WriteErrorLog(err.Error(), "Failed to listen relay statsd")
+			}
+		}
+		if flags.RelayHTTPAddress != "" {
+			if err = relay.DefaultRelay.ListenHTTP(ctxGrSh, flags.RelayHTTPAddress); err != nil {
+				logger.WriteErrorLog(err.Error(), "Failed to listen relay http")
+			}
+		}
+	}
+
 	var serversWg sync.WaitGroup
 	serversWg.Add(1)
 
 	go grpc.StartClient(ctxGrSh, &serversWg)
 
 	serversWg.Add(1)
-	c := handlers.NewJSONClient()
 	r := handlers.NewRequest()
 	go r.SendMultipleMetricsJSON(c, -1, ctxGrSh, flags, manager, &serversWg)
 
@@ -0,0 +1,7 @@
+// Package relay локальный прием метрик приложений агентом
+//
+// Приложения на той же машине отправляют метрики агенту по UDP в формате StatsD
+// или запросом POST /push с телом models.Metrics (одна метрика или массив).
+// Агент накапливает значения между отправками и добавляет их в свою пачку,
+// поэтому приложениям не нужны адрес сервера, ключ подписи и публичный ключ шифрования.
+package relay
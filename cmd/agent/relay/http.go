@@ -0,0 +1,111 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// MaxPushBodySize максимальный размер тела запроса /push
+const MaxPushBodySize = 1 << 20
+
+// shutdownTimeout время на завершение запросов при остановке агента
+const shutdownTimeout = 5 * time.Second
+
+// Router маршруты локального приема метрик
+func (r *Relay) Router() chi.Router {
+	router := chi.NewRouter()
+	router.Post("/push", r.Push)
+	return router
+}
+
+// ListenHTTP открытие порта и запуск приема POST /push до завершения контекста
+func (r *Relay) ListenHTTP(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           r.Router(),
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.WriteErrorLog(err.Error(), "relay http Shutdown")
+		}
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WriteErrorLog(err.Error(), "relay http Serve")
+		}
+	}()
+	return nil
+}
+
+// Push прием одной метрики или массива метрик models.Metrics,
+// пачка принимается целиком или отклоняется целиком
+func (r *Relay) Push(rw http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(rw, req.Body, MaxPushBodySize))
+	if err != nil {
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var metrics []models.Metrics
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		var metric models.Metrics
+		err = json.Unmarshal(body, &metric)
+		metrics = append(metrics, metric)
+	} else {
+		err = json.Unmarshal(body, &metrics)
+	}
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "relay push decode")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, metric := range metrics {
+		if !valid(metric) {
+			logger.WriteDebugLog("relay push invalid metric", metric.ID)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	for _, metric := range metrics {
+		if err = r.Add(metric); err != nil {
+			logger.WriteErrorLog(err.Error(), "relay push")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// valid проверка имени и значения метрики по ее типу
+func valid(metric models.Metrics) bool {
+	if metric.ID == "" {
+		return false
+	}
+	switch metric.MType {
+	case "gauge":
+		return metric.Value != nil
+	case "counter":
+		return metric.Delta != nil
+	}
+	return false
+}
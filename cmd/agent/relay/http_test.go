@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay_Push(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantLen    int
+	}{
+		{name: "single metric", body: `{"id":"queue","type":"gauge","value":1}`, wantStatus: http.StatusOK, wantLen: 1},
+		{name: "batch", body: `[{"id":"jobs","type":"counter","delta":2},{"id":"queue","type":"gauge","value":3,"labels":{"app":"api"}}]`, wantStatus: http.StatusOK, wantLen: 2},
+		{name: "bad json", body: `{"id":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown type", body: `[{"id":"x","type":"histogram","value":1}]`, wantStatus: http.StatusBadRequest},
+		{name: "counter without delta", body: `[{"id":"jobs","type":"counter","delta":1},{"id":"jobs","type":"counter"}]`, wantStatus: http.StatusBadRequest},
+		{name: "empty id", body: `{"type":"gauge","value":1}`, wantStatus: http.StatusBadRequest},
+		{name: "too large", body: `[` + strings.Repeat(" ", MaxPushBodySize) + `]`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRelay()
+			server := httptest.NewServer(r.Router())
+			defer server.Close()
+
+			resp, err := http.Post(server.URL+"/push", "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			// пачка с ошибкой не принимается частично
+			assert.Len(t, r.Drain(), tt.wantLen)
+		})
+	}
+}
+
+func TestRelay_ListenHTTP(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Error(t, NewRelay().ListenHTTP(ctx, busy.Addr().String()))
+}
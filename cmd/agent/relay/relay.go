@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/statsd"
+)
+
+// DefaultRelay локальный прием метрик агента, nil если прием выключен
+var DefaultRelay *Relay
+
+// ErrUnknownGauge значение gauge еще не приходило
+var ErrUnknownGauge = errors.New("relay: unknown gauge")
+
+// Relay накапливает метрики приложений до отправки агентом,
+// ключи значений с учетом меток (models.MetricKey)
+type Relay struct {
+	statsd   *statsd.Server
+	gauges   map[string]float64
+	last     map[string]float64
+	counters map[string]int64
+	mu       sync.Mutex
+}
+
+// NewRelay создает пустой локальный прием метрик
+func NewRelay() *Relay {
+	r := &Relay{
+		gauges:   make(map[string]float64),
+		last:     make(map[string]float64),
+		counters: make(map[string]int64),
+	}
+	// отправители StatsD ограничиваются адресом прослушивания, подсеть не проверяется
+	r.statsd = statsd.NewServer(r, nil)
+	return r
+}
+
+// ListenStatsd запуск приема StatsD по UDP до завершения контекста
+func (r *Relay) ListenStatsd(ctx context.Context, address string) error {
+	return r.statsd.ListenAndServe(ctx, "udp", address)
+}
+
+// SetGauge сохранение значения gauge до отправки
+func (r *Relay) SetGauge(name string, value models.Gauge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = float64(value)
+	r.last[name] = float64(value)
+	return nil
+}
+
+// GetGauge последнее известное значение gauge, нужно для относительных изменений StatsD
+func (r *Relay) GetGauge(name string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.last[name]
+	if !ok {
+		return 0, ErrUnknownGauge
+	}
+	return value, nil
+}
+
+// AddCounter добавление приращения счетчика до отправки
+func (r *Relay) AddCounter(name string, value models.Counter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[name] += int64(value)
+	return nil
+}
+
+// Add добавление метрики, пришедшей запросом /push
+func (r *Relay) Add(metric models.Metrics) error {
+	switch {
+	case metric.MType == "gauge" && metric.Value != nil:
+		return r.SetGauge(metric.Key(), models.Gauge(*metric.Value))
+	case metric.MType == "counter" && metric.Delta != nil:
+		return r.AddCounter(metric.Key(), models.Counter(*metric.Delta))
+	}
+	return errors.New("relay: invalid metric " + metric.ID)
+}
+
+// Drain накопленные с прошлой отправки метрики в порядке ключей, накопленное очищается
+func (r *Relay) Drain() []models.Metrics {
+	// значения StatsD из текущего окна попадают в эту же отправку
+	if err := r.statsd.Flush(); err != nil {
+		logger.WriteErrorLog(err.Error(), "relay statsd Flush")
+	}
+
+	r.mu.Lock()
+	gauges, counters := r.gauges, r.counters
+	r.gauges = make(map[string]float64)
+	r.counters = make(map[string]int64)
+	r.mu.Unlock()
+
+	metrics := make([]models.Metrics, 0, len(gauges)+len(counters))
+	for _, key := range models.SortedKeys(gauges) {
+		value := gauges[key]
+		metrics = appendMetric(metrics, key, "gauge", &value, nil)
+	}
+	for _, key := range models.SortedKeys(counters) {
+		delta := counters[key]
+		metrics = appendMetric(metrics, key, "counter", nil, &delta)
+	}
+	return metrics
+}
+
+// appendMetric добавление метрики по ключу хранения, ключ с ошибкой пропускается
+func appendMetric(metrics []models.Metrics, key string, mType string, value *float64, delta *int64) []models.Metrics {
+	name, labels, err := models.ParseMetricKey(key)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "relay key "+key)
+		return metrics
+	}
+	return append(metrics, models.Metrics{
+		ID:     name,
+		MType:  mType,
+		Value:  value,
+		Delta:  delta,
+		Labels: labels,
+	})
+}
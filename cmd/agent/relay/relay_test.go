@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestRelay_Drain(t *testing.T) {
+	r := NewRelay()
+	assert.Empty(t, r.Drain())
+
+	value := 1.5
+	delta := int64(3)
+	require.NoError(t, r.Add(models.Metrics{ID: "queue", MType: "gauge", Value: &value, Labels: map[string]string{"app": "api"}}))
+	require.NoError(t, r.Add(models.Metrics{ID: "jobs", MType: "counter", Delta: &delta}))
+	require.NoError(t, r.Add(models.Metrics{ID: "jobs", MType: "counter", Delta: &delta}))
+	assert.Error(t, r.Add(models.Metrics{ID: "broken", MType: "gauge"}))
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+	r.statsd.HandlePacket(addr, []byte("jobs:1|c\nlatency:10|ms\nlatency:20|ms"))
+
+	got := r.Drain()
+	byKey := make(map[string]models.Metrics, len(got))
+	for _, m := range got {
+		byKey[m.Key()] = m
+	}
+	assert.Equal(t, 1.5, *byKey[`queue{app="api"}`].Value)
+	assert.Equal(t, map[string]string{"app": "api"}, byKey[`queue{app="api"}`].Labels)
+	assert.Equal(t, int64(7), *byKey["jobs"].Delta)
+	assert.Equal(t, 15.0, *byKey["latency.mean"].Value)
+	assert.Equal(t, int64(2), *byKey["latency.count"].Delta)
+
+	// после отправки накопленное очищается
+	assert.Empty(t, r.Drain())
+}
+
+func TestRelay_RelativeGauge(t *testing.T) {
+	r := NewRelay()
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+
+	_, err := r.GetGauge("temp")
+	assert.ErrorIs(t, err, ErrUnknownGauge)
+
+	r.statsd.HandlePacket(addr, []byte("temp:10|g"))
+	require.Len(t, r.Drain(), 1)
+
+	// относительное изменение применяется к последнему значению, даже уже отправленному
+	r.statsd.HandlePacket(addr, []byte("temp:+2.5|g"))
+	got := r.Drain()
+	require.Len(t, got, 1)
+	assert.Equal(t, 12.5, *got[0].Value)
+}
@@ -0,0 +1,6 @@
+// Package spool очередь неотправленных пачек метрик агента на диске
+//
+// Пачки дописываются в сегменты, каждая запись хранит длину и контрольную сумму.
+// Позиция воспроизведения сохраняется в файле cursor, поэтому после перезапуска агента
+// уже отправленные пачки повторно не отправляются.
+package spool
@@ -0,0 +1,387 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// SegmentExt расширение файлов сегментов
+const SegmentExt = ".seg"
+
+// CursorFile имя файла с позицией воспроизведения
+const CursorFile = "cursor"
+
+// recordHeaderSize длина записи и ее контрольная сумма
+const recordHeaderSize = 8
+
+// maxRecordSize наибольшая длина пачки в записи, длина из заголовка больше нее считается повреждением
+const maxRecordSize = 64 << 20
+
+// DefaultSpool очередь агента, nil если очередь выключена
+var DefaultSpool *Spool
+
+// ErrCorruptRecord запись в сегменте повреждена
+var ErrCorruptRecord = errors.New("spool: corrupt record")
+
+// ErrRecordTooLarge пачка длиннее maxRecordSize
+var ErrRecordTooLarge = errors.New("spool: record too large")
+
+// Options ограничения очереди
+// SegmentSize размер сегмента в байтах, после которого открывается следующий
+// MaxSize общий размер очереди в байтах, при превышении удаляются самые старые сегменты
+// MaxAge время жизни сегмента, 0 - без ограничения
+type Options struct {
+	SegmentSize int64
+	MaxSize     int64
+	MaxAge      time.Duration
+}
+
+// Spool очередь неотправленных пачек метрик на диске,
+// пачки дописываются в конец сегментов и воспроизводятся в порядке записи
+type Spool struct {
+	active   *os.File
+	dir      string
+	segments []uint64
+	options  Options
+	cursor   cursor
+	size     int64
+	mu       sync.Mutex
+	replayMu sync.Mutex
+}
+
+// cursor позиция первой невоспроизведенной записи
+type cursor struct {
+	segment uint64
+	offset  int64
+}
+
+// Open открывает очередь в директории dir, создавая ее при необходимости
+func Open(dir string, options Options) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool: create dir: %w", err)
+	}
+	s := &Spool{
+		dir:     dir,
+		options: options,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool: read dir: %w", err)
+	}
+	for _, entry := range entries {
+		seq, ok := parseSegmentName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("spool: stat segment: %w", err)
+		}
+		s.segments = append(s.segments, seq)
+		s.size += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	s.cursor, err = s.readCursor()
+	if err != nil {
+		return nil, err
+	}
+	// сегменты до позиции уже воспроизведены, но не успели удалиться
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.segment {
+		s.removeSegment(s.segments[0])
+	}
+	return s, nil
+}
+
+// Append дописывает пачку в конец очереди
+func (s *Spool) Append(batch []byte) error {
+	if len(batch) > maxRecordSize {
+		return ErrRecordTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordSize := int64(recordHeaderSize + len(batch))
+	if s.active != nil && s.options.SegmentSize > 0 {
+		info, err := s.active.Stat()
+		if err != nil {
+			return fmt.Errorf("spool: stat segment: %w", err)
+		}
+		if info.Size() > 0 && info.Size()+recordSize > s.options.SegmentSize {
+			s.sealActive()
+		}
+	}
+	if s.active == nil {
+		if err := s.openSegment(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(batch)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(batch))
+	copy(record[recordHeaderSize:], batch)
+	if _, err := s.active.Write(record); err != nil {
+		return fmt.Errorf("spool: write record: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("spool: sync segment: %w", err)
+	}
+	s.size += recordSize
+
+	s.enforceLimits(time.Now())
+	return nil
+}
+
+// Empty проверяет, есть ли в очереди невоспроизведенные пачки
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) == 0
+}
+
+// Size общий размер сегментов очереди в байтах
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Replay отправляет пачки через send в порядке записи и удаляет отправленные,
+// на первой ошибке send воспроизведение останавливается и продолжится со следующего вызова
+func (s *Spool) Replay(send func(batch []byte) error) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	// новые пачки во время воспроизведения пишутся в следующий сегмент
+	s.mu.Lock()
+	s.sealActive()
+	segments := append([]uint64(nil), s.segments...)
+	pos := s.cursor
+	s.mu.Unlock()
+
+	for _, seq := range segments {
+		offset := int64(0)
+		if seq == pos.segment {
+			offset = pos.offset
+		}
+		if err := s.replaySegment(seq, offset, send); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.removeSegment(seq)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Close закрывает текущий сегмент
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// replaySegment воспроизводит записи сегмента начиная с offset
+func (s *Spool) replaySegment(seq uint64, offset int64, send func(batch []byte) error) error {
+	f, err := os.Open(s.segmentPath(seq))
+	if errors.Is(err, os.ErrNotExist) {
+		// сегмент удален по ограничениям очереди
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("spool: open segment: %w", err)
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("spool: seek segment: %w", err)
+	}
+	reader := bufio.NewReader(f)
+	for {
+		batch, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// хвост сегмента поврежден, например при аварийном завершении во время записи
+			logger.WriteErrorLog(err.Error(), "spool segment "+s.segmentPath(seq))
+			return nil
+		}
+
+		if err = send(batch); err != nil {
+			return err
+		}
+
+		offset += int64(recordHeaderSize + len(batch))
+		s.mu.Lock()
+		s.cursor = cursor{segment: seq, offset: offset}
+		err = s.writeCursor()
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readRecord читает одну запись сегмента
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrCorruptRecord
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, ErrCorruptRecord
+	}
+	batch := make([]byte, size)
+	if _, err := io.ReadFull(r, batch); err != nil {
+		return nil, ErrCorruptRecord
+	}
+	if crc32.ChecksumIEEE(batch) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorruptRecord
+	}
+	return batch, nil
+}
+
+// openSegment открывает новый сегмент для записи, вызывается под мьютексом
+func (s *Spool) openSegment() error {
+	seq := uint64(1)
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1] + 1
+	}
+	if seq <= s.cursor.segment {
+		seq = s.cursor.segment + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("spool: open segment: %w", err)
+	}
+	s.active = f
+	s.segments = append(s.segments, seq)
+	return nil
+}
+
+// sealActive закрывает сегмент для записи, вызывается под мьютексом
+func (s *Spool) sealActive() {
+	if s.active == nil {
+		return
+	}
+	if err := s.active.Close(); err != nil {
+		logger.WriteErrorLog(err.Error(), "spool close segment")
+	}
+	s.active = nil
+}
+
+// enforceLimits удаляет самые старые сегменты сверх ограничений, вызывается под мьютексом
+func (s *Spool) enforceLimits(now time.Time) {
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		overSize := s.options.MaxSize > 0 && s.size > s.options.MaxSize
+		expired := false
+		if s.options.MaxAge > 0 {
+			if info, err := os.Stat(s.segmentPath(oldest)); err == nil {
+				expired = now.Sub(info.ModTime()) > s.options.MaxAge
+			}
+		}
+		if !overSize && !expired {
+			return
+		}
+		logger.WriteInfoLog("spool drops segment", s.segmentPath(oldest))
+		s.removeSegment(oldest)
+	}
+}
+
+// removeSegment удаляет сегмент с диска, вызывается под мьютексом
+func (s *Spool) removeSegment(seq uint64) {
+	for i, segment := range s.segments {
+		if segment != seq {
+			continue
+		}
+		if s.active != nil && i == len(s.segments)-1 {
+			s.sealActive()
+		}
+		if info, err := os.Stat(s.segmentPath(seq)); err == nil {
+			s.size -= info.Size()
+		}
+		if err := os.Remove(s.segmentPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.WriteErrorLog(err.Error(), "spool remove segment")
+		}
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		break
+	}
+	if s.cursor.segment <= seq {
+		s.cursor = cursor{segment: seq + 1}
+		if err := s.writeCursor(); err != nil {
+			logger.WriteErrorLog(err.Error(), "spool cursor")
+		}
+	}
+}
+
+// segmentPath путь до сегмента с номером seq
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, SegmentExt))
+}
+
+// parseSegmentName получение номера сегмента из имени файла
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, SegmentExt) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, SegmentExt), 10, 64)
+	return seq, err == nil
+}
+
+// readCursor читает позицию воспроизведения
+func (s *Spool) readCursor() (cursor, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, CursorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return cursor{}, nil
+	}
+	if err != nil {
+		return cursor{}, fmt.Errorf("spool: read cursor: %w", err)
+	}
+	var c cursor
+	if _, err = fmt.Sscanf(string(data), "%d %d", &c.segment, &c.offset); err != nil {
+		return cursor{}, fmt.Errorf("spool: parse cursor: %w", err)
+	}
+	return c, nil
+}
+
+// writeCursor сохраняет позицию воспроизведения через временный файл
+func (s *Spool) writeCursor() error {
+	path := filepath.Join(s.dir, CursorFile)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d", s.cursor.segment, s.cursor.offset)
+	if err := os.WriteFile(tmp, []byte(data), 0o644); err != nil {
+		return fmt.Errorf("spool: write cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("spool: write cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package spool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collect отправка, сохраняющая пачки, с ошибкой на пачке failOn
+func collect(sent *[]string, failOn string) func([]byte) error {
+	return func(batch []byte) error {
+		if string(batch) == failOn {
+			return errors.New("server is down")
+		}
+		*sent = append(*sent, string(batch))
+		return nil
+	}
+}
+
+func TestSpool_AppendReplay(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{SegmentSize: 32})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.True(t, s.Empty())
+
+	want := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		batch := fmt.Sprintf(`[{"id":"PollCount","delta":%d}]`, i)
+		want = append(want, batch)
+		require.NoError(t, s.Append([]byte(batch)))
+	}
+	assert.False(t, s.Empty())
+	assert.Greater(t, len(s.segments), 1)
+
+	var sent []string
+	require.NoError(t, s.Replay(collect(&sent, "")))
+	assert.Equal(t, want, sent)
+	assert.True(t, s.Empty())
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestSpool_ReplayResumesAfterError(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	for _, batch := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Append([]byte(batch)))
+	}
+
+	var sent []string
+	assert.Error(t, s.Replay(collect(&sent, "b")))
+	assert.Equal(t, []string{"a"}, sent)
+	require.NoError(t, s.Close())
+
+	// позиция переживает перезапуск агента, пачка a повторно не отправляется
+	s, err = Open(dir, Options{SegmentSize: 1 << 20})
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Append([]byte("d")))
+
+	sent = nil
+	require.NoError(t, s.Replay(collect(&sent, "")))
+	assert.Equal(t, []string{"b", "c", "d"}, sent)
+	assert.True(t, s.Empty())
+}
+
+func TestSpool_MaxSize(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{SegmentSize: 10, MaxSize: 30})
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, batch := range []string{"1", "2", "3", "4", "5", "6"} {
+		require.NoError(t, s.Append([]byte(batch)))
+	}
+	assert.LessOrEqual(t, s.Size(), int64(30))
+
+	var sent []string
+	require.NoError(t, s.Replay(collect(&sent, "")))
+	assert.Equal(t, []string{"4", "5", "6"}, sent)
+}
+
+func TestSpool_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{SegmentSize: 10, MaxAge: time.Hour})
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Append([]byte("old")))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(s.segmentPath(s.segments[0]), old, old))
+	require.NoError(t, s.Append([]byte("new")))
+
+	var sent []string
+	require.NoError(t, s.Replay(collect(&sent, "")))
+	assert.Equal(t, []string{"new"}, sent)
+}
+
+func TestSpool_CorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, s.Append([]byte("a")))
+	require.NoError(t, s.Append([]byte("b")))
+	path := s.segmentPath(s.segments[0])
+	require.NoError(t, s.Close())
+
+	// обрываем последнюю запись, как при аварийном завершении
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-1))
+
+	s, err = Open(dir, Options{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	var sent []string
+	require.NoError(t, s.Replay(collect(&sent, "")))
+	assert.Equal(t, []string{"a"}, sent)
+	assert.True(t, s.Empty())
+}
+
+func TestSpool_RecordTooLarge(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.ErrorIs(t, s.Append(make([]byte, maxRecordSize+1)), ErrRecordTooLarge)
+	assert.True(t, s.Empty())
+}
+
+func Test_readRecord_ForgedLength(t *testing.T) {
+	header := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], math.MaxUint32)
+
+	// длина из заголовка проверяется до выделения памяти под пачку
+	_, err := readRecord(bytes.NewReader(append(header, 'a')))
+	assert.ErrorIs(t, err, ErrCorruptRecord)
+}
+
+func TestOpen_SkipsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("x"), 0o644))
+
+	s, err := Open(dir, Options{})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.True(t, s.Empty())
+}
+
+func Test_parseSegmentName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   uint64
+		wantOk bool
+	}{
+		{name: "00000000000000000007.seg", want: 7, wantOk: true},
+		{name: "cursor", wantOk: false},
+		{name: "abc.seg", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSegmentName(tt.name)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
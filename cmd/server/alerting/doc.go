@@ -0,0 +1,6 @@
+// Package alerting пакет с логикой алертинга по значениям метрик
+// - разбор правил вида `FreeMemory < 5e8 for 2m` или `rate(PollCount) > 10`
+// - периодическая проверка правил по хранилищу метрик
+// - отслеживание состояний pending/firing/resolved
+// - отправка уведомлений в лог и на webhook
+package alerting
@@ -0,0 +1,194 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// State состояние алерта
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Source источник значений метрик для проверки правил
+type Source interface {
+	GetGauge(name string) (float64, error)
+	GetCounter(name string) (int64, error)
+}
+
+// Alert текущее состояние правила алертинга
+type Alert struct {
+	ActiveAt   time.Time `json:"active_at"`
+	FiredAt    time.Time `json:"fired_at,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+	Rule       string    `json:"rule"`
+	Metric     string    `json:"metric"`
+	State      State     `json:"state"`
+	Value      float64   `json:"value"`
+}
+
+// counterPoint предыдущее значение счетчика для расчета скорости
+type counterPoint struct {
+	at    time.Time
+	value int64
+}
+
+// Engine проверяет правила по хранилищу метрик и рассылает уведомления
+type Engine struct {
+	source    Source
+	alerts    map[string]*Alert
+	previous  map[string]counterPoint
+	rules     []Rule
+	notifiers []Notifier
+	mx        sync.RWMutex
+}
+
+// NewEngine создание движка алертинга
+func NewEngine(rules []Rule, source Source, notifiers ...Notifier) *Engine {
+	return &Engine{
+		source:    source,
+		alerts:    make(map[string]*Alert),
+		previous:  make(map[string]counterPoint),
+		rules:     rules,
+		notifiers: notifiers,
+	}
+}
+
+// Run проверка правил по тикеру до завершения контекста
+func (e *Engine) Run(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(now)
+		}
+	}
+}
+
+// Evaluate однократная проверка всех правил
+func (e *Engine) Evaluate(now time.Time) {
+	e.mx.Lock()
+	notifications := make([]Alert, 0)
+	for _, rule := range e.rules {
+		value, ok := e.value(rule, now)
+		if !ok {
+			continue
+		}
+		if alert, changed := e.transition(rule, value, now); changed {
+			notifications = append(notifications, alert)
+		}
+	}
+	e.mx.Unlock()
+
+	for _, alert := range notifications {
+		e.notify(alert)
+	}
+}
+
+// Alerts получение алертов в указанном состоянии, отсортированных по правилу
+func (e *Engine) Alerts(state State) []Alert {
+	result := make([]Alert, 0)
+	if e == nil {
+		return result
+	}
+
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	for _, alert := range e.alerts {
+		if alert.State == state {
+			result = append(result, *alert)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Rule < result[j].Rule
+	})
+	return result
+}
+
+// value получение проверяемого значения, false если значение еще не известно
+func (e *Engine) value(rule Rule, now time.Time) (float64, bool) {
+	if !rule.Rate {
+		if gauge, err := e.source.GetGauge(rule.Metric); err == nil {
+			return gauge, true
+		}
+		if counter, err := e.source.GetCounter(rule.Metric); err == nil {
+			return float64(counter), true
+		}
+		logger.WriteDebugLog("alert metric not found", rule.Metric)
+		return 0, false
+	}
+
+	counter, err := e.source.GetCounter(rule.Metric)
+	if err != nil {
+		logger.WriteDebugLog("alert counter not found", rule.Metric)
+		return 0, false
+	}
+	prev, ok := e.previous[rule.Metric]
+	if !ok || !now.After(prev.at) {
+		e.previous[rule.Metric] = counterPoint{at: now, value: counter}
+		return 0, false
+	}
+	e.previous[rule.Metric] = counterPoint{at: now, value: counter}
+
+	delta := counter - prev.value
+	if delta < 0 {
+		// счетчик был сброшен
+		delta = counter
+	}
+	return float64(delta) / now.Sub(prev.at).Seconds(), true
+}
+
+// transition смена состояния алерта, true если нужно отправить уведомление
+func (e *Engine) transition(rule Rule, value float64, now time.Time) (Alert, bool) {
+	alert, exists := e.alerts[rule.Expr]
+	active := exists && alert.State != StateResolved
+
+	if !rule.compare(value) {
+		if !active {
+			return Alert{}, false
+		}
+		alert.Value = value
+		if alert.State == StatePending {
+			delete(e.alerts, rule.Expr)
+			return Alert{}, false
+		}
+		alert.State = StateResolved
+		alert.ResolvedAt = now
+		return *alert, true
+	}
+
+	if !active {
+		alert = &Alert{
+			Rule:     rule.Expr,
+			Metric:   rule.Metric,
+			State:    StatePending,
+			ActiveAt: now,
+		}
+		e.alerts[rule.Expr] = alert
+	}
+	alert.Value = value
+	if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+		alert.State = StateFiring
+		alert.FiredAt = now
+		return *alert, true
+	}
+	return Alert{}, false
+}
+
+func (e *Engine) notify(alert Alert) {
+	for _, notifier := range e.notifiers {
+		if err := notifier.Notify(alert); err != nil {
+			logger.WriteErrorLog(err.Error(), "alert notify")
+		}
+	}
+}
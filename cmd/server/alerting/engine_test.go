@@ -0,0 +1,153 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+func (s *fakeSource) GetGauge(name string) (float64, error) {
+	if v, ok := s.gauges[name]; ok {
+		return v, nil
+	}
+	return 0, errors.New("not found")
+}
+
+func (s *fakeSource) GetCounter(name string) (int64, error) {
+	if v, ok := s.counters[name]; ok {
+		return v, nil
+	}
+	return 0, errors.New("not found")
+}
+
+type recordNotifier struct {
+	alerts []Alert
+}
+
+func (n *recordNotifier) Notify(alert Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func mustRule(t *testing.T, expr string) Rule {
+	t.Helper()
+	rule, err := ParseRule(expr)
+	require.NoError(t, err)
+	return rule
+}
+
+func TestEngine_EvaluateThreshold(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"Alloc": 50}}
+	notifier := &recordNotifier{}
+	engine := NewEngine([]Rule{mustRule(t, "Alloc > 100 for 1m")}, source, notifier)
+	start := time.Unix(1700000000, 0)
+
+	engine.Evaluate(start)
+	assert.Empty(t, engine.Alerts(StatePending))
+
+	source.gauges["Alloc"] = 150
+	engine.Evaluate(start.Add(10 * time.Second))
+	pending := engine.Alerts(StatePending)
+	require.Len(t, pending, 1)
+	assert.Equal(t, float64(150), pending[0].Value)
+	assert.Empty(t, notifier.alerts)
+
+	engine.Evaluate(start.Add(80 * time.Second))
+	firing := engine.Alerts(StateFiring)
+	require.Len(t, firing, 1)
+	assert.Equal(t, start.Add(80*time.Second), firing[0].FiredAt)
+	require.Len(t, notifier.alerts, 1)
+	assert.Equal(t, StateFiring, notifier.alerts[0].State)
+
+	source.gauges["Alloc"] = 10
+	engine.Evaluate(start.Add(90 * time.Second))
+	assert.Empty(t, engine.Alerts(StateFiring))
+	assert.Len(t, engine.Alerts(StateResolved), 1)
+	require.Len(t, notifier.alerts, 2)
+	assert.Equal(t, StateResolved, notifier.alerts[1].State)
+
+	// повторное срабатывание после resolved начинается с pending
+	source.gauges["Alloc"] = 200
+	engine.Evaluate(start.Add(100 * time.Second))
+	assert.Len(t, engine.Alerts(StatePending), 1)
+	assert.Empty(t, engine.Alerts(StateResolved))
+}
+
+func TestEngine_EvaluatePendingCancelled(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"Alloc": 150}}
+	notifier := &recordNotifier{}
+	engine := NewEngine([]Rule{mustRule(t, "Alloc > 100 for 1m")}, source, notifier)
+	start := time.Unix(1700000000, 0)
+
+	engine.Evaluate(start)
+	source.gauges["Alloc"] = 1
+	engine.Evaluate(start.Add(time.Second))
+
+	assert.Empty(t, engine.Alerts(StatePending))
+	assert.Empty(t, engine.Alerts(StateResolved))
+	assert.Empty(t, notifier.alerts)
+}
+
+func TestEngine_EvaluateRate(t *testing.T) {
+	source := &fakeSource{counters: map[string]int64{"PollCount": 100}}
+	notifier := &recordNotifier{}
+	engine := NewEngine([]Rule{mustRule(t, "rate(PollCount) > 5")}, source, notifier)
+	start := time.Unix(1700000000, 0)
+
+	engine.Evaluate(start)
+	assert.Empty(t, engine.Alerts(StateFiring))
+
+	source.counters["PollCount"] = 200
+	engine.Evaluate(start.Add(10 * time.Second))
+	firing := engine.Alerts(StateFiring)
+	require.Len(t, firing, 1)
+	assert.Equal(t, float64(10), firing[0].Value)
+
+	// сброс счетчика
+	source.counters["PollCount"] = 20
+	engine.Evaluate(start.Add(20 * time.Second))
+	assert.Empty(t, engine.Alerts(StateFiring))
+	require.Len(t, notifier.alerts, 2)
+	assert.Equal(t, float64(2), notifier.alerts[1].Value)
+}
+
+func TestEngine_EvaluateMissingMetric(t *testing.T) {
+	engine := NewEngine([]Rule{mustRule(t, "Unknown > 1"), mustRule(t, "Counter > 1")}, &fakeSource{counters: map[string]int64{"Counter": 5}})
+	engine.Evaluate(time.Now())
+
+	firing := engine.Alerts(StateFiring)
+	require.Len(t, firing, 1)
+	assert.Equal(t, "Counter", firing[0].Metric)
+}
+
+func TestEngine_AlertsNil(t *testing.T) {
+	var engine *Engine
+	assert.Equal(t, []Alert{}, engine.Alerts(StateFiring))
+}
+
+func TestEngine_Run(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"Alloc": 150}}
+	engine := NewEngine([]Rule{mustRule(t, "Alloc > 100")}, source)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		engine.Run(ctx, time.NewTicker(10*time.Millisecond))
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(engine.Alerts(StateFiring)) == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
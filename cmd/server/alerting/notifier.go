@@ -0,0 +1,64 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// Notifier отправляет уведомления о смене состояния алерта
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// LogNotifier пишет уведомления в лог
+type LogNotifier struct{}
+
+// NewLogNotifier создание уведомителя через лог
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+// Notify запись уведомления в лог
+func (n *LogNotifier) Notify(alert Alert) error {
+	logger.WriteInfoLog("alert "+string(alert.State), alert.Rule+" value="+strconv.FormatFloat(alert.Value, 'f', -1, 64))
+	return nil
+}
+
+// WebhookNotifier отправляет уведомления POST запросом в формате json
+type WebhookNotifier struct {
+	httpClient *http.Client
+	url        string
+}
+
+// NewWebhookNotifier создание уведомителя через webhook
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		url:        url,
+	}
+}
+
+// Notify отправка уведомления на webhook
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	res, err := n.httpClient.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return internalErrors.NewRequestError(res.Status, res.StatusCode)
+	}
+	return nil
+}
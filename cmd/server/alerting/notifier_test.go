@@ -0,0 +1,41 @@
+package alerting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var received Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	alert := Alert{Rule: "Alloc > 1", Metric: "Alloc", State: StateFiring, Value: 2}
+	require.NoError(t, NewWebhookNotifier(srv.URL).Notify(alert))
+	assert.Equal(t, alert.Rule, received.Rule)
+	assert.Equal(t, alert.State, received.State)
+	assert.Equal(t, alert.Value, received.Value)
+}
+
+func TestWebhookNotifier_NotifyError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	assert.Error(t, NewWebhookNotifier(srv.URL).Notify(Alert{}))
+}
+
+func TestLogNotifier_Notify(t *testing.T) {
+	assert.NoError(t, NewLogNotifier().Notify(Alert{Rule: "Alloc > 1", State: StateFiring}))
+}
@@ -0,0 +1,128 @@
+package alerting
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule правило алертинга
+// Expr исходная строка правила
+// Metric имя проверяемой метрики
+// Rate проверяется скорость изменения счетчика в секунду, а не значение
+// Op оператор сравнения
+// Threshold пороговое значение
+// For сколько условие должно выполняться до перехода в firing
+type Rule struct {
+	Expr      string
+	Metric    string
+	Op        string
+	Threshold float64
+	For       time.Duration
+	Rate      bool
+}
+
+var operators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// ParseRule разбор правила вида `<metric|rate(metric)> <op> <threshold> [for <duration>]`
+func ParseRule(expr string) (Rule, error) {
+	rule := Rule{Expr: strings.TrimSpace(expr)}
+	body := rule.Expr
+
+	if idx := strings.LastIndex(body, " for "); idx >= 0 {
+		duration, err := time.ParseDuration(strings.TrimSpace(body[idx+len(" for "):]))
+		if err != nil {
+			return rule, fmt.Errorf("invalid duration in rule %q: %w", expr, err)
+		}
+		rule.For = duration
+		body = body[:idx]
+	}
+
+	for _, op := range operators {
+		idx := strings.Index(body, op)
+		if idx < 0 {
+			continue
+		}
+		rule.Op = op
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(body[idx+len(op):]), 64)
+		if err != nil {
+			return rule, fmt.Errorf("invalid threshold in rule %q: %w", expr, err)
+		}
+		rule.Threshold = threshold
+		body = strings.TrimSpace(body[:idx])
+		break
+	}
+	if rule.Op == "" {
+		return rule, fmt.Errorf("no comparison operator in rule %q", expr)
+	}
+
+	if strings.HasPrefix(body, "rate(") && strings.HasSuffix(body, ")") {
+		rule.Rate = true
+		body = strings.TrimSpace(body[len("rate(") : len(body)-1])
+	}
+	if body == "" || strings.ContainsAny(body, " ()") {
+		return rule, fmt.Errorf("invalid metric name in rule %q", expr)
+	}
+	rule.Metric = body
+	return rule, nil
+}
+
+// LoadRules загрузка правил из конфигурации и файла правил (одно правило на строку, # комментарий)
+func LoadRules(exprs []string, filePath string) ([]Rule, error) {
+	all := append([]string{}, exprs...)
+
+	if filePath != "" {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open rules file %s: %w", filePath, err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			all = append(all, scanner.Text())
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read rules file %s: %w", filePath, err)
+		}
+	}
+
+	rules := make([]Rule, 0, len(all))
+	var errs []error
+	for _, expr := range all {
+		expr = strings.TrimSpace(expr)
+		if expr == "" || strings.HasPrefix(expr, "#") {
+			continue
+		}
+		rule, err := ParseRule(expr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// compare проверка выполнения условия правила
+func (r Rule) compare(value float64) bool {
+	switch r.Op {
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "gauge threshold",
+			expr: "Alloc > 100",
+			want: Rule{Expr: "Alloc > 100", Metric: "Alloc", Op: ">", Threshold: 100},
+		},
+		{
+			name: "rate with duration",
+			expr: " rate(PollCount) >= 2.5 for 1m ",
+			want: Rule{Expr: "rate(PollCount) >= 2.5 for 1m", Metric: "PollCount", Op: ">=", Threshold: 2.5, For: time.Minute, Rate: true},
+		},
+		{
+			name: "negative threshold",
+			expr: "Temp<-10",
+			want: Rule{Expr: "Temp<-10", Metric: "Temp", Op: "<", Threshold: -10},
+		},
+		{
+			name:    "no operator",
+			expr:    "Alloc 100",
+			wantErr: true,
+		},
+		{
+			name:    "bad threshold",
+			expr:    "Alloc > abc",
+			wantErr: true,
+		},
+		{
+			name:    "bad duration",
+			expr:    "Alloc > 1 for soon",
+			wantErr: true,
+		},
+		{
+			name:    "empty metric",
+			expr:    "> 1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRule(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nHeapAlloc > 10\n"), 0644))
+
+	rules, err := LoadRules([]string{"Alloc < 1"}, path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "Alloc", rules[0].Metric)
+	assert.Equal(t, "HeapAlloc", rules[1].Metric)
+
+	rules, err = LoadRules([]string{"bad", "Alloc < 1"}, "")
+	assert.Error(t, err)
+	assert.Len(t, rules, 1)
+
+	_, err = LoadRules(nil, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestRule_compare(t *testing.T) {
+	tests := []struct {
+		op    string
+		value float64
+		want  bool
+	}{
+		{">", 2, true},
+		{">", 1, false},
+		{">=", 1, true},
+		{"<", 0, true},
+		{"<=", 1, true},
+		{"==", 1, true},
+		{"!=", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			assert.Equal(t, tt.want, Rule{Op: tt.op, Threshold: 1}.compare(tt.value))
+		})
+	}
+}
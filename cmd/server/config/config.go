@@ -21,14 +21,42 @@ type envConfig struct {
 
 // ServerConfig структура для парсинга файла конфигурации
 type ServerConfig struct {
-	Restore         *bool  `json:"restore"`
-	Address         string `json:"address"`
-	FileStoragePath string `json:"store_file"`
-	DatabaseDSN     string `json:"database_dsn"`
-	HashKey         string `json:"hash_key"`
-	CryptoKey       string `json:"crypto_key"`
-	StoreInterval   string `json:"store_interval"`
-	TrustedSubnet   string `json:"trusted_subnet"`
+	Restore            *bool    `json:"restore"`
+	Address            string   `json:"address"`
+	FileStoragePath    string   `json:"store_file"`
+	DatabaseDSN        string   `json:"database_dsn"`
+	HashKey            string   `json:"hash_key"`
+	CryptoKey          string   `json:"crypto_key"`
+	StoreInterval      string   `json:"store_interval"`
+	TrustedSubnet      string   `json:"trusted_subnet"`
+	MetricsPrefix      string   `json:"metrics_prefix"`
+	AlertRulesFile     string   `json:"alert_rules_file"`
+	AlertWebhook       string   `json:"alert_webhook"`
+	AlertInterval      string   `json:"alert_interval"`
+	StatsdAddress      string   `json:"statsd_address"`
+	StatsdSocket       string   `json:"statsd_socket"`
+	StatsdFlush        string   `json:"statsd_flush_interval"`
+	TLSCert            string   `json:"tls_cert"`
+	TLSKey             string   `json:"tls_key"`
+	TLSClientCA        string   `json:"tls_client_ca"`
+	AgentPolicy        string   `json:"agent_policy"`
+	CryptoKeyGrace     string   `json:"crypto_key_grace"`
+	CryptoKeyReload    string   `json:"crypto_key_reload"`
+	ReplayWindow       string   `json:"replay_window"`
+	AgentRegistry      string   `json:"agent_registry"`
+	AdminToken         string   `json:"admin_token"`
+	DeniedSubnets      string   `json:"denied_subnets"`
+	TrustedProxies     string   `json:"trusted_proxies"`
+	IPFilterFile       string   `json:"ip_filter_file"`
+	IPFilterReload     string   `json:"ip_filter_reload"`
+	ClientRateLimit    string   `json:"client_rate_limit"`
+	ClientRateBurst    string   `json:"client_rate_burst"`
+	MaxBodySize        string   `json:"max_body_size"`
+	MaxBatchSize       string   `json:"max_batch_size"`
+	RetentionRulesFile string   `json:"retention_rules_file"`
+	RetentionInterval  string   `json:"retention_interval"`
+	AlertRules         []string `json:"alert_rules"`
+	RetentionRules     []string `json:"retention_rules"`
 }
 
 // loadConfig загружает конфигурацию из файла
@@ -53,6 +81,62 @@ func (cfg *ServerConfig) prepareConfig() error {
 	}
 	cfg.StoreInterval = strconv.FormatFloat(storeInterval.Seconds(), 'f', 0, 64)
 
+	if cfg.AlertInterval != "" {
+		alertInterval, err := time.ParseDuration(cfg.AlertInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse AlertInterval: %w", err)
+		}
+		cfg.AlertInterval = strconv.FormatFloat(alertInterval.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.CryptoKeyGrace != "" {
+		grace, err := time.ParseDuration(cfg.CryptoKeyGrace)
+		if err != nil {
+			return fmt.Errorf("failed to parse CryptoKeyGrace: %w", err)
+		}
+		cfg.CryptoKeyGrace = strconv.FormatFloat(grace.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.CryptoKeyReload != "" {
+		reload, err := time.ParseDuration(cfg.CryptoKeyReload)
+		if err != nil {
+			return fmt.Errorf("failed to parse CryptoKeyReload: %w", err)
+		}
+		cfg.CryptoKeyReload = strconv.FormatFloat(reload.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.ReplayWindow != "" {
+		replayWindow, err := time.ParseDuration(cfg.ReplayWindow)
+		if err != nil {
+			return fmt.Errorf("failed to parse ReplayWindow: %w", err)
+		}
+		cfg.ReplayWindow = strconv.FormatFloat(replayWindow.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.IPFilterReload != "" {
+		ipFilterReload, err := time.ParseDuration(cfg.IPFilterReload)
+		if err != nil {
+			return fmt.Errorf("failed to parse IPFilterReload: %w", err)
+		}
+		cfg.IPFilterReload = strconv.FormatFloat(ipFilterReload.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.StatsdFlush != "" {
+		statsdFlush, err := time.ParseDuration(cfg.StatsdFlush)
+		if err != nil {
+			return fmt.Errorf("failed to parse StatsdFlush: %w", err)
+		}
+		cfg.StatsdFlush = strconv.FormatFloat(statsdFlush.Seconds(), 'f', 0, 64)
+	}
+
+	if cfg.RetentionInterval != "" {
+		retentionInterval, err := time.ParseDuration(cfg.RetentionInterval)
+		if err != nil {
+			return fmt.Errorf("failed to parse RetentionInterval: %w", err)
+		}
+		cfg.RetentionInterval = strconv.FormatFloat(retentionInterval.Seconds(), 'f', 0, 64)
+	}
+
 	return nil
 }
 
@@ -67,3 +67,221 @@ func (cfg *ServerConfig) GetTrustedSubnet(defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetMetricsPrefix получение параметра MetricsPrefix
+func (cfg *ServerConfig) GetMetricsPrefix(defaultValue string) string {
+	if cfg.MetricsPrefix != "" {
+		return cfg.MetricsPrefix
+	}
+	return defaultValue
+}
+
+// GetAlertRules получение параметра AlertRules
+func (cfg *ServerConfig) GetAlertRules() []string {
+	return cfg.AlertRules
+}
+
+// GetAlertRulesFile получение параметра AlertRulesFile
+func (cfg *ServerConfig) GetAlertRulesFile(defaultValue string) string {
+	if cfg.AlertRulesFile != "" {
+		return cfg.AlertRulesFile
+	}
+	return defaultValue
+}
+
+// GetAlertWebhook получение параметра AlertWebhook
+func (cfg *ServerConfig) GetAlertWebhook(defaultValue string) string {
+	if cfg.AlertWebhook != "" {
+		return cfg.AlertWebhook
+	}
+	return defaultValue
+}
+
+// GetAlertInterval получение параметра AlertInterval
+func (cfg *ServerConfig) GetAlertInterval(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.AlertInterval); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetStatsdAddress получение параметра StatsdAddress
+func (cfg *ServerConfig) GetStatsdAddress(defaultValue string) string {
+	if cfg.StatsdAddress != "" {
+		return cfg.StatsdAddress
+	}
+	return defaultValue
+}
+
+// GetStatsdSocket получение параметра StatsdSocket
+func (cfg *ServerConfig) GetStatsdSocket(defaultValue string) string {
+	if cfg.StatsdSocket != "" {
+		return cfg.StatsdSocket
+	}
+	return defaultValue
+}
+
+// GetStatsdFlush получение параметра StatsdFlush
+func (cfg *ServerConfig) GetStatsdFlush(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.StatsdFlush); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetTLSCert получение параметра TLSCert
+func (cfg *ServerConfig) GetTLSCert(defaultValue string) string {
+	if cfg.TLSCert != "" {
+		return cfg.TLSCert
+	}
+	return defaultValue
+}
+
+// GetTLSKey получение параметра TLSKey
+func (cfg *ServerConfig) GetTLSKey(defaultValue string) string {
+	if cfg.TLSKey != "" {
+		return cfg.TLSKey
+	}
+	return defaultValue
+}
+
+// GetTLSClientCA получение параметра TLSClientCA
+func (cfg *ServerConfig) GetTLSClientCA(defaultValue string) string {
+	if cfg.TLSClientCA != "" {
+		return cfg.TLSClientCA
+	}
+	return defaultValue
+}
+
+// GetAgentPolicy получение параметра AgentPolicy
+func (cfg *ServerConfig) GetAgentPolicy(defaultValue string) string {
+	if cfg.AgentPolicy != "" {
+		return cfg.AgentPolicy
+	}
+	return defaultValue
+}
+
+// GetCryptoKeyGrace получение параметра CryptoKeyGrace
+func (cfg *ServerConfig) GetCryptoKeyGrace(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.CryptoKeyGrace); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetCryptoKeyReload получение параметра CryptoKeyReload
+func (cfg *ServerConfig) GetCryptoKeyReload(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.CryptoKeyReload); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetReplayWindow получение параметра ReplayWindow
+func (cfg *ServerConfig) GetReplayWindow(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.ReplayWindow); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetAgentRegistry получение параметра AgentRegistry
+func (cfg *ServerConfig) GetAgentRegistry(defaultValue string) string {
+	if cfg.AgentRegistry != "" {
+		return cfg.AgentRegistry
+	}
+	return defaultValue
+}
+
+// GetAdminToken получение параметра AdminToken
+func (cfg *ServerConfig) GetAdminToken(defaultValue string) string {
+	if cfg.AdminToken != "" {
+		return cfg.AdminToken
+	}
+	return defaultValue
+}
+
+// GetDeniedSubnets получение параметра DeniedSubnets
+func (cfg *ServerConfig) GetDeniedSubnets(defaultValue string) string {
+	if cfg.DeniedSubnets != "" {
+		return cfg.DeniedSubnets
+	}
+	return defaultValue
+}
+
+// GetTrustedProxies получение параметра TrustedProxies
+func (cfg *ServerConfig) GetTrustedProxies(defaultValue string) string {
+	if cfg.TrustedProxies != "" {
+		return cfg.TrustedProxies
+	}
+	return defaultValue
+}
+
+// GetIPFilterFile получение параметра IPFilterFile
+func (cfg *ServerConfig) GetIPFilterFile(defaultValue string) string {
+	if cfg.IPFilterFile != "" {
+		return cfg.IPFilterFile
+	}
+	return defaultValue
+}
+
+// GetIPFilterReload получение параметра IPFilterReload
+func (cfg *ServerConfig) GetIPFilterReload(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.IPFilterReload); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetClientRateLimit получение параметра ClientRateLimit
+func (cfg *ServerConfig) GetClientRateLimit(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.ClientRateLimit); err == nil && val >= 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetClientRateBurst получение параметра ClientRateBurst
+func (cfg *ServerConfig) GetClientRateBurst(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.ClientRateBurst); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetMaxBodySize получение параметра MaxBodySize
+func (cfg *ServerConfig) GetMaxBodySize(defaultValue int64) int64 {
+	if val, err := strconv.ParseInt(cfg.MaxBodySize, 10, 64); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetMaxBatchSize получение параметра MaxBatchSize
+func (cfg *ServerConfig) GetMaxBatchSize(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.MaxBatchSize); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// GetRetentionRules получение параметра RetentionRules
+func (cfg *ServerConfig) GetRetentionRules() []string {
+	return cfg.RetentionRules
+}
+
+// GetRetentionRulesFile получение параметра RetentionRulesFile
+func (cfg *ServerConfig) GetRetentionRulesFile(defaultValue string) string {
+	if cfg.RetentionRulesFile != "" {
+		return cfg.RetentionRulesFile
+	}
+	return defaultValue
+}
+
+// GetRetentionInterval получение параметра RetentionInterval
+func (cfg *ServerConfig) GetRetentionInterval(defaultValue int) int {
+	if val, err := strconv.Atoi(cfg.RetentionInterval); err == nil && val > 0 {
+		return val
+	}
+	return defaultValue
+}
@@ -18,6 +18,14 @@ func TestAgentConfig_Get(t *testing.T) {
 		CryptoKey       string
 		StoreInterval   string
 		TrustedSubnet   string
+		MetricsPrefix   string
+		AlertRulesFile  string
+		AlertWebhook    string
+		AlertInterval   string
+		StatsdAddress   string
+		StatsdSocket    string
+		StatsdFlush     string
+		AlertRules      []string
 	}
 	type wantConf struct {
 		Restore         *bool
@@ -27,7 +35,15 @@ func TestAgentConfig_Get(t *testing.T) {
 		HashKey         string
 		CryptoKey       string
 		TrustedSubnet   string
+		MetricsPrefix   string
+		AlertRulesFile  string
+		AlertWebhook    string
+		StatsdAddress   string
+		StatsdSocket    string
+		AlertRules      []string
 		StoreInterval   int
+		AlertInterval   int
+		StatsdFlush     int
 	}
 	tests := []struct {
 		name               string
@@ -46,6 +62,14 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:         "testhashkey",
 				CryptoKey:       "testcryptokey",
 				TrustedSubnet:   "testtrustedsubnet",
+				MetricsPrefix:   "testmetricsprefix",
+				AlertRulesFile:  "testalertrulesfile",
+				AlertWebhook:    "testalertwebhook",
+				AlertInterval:   "5",
+				StatsdAddress:   "teststatsdaddress",
+				StatsdSocket:    "teststatsdsocket",
+				StatsdFlush:     "7",
+				AlertRules:      []string{"Alloc > 1"},
 				StoreInterval:   "1",
 				Restore:         &restoreFalse,
 			},
@@ -56,7 +80,15 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:         "testhashkey",
 				CryptoKey:       "testcryptokey",
 				TrustedSubnet:   "testtrustedsubnet",
+				MetricsPrefix:   "testmetricsprefix",
+				AlertRulesFile:  "testalertrulesfile",
+				AlertWebhook:    "testalertwebhook",
+				AlertRules:      []string{"Alloc > 1"},
 				StoreInterval:   1,
+				AlertInterval:   5,
+				StatsdAddress:   "teststatsdaddress",
+				StatsdSocket:    "teststatsdsocket",
+				StatsdFlush:     7,
 				Restore:         &restoreFalse,
 			},
 			defaultStringValue: "default",
@@ -73,7 +105,14 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:         "default",
 				CryptoKey:       "default",
 				TrustedSubnet:   "default",
+				MetricsPrefix:   "default",
+				AlertRulesFile:  "default",
+				AlertWebhook:    "default",
 				StoreInterval:   100,
+				AlertInterval:   100,
+				StatsdAddress:   "default",
+				StatsdSocket:    "default",
+				StatsdFlush:     100,
 				Restore:         &restoreTrue,
 			},
 			defaultStringValue: "default",
@@ -90,6 +129,14 @@ func TestAgentConfig_Get(t *testing.T) {
 				HashKey:         tt.conf.HashKey,
 				CryptoKey:       tt.conf.CryptoKey,
 				TrustedSubnet:   tt.conf.TrustedSubnet,
+				MetricsPrefix:   tt.conf.MetricsPrefix,
+				AlertRulesFile:  tt.conf.AlertRulesFile,
+				AlertWebhook:    tt.conf.AlertWebhook,
+				AlertInterval:   tt.conf.AlertInterval,
+				StatsdAddress:   tt.conf.StatsdAddress,
+				StatsdSocket:    tt.conf.StatsdSocket,
+				StatsdFlush:     tt.conf.StatsdFlush,
+				AlertRules:      tt.conf.AlertRules,
 				StoreInterval:   tt.conf.StoreInterval,
 				Restore:         tt.conf.Restore,
 			}
@@ -101,6 +148,79 @@ func TestAgentConfig_Get(t *testing.T) {
 			assert.Equalf(t, tt.wantConf.StoreInterval, cfg.GetStoreInterval(tt.defaultIntValue), "GetHashKey(%v)", tt.defaultIntValue)
 			assert.Equalf(t, *(tt.wantConf.Restore), cfg.GetRestore(tt.defaultBoolValue), "GetHashKey(%v)", tt.defaultBoolValue)
 			assert.Equalf(t, tt.wantConf.TrustedSubnet, cfg.GetTrustedSubnet(tt.defaultStringValue), "GetTrustedSubnet(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.MetricsPrefix, cfg.GetMetricsPrefix(tt.defaultStringValue), "GetMetricsPrefix(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.AlertRulesFile, cfg.GetAlertRulesFile(tt.defaultStringValue), "GetAlertRulesFile(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.AlertWebhook, cfg.GetAlertWebhook(tt.defaultStringValue), "GetAlertWebhook(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.AlertInterval, cfg.GetAlertInterval(tt.defaultIntValue), "GetAlertInterval(%v)", tt.defaultIntValue)
+			assert.Equalf(t, tt.wantConf.AlertRules, cfg.GetAlertRules(), "GetAlertRules()")
+			assert.Equalf(t, tt.wantConf.StatsdAddress, cfg.GetStatsdAddress(tt.defaultStringValue), "GetStatsdAddress(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.StatsdSocket, cfg.GetStatsdSocket(tt.defaultStringValue), "GetStatsdSocket(%v)", tt.defaultStringValue)
+			assert.Equalf(t, tt.wantConf.StatsdFlush, cfg.GetStatsdFlush(tt.defaultIntValue), "GetStatsdFlush(%v)", tt.defaultIntValue)
 		})
 	}
 }
+
+func TestServerConfig_GetTLS(t *testing.T) {
+	cfg := &ServerConfig{TLSCert: "server.pem", TLSKey: "server-key.pem", AgentPolicy: "policy.json"}
+	assert.Equal(t, "server.pem", cfg.GetTLSCert("default"))
+	assert.Equal(t, "server-key.pem", cfg.GetTLSKey("default"))
+	assert.Equal(t, "default", cfg.GetTLSClientCA("default"))
+	assert.Equal(t, "policy.json", cfg.GetAgentPolicy("default"))
+}
+
+func TestServerConfig_GetCryptoKeyRotation(t *testing.T) {
+	cfg := &ServerConfig{CryptoKeyGrace: "3600"}
+	assert.Equal(t, 3600, cfg.GetCryptoKeyGrace(86400))
+	assert.Equal(t, 60, cfg.GetCryptoKeyReload(60))
+}
+
+func TestServerConfig_GetReplayWindow(t *testing.T) {
+	assert.Equal(t, 60, (&ServerConfig{ReplayWindow: "60"}).GetReplayWindow(300))
+	assert.Equal(t, 300, (&ServerConfig{}).GetReplayWindow(300))
+}
+
+func TestServerConfig_GetAgentRegistry(t *testing.T) {
+	cfg := &ServerConfig{AgentRegistry: "agents.json"}
+	assert.Equal(t, "agents.json", cfg.GetAgentRegistry("default"))
+	assert.Equal(t, "default", cfg.GetAdminToken("default"))
+}
+
+func TestServerConfig_GetIPFilter(t *testing.T) {
+	cfg := &ServerConfig{DeniedSubnets: "10.0.0.0/8", TrustedProxies: "127.0.0.1", IPFilterFile: "ipfilter.json", IPFilterReload: "30"}
+	assert.Equal(t, "10.0.0.0/8", cfg.GetDeniedSubnets(""))
+	assert.Equal(t, "127.0.0.1", cfg.GetTrustedProxies(""))
+	assert.Equal(t, "ipfilter.json", cfg.GetIPFilterFile(""))
+	assert.Equal(t, 30, cfg.GetIPFilterReload(60))
+
+	empty := &ServerConfig{}
+	assert.Equal(t, "default", empty.GetDeniedSubnets("default"))
+	assert.Equal(t, "default", empty.GetTrustedProxies("default"))
+	assert.Equal(t, "default", empty.GetIPFilterFile("default"))
+	assert.Equal(t, 60, empty.GetIPFilterReload(60))
+}
+
+func TestServerConfig_GetLimits(t *testing.T) {
+	cfg := &ServerConfig{ClientRateLimit: "50", ClientRateBurst: "100", MaxBodySize: "1048576", MaxBatchSize: "500"}
+	assert.Equal(t, 50, cfg.GetClientRateLimit(0))
+	assert.Equal(t, 100, cfg.GetClientRateBurst(0))
+	assert.Equal(t, int64(1048576), cfg.GetMaxBodySize(10))
+	assert.Equal(t, 500, cfg.GetMaxBatchSize(10))
+
+	empty := &ServerConfig{}
+	assert.Equal(t, 0, empty.GetClientRateLimit(0))
+	assert.Equal(t, 0, empty.GetClientRateBurst(0))
+	assert.Equal(t, int64(10), empty.GetMaxBodySize(10))
+	assert.Equal(t, 10, empty.GetMaxBatchSize(10))
+}
+
+func TestServerConfig_GetRetention(t *testing.T) {
+	cfg := &ServerConfig{RetentionRules: []string{"* raw=24h 1m=30d"}, RetentionRulesFile: "retention.txt", RetentionInterval: "30"}
+	assert.Equal(t, []string{"* raw=24h 1m=30d"}, cfg.GetRetentionRules())
+	assert.Equal(t, "retention.txt", cfg.GetRetentionRulesFile(""))
+	assert.Equal(t, 30, cfg.GetRetentionInterval(60))
+
+	empty := &ServerConfig{}
+	assert.Nil(t, empty.GetRetentionRules())
+	assert.Equal(t, "default", empty.GetRetentionRulesFile("default"))
+	assert.Equal(t, 60, empty.GetRetentionInterval(60))
+}
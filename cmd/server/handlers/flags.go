@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"flag"
 
 	"github.com/caarlos0/env/v6"
 	serverConfig "github.com/ramil063/gometrics/cmd/server/config"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
 )
 
 // MainURL основной урл на которым поднят сервис
@@ -19,40 +21,170 @@ var FileStoragePath = "internal/storage/files/metrics.json"
 // Restore флаг восстановления данных с сохраненного файла
 var Restore = true
 
-// DatabaseDSN настройки подключения к БД
+// DatabaseDSN настройки подключения к БД, PostgreSQL DSN или sqlite://path
 var DatabaseDSN = ""
 
 // HashKey ключ для декодирования зашифрованных данных
 var HashKey = ""
 
-// CryptoKey путь до приватного ключа шифрования
+// CryptoKey путь до приватного ключа шифрования или каталога с приватными ключами (*.pem)
 var CryptoKey = ""
 
-// TrustedSubnet доверенная подсеть для пропуска на сервер
+// CryptoKeyGrace сколько секунд принимаются данные, зашифрованные ключом, удаленным из каталога
+var CryptoKeyGrace = 86400
+
+// CryptoKeyReload интервал перечитывания ключей шифрования в секундах
+var CryptoKeyReload = 60
+
+// ReplayWindow допустимое расхождение времени подписи запроса и времени сервера в секундах
+var ReplayWindow = 300
+
+// AgentRegistry путь до файла реестра агентов с отдельными ключами, пустой - все агенты используют HashKey
+var AgentRegistry = ""
+
+// AdminToken токен администратора для управления реестром агентов, пустой - администрирование выключено
+var AdminToken = ""
+
+// TrustedSubnet доверенные подсети IPv4 и IPv6 для пропуска на сервер через запятую, пустой - пропускаются все
 var TrustedSubnet = ""
 
+// DeniedSubnets запрещенные подсети через запятую, проверяются раньше доверенных
+var DeniedSubnets = ""
+
+// TrustedProxies подсети прокси через запятую, от которых учитываются заголовки X-Real-IP и X-Forwarded-For
+var TrustedProxies = ""
+
+// IPFilterFile путь до JSON файла с дополнительными списками подсетей, перечитывается без перезапуска
+var IPFilterFile = ""
+
+// IPFilterReload интервал перечитывания файла списков подсетей в секундах
+var IPFilterReload = 60
+
+// ClientRateLimit сколько запросов записи метрик в секунду принимается от одного агента или адреса, 0 - без ограничения
+var ClientRateLimit = 0
+
+// ClientRateBurst сколько запросов записи метрик можно прислать подряд, 0 - равно ClientRateLimit
+var ClientRateBurst = 0
+
+// MaxBodySize максимальный размер тела запроса в байтах, в том числе после распаковки gzip
+var MaxBodySize int64 = 10 << 20
+
+// MaxBatchSize максимальное количество метрик в одном запросе
+var MaxBatchSize = 10000
+
+// MetricsPrefix префикс имен метрик при выдаче в формате Prometheus
+var MetricsPrefix = ""
+
+// AlertRulesFile путь до файла с правилами алертинга
+var AlertRulesFile = ""
+
+// AlertWebhook адрес для отправки уведомлений алертинга
+var AlertWebhook = ""
+
+// AlertInterval интервал проверки правил алертинга в секундах
+var AlertInterval = 10
+
+// RetentionRulesFile путь до файла с политиками хранения истории
+var RetentionRulesFile = ""
+
+// RetentionInterval интервал прореживания и удаления устаревшей истории в секундах
+var RetentionInterval = 60
+
+// StatsdAddress адрес UDP для приема метрик StatsD, пустой отключает прием
+var StatsdAddress = ""
+
+// StatsdSocket путь до Unix сокета для приема метрик StatsD, пустой отключает прием
+var StatsdSocket = ""
+
+// StatsdFlushInterval интервал записи агрегированных метрик StatsD в секундах
+var StatsdFlushInterval = 10
+
+// TLSCert путь до сертификата сервера, пустой - сервер работает без TLS
+var TLSCert = ""
+
+// TLSKey путь до приватного ключа сертификата сервера
+var TLSKey = ""
+
+// TLSClientCA путь до CA сертификатов агентов, если задан - агент обязан предъявить сертификат
+var TLSClientCA = ""
+
+// AgentPolicy путь до файла с разрешенными для записи метриками по идентификатору агента
+var AgentPolicy = ""
+
 // EnvVars содержит переменные флагов
 type EnvVars struct {
-	Address         string `env:"ADDRESS"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	DatabaseDSN     string `env:"DATABASE_DSN"`
-	HashKey         string `env:"KEY"`
-	CryptoKey       string `env:"CRYPTO_KEY"`
-	TrustedSubnet   string `env:"TRUSTED_SUBNET"`
-	StoreInterval   int    `env:"STORE_INTERVAL"`
-	Restore         bool   `env:"RESTORE"`
+	Address            string `env:"ADDRESS"`
+	FileStoragePath    string `env:"FILE_STORAGE_PATH"`
+	DatabaseDSN        string `env:"DATABASE_DSN"`
+	HashKey            string `env:"KEY"`
+	CryptoKey          string `env:"CRYPTO_KEY"`
+	TrustedSubnet      string `env:"TRUSTED_SUBNET"`
+	DeniedSubnets      string `env:"DENIED_SUBNETS"`
+	TrustedProxies     string `env:"TRUSTED_PROXIES"`
+	IPFilterFile       string `env:"IP_FILTER_FILE"`
+	MetricsPrefix      string `env:"METRICS_PREFIX"`
+	AlertRulesFile     string `env:"ALERT_RULES_FILE"`
+	AlertWebhook       string `env:"ALERT_WEBHOOK"`
+	RetentionRulesFile string `env:"RETENTION_RULES_FILE"`
+	StatsdAddress      string `env:"STATSD_ADDRESS"`
+	StatsdSocket       string `env:"STATSD_SOCKET"`
+	TLSCert            string `env:"TLS_CERT"`
+	TLSKey             string `env:"TLS_KEY"`
+	TLSClientCA        string `env:"TLS_CLIENT_CA"`
+	AgentPolicy        string `env:"AGENT_POLICY"`
+	AgentRegistry      string `env:"AGENT_REGISTRY"`
+	AdminToken         string `env:"ADMIN_TOKEN"`
+	StoreInterval      int    `env:"STORE_INTERVAL"`
+	AlertInterval      int    `env:"ALERT_INTERVAL"`
+	RetentionInterval  int    `env:"RETENTION_INTERVAL"`
+	CryptoKeyGrace     int    `env:"CRYPTO_KEY_GRACE"`
+	CryptoKeyReload    int    `env:"CRYPTO_KEY_RELOAD"`
+	ReplayWindow       int    `env:"REPLAY_WINDOW"`
+	StatsdFlush        int    `env:"STATSD_FLUSH_INTERVAL"`
+	IPFilterReload     int    `env:"IP_FILTER_RELOAD"`
+	ClientRateLimit    int    `env:"CLIENT_RATE_LIMIT"`
+	ClientRateBurst    int    `env:"CLIENT_RATE_BURST"`
+	MaxBatchSize       int    `env:"MAX_BATCH_SIZE"`
+	MaxBodySize        int64  `env:"MAX_BODY_SIZE"`
+	Restore            bool   `env:"RESTORE"`
 }
 
 // InitFlags парсит глобальные переменные системы, или парсит флаги, или подменяет их значениями по умолчанию
 func InitFlags(config *serverConfig.ServerConfig) {
 	flag.StringVar(&MainURL, "a", config.GetAddress("localhost:8080"), "address and port to run server")
-	flag.StringVar(&DatabaseDSN, "d", config.GetDatabaseDSN(""), "database DSN")
+	flag.StringVar(&DatabaseDSN, "d", config.GetDatabaseDSN(""), "database DSN, postgres DSN or sqlite://path")
 	flag.IntVar(&StoreInterval, "i", config.GetStoreInterval(300), "interval of saving metrics to file")
 	flag.StringVar(&FileStoragePath, "f", config.GetFileStoragePath("internal/storage/files/metrics.json"), "file storage path")
 	flag.BoolVar(&Restore, "r", config.GetRestore(true), "file storage path")
 	flag.StringVar(&HashKey, "k", config.GetHashKey(""), "key for hash")
-	flag.StringVar(&CryptoKey, "crypto-key", config.GetCryptoKey(""), "key for encryption")
-	flag.StringVar(&TrustedSubnet, "t", config.GetTrustedSubnet(""), "allowed subnet")
+	flag.StringVar(&CryptoKey, "crypto-key", config.GetCryptoKey(""), "private key or directory of private keys for encryption")
+	flag.IntVar(&CryptoKeyGrace, "crypto-key-grace", config.GetCryptoKeyGrace(86400), "seconds to accept a key removed from the keys directory")
+	flag.IntVar(&CryptoKeyReload, "crypto-key-reload", config.GetCryptoKeyReload(60), "interval of encryption keys reload")
+	flag.IntVar(&ReplayWindow, "replay-window", config.GetReplayWindow(300), "seconds a signed request is accepted")
+	flag.StringVar(&AgentRegistry, "agent-registry", config.GetAgentRegistry(""), "file of registered agents with their own keys")
+	flag.StringVar(&AdminToken, "admin-token", config.GetAdminToken(""), "token for agent registry administration")
+	flag.StringVar(&TrustedSubnet, "t", config.GetTrustedSubnet(""), "comma separated allowed subnets")
+	flag.StringVar(&DeniedSubnets, "denied-subnets", config.GetDeniedSubnets(""), "comma separated denied subnets")
+	flag.StringVar(&TrustedProxies, "trusted-proxies", config.GetTrustedProxies(""), "comma separated subnets of proxies allowed to pass client ip")
+	flag.StringVar(&IPFilterFile, "ip-filter-file", config.GetIPFilterFile(""), "json file with additional subnet lists")
+	flag.IntVar(&IPFilterReload, "ip-filter-reload", config.GetIPFilterReload(60), "interval of subnet lists file reload")
+	flag.IntVar(&ClientRateLimit, "client-rate-limit", config.GetClientRateLimit(0), "requests per second accepted from one agent or address")
+	flag.IntVar(&ClientRateBurst, "client-rate-burst", config.GetClientRateBurst(0), "requests accepted in a burst from one agent or address")
+	flag.Int64Var(&MaxBodySize, "max-body-size", config.GetMaxBodySize(10<<20), "max request body size in bytes after decompression")
+	flag.IntVar(&MaxBatchSize, "max-batch-size", config.GetMaxBatchSize(10000), "max metrics in one request")
+	flag.StringVar(&MetricsPrefix, "metrics-prefix", config.GetMetricsPrefix(""), "prefix of metric names for prometheus")
+	flag.StringVar(&AlertRulesFile, "alert-rules", config.GetAlertRulesFile(""), "file with alerting rules")
+	flag.StringVar(&AlertWebhook, "alert-webhook", config.GetAlertWebhook(""), "webhook url for alert notifications")
+	flag.IntVar(&AlertInterval, "alert-interval", config.GetAlertInterval(10), "interval of alerting rules evaluation")
+	flag.StringVar(&RetentionRulesFile, "retention-rules", config.GetRetentionRulesFile(""), "file with history retention policies")
+	flag.IntVar(&RetentionInterval, "retention-interval", config.GetRetentionInterval(60), "interval of history downsampling and cleanup")
+	flag.StringVar(&StatsdAddress, "statsd-address", config.GetStatsdAddress(""), "udp address of statsd listener")
+	flag.StringVar(&StatsdSocket, "statsd-socket", config.GetStatsdSocket(""), "unix datagram socket of statsd listener")
+	flag.IntVar(&StatsdFlushInterval, "statsd-flush-interval", config.GetStatsdFlush(10), "interval of statsd metrics flush")
+	flag.StringVar(&TLSCert, "tls-cert", config.GetTLSCert(""), "server certificate for https")
+	flag.StringVar(&TLSKey, "tls-key", config.GetTLSKey(""), "server certificate private key for https")
+	flag.StringVar(&TLSClientCA, "tls-client-ca", config.GetTLSClientCA(""), "CA of agent certificates, enables client certificate verification")
+	flag.StringVar(&AgentPolicy, "agent-policy", config.GetAgentPolicy(""), "file with metrics allowed for each agent")
 	flag.Parse()
 
 	var ev EnvVars
@@ -86,10 +218,114 @@ func InitFlags(config *serverConfig.ServerConfig) {
 		CryptoKey = ev.CryptoKey
 	}
 
+	if ev.CryptoKeyGrace != 0 {
+		CryptoKeyGrace = ev.CryptoKeyGrace
+	}
+
+	if ev.CryptoKeyReload != 0 {
+		CryptoKeyReload = ev.CryptoKeyReload
+	}
+
+	if ev.ReplayWindow != 0 {
+		ReplayWindow = ev.ReplayWindow
+	}
+
+	if ev.AgentRegistry != "" {
+		AgentRegistry = ev.AgentRegistry
+	}
+
+	if ev.AdminToken != "" {
+		AdminToken = ev.AdminToken
+	}
+
 	if ev.TrustedSubnet != "" {
 		TrustedSubnet = ev.TrustedSubnet
 	}
 
+	if ev.DeniedSubnets != "" {
+		DeniedSubnets = ev.DeniedSubnets
+	}
+
+	if ev.TrustedProxies != "" {
+		TrustedProxies = ev.TrustedProxies
+	}
+
+	if ev.IPFilterFile != "" {
+		IPFilterFile = ev.IPFilterFile
+	}
+
+	if ev.IPFilterReload != 0 {
+		IPFilterReload = ev.IPFilterReload
+	}
+
+	if ev.ClientRateLimit != 0 {
+		ClientRateLimit = ev.ClientRateLimit
+	}
+
+	if ev.ClientRateBurst != 0 {
+		ClientRateBurst = ev.ClientRateBurst
+	}
+
+	if ev.MaxBodySize != 0 {
+		MaxBodySize = ev.MaxBodySize
+	}
+
+	if ev.MaxBatchSize != 0 {
+		MaxBatchSize = ev.MaxBatchSize
+	}
+
+	if ev.MetricsPrefix != "" {
+		MetricsPrefix = ev.MetricsPrefix
+	}
+
+	if ev.AlertRulesFile != "" {
+		AlertRulesFile = ev.AlertRulesFile
+	}
+
+	if ev.AlertWebhook != "" {
+		AlertWebhook = ev.AlertWebhook
+	}
+
+	if ev.AlertInterval != 0 {
+		AlertInterval = ev.AlertInterval
+	}
+
+	if ev.RetentionRulesFile != "" {
+		RetentionRulesFile = ev.RetentionRulesFile
+	}
+
+	if ev.RetentionInterval != 0 {
+		RetentionInterval = ev.RetentionInterval
+	}
+
+	if ev.StatsdAddress != "" {
+		StatsdAddress = ev.StatsdAddress
+	}
+
+	if ev.StatsdSocket != "" {
+		StatsdSocket = ev.StatsdSocket
+	}
+
+	if ev.StatsdFlush != 0 {
+		StatsdFlushInterval = ev.StatsdFlush
+	}
+
+	if ev.TLSCert != "" {
+		TLSCert = ev.TLSCert
+	}
+
+	if ev.TLSKey != "" {
+		TLSKey = ev.TLSKey
+	}
+
+	if ev.TLSClientCA != "" {
+		TLSClientCA = ev.TLSClientCA
+	}
+
+	if ev.AgentPolicy != "" {
+		AgentPolicy = ev.AgentPolicy
+	}
+
 	//only for autotests
 	//logger.WriteInfoLog("set g.var", "Address:"+MainURL)
 	//logger.WriteInfoLog("set g.var", "StoreInterval:"+strconv.Itoa(StoreInterval))
@@ -98,3 +334,35 @@ func InitFlags(config *serverConfig.ServerConfig) {
 	//logger.WriteInfoLog("set g.var", "DatabaseDSN:"+DatabaseDSN)
 	//logger.WriteInfoLog("set g.var", "HashKey:"+HashKey)
 }
+
+// ValidateFlags проверка значений флагов, которые нельзя заменить значениями по умолчанию
+func ValidateFlags() error {
+	if AlertInterval <= 0 {
+		return errors.New("alert interval must be positive")
+	}
+	if CryptoKeyReload <= 0 {
+		return errors.New("crypto key reload interval must be positive")
+	}
+	if IPFilterReload <= 0 {
+		return errors.New("ip filter reload interval must be positive")
+	}
+	if RetentionInterval <= 0 {
+		return errors.New("retention interval must be positive")
+	}
+	if StatsdFlushInterval <= 0 {
+		return errors.New("statsd flush interval must be positive")
+	}
+	if ReplayWindow <= 0 {
+		return errors.New("replay window must be positive")
+	}
+	return nil
+}
+
+// IPFilterConfig списки подсетей фильтра адресов клиентов из флагов
+func IPFilterConfig() ipfilter.Config {
+	return ipfilter.Config{
+		Allow:          ipfilter.SplitList(TrustedSubnet),
+		Deny:           ipfilter.SplitList(DeniedSubnets),
+		TrustedProxies: ipfilter.SplitList(TrustedProxies),
+	}
+}
@@ -70,3 +70,76 @@ func TestParseFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestIPFilterConfig(t *testing.T) {
+	oldTrusted, oldDenied, oldProxies := TrustedSubnet, DeniedSubnets, TrustedProxies
+	defer func() {
+		TrustedSubnet, DeniedSubnets, TrustedProxies = oldTrusted, oldDenied, oldProxies
+	}()
+
+	TrustedSubnet = "192.168.1.0/24, 2001:db8::/32"
+	DeniedSubnets = "192.168.1.100"
+	TrustedProxies = ""
+
+	cfg := IPFilterConfig()
+	assert.Equal(t, []string{"192.168.1.0/24", "2001:db8::/32"}, cfg.Allow)
+	assert.Equal(t, []string{"192.168.1.100"}, cfg.Deny)
+	assert.Empty(t, cfg.TrustedProxies)
+}
+
+func TestValidateFlags(t *testing.T) {
+	oldAlertInterval := AlertInterval
+	oldCryptoKeyReload := CryptoKeyReload
+	oldIPFilterReload := IPFilterReload
+	oldRetentionInterval := RetentionInterval
+	oldStatsdFlushInterval := StatsdFlushInterval
+	oldReplayWindow := ReplayWindow
+	defer func() {
+		AlertInterval = oldAlertInterval
+		CryptoKeyReload = oldCryptoKeyReload
+		IPFilterReload = oldIPFilterReload
+		RetentionInterval = oldRetentionInterval
+		StatsdFlushInterval = oldStatsdFlushInterval
+		ReplayWindow = oldReplayWindow
+	}()
+
+	tests := []struct {
+		name              string
+		alertInterval     int
+		cryptoKeyReload   int
+		ipFilterReload    int
+		retentionInterval int
+		statsdFlush       int
+		replayWindow      int
+		wantErr           bool
+	}{
+		{name: "valid", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: 300},
+		{name: "zero alert interval", alertInterval: 0, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "negative alert interval", alertInterval: -1, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "zero crypto key reload", alertInterval: 10, cryptoKeyReload: 0, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "zero ip filter reload", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 0, retentionInterval: 60, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "negative ip filter reload", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: -1, retentionInterval: 60, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "zero retention interval", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 0, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "negative retention interval", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: -1, statsdFlush: 10, replayWindow: 300, wantErr: true},
+		{name: "zero statsd flush interval", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 0, replayWindow: 300, wantErr: true},
+		{name: "negative statsd flush interval", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: -1, replayWindow: 300, wantErr: true},
+		{name: "zero replay window", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: 0, wantErr: true},
+		{name: "negative replay window", alertInterval: 10, cryptoKeyReload: 60, ipFilterReload: 60, retentionInterval: 60, statsdFlush: 10, replayWindow: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AlertInterval = tt.alertInterval
+			CryptoKeyReload = tt.cryptoKeyReload
+			IPFilterReload = tt.ipFilterReload
+			RetentionInterval = tt.retentionInterval
+			StatsdFlushInterval = tt.statsdFlush
+			ReplayWindow = tt.replayWindow
+			err := ValidateFlags()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
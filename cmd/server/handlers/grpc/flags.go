@@ -1,12 +1,14 @@
 package grpc
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 
 	"github.com/caarlos0/env/v6"
 
 	serverConfig "github.com/ramil063/gometrics/cmd/server/config"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
 )
 
 // ServerConfigFlags содержит переменные флагов
@@ -16,8 +18,22 @@ import (
 // Restore флаг восстановления данных с сохраненного файла
 // DatabaseDSN настройки подключения к БД
 // HashKey ключ для декодирования зашифрованных данных
-// CryptoKey путь до приватного ключа шифрования
-// TrustedSubnet доверенная подсеть для пропуска на сервер
+// CryptoKey путь до приватного ключа шифрования или каталога с приватными ключами (*.pem)
+// CryptoKeyGrace сколько секунд принимаются данные, зашифрованные ключом, удаленным из каталога
+// CryptoKeyReload интервал перечитывания ключей шифрования в секундах
+// TrustedSubnet доверенные подсети IPv4 и IPv6 для пропуска на сервер через запятую
+// DeniedSubnets запрещенные подсети через запятую, проверяются раньше доверенных
+// TrustedProxies подсети прокси через запятую, от которых учитываются метаданные x-real-ip и x-forwarded-for
+// IPFilterFile путь до JSON файла с дополнительными списками подсетей
+// IPFilterReload интервал перечитывания файла списков подсетей в секундах
+// ClientRateLimit сколько запросов в секунду принимается от одного агента или адреса, 0 - без ограничения
+// ClientRateBurst сколько запросов можно прислать подряд, 0 - равно ClientRateLimit
+// MaxBodySize максимальный размер сообщения в байтах после распаковки
+// MaxBatchSize максимальное количество метрик в одном сообщении
+// TLSCert путь до сертификата сервера, пустой - сервер работает без TLS
+// TLSKey путь до приватного ключа сертификата сервера
+// TLSClientCA путь до CA сертификатов агентов, если задан - агент обязан предъявить сертификат
+// AgentPolicy путь до файла с разрешенными для записи метриками по идентификатору агента
 type ServerConfigFlags struct {
 	Address         string `env:"GRPC_ADDRESS"`
 	FileStoragePath string `env:"GRPC_FILE_STORAGE_PATH"`
@@ -25,7 +41,21 @@ type ServerConfigFlags struct {
 	HashKey         string `env:"GRPC_KEY"`
 	CryptoKey       string `env:"GRPC_CRYPTO_KEY"`
 	TrustedSubnet   string `env:"GRPC_TRUSTED_SUBNET"`
+	DeniedSubnets   string `env:"GRPC_DENIED_SUBNETS"`
+	TrustedProxies  string `env:"GRPC_TRUSTED_PROXIES"`
+	IPFilterFile    string `env:"GRPC_IP_FILTER_FILE"`
+	TLSCert         string `env:"GRPC_TLS_CERT"`
+	TLSKey          string `env:"GRPC_TLS_KEY"`
+	TLSClientCA     string `env:"GRPC_TLS_CLIENT_CA"`
+	AgentPolicy     string `env:"GRPC_AGENT_POLICY"`
 	StoreInterval   int    `env:"GRPC_STORE_INTERVAL"`
+	CryptoKeyGrace  int    `env:"GRPC_CRYPTO_KEY_GRACE"`
+	CryptoKeyReload int    `env:"GRPC_CRYPTO_KEY_RELOAD"`
+	IPFilterReload  int    `env:"GRPC_IP_FILTER_RELOAD"`
+	ClientRateLimit int    `env:"GRPC_CLIENT_RATE_LIMIT"`
+	ClientRateBurst int    `env:"GRPC_CLIENT_RATE_BURST"`
+	MaxBatchSize    int    `env:"GRPC_MAX_BATCH_SIZE"`
+	MaxBodySize     int64  `env:"GRPC_MAX_BODY_SIZE"`
 	Restore         bool   `env:"GRPC_RESTORE"`
 }
 
@@ -36,6 +66,11 @@ func GetFlags(config *serverConfig.ServerConfig) (*ServerConfigFlags, error) {
 		Address:         "localhost:3202",
 		FileStoragePath: "internal/storage/files/grpc/metrics.json",
 		StoreInterval:   300,
+		CryptoKeyGrace:  86400,
+		CryptoKeyReload: 60,
+		IPFilterReload:  60,
+		MaxBodySize:     10 << 20,
+		MaxBatchSize:    10000,
 	}
 
 	var (
@@ -47,16 +82,48 @@ func GetFlags(config *serverConfig.ServerConfig) (*ServerConfigFlags, error) {
 		trustedSubnet   string
 		storeInterval   int
 		restore         bool
+
+		tlsCert     string
+		tlsKey      string
+		tlsClientCA string
+		agentPolicy string
+
+		cryptoKeyGrace  int
+		cryptoKeyReload int
+
+		deniedSubnets  string
+		trustedProxies string
+		ipFilterFile   string
+		ipFilterReload int
+
+		clientRateLimit int
+		clientRateBurst int
+		maxBodySize     int64
+		maxBatchSize    int
 	)
 
 	flag.StringVar(&address, "grpc-a", config.GetAddress(flags.Address), "address and port to run server")
 	flag.StringVar(&fileStoragePath, "grpc-f", config.GetFileStoragePath(flags.FileStoragePath), "file storage path")
-	flag.StringVar(&databaseDSN, "grpc-d", config.GetDatabaseDSN(flags.DatabaseDSN), "database DSN")
+	flag.StringVar(&databaseDSN, "grpc-d", config.GetDatabaseDSN(flags.DatabaseDSN), "database DSN, postgres DSN or sqlite://path")
 	flag.StringVar(&hashKey, "grpc-k", config.GetHashKey(flags.HashKey), "key for hash")
-	flag.StringVar(&cryptoKey, "grpc-crypto-key", config.GetCryptoKey(flags.CryptoKey), "key for encryption")
-	flag.StringVar(&trustedSubnet, "grpc-t", config.GetTrustedSubnet(flags.TrustedSubnet), "allowed subnet")
+	flag.StringVar(&cryptoKey, "grpc-crypto-key", config.GetCryptoKey(flags.CryptoKey), "private key or directory of private keys for encryption")
+	flag.IntVar(&cryptoKeyGrace, "grpc-crypto-key-grace", config.GetCryptoKeyGrace(flags.CryptoKeyGrace), "seconds to accept a key removed from the keys directory")
+	flag.IntVar(&cryptoKeyReload, "grpc-crypto-key-reload", config.GetCryptoKeyReload(flags.CryptoKeyReload), "interval of encryption keys reload")
+	flag.StringVar(&trustedSubnet, "grpc-t", config.GetTrustedSubnet(flags.TrustedSubnet), "comma separated allowed subnets")
+	flag.StringVar(&deniedSubnets, "grpc-denied-subnets", config.GetDeniedSubnets(flags.DeniedSubnets), "comma separated denied subnets")
+	flag.StringVar(&trustedProxies, "grpc-trusted-proxies", config.GetTrustedProxies(flags.TrustedProxies), "comma separated subnets of proxies allowed to pass client ip")
+	flag.StringVar(&ipFilterFile, "grpc-ip-filter-file", config.GetIPFilterFile(flags.IPFilterFile), "json file with additional subnet lists")
+	flag.IntVar(&ipFilterReload, "grpc-ip-filter-reload", config.GetIPFilterReload(flags.IPFilterReload), "interval of subnet lists file reload")
+	flag.IntVar(&clientRateLimit, "grpc-client-rate-limit", config.GetClientRateLimit(flags.ClientRateLimit), "requests per second accepted from one agent or address")
+	flag.IntVar(&clientRateBurst, "grpc-client-rate-burst", config.GetClientRateBurst(flags.ClientRateBurst), "requests accepted in a burst from one agent or address")
+	flag.Int64Var(&maxBodySize, "grpc-max-body-size", config.GetMaxBodySize(flags.MaxBodySize), "max message size in bytes after decompression")
+	flag.IntVar(&maxBatchSize, "grpc-max-batch-size", config.GetMaxBatchSize(flags.MaxBatchSize), "max metrics in one message")
 	flag.IntVar(&storeInterval, "grpc-i", config.GetStoreInterval(flags.StoreInterval), "interval of saving metrics to file")
 	flag.BoolVar(&restore, "grpc-r", config.GetRestore(flags.Restore), "restore from file")
+	flag.StringVar(&tlsCert, "grpc-tls-cert", config.GetTLSCert(flags.TLSCert), "server certificate for tls")
+	flag.StringVar(&tlsKey, "grpc-tls-key", config.GetTLSKey(flags.TLSKey), "server certificate private key for tls")
+	flag.StringVar(&tlsClientCA, "grpc-tls-client-ca", config.GetTLSClientCA(flags.TLSClientCA), "CA of agent certificates, enables client certificate verification")
+	flag.StringVar(&agentPolicy, "grpc-agent-policy", config.GetAgentPolicy(flags.AgentPolicy), "file with metrics allowed for each agent")
 	flag.Parse()
 
 	var envVars ServerConfigFlags
@@ -66,9 +133,24 @@ func GetFlags(config *serverConfig.ServerConfig) (*ServerConfigFlags, error) {
 	}
 
 	applyFlags(flags, address, fileStoragePath, databaseDSN, hashKey, cryptoKey, trustedSubnet, storeInterval, restore)
+	applyTLSFlags(flags, tlsCert, tlsKey, tlsClientCA, agentPolicy)
+	applyKeyRotationFlags(flags, cryptoKeyGrace, cryptoKeyReload)
+	applyIPFilterFlags(flags, deniedSubnets, trustedProxies, ipFilterFile, ipFilterReload)
+	applyLimitFlags(flags, clientRateLimit, clientRateBurst, maxBodySize, maxBatchSize)
 	applyEnvVars(flags, envVars)
 
-	return flags, nil
+	return flags, validateFlags(flags)
+}
+
+// validateFlags проверка значений флагов, которые нельзя заменить значениями по умолчанию
+func validateFlags(flags *ServerConfigFlags) error {
+	if flags.CryptoKeyReload <= 0 {
+		return errors.New("grpc crypto key reload interval must be positive")
+	}
+	if flags.IPFilterReload <= 0 {
+		return errors.New("grpc ip filter reload interval must be positive")
+	}
+	return nil
 }
 
 // applyFlags присваивание флагов переданных в командной строке
@@ -110,6 +192,64 @@ func applyFlags(
 	}
 }
 
+// applyTLSFlags присваивание флагов TLS и политики доступа агентов
+func applyTLSFlags(flags *ServerConfigFlags, cert, key, clientCA, agentPolicy string) {
+	if cert != "" {
+		flags.TLSCert = cert
+	}
+	if key != "" {
+		flags.TLSKey = key
+	}
+	if clientCA != "" {
+		flags.TLSClientCA = clientCA
+	}
+	if agentPolicy != "" {
+		flags.AgentPolicy = agentPolicy
+	}
+}
+
+// applyKeyRotationFlags присваивание флагов смены ключей шифрования
+func applyKeyRotationFlags(flags *ServerConfigFlags, grace, reload int) {
+	if grace > 0 {
+		flags.CryptoKeyGrace = grace
+	}
+	if reload > 0 {
+		flags.CryptoKeyReload = reload
+	}
+}
+
+// applyIPFilterFlags присваивание флагов фильтра адресов клиентов
+func applyIPFilterFlags(flags *ServerConfigFlags, deniedSubnets, trustedProxies, ipFilterFile string, ipFilterReload int) {
+	if deniedSubnets != "" {
+		flags.DeniedSubnets = deniedSubnets
+	}
+	if trustedProxies != "" {
+		flags.TrustedProxies = trustedProxies
+	}
+	if ipFilterFile != "" {
+		flags.IPFilterFile = ipFilterFile
+	}
+	if ipFilterReload > 0 {
+		flags.IPFilterReload = ipFilterReload
+	}
+}
+
+// applyLimitFlags присваивание флагов ограничений запросов клиентов
+func applyLimitFlags(flags *ServerConfigFlags, clientRateLimit, clientRateBurst int, maxBodySize int64, maxBatchSize int) {
+	if clientRateLimit > 0 {
+		flags.ClientRateLimit = clientRateLimit
+	}
+	if clientRateBurst > 0 {
+		flags.ClientRateBurst = clientRateBurst
+	}
+	if maxBodySize > 0 {
+		flags.MaxBodySize = maxBodySize
+	}
+	if maxBatchSize > 0 {
+		flags.MaxBatchSize = maxBatchSize
+	}
+}
+
 // applyEnvVars присваивание переменных окружения
 func applyEnvVars(flags *ServerConfigFlags, envVars ServerConfigFlags) {
 	if envVars.Address != "" {
@@ -130,6 +270,48 @@ func applyEnvVars(flags *ServerConfigFlags, envVars ServerConfigFlags) {
 	if envVars.TrustedSubnet != "" {
 		flags.TrustedSubnet = envVars.TrustedSubnet
 	}
+	if envVars.DeniedSubnets != "" {
+		flags.DeniedSubnets = envVars.DeniedSubnets
+	}
+	if envVars.TrustedProxies != "" {
+		flags.TrustedProxies = envVars.TrustedProxies
+	}
+	if envVars.IPFilterFile != "" {
+		flags.IPFilterFile = envVars.IPFilterFile
+	}
+	if envVars.IPFilterReload != 0 {
+		flags.IPFilterReload = envVars.IPFilterReload
+	}
+	if envVars.ClientRateLimit != 0 {
+		flags.ClientRateLimit = envVars.ClientRateLimit
+	}
+	if envVars.ClientRateBurst != 0 {
+		flags.ClientRateBurst = envVars.ClientRateBurst
+	}
+	if envVars.MaxBodySize != 0 {
+		flags.MaxBodySize = envVars.MaxBodySize
+	}
+	if envVars.MaxBatchSize != 0 {
+		flags.MaxBatchSize = envVars.MaxBatchSize
+	}
+	if envVars.TLSCert != "" {
+		flags.TLSCert = envVars.TLSCert
+	}
+	if envVars.TLSKey != "" {
+		flags.TLSKey = envVars.TLSKey
+	}
+	if envVars.TLSClientCA != "" {
+		flags.TLSClientCA = envVars.TLSClientCA
+	}
+	if envVars.AgentPolicy != "" {
+		flags.AgentPolicy = envVars.AgentPolicy
+	}
+	if envVars.CryptoKeyGrace != 0 {
+		flags.CryptoKeyGrace = envVars.CryptoKeyGrace
+	}
+	if envVars.CryptoKeyReload != 0 {
+		flags.CryptoKeyReload = envVars.CryptoKeyReload
+	}
 	if envVars.StoreInterval != 0 {
 		flags.StoreInterval = envVars.StoreInterval
 	}
@@ -137,3 +319,12 @@ func applyEnvVars(flags *ServerConfigFlags, envVars ServerConfigFlags) {
 		flags.Restore = envVars.Restore
 	}
 }
+
+// IPFilterConfig списки подсетей фильтра адресов клиентов из флагов
+func (flags *ServerConfigFlags) IPFilterConfig() ipfilter.Config {
+	return ipfilter.Config{
+		Allow:          ipfilter.SplitList(flags.TrustedSubnet),
+		Deny:           ipfilter.SplitList(flags.DeniedSubnets),
+		TrustedProxies: ipfilter.SplitList(flags.TrustedProxies),
+	}
+}
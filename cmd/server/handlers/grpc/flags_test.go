@@ -0,0 +1,31 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   ServerConfigFlags
+		wantErr bool
+	}{
+		{name: "valid", flags: ServerConfigFlags{CryptoKeyReload: 60, IPFilterReload: 60}},
+		{name: "zero crypto key reload", flags: ServerConfigFlags{CryptoKeyReload: 0, IPFilterReload: 60}, wantErr: true},
+		{name: "negative crypto key reload", flags: ServerConfigFlags{CryptoKeyReload: -1, IPFilterReload: 60}, wantErr: true},
+		{name: "zero ip filter reload", flags: ServerConfigFlags{CryptoKeyReload: 60, IPFilterReload: 0}, wantErr: true},
+		{name: "negative ip filter reload", flags: ServerConfigFlags{CryptoKeyReload: 60, IPFilterReload: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFlags(&tt.flags)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
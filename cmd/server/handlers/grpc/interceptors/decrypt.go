@@ -5,6 +5,7 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
@@ -22,22 +23,104 @@ func NewDecryptUnaryInterceptor(manager *crypto.Manager) grpc.UnaryServerInterce
 			return handler(ctx, req)
 		}
 
-		request := req.(*pb.ListMetricsRequest)
-		// Дешифруем данные
-		decryptedData, err := decryptor.Decrypt(request.GetCryptoMetrics())
+		// Зашифрованы только пачки метрик на запись
+		request, ok := req.(*pb.ListMetricsRequest)
+		if !ok {
+			return handler(ctx, req)
+		}
+		originalReq, err := decryptRequest(decryptor, schemeFromContext(ctx), keyIDFromContext(ctx), request)
 		if err != nil {
-			logger.WriteErrorLog(err.Error(), "Decryption failed")
-			return nil, status.Errorf(codes.InvalidArgument, "decryption failed")
+			return nil, err
 		}
 
-		// Десериализуем оригинальный запрос
-		var originalReq pb.ListMetricsRequest
-		if err = proto.Unmarshal(decryptedData, &originalReq); err != nil {
-			logger.WriteErrorLog(err.Error(), "Failed to unmarshal decrypted data")
-			return nil, status.Errorf(codes.InvalidArgument, "invalid request format")
+		// Вызываем обработчик с дешифрованным запросом
+		return handler(ctx, originalReq)
+	}
+}
+
+// NewDecryptStreamInterceptor расшифровывает каждое сообщение входящего потока
+func NewDecryptStreamInterceptor(manager *crypto.Manager) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		// Если дешифратор не настроен, пропускаем
+		decryptor := manager.GetGRPCDecryptor()
+		if decryptor == nil {
+			return handler(srv, ss)
 		}
 
-		// Вызываем обработчик с дешифрованным запросом
-		return handler(ctx, &originalReq)
+		return handler(srv, &decryptServerStream{
+			ServerStream: ss,
+			decryptor:    decryptor,
+			scheme:       schemeFromContext(ss.Context()),
+			keyID:        keyIDFromContext(ss.Context()),
+		})
+	}
+}
+
+// decryptServerStream поток, расшифровывающий входящие пачки метрик
+type decryptServerStream struct {
+	grpc.ServerStream
+	decryptor crypto.Decryptor
+	scheme    string
+	keyID     string
+}
+
+// RecvMsg читает сообщение из потока и подменяет его расшифрованным
+func (s *decryptServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	request, ok := m.(*pb.ListMetricsRequest)
+	if !ok {
+		return nil
+	}
+	originalReq, err := decryptRequest(s.decryptor, s.scheme, s.keyID, request)
+	if err != nil {
+		return err
+	}
+	hashSHA256 := request.GetHashsha256()
+	proto.Reset(request)
+	proto.Merge(request, originalReq)
+	if request.GetHashsha256() == "" {
+		request.Hashsha256 = hashSHA256
+	}
+	return nil
+}
+
+// schemeFromContext получает схему шифрования из метаданных
+func schemeFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(crypto.SchemeMetadataKey)) > 0 {
+		return md.Get(crypto.SchemeMetadataKey)[0]
+	}
+	return ""
+}
+
+// keyIDFromContext получает идентификатор ключа шифрования из метаданных
+func keyIDFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(crypto.KeyIDMetadataKey)) > 0 {
+		return md.Get(crypto.KeyIDMetadataKey)[0]
+	}
+	return ""
+}
+
+// decryptRequest дешифрует пачку метрик и восстанавливает оригинальный запрос,
+// идентификатор ключа из сообщения важнее метаданных, так как в потоке ключ может смениться
+func decryptRequest(decryptor crypto.Decryptor, scheme string, keyID string, request *pb.ListMetricsRequest) (*pb.ListMetricsRequest, error) {
+	if request.GetKeyId() != "" {
+		keyID = request.GetKeyId()
+	}
+	// Дешифруем данные
+	decryptedData, err := crypto.DecryptWithKey(decryptor, keyID, scheme, request.GetCryptoMetrics())
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Decryption failed")
+		return nil, status.Errorf(codes.InvalidArgument, "decryption failed")
+	}
+
+	// Десериализуем оригинальный запрос
+	var originalReq pb.ListMetricsRequest
+	if err = proto.Unmarshal(decryptedData, &originalReq); err != nil {
+		logger.WriteErrorLog(err.Error(), "Failed to unmarshal decrypted data")
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request format")
 	}
+	return &originalReq, nil
 }
@@ -2,16 +2,27 @@ package interceptors
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/crypto/envelope"
+	cryptoRSA "github.com/ramil063/gometrics/internal/security/crypto/rsa"
 )
 
 // mockDecryptor для тестирования
@@ -105,6 +116,18 @@ func TestDecryptUnaryInterceptor(t *testing.T) {
 			wantErr:     true,
 			wantErrCode: codes.InvalidArgument,
 		},
+		{
+			name: "read request is not decrypted",
+			decryptor: &mockDecryptor{
+				decryptFunc: func(data []byte) ([]byte, error) {
+					return nil, assert.AnError
+				},
+			},
+			req:           &pb.GetMetricRequest{Id: "cpu"},
+			handlerResp:   &pb.Metric{Id: "cpu"},
+			wantErr:       false,
+			checkResponse: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -143,3 +166,113 @@ func TestDecryptUnaryInterceptor(t *testing.T) {
 		})
 	}
 }
+
+func TestDecryptUnaryInterceptor_Schemes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	testMetrics := &pb.ListMetricsRequest{
+		Metrics: []*pb.Metric{
+			{Id: "cpu", Value: 42.5},
+		},
+	}
+	plaintext, err := proto.Marshal(testMetrics)
+	require.NoError(t, err)
+
+	envelopeData, err := envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+	legacyData, err := cryptoRSA.RsaEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	manager := crypto.NewCryptoManager()
+	manager.SetGRPCDecryptor(crypto.NewNegotiatingDecryptorWithKey(key))
+	interceptor := NewDecryptUnaryInterceptor(manager)
+
+	tests := []struct {
+		name    string
+		scheme  string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "envelope with scheme metadata", scheme: crypto.SchemeEnvelope, data: envelopeData},
+		{name: "envelope without metadata", data: envelopeData},
+		{name: "legacy without metadata", data: legacyData},
+		{name: "unknown scheme", scheme: "rot13", data: envelopeData, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.scheme != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(crypto.SchemeMetadataKey, tt.scheme))
+			}
+
+			var got *pb.ListMetricsRequest
+			_, err := interceptor(ctx, &pb.ListMetricsRequest{CryptoMetrics: tt.data}, nil,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					got = req.(*pb.ListMetricsRequest)
+					return nil, nil
+				})
+			if tt.wantErr {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(testMetrics, got))
+		})
+	}
+}
+
+func TestDecryptUnaryInterceptor_KeyID(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+	keyRing, err := crypto.NewKeyRing(keyFile, time.Hour)
+	require.NoError(t, err)
+	keyID, err := crypto.KeyID(&key.PublicKey)
+	require.NoError(t, err)
+
+	testMetrics := &pb.ListMetricsRequest{Metrics: []*pb.Metric{{Id: "cpu", Value: 42.5}}}
+	plaintext, err := proto.Marshal(testMetrics)
+	require.NoError(t, err)
+	encrypted, err := envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	manager := crypto.NewCryptoManager()
+	manager.SetGRPCDecryptor(keyRing)
+	interceptor := NewDecryptUnaryInterceptor(manager)
+
+	tests := []struct {
+		name          string
+		messageKeyID  string
+		metadataKeyID string
+		wantErr       bool
+	}{
+		{name: "key id in message", messageKeyID: keyID},
+		{name: "key id in metadata", metadataKeyID: keyID},
+		{name: "message overrides metadata", messageKeyID: keyID, metadataKeyID: "0000000000000000"},
+		{name: "unknown key id", messageKeyID: "0000000000000000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.metadataKeyID != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(crypto.KeyIDMetadataKey, tt.metadataKeyID))
+			}
+
+			var got *pb.ListMetricsRequest
+			_, err := interceptor(ctx, &pb.ListMetricsRequest{CryptoMetrics: encrypted, KeyId: tt.messageKeyID}, nil,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					got = req.(*pb.ListMetricsRequest)
+					return nil, nil
+				})
+			if tt.wantErr {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(testMetrics, got))
+		})
+	}
+}
@@ -2,21 +2,30 @@ package interceptors
 
 import (
 	"context"
+	"crypto/hmac"
+	"errors"
+	"strconv"
 	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers"
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/hash"
+	"github.com/ramil063/gometrics/internal/security/agents"
 )
 
-// HashCheckUnaryInterceptor проверяет хеш входящих данных и добавляет хеш к исходящим
+// HashCheckUnaryInterceptor проверяет хеш входящих данных и добавляет хеш к исходящим,
+// хеш покрывает время и одноразовое значение из метаданных, устаревшие и повторные запросы отклоняются.
+// При заданном реестре агентов данные подписываются ключом агента из метаданных x-agent-id
+// или запрос подтверждается API токеном агента
 func HashCheckUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	// Если хеш-ключ не установлен, пропускаем проверку
-	if handlers.HashKey == "" {
+	// Если хеш-ключ и реестр агентов не установлены, пропускаем проверку
+	if !agents.Enabled(agents.DefaultRegistry, handlers.HashKey) {
 		return handler(ctx, req)
 	}
 	// Получаем метаданные из контекста
@@ -26,31 +35,48 @@ func HashCheckUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.
 		return nil, status.Error(codes.InvalidArgument, "grpc: metadata is required")
 	}
 
+	ctx, key, err := authenticateAgent(ctx, md)
+	if err != nil {
+		return nil, err
+	}
+
 	// 1. Проверка входящего хеша
-	if reqBytes, ok := req.([]byte); ok {
+	if reqBytes, ok, err := signedPayload(req); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to marshal metrics: %v", err)
+	} else if ok {
+		timestamp := getFirstValue(md, hash.TimestampMetadataKey)
+		nonce := getFirstValue(md, hash.NonceMetadataKey)
+		// агент подтвердил себя токеном, подпись не нужна, но повтор запроса отклоняется
+		if key == "" {
+			if err = checkReplay(timestamp, nonce); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+
 		// Получаем хеш из заголовков
 		headerHashSHA256 := getFirstValue(md, "hashsha256")
 		if headerHashSHA256 == "" {
 			return nil, status.Error(codes.InvalidArgument, "grpc: hash is empty")
 		}
 
-		// Вычисляем хеш тела запроса
-		bodyHashSHA256 := hash.CreateSha256(reqBytes, handlers.HashKey)
-		if headerHashSHA256 != bodyHashSHA256 {
-			return nil, status.Error(codes.InvalidArgument, "grpc: hash isn't correct")
+		// Вычисляем подпись тела запроса вместе со временем и одноразовым значением
+		bodyHashSHA256 := hash.CreateSignedSha256(reqBytes, key, timestamp, nonce)
+		if err = checkSignature(headerHashSHA256, bodyHashSHA256, timestamp, nonce); err != nil {
+			return nil, err
 		}
 	}
 
 	// Вызываем обработчик
 	resp, err := handler(ctx, req)
-	if err != nil {
-		return nil, err
+	if err != nil || key == "" {
+		return resp, err
 	}
 
 	// 2. Добавление хеша к исходящим данным
 	if respBytes, ok := resp.([]byte); ok {
 		// Вычисляем хеш ответа
-		respHash := hash.CreateSha256(respBytes, handlers.HashKey)
+		respHash := hash.CreateSha256(respBytes, key)
 
 		// Устанавливаем заголовок с хешем
 		header := metadata.Pairs("hashsha256", respHash)
@@ -62,6 +88,113 @@ func HashCheckUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.
 	return resp, nil
 }
 
+// HashCheckStreamInterceptor проверяет хеш каждой пачки метрик входящего потока,
+// хеш, время и одноразовое значение передаются в полях сообщения, так как метаданные общие на весь поток,
+// агент проверяется один раз при открытии потока
+func HashCheckStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// Если хеш-ключ и реестр агентов не установлены, пропускаем проверку
+	if !agents.Enabled(agents.DefaultRegistry, handlers.HashKey) {
+		return handler(srv, ss)
+	}
+	md, ok := metadata.FromIncomingContext(ss.Context())
+	if !ok {
+		return status.Error(codes.InvalidArgument, "grpc: metadata is required")
+	}
+
+	ctx, key, err := authenticateAgent(ss.Context(), md)
+	if err != nil {
+		return err
+	}
+	stream := grpc.ServerStream(&identityServerStream{ServerStream: ss, ctx: ctx})
+	return handler(srv, &hashServerStream{ServerStream: stream, key: key})
+}
+
+// authenticateAgent проверяет агента из метаданных и возвращает контекст с его идентификатором
+// и ключ подписи, пустой ключ - агент подтвердил себя токеном
+func authenticateAgent(ctx context.Context, md metadata.MD) (context.Context, string, error) {
+	agentID := getFirstValue(md, agents.AgentIDMetadataKey)
+	key, err := agents.Authenticate(
+		agents.DefaultRegistry,
+		handlers.HashKey,
+		agentID,
+		agents.BearerToken(getFirstValue(md, agents.AuthorizationMetadataKey)))
+	if err != nil {
+		return ctx, "", status.Errorf(codes.Unauthenticated, "grpc: %v", err)
+	}
+	if agents.DefaultRegistry == nil {
+		return ctx, key, nil
+	}
+	ctx, err = agents.BindIdentity(ctx, agentID)
+	if err != nil {
+		return ctx, "", status.Errorf(codes.PermissionDenied, "grpc: %v", err)
+	}
+	return ctx, key, nil
+}
+
+// hashServerStream поток, проверяющий хеш входящих пачек метрик,
+// с пустым ключом (агент подтвердил себя токеном) проверяются только время и одноразовое значение
+type hashServerStream struct {
+	grpc.ServerStream
+	key string
+}
+
+// RecvMsg читает сообщение из потока и сверяет его хеш
+func (s *hashServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	request, ok := m.(*pb.ListMetricsRequest)
+	if !ok {
+		return nil
+	}
+	if s.key == "" {
+		return checkReplay(strconv.FormatInt(request.GetTimestamp(), 10), request.GetNonce())
+	}
+	if request.GetHashsha256() == "" {
+		return status.Error(codes.InvalidArgument, "grpc: hash is empty")
+	}
+
+	timestamp := strconv.FormatInt(request.GetTimestamp(), 10)
+	metricsHash, err := hash.CreateSignedMetricsSha256(request.GetMetrics(), s.key, timestamp, request.GetNonce())
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal metrics: %v", err)
+	}
+	return checkSignature(request.GetHashsha256(), metricsHash, timestamp, request.GetNonce())
+}
+
+// signedPayload данные запроса, которые покрывает подпись,
+// для пачки метрик сериализация детерминированная, как на агенте
+func signedPayload(req interface{}) ([]byte, bool, error) {
+	switch r := req.(type) {
+	case []byte:
+		return r, true, nil
+	case *pb.ListMetricsRequest:
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pb.ListMetricsRequest{Metrics: r.GetMetrics()})
+		return body, true, err
+	}
+	return nil, false, nil
+}
+
+// checkSignature сверяет подпись и отклоняет устаревшие и повторные запросы
+func checkSignature(received string, expected string, timestamp string, nonce string) error {
+	if !hmac.Equal([]byte(received), []byte(expected)) {
+		return status.Error(codes.InvalidArgument, "grpc: hash isn't correct")
+	}
+	return checkReplay(timestamp, nonce)
+}
+
+// checkReplay отклоняет устаревшие и повторные запросы
+func checkReplay(timestamp string, nonce string) error {
+	if err := hash.DefaultReplayGuard.Check(timestamp, nonce); err != nil {
+		if errors.Is(err, hash.ErrReplayedRequest) {
+			return status.Errorf(codes.AlreadyExists, "grpc: %v", err)
+		}
+		return status.Errorf(codes.InvalidArgument, "grpc: %v", err)
+	}
+	return nil
+}
+
 // getFirstValue получает первое значение из метаданных по ключу
 func getFirstValue(md metadata.MD, key string) string {
 	key = strings.ToLower(key)
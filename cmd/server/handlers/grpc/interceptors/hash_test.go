@@ -2,7 +2,10 @@ package interceptors
 
 import (
 	"context"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -11,7 +14,10 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers"
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/hash"
+	"github.com/ramil063/gometrics/internal/security/agents"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 // Вспомогательная функция для создания контекста с метаданными
@@ -19,11 +25,30 @@ func createContextWithMetadata(md metadata.MD) context.Context {
 	return metadata.NewIncomingContext(context.Background(), md)
 }
 
+// signedMetadata метаданные с подписью данных, временем и одноразовым значением
+func signedMetadata(body []byte, key string, timestamp string, nonce string) metadata.MD {
+	return metadata.Pairs(
+		"hashsha256", hash.CreateSignedSha256(body, key, timestamp, nonce),
+		hash.TimestampMetadataKey, timestamp,
+		hash.NonceMetadataKey, nonce,
+	)
+}
+
 func TestHashCheckUnaryInterceptor(t *testing.T) {
 	// Устанавливаем тестовый хеш-ключ
 	originalHashKey := handlers.HashKey
+	originalGuard := hash.DefaultReplayGuard
 	handlers.HashKey = "test-secret-key"
-	defer func() { handlers.HashKey = originalHashKey }()
+	defer func() {
+		handlers.HashKey = originalHashKey
+		hash.DefaultReplayGuard = originalGuard
+	}()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	batch := []*pb.Metric{{Id: "cpu", Value: 1, Labels: map[string]string{"host": "a", "core": "1"}}}
+	batchHash, err := hash.CreateSignedMetricsSha256(batch, "test-secret-key", now, "n1")
+	require.NoError(t, err)
 
 	tests := []struct {
 		ctx           context.Context
@@ -35,12 +60,11 @@ func TestHashCheckUnaryInterceptor(t *testing.T) {
 		wantErr       bool
 		wantHeader    bool
 		checkResponse bool
+		replay        bool
 	}{
 		{
-			name: "string response without hash",
-			ctx: createContextWithMetadata(metadata.Pairs(
-				"hashsha256", hash.CreateSha256([]byte("test-data"), "test-secret-key"),
-			)),
+			name:          "string response without hash",
+			ctx:           createContextWithMetadata(signedMetadata([]byte("test-data"), "test-secret-key", now, "n1")),
 			req:           []byte("test-data"),
 			handlerResp:   "response",
 			handlerErr:    nil,
@@ -73,6 +97,53 @@ func TestHashCheckUnaryInterceptor(t *testing.T) {
 			wantErr:     true,
 			wantErrCode: codes.InvalidArgument,
 		},
+		{
+			name: "hash without timestamp and nonce",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				"hashsha256", hash.CreateSha256([]byte("test-data"), "test-secret-key"),
+			)),
+			req:         []byte("test-data"),
+			wantErr:     true,
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "stale request",
+			ctx:         createContextWithMetadata(signedMetadata([]byte("test-data"), "test-secret-key", stale, "n1")),
+			req:         []byte("test-data"),
+			wantErr:     true,
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "replayed request",
+			ctx:         createContextWithMetadata(signedMetadata([]byte("test-data"), "test-secret-key", now, "n1")),
+			req:         []byte("test-data"),
+			handlerResp: "response",
+			replay:      true,
+			wantErr:     true,
+			wantErrCode: codes.AlreadyExists,
+		},
+		{
+			name: "metrics batch",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				"hashsha256", batchHash,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			req:           &pb.ListMetricsRequest{Metrics: batch},
+			handlerResp:   &pb.ListMetricsResponse{},
+			checkResponse: true,
+		},
+		{
+			name: "metrics batch with wrong hash",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				"hashsha256", batchHash,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			req:         &pb.ListMetricsRequest{Metrics: []*pb.Metric{{Id: "cpu", Value: 2}}},
+			wantErr:     true,
+			wantErrCode: codes.InvalidArgument,
+		},
 		{
 			name: "non-bytes request",
 			ctx: createContextWithMetadata(metadata.Pairs(
@@ -90,6 +161,12 @@ func TestHashCheckUnaryInterceptor(t *testing.T) {
 				return tt.handlerResp, tt.handlerErr
 			}
 
+			hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+			if tt.replay {
+				_, err := HashCheckUnaryInterceptor(tt.ctx, tt.req, nil, handler)
+				require.NoError(t, err)
+			}
+
 			resp, err := HashCheckUnaryInterceptor(tt.ctx, tt.req, nil, handler)
 
 			if tt.wantErr {
@@ -122,6 +199,117 @@ func TestHashCheckUnaryInterceptor(t *testing.T) {
 	}
 }
 
+func TestHashCheckUnaryInterceptor_Registry(t *testing.T) {
+	originalHashKey := handlers.HashKey
+	originalRegistry := agents.DefaultRegistry
+	originalGuard := hash.DefaultReplayGuard
+	defer func() {
+		handlers.HashKey = originalHashKey
+		agents.DefaultRegistry = originalRegistry
+		hash.DefaultReplayGuard = originalGuard
+	}()
+	handlers.HashKey = ""
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	credentials, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	agents.DefaultRegistry = registry
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	batch := []*pb.Metric{{Id: "cpu", Value: 1}}
+	batchHash, err := hash.CreateSignedMetricsSha256(batch, credentials.Secret, now, "n1")
+	require.NoError(t, err)
+	sharedHash, err := hash.CreateSignedMetricsSha256(batch, "shared", now, "n1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		ctx          context.Context
+		name         string
+		wantIdentity string
+		wantErrCode  codes.Code
+	}{
+		{
+			name: "agent secret",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				"hashsha256", batchHash,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			wantIdentity: "agent-1",
+		},
+		{
+			name: "agent token",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			wantIdentity: "agent-1",
+		},
+		{
+			name: "agent token without nonce",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+			)),
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "other key",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				"hashsha256", sharedHash,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name: "unknown agent",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-2",
+				"hashsha256", batchHash,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)),
+			wantErrCode: codes.Unauthenticated,
+		},
+		{
+			name: "missing agent id",
+			ctx: createContextWithMetadata(metadata.Pairs(
+				"hashsha256", batchHash,
+			)),
+			wantErrCode: codes.Unauthenticated,
+		},
+		{
+			name: "certificate of other agent",
+			ctx: mtls.WithIdentity(createContextWithMetadata(metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+				hash.TimestampMetadataKey, now,
+				hash.NonceMetadataKey, "n1",
+			)), "agent-2"),
+			wantErrCode: codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+			var identity string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				identity, _ = mtls.IdentityFromContext(ctx)
+				return &pb.ListMetricsResponse{}, nil
+			}
+
+			_, err := HashCheckUnaryInterceptor(tt.ctx, &pb.ListMetricsRequest{Metrics: batch}, nil, handler)
+			assert.Equal(t, tt.wantErrCode, status.Code(err))
+			assert.Equal(t, tt.wantIdentity, identity)
+		})
+	}
+}
+
 func Test_getFirstValue(t *testing.T) {
 	type args struct {
 		md  metadata.MD
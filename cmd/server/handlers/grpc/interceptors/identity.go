@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+// IdentityUnaryInterceptor добавляет в контекст идентификатор агента из сертификата клиента
+func IdentityUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withPeerIdentity(ctx), req)
+}
+
+// IdentityStreamInterceptor добавляет в контекст потока идентификатор агента из сертификата клиента
+func IdentityStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &identityServerStream{ServerStream: ss, ctx: withPeerIdentity(ss.Context())})
+}
+
+// identityServerStream поток с контекстом, содержащим идентификатор агента
+type identityServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context контекст потока
+func (s *identityServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// withPeerIdentity добавляет идентификатор, если соединение установлено по TLS с сертификатом клиента
+func withPeerIdentity(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if identity := mtls.Identity(&tlsInfo.State); identity != "" {
+		return mtls.WithIdentity(ctx, identity)
+	}
+	return ctx
+}
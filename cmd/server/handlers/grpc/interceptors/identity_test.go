@@ -0,0 +1,66 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+func TestIdentityUnaryInterceptor(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}}
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 3202}
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantIdentity string
+	}{
+		{name: "without peer", ctx: context.Background(), wantIdentity: ""},
+		{name: "without tls", ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr}), wantIdentity: ""},
+		{
+			name: "verified certificate",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{
+				Addr:     addr,
+				AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+			}),
+			wantIdentity: "agent-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				identity, _ = mtls.IdentityFromContext(ctx)
+				return nil, nil
+			}
+			_, err := IdentityUnaryInterceptor(tt.ctx, nil, &grpc.UnaryServerInfo{}, handler)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantIdentity, identity)
+		})
+	}
+}
+
+func TestIdentityStreamInterceptor(t *testing.T) {
+	cert := &x509.Certificate{DNSNames: []string{"agent-2.local"}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+
+	var identity string
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		identity, _ = mtls.IdentityFromContext(stream.Context())
+		return nil
+	}
+	err := IdentityStreamInterceptor(nil, &mockServerStream{ctx: ctx}, &grpc.StreamServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-2.local", identity)
+}
@@ -0,0 +1,152 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+// NewRateLimitAuthInterceptor ограничивает частоту запросов до проверки агента: запрос клиента без токенов
+// отклоняется без проверки подписи, а не прошедший проверку запрос забирает токен клиента,
+// чтобы поток запросов с неверной подписью не заставлял сервер проверять каждую.
+// Прошедший проверку запрос учитывает NewRateLimitInterceptor
+func NewRateLimitAuthInterceptor(limiter *ratelimit.Limiter, filter *ipfilter.Reloadable) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if limiter == nil {
+			return handler(ctx, req)
+		}
+		attempt, err := startAuthAttempt(limiter, rateLimitKey(ctx, filter))
+		if err != nil {
+			return nil, err
+		}
+		defer attempt.Finish()
+		return handler(ratelimit.WithAuthAttempt(ctx, attempt), req)
+	}
+}
+
+// NewRateLimitAuthStreamInterceptor ограничивает частоту открытия потоков и сообщений потока до проверки агента,
+// каждое сообщение проверяется перед сверкой его подписи
+func NewRateLimitAuthStreamInterceptor(limiter *ratelimit.Limiter, filter *ipfilter.Reloadable) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limiter == nil {
+			return handler(srv, ss)
+		}
+		key := rateLimitKey(ss.Context(), filter)
+		attempt, err := startAuthAttempt(limiter, key)
+		if err != nil {
+			return err
+		}
+		defer attempt.Finish()
+		ctx := ratelimit.WithAuthAttempt(ss.Context(), attempt)
+		return handler(srv, &authAttemptServerStream{ServerStream: ss, ctx: ctx, attempt: attempt, key: key})
+	}
+}
+
+// authAttemptServerStream поток, начинающий проверку агента для каждого полученного сообщения
+type authAttemptServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	attempt *ratelimit.AuthAttempt
+	key     string
+}
+
+// Context контекст потока с попыткой проверки агента
+func (s *authAttemptServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg получает сообщение и отклоняет его, если у клиента не осталось токенов
+func (s *authAttemptServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if wait := s.attempt.Start(); wait > 0 {
+		logger.WriteDebugLog("rate limit exceeded before auth", s.key)
+		return ratelimit.ThrottledError("rate limit exceeded", wait)
+	}
+	return nil
+}
+
+// startAuthAttempt начинает проверку агента клиента key, если у клиента нет токенов - отвечает ResourceExhausted
+func startAuthAttempt(limiter *ratelimit.Limiter, key string) (*ratelimit.AuthAttempt, error) {
+	attempt := limiter.NewAuthAttempt(key)
+	if wait := attempt.Start(); wait > 0 {
+		logger.WriteDebugLog("rate limit exceeded before auth", key)
+		return nil, ratelimit.ThrottledError("rate limit exceeded", wait)
+	}
+	return attempt, nil
+}
+
+// NewRateLimitInterceptor ограничивает частоту запросов от одного агента или адреса,
+// сверх лимита отвечает ResourceExhausted с RetryInfo
+func NewRateLimitInterceptor(limiter *ratelimit.Limiter, filter *ipfilter.Reloadable) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ratelimit.AuthAttemptFromContext(ctx).Pass()
+		if err := checkRateLimit(ctx, limiter, filter); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewRateLimitStreamInterceptor ограничивает частоту сообщений потока, каждое сообщение считается запросом
+func NewRateLimitStreamInterceptor(limiter *ratelimit.Limiter, filter *ipfilter.Reloadable) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limiter == nil {
+			return handler(srv, ss)
+		}
+		attempt := ratelimit.AuthAttemptFromContext(ss.Context())
+		// агент проверен при открытии потока
+		attempt.Pass()
+		return handler(srv, &rateLimitServerStream{ServerStream: ss, limiter: limiter, filter: filter, attempt: attempt})
+	}
+}
+
+// rateLimitServerStream поток, проверяющий лимит при получении каждого сообщения
+type rateLimitServerStream struct {
+	grpc.ServerStream
+	limiter *ratelimit.Limiter
+	filter  *ipfilter.Reloadable
+	attempt *ratelimit.AuthAttempt
+}
+
+// RecvMsg получает сообщение и забирает токен клиента,
+// сообщение, не прошедшее проверку агента, забирает токен клиента, с которым пришло
+func (s *rateLimitServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		s.attempt.Finish()
+		return err
+	}
+	s.attempt.Pass()
+	return checkRateLimit(s.Context(), s.limiter, s.filter)
+}
+
+// checkRateLimit забирает токен клиента из ограничителя
+func checkRateLimit(ctx context.Context, limiter *ratelimit.Limiter, filter *ipfilter.Reloadable) error {
+	if limiter == nil {
+		return nil
+	}
+	key := rateLimitKey(ctx, filter)
+	if ok, wait := limiter.Allow(key); !ok {
+		logger.WriteDebugLog("rate limit exceeded", key)
+		return ratelimit.ThrottledError("rate limit exceeded", wait)
+	}
+	return nil
+}
+
+// rateLimitKey ключ клиента, агент из сертификата или адрес клиента с учетом доверенных прокси
+func rateLimitKey(ctx context.Context, filter *ipfilter.Reloadable) string {
+	if identity, ok := mtls.IdentityFromContext(ctx); ok {
+		return "agent:" + identity
+	}
+	clientIP, err := getClientIP(ctx, filter.Filter())
+	if err != nil {
+		return "ip:unknown"
+	}
+	return "ip:" + clientIP.String()
+}
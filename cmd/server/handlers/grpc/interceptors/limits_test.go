@@ -0,0 +1,151 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+func TestNewRateLimitInterceptor(t *testing.T) {
+	interceptor := NewRateLimitInterceptor(ratelimit.NewLimiter(1, 1), nil)
+	handler := &mockUnaryHandler{resp: "response"}
+
+	_, err := interceptor(createTestContext("10.0.0.1"), "request", nil, handler.handle)
+	assert.NoError(t, err)
+
+	_, err = interceptor(createTestContext("10.0.0.1"), "request", nil, handler.handle)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	wait, ok := ratelimit.RetryAfterFromError(err)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Second, wait, float64(100*time.Millisecond))
+
+	// у другого адреса и у агента с сертификатом свои лимиты
+	_, err = interceptor(createTestContext("10.0.0.2"), "request", nil, handler.handle)
+	assert.NoError(t, err)
+	_, err = interceptor(mtls.WithIdentity(createTestContext("10.0.0.1"), "agent-1"), "request", nil, handler.handle)
+	assert.NoError(t, err)
+}
+
+func TestNewRateLimitInterceptor_Disabled(t *testing.T) {
+	interceptor := NewRateLimitInterceptor(nil, nil)
+	handler := &mockUnaryHandler{resp: "response"}
+	for i := 0; i < 10; i++ {
+		_, err := interceptor(context.Background(), "request", nil, handler.handle)
+		assert.NoError(t, err)
+	}
+}
+
+func TestNewRateLimitStreamInterceptor(t *testing.T) {
+	interceptor := NewRateLimitStreamInterceptor(ratelimit.NewLimiter(1, 2), nil)
+	stream := &mockServerStream{
+		ctx: createTestContext("10.0.0.1"),
+		requests: []*pb.ListMetricsRequest{
+			{Metrics: []*pb.Metric{{Id: "m1"}}},
+			{Metrics: []*pb.Metric{{Id: "m2"}}},
+			{Metrics: []*pb.Metric{{Id: "m3"}}},
+		},
+	}
+	var received []*pb.ListMetricsRequest
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{}, recvAll(&received))
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Len(t, received, 2)
+}
+
+// failingAuthStream поток, отклоняющий сообщения с метрикой bad, как проверка подписи
+type failingAuthStream struct {
+	grpc.ServerStream
+}
+
+func (s *failingAuthStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if m.(*pb.ListMetricsRequest).GetMetrics()[0].GetId() == "bad" {
+		return status.Error(codes.InvalidArgument, "hash isn't correct")
+	}
+	return nil
+}
+
+func TestNewRateLimitAuthInterceptor(t *testing.T) {
+	limiter := ratelimit.NewLimiter(1, 1)
+	before := NewRateLimitAuthInterceptor(limiter, nil)
+	after := NewRateLimitInterceptor(limiter, nil)
+	handler := &mockUnaryHandler{resp: "response"}
+	// проверка агента пропускает только запрос ok
+	call := func(ip string, req string) error {
+		_, err := before(createTestContext(ip), req, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if req != "ok" {
+				return nil, status.Error(codes.Unauthenticated, "unknown agent")
+			}
+			return after(ctx, req, nil, handler.handle)
+		})
+		return err
+	}
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(call("10.0.0.1", "bad")))
+	err := call("10.0.0.1", "ok")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "failed auth spends the address token")
+	_, ok := ratelimit.RetryAfterFromError(err)
+	assert.True(t, ok)
+
+	// прошедший проверку запрос тратит один токен, а не два
+	assert.NoError(t, call("10.0.0.2", "ok"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("10.0.0.2", "ok")))
+}
+
+func TestNewRateLimitAuthStreamInterceptor(t *testing.T) {
+	limiter := ratelimit.NewLimiter(1, 2)
+	before := NewRateLimitAuthStreamInterceptor(limiter, nil)
+	after := NewRateLimitStreamInterceptor(limiter, nil)
+	stream := &mockServerStream{
+		ctx: createTestContext("10.0.0.1"),
+		requests: []*pb.ListMetricsRequest{
+			{Metrics: []*pb.Metric{{Id: "bad"}}},
+			{Metrics: []*pb.Metric{{Id: "bad"}}},
+			{Metrics: []*pb.Metric{{Id: "m1"}}},
+		},
+	}
+	// обработчик продолжает читать поток после отклоненных сообщений
+	var errs []error
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			var req pb.ListMetricsRequest
+			err := stream.RecvMsg(&req)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+	}
+	err := before(nil, stream, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		return after(srv, &failingAuthStream{ServerStream: ss}, &grpc.StreamServerInfo{}, handler)
+	})
+
+	assert.NoError(t, err)
+	require.Len(t, errs, 3)
+	assert.Equal(t, codes.InvalidArgument, status.Code(errs[0]))
+	assert.Equal(t, codes.InvalidArgument, status.Code(errs[1]))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errs[2]), "messages with a wrong hash spend the address tokens")
+}
+
+func TestNewRateLimitAuthInterceptor_Disabled(t *testing.T) {
+	interceptor := NewRateLimitAuthInterceptor(nil, nil)
+	handler := &mockUnaryHandler{resp: "response"}
+	for i := 0; i < 10; i++ {
+		_, err := interceptor(context.Background(), "request", nil, handler.handle)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,311 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+	"github.com/ramil063/gometrics/internal/hash"
+	"github.com/ramil063/gometrics/internal/security/agents"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+// mockServerStream поток, отдающий заранее подготовленные сообщения
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	requests []*pb.ListMetricsRequest
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockServerStream) RecvMsg(msg interface{}) error {
+	if len(m.requests) == 0 {
+		return io.EOF
+	}
+	proto.Merge(msg.(proto.Message), m.requests[0])
+	m.requests = m.requests[1:]
+	return nil
+}
+
+// recvAll обработчик, вычитывающий все сообщения потока
+func recvAll(received *[]*pb.ListMetricsRequest) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			var req pb.ListMetricsRequest
+			err := stream.RecvMsg(&req)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			*received = append(*received, &req)
+		}
+	}
+}
+
+func TestNewTrustedIPStreamInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		trustedSubnet string
+		clientIP      string
+		wantErrCode   codes.Code
+	}{
+		{name: "no subnet", trustedSubnet: "", clientIP: "10.0.0.1", wantErrCode: codes.OK},
+		{name: "trusted", trustedSubnet: "192.168.1.0/24", clientIP: "192.168.1.10", wantErrCode: codes.OK},
+		{name: "not trusted", trustedSubnet: "192.168.1.0/24", clientIP: "10.0.0.1", wantErrCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := NewTrustedIPStreamInterceptor(newTestFilter(t, ipfilter.Config{Allow: ipfilter.SplitList(tt.trustedSubnet)}))
+			called := false
+			err := interceptor(nil, &mockServerStream{ctx: createTestContext(tt.clientIP)}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+				called = true
+				return nil
+			})
+			assert.Equal(t, tt.wantErrCode, status.Code(err))
+			assert.Equal(t, tt.wantErrCode == codes.OK, called)
+		})
+	}
+}
+
+func TestNewDecryptStreamInterceptor(t *testing.T) {
+	original := &pb.ListMetricsRequest{Metrics: []*pb.Metric{{Id: "cpu", Value: 42.5}}}
+	encrypted, err := proto.Marshal(original)
+	require.NoError(t, err)
+
+	t.Run("decrypts every message", func(t *testing.T) {
+		manager := crypto.NewCryptoManager()
+		manager.SetGRPCDecryptor(&mockDecryptor{decryptFunc: func(data []byte) ([]byte, error) { return data, nil }})
+
+		stream := &mockServerStream{
+			ctx: context.Background(),
+			requests: []*pb.ListMetricsRequest{
+				{CryptoMetrics: encrypted, Hashsha256: "hash-1"},
+				{CryptoMetrics: encrypted, Hashsha256: "hash-2"},
+			},
+		}
+		var received []*pb.ListMetricsRequest
+		err := NewDecryptStreamInterceptor(manager)(nil, stream, &grpc.StreamServerInfo{}, recvAll(&received))
+		require.NoError(t, err)
+		require.Len(t, received, 2)
+		for i, req := range received {
+			assert.Equal(t, "cpu", req.GetMetrics()[0].GetId())
+			assert.Empty(t, req.GetCryptoMetrics())
+			assert.Equal(t, []string{"hash-1", "hash-2"}[i], req.GetHashsha256())
+		}
+	})
+
+	t.Run("decryption error", func(t *testing.T) {
+		manager := crypto.NewCryptoManager()
+		manager.SetGRPCDecryptor(&mockDecryptor{decryptFunc: func(data []byte) ([]byte, error) { return nil, errors.New("bad key") }})
+
+		stream := &mockServerStream{
+			ctx:      context.Background(),
+			requests: []*pb.ListMetricsRequest{{CryptoMetrics: encrypted}},
+		}
+		var received []*pb.ListMetricsRequest
+		err := NewDecryptStreamInterceptor(manager)(nil, stream, &grpc.StreamServerInfo{}, recvAll(&received))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("without decryptor", func(t *testing.T) {
+		stream := &mockServerStream{
+			ctx:      context.Background(),
+			requests: []*pb.ListMetricsRequest{original},
+		}
+		var received []*pb.ListMetricsRequest
+		err := NewDecryptStreamInterceptor(crypto.NewCryptoManager())(nil, stream, &grpc.StreamServerInfo{}, recvAll(&received))
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(original, received[0]))
+	})
+}
+
+// signedBatch пачка метрик, подписанная как на агенте
+func signedBatch(t *testing.T, batch []*pb.Metric, timestamp int64, nonce string) *pb.ListMetricsRequest {
+	t.Helper()
+	metricsHash, err := hash.CreateSignedMetricsSha256(batch, handlers.HashKey, strconv.FormatInt(timestamp, 10), nonce)
+	require.NoError(t, err)
+	return &pb.ListMetricsRequest{Metrics: batch, Hashsha256: metricsHash, Timestamp: timestamp, Nonce: nonce}
+}
+
+func TestHashCheckStreamInterceptor(t *testing.T) {
+	originalHashKey := handlers.HashKey
+	originalGuard := hash.DefaultReplayGuard
+	handlers.HashKey = "test-secret-key"
+	defer func() {
+		handlers.HashKey = originalHashKey
+		hash.DefaultReplayGuard = originalGuard
+	}()
+
+	batch := []*pb.Metric{{Id: "cpu", Value: 1, Labels: map[string]string{"host": "a", "core": "1"}}}
+	now := time.Now().Unix()
+	md := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-real-ip", "127.0.0.1"))
+
+	tests := []struct {
+		ctx         context.Context
+		name        string
+		requests    []*pb.ListMetricsRequest
+		wantErrCode codes.Code
+		wantCount   int
+	}{
+		{
+			name:      "valid hashes",
+			ctx:       md,
+			requests:  []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1"), signedBatch(t, batch, now, "n2")},
+			wantCount: 2,
+		},
+		{
+			name:        "missing metadata",
+			ctx:         context.Background(),
+			requests:    []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1")},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "empty hash",
+			ctx:         md,
+			requests:    []*pb.ListMetricsRequest{{Metrics: batch}},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "invalid hash in second message",
+			ctx:         md,
+			requests:    []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1"), {Metrics: batch, Hashsha256: "invalid", Timestamp: now, Nonce: "n2"}},
+			wantErrCode: codes.InvalidArgument,
+			wantCount:   1,
+		},
+		{
+			name:        "replayed message",
+			ctx:         md,
+			requests:    []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1"), signedBatch(t, batch, now, "n1")},
+			wantErrCode: codes.AlreadyExists,
+			wantCount:   1,
+		},
+		{
+			name:        "stale message",
+			ctx:         md,
+			requests:    []*pb.ListMetricsRequest{signedBatch(t, batch, now-3600, "n1")},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "unsigned timestamp",
+			ctx:         md,
+			requests:    []*pb.ListMetricsRequest{{Metrics: batch, Hashsha256: signedBatch(t, batch, now, "n1").GetHashsha256(), Timestamp: now + 1, Nonce: "n1"}},
+			wantErrCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+			var received []*pb.ListMetricsRequest
+			err := HashCheckStreamInterceptor(nil, &mockServerStream{ctx: tt.ctx, requests: tt.requests}, &grpc.StreamServerInfo{}, recvAll(&received))
+			assert.Equal(t, tt.wantErrCode, status.Code(err))
+			assert.Len(t, received, tt.wantCount)
+		})
+	}
+}
+
+func TestHashCheckStreamInterceptor_Registry(t *testing.T) {
+	originalHashKey := handlers.HashKey
+	originalRegistry := agents.DefaultRegistry
+	originalGuard := hash.DefaultReplayGuard
+	defer func() {
+		handlers.HashKey = originalHashKey
+		agents.DefaultRegistry = originalRegistry
+		hash.DefaultReplayGuard = originalGuard
+	}()
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	credentials, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	agents.DefaultRegistry = registry
+	handlers.HashKey = credentials.Secret
+
+	batch := []*pb.Metric{{Id: "cpu", Value: 1}}
+	now := time.Now().Unix()
+
+	tests := []struct {
+		ctx         context.Context
+		name        string
+		requests    []*pb.ListMetricsRequest
+		wantErrCode codes.Code
+		wantCount   int
+	}{
+		{
+			name:      "agent secret",
+			ctx:       metadata.NewIncomingContext(context.Background(), metadata.Pairs(agents.AgentIDMetadataKey, "agent-1")),
+			requests:  []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1"), signedBatch(t, batch, now, "n2")},
+			wantCount: 2,
+		},
+		{
+			name: "agent token",
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+			)),
+			requests:  []*pb.ListMetricsRequest{{Metrics: batch, Timestamp: now, Nonce: "n1"}},
+			wantCount: 1,
+		},
+		{
+			name: "agent token replayed",
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+			)),
+			requests:    []*pb.ListMetricsRequest{{Metrics: batch, Timestamp: now, Nonce: "n1"}, {Metrics: batch, Timestamp: now, Nonce: "n1"}},
+			wantErrCode: codes.AlreadyExists,
+			wantCount:   1,
+		},
+		{
+			name: "agent token without nonce",
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				agents.AgentIDMetadataKey, "agent-1",
+				agents.AuthorizationMetadataKey, "Bearer "+credentials.Token,
+			)),
+			requests:    []*pb.ListMetricsRequest{{Metrics: batch}},
+			wantErrCode: codes.InvalidArgument,
+		},
+		{
+			name:        "unknown agent",
+			ctx:         metadata.NewIncomingContext(context.Background(), metadata.Pairs(agents.AgentIDMetadataKey, "agent-2")),
+			requests:    []*pb.ListMetricsRequest{signedBatch(t, batch, now, "n1")},
+			wantErrCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+			var received []*pb.ListMetricsRequest
+			var identity string
+			handler := func(srv interface{}, stream grpc.ServerStream) error {
+				identity, _ = mtls.IdentityFromContext(stream.Context())
+				return recvAll(&received)(srv, stream)
+			}
+			err := HashCheckStreamInterceptor(nil, &mockServerStream{ctx: tt.ctx, requests: tt.requests}, &grpc.StreamServerInfo{}, handler)
+			assert.Equal(t, tt.wantErrCode, status.Code(err))
+			assert.Len(t, received, tt.wantCount)
+			if tt.wantErrCode == codes.OK {
+				assert.Equal(t, "agent-1", identity)
+			}
+		})
+	}
+}
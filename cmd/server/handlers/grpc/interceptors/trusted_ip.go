@@ -3,70 +3,82 @@ package interceptors
 import (
 	"context"
 	"net"
+	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
 )
 
-func NewTrustedIPInterceptor(trustedSubnet string) grpc.UnaryServerInterceptor {
+// NewTrustedIPInterceptor проверяет IP клиента по спискам подсетей фильтра
+func NewTrustedIPInterceptor(filter *ipfilter.Reloadable) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		// Если не задана доверенная подсеть, пропускаем проверку
-		if trustedSubnet == "" {
-			return handler(ctx, req)
-		}
-
-		// Получаем IP из контекста
-		clientIP, err := getClientIP(ctx)
-		if err != nil {
-			return nil, status.Errorf(codes.PermissionDenied, "failed to get client IP: %v", err)
-		}
-
-		// Проверяем IP
-		if !isIPTrusted(trustedSubnet, clientIP) {
-			return nil, status.Errorf(codes.PermissionDenied, "IP %s is not trusted", clientIP)
+		if err := checkTrustedIP(ctx, filter); err != nil {
+			return nil, err
 		}
-
 		return handler(ctx, req)
 	}
 }
 
-// getClientIP извлекает IP адрес клиента из контекста
-func getClientIP(ctx context.Context) (string, error) {
-	// 1. Проверяем X-Real-IP в метаданных (как в HTTP)
-	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		if realIPs := md.Get("x-real-ip"); len(realIPs) > 0 {
-			return realIPs[0], nil
+// NewTrustedIPStreamInterceptor проверяет IP клиента при открытии потока
+func NewTrustedIPStreamInterceptor(filter *ipfilter.Reloadable) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkTrustedIP(ss.Context(), filter); err != nil {
+			return err
 		}
+		return handler(srv, ss)
 	}
+}
 
-	// 2. Если нет в метаданных, берем из peer информации
-	p, ok := peer.FromContext(ctx)
-	if !ok {
-		return "", status.Error(codes.PermissionDenied, "could not get peer info")
+// checkTrustedIP проверяет, что клиент разрешен фильтром
+func checkTrustedIP(ctx context.Context, filter *ipfilter.Reloadable) error {
+	f := filter.Filter()
+	// Если подсети не заданы, пропускаем проверку
+	if !f.Restricted() {
+		return nil
+	}
+
+	clientIP, err := getClientIP(ctx, f)
+	if err != nil {
+		return status.Errorf(codes.PermissionDenied, "failed to get client IP: %v", err)
+	}
+	if !f.Allowed(clientIP) {
+		return status.Errorf(codes.PermissionDenied, "IP %s is not trusted", clientIP)
 	}
+	return nil
+}
 
-	if addr, ok := p.Addr.(*net.TCPAddr); ok {
-		return addr.IP.String(), nil
+// getClientIP адрес клиента, метаданные с адресом учитываются фильтром только от доверенного прокси
+func getClientIP(ctx context.Context, f *ipfilter.Filter) (net.IP, error) {
+	peerIP, err := getPeerIP(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return "", status.Error(codes.PermissionDenied, "could not extract IP from peer")
+	var realIP, forwardedFor string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-real-ip"); len(values) > 0 {
+			realIP = values[0]
+		}
+		forwardedFor = strings.Join(md.Get("x-forwarded-for"), ",")
+	}
+	return f.ClientIP(peerIP, realIP, forwardedFor), nil
 }
 
-// isIPTrusted проверяет принадлежность IP к доверенной подсети
-func isIPTrusted(trustedSubnet, ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+// getPeerIP извлекает IP адрес соединения из контекста
+func getPeerIP(ctx context.Context) (net.IP, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "could not get peer info")
 	}
 
-	_, subnet, err := net.ParseCIDR(trustedSubnet)
-	if err != nil {
-		return false
+	if addr, ok := p.Addr.(*net.TCPAddr); ok && addr.IP != nil {
+		return addr.IP, nil
 	}
 
-	return subnet.Contains(ip)
+	return nil, status.Error(codes.PermissionDenied, "could not extract IP from peer")
 }
@@ -6,10 +6,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
 )
 
 // mockUnaryHandler для тестирования
@@ -33,64 +36,107 @@ func createTestContext(ip string) context.Context {
 	return ctx
 }
 
+// newTestFilter создает фильтр для тестов
+func newTestFilter(t *testing.T, cfg ipfilter.Config) *ipfilter.Reloadable {
+	filter, err := ipfilter.NewReloadable(cfg, "")
+	require.NoError(t, err)
+	return filter
+}
+
 func TestNewTrustedIPInterceptor(t *testing.T) {
 	tests := []struct {
-		name          string
-		trustedSubnet string
-		clientIP      string
-		errContains   string
-		wantErr       bool
-		errCode       codes.Code
+		metadata    map[string]string
+		name        string
+		clientIP    string
+		errContains string
+		cfg         ipfilter.Config
+		wantErr     bool
+		errCode     codes.Code
 	}{
 		{
-			name:          "empty trusted subnet allows all",
-			trustedSubnet: "",
-			clientIP:      "192.168.1.100",
-			wantErr:       false,
+			name:     "empty trusted subnet allows all",
+			clientIP: "192.168.1.100",
+			wantErr:  false,
+		},
+		{
+			name:     "trusted IP passes",
+			cfg:      ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			clientIP: "192.168.1.100",
+			wantErr:  false,
+		},
+		{
+			name:        "untrusted IP blocked",
+			cfg:         ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			clientIP:    "10.0.0.1",
+			wantErr:     true,
+			errCode:     codes.PermissionDenied,
+			errContains: "is not trusted",
+		},
+		{
+			name:        "denied IP blocked",
+			cfg:         ipfilter.Config{Allow: []string{"192.168.1.0/24"}, Deny: []string{"192.168.1.100"}},
+			clientIP:    "192.168.1.100",
+			wantErr:     true,
+			errCode:     codes.PermissionDenied,
+			errContains: "is not trusted",
+		},
+		{
+			name:        "no IP in context fails",
+			cfg:         ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			clientIP:    "",
+			wantErr:     true,
+			errCode:     codes.PermissionDenied,
+			errContains: "failed to get client IP",
 		},
 		{
-			name:          "trusted IP passes",
-			trustedSubnet: "192.168.1.0/24",
-			clientIP:      "192.168.1.100",
-			wantErr:       false,
+			name:     "invalid IP format fails",
+			cfg:      ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			clientIP: "invalid-ip",
+			wantErr:  true,
+			errCode:  codes.PermissionDenied,
 		},
 		{
-			name:          "untrusted IP blocked",
-			trustedSubnet: "192.168.1.0/24",
-			clientIP:      "10.0.0.1",
-			wantErr:       true,
-			errCode:       codes.PermissionDenied,
-			errContains:   "is not trusted",
+			name:     "IPv6 trusted",
+			cfg:      ipfilter.Config{Allow: []string{"2001:db8::/32"}},
+			clientIP: "2001:db8::1",
+			wantErr:  false,
 		},
 		{
-			name:          "no IP in context fails",
-			trustedSubnet: "192.168.1.0/24",
-			clientIP:      "",
-			wantErr:       true,
-			errCode:       codes.PermissionDenied,
-			errContains:   "failed to get client IP",
+			name:        "spoofed x-real-ip ignored",
+			cfg:         ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			clientIP:    "10.0.0.1",
+			metadata:    map[string]string{"x-real-ip": "192.168.1.100"},
+			wantErr:     true,
+			errCode:     codes.PermissionDenied,
+			errContains: "10.0.0.1",
 		},
 		{
-			name:          "invalid IP format fails",
-			trustedSubnet: "192.168.1.0/24",
-			clientIP:      "invalid-ip",
-			wantErr:       true,
-			errCode:       codes.PermissionDenied,
+			name:     "x-real-ip from trusted proxy",
+			cfg:      ipfilter.Config{Allow: []string{"192.168.1.0/24"}, TrustedProxies: []string{"10.0.0.0/8"}},
+			clientIP: "10.0.0.1",
+			metadata: map[string]string{"x-real-ip": "192.168.1.100"},
+			wantErr:  false,
 		},
 		{
-			name:          "IPv6 trusted",
-			trustedSubnet: "2001:db8::/32",
-			clientIP:      "2001:db8::1",
-			wantErr:       false,
+			name:        "x-forwarded-for from trusted proxy",
+			cfg:         ipfilter.Config{Allow: []string{"192.168.1.0/24"}, TrustedProxies: []string{"10.0.0.0/8"}},
+			clientIP:    "10.0.0.1",
+			metadata:    map[string]string{"x-forwarded-for": "192.168.1.100, 172.16.0.1"},
+			wantErr:     true,
+			errCode:     codes.PermissionDenied,
+			errContains: "172.16.0.1",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			interceptor := NewTrustedIPInterceptor(tt.trustedSubnet)
+			interceptor := NewTrustedIPInterceptor(newTestFilter(t, tt.cfg))
 			handler := &mockUnaryHandler{resp: "response", err: nil}
 
 			ctx := createTestContext(tt.clientIP)
+			if tt.metadata != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.New(tt.metadata))
+			}
 			resp, err := interceptor(ctx, "request", nil, handler.handle)
 
 			if tt.wantErr {
@@ -110,43 +156,17 @@ func TestNewTrustedIPInterceptor(t *testing.T) {
 	}
 }
 
-func TestGetClientIP_FromMetadata(t *testing.T) {
-	tests := []struct {
-		name     string
-		metadata map[string]string
-		expected string
-	}{
-		{
-			name:     "single x-real-ip",
-			metadata: map[string]string{"x-real-ip": "192.168.1.1"},
-			expected: "192.168.1.1",
-		},
-		{
-			name:     "multiple x-real-ip values",
-			metadata: map[string]string{"x-real-ip": "10.0.0.1, 10.0.0.2"},
-			expected: "10.0.0.1, 10.0.0.2",
-		},
-		{
-			name:     "case insensitive header",
-			metadata: map[string]string{"X-Real-Ip": "172.16.0.1"},
-			expected: "172.16.0.1",
-		},
-	}
+func TestNewTrustedIPInterceptor_NilFilter(t *testing.T) {
+	interceptor := NewTrustedIPInterceptor(nil)
+	handler := &mockUnaryHandler{resp: "response"}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			md := metadata.New(tt.metadata)
-			ctx := metadata.NewIncomingContext(context.Background(), md)
-
-			ip, err := getClientIP(ctx)
+	resp, err := interceptor(context.Background(), "request", nil, handler.handle)
 
-			assert.NoError(t, err)
-			assert.Equal(t, tt.expected, ip)
-		})
-	}
+	assert.NoError(t, err)
+	assert.Equal(t, "response", resp)
 }
 
-func TestGetClientIP_Errors(t *testing.T) {
+func TestGetPeerIP_Errors(t *testing.T) {
 	tests := []struct {
 		name   string
 		ctx    context.Context
@@ -166,9 +186,9 @@ func TestGetClientIP_Errors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ip, err := getClientIP(tt.ctx)
+			ip, err := getPeerIP(tt.ctx)
 
-			assert.Equal(t, "", ip)
+			assert.Nil(t, ip)
 			assert.Error(t, err)
 			assert.Equal(t, codes.PermissionDenied, status.Code(err))
 			assert.Contains(t, err.Error(), tt.errMsg)
@@ -180,38 +200,3 @@ type mockAddr struct{}
 
 func (m mockAddr) Network() string { return "mock" }
 func (m mockAddr) String() string  { return "mock" }
-
-func Test_isIPTrusted(t *testing.T) {
-	type args struct {
-		trustedSubnet string
-		ipStr         string
-	}
-	tests := []struct {
-		name string
-		args args
-		want bool
-	}{
-		{
-			name: "trusted IP passes",
-			args: args{
-				trustedSubnet: "192.168.1.0/24",
-				ipStr:         "192.168.1.100",
-			},
-			want: true,
-		},
-		{
-			name: "trusted IP passes",
-			args: args{
-				trustedSubnet: "192.168.1.0/24",
-				ipStr:         "192.168.2.100",
-			},
-			want: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			isTrusted := isIPTrusted(tt.args.trustedSubnet, tt.args.ipStr)
-			assert.Equal(t, tt.want, isTrusted)
-		})
-	}
-}
@@ -2,36 +2,146 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers/server"
+	"github.com/ramil063/gometrics/cmd/server/query"
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 type MetricsServer struct {
 	pb.UnimplementedMetricsServer
 
 	storage server.Storager
+	hub     *Hub
+	// policy метрики, разрешенные для записи агентам, nil - разрешено все
+	policy *mtls.Policy
+	// maxBatchSize максимальное количество метрик в одном сообщении, 0 - без ограничения
+	maxBatchSize int
 }
 
 // NewMetricsServer получение нового сервера для обновления метрик
 func NewMetricsServer(storage server.Storager) *MetricsServer {
 	return &MetricsServer{
 		storage: storage,
+		hub:     NewHub(),
 	}
 }
 
 // UpdateMetrics основная функция обновления метрик
 func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	pbResults, err := s.updateMetrics(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListMetricsResponse{
+		Metrics: pbResults,
+		Error:   "",
+	}, nil
+}
+
+// StreamUpdates обновление метрик пачками через один открытый поток,
+// в ответе последнее значение каждой обновленной метрики, в трейлере - количество сохраненных пачек,
+// по нему агент узнает, какие пачки нужно отправить повторно после ошибки
+func (s *MetricsServer) StreamUpdates(stream pb.Metrics_StreamUpdatesServer) error {
+	latest := make(map[string]*pb.Metric)
+	order := make([]string, 0)
+	applied := 0
+	defer func() {
+		stream.SetTrailer(metadata.Pairs(pb.AppliedBatchesMetadataKey, strconv.Itoa(applied)))
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		pbResults, err := s.updateMetrics(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		applied++
+		for _, m := range pbResults {
+			key := models.MetricKey(m.GetId(), m.GetLabels()) + "/" + m.GetType().String()
+			if _, ok := latest[key]; !ok {
+				order = append(order, key)
+			}
+			latest[key] = m
+		}
+	}
+
+	pbResults := make([]*pb.Metric, 0, len(order))
+	for _, key := range order {
+		pbResults = append(pbResults, latest[key])
+	}
+	return stream.SendAndClose(&pb.ListMetricsResponse{
+		Metrics: pbResults,
+		Error:   "",
+	})
+}
+
+// WatchMetrics отправляет подписчику каждое сохраненное изменение подходящих под фильтр метрик
+func (s *MetricsServer) WatchMetrics(filter *pb.MetricsFilter, stream pb.Metrics_WatchMetricsServer) error {
+	if s.hub == nil {
+		return status.Error(codes.Unavailable, "watch is not available")
+	}
+	watcher, err := NewWatcher(filter)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+
+	updates, unsubscribe := s.hub.Subscribe(watcher)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case metric, ok := <-updates:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher is too slow")
+			}
+			if err = stream.Send(metric); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// updateMetrics сохраняет пачку метрик и оповещает подписчиков об изменениях
+func (s *MetricsServer) updateMetrics(ctx context.Context, req *pb.ListMetricsRequest) ([]*pb.Metric, error) {
+	if s.maxBatchSize > 0 && len(req.GetMetrics()) > s.maxBatchSize {
+		// слишком большая пачка не станет меньше, поэтому это не ограничение частоты, а ошибка запроса
+		return nil, status.Errorf(codes.InvalidArgument, "too many metrics in batch: %d, max %d", len(req.GetMetrics()), s.maxBatchSize)
+	}
 	// 1. Конвертируем protobuf -> models.Metrics
 	metrics := make([]models.Metrics, 0, len(req.GetMetrics()))
 	for _, pbMetric := range req.GetMetrics() {
+		if err := models.ValidateMetricKey(pbMetric.GetId(), pbMetric.GetLabels()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		m := models.Metrics{
-			ID:    pbMetric.GetId(),
-			MType: pbMetric.GetType().String(),
+			ID:     pbMetric.GetId(),
+			MType:  pbMetric.GetType().String(),
+			Labels: pbMetric.GetLabels(),
 		}
 
 		switch pbMetric.GetType() {
@@ -47,18 +157,28 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.ListMetricsRe
 		metrics = append(metrics, m)
 	}
 
-	// 2. Вызываем логику обработки
+	// 2. Проверяем, что агенту разрешено записывать все метрики пачки
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	if err := s.policy.Authorize(ctx, names...); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	// 3. Вызываем логику обработки
 	result, err := server.UpdateMetrics(s.storage, metrics)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "update metrics failed: %v", err)
 	}
 
-	// 3. Конвертируем результат обратно в protobuf
+	// 4. Конвертируем результат обратно в protobuf
 	pbResults := make([]*pb.Metric, 0, len(result))
 	for _, m := range result {
 		pbMetric := &pb.Metric{
-			Id:   m.ID,
-			Type: mapMetricType(m.MType),
+			Id:     m.ID,
+			Type:   mapMetricType(m.MType),
+			Labels: m.Labels,
 		}
 
 		switch m.MType {
@@ -74,10 +194,254 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.ListMetricsRe
 		pbResults = append(pbResults, pbMetric)
 	}
 
-	return &pb.ListMetricsResponse{
-		Metrics: pbResults,
-		Error:   "",
-	}, nil
+	if s.hub != nil {
+		s.hub.Publish(pbResults)
+	}
+	return pbResults, nil
+}
+
+// DefaultPageSize размер страницы ListMetrics по умолчанию
+const DefaultPageSize = 100
+
+// MaxPageSize максимальный размер страницы ListMetrics
+const MaxPageSize = 1000
+
+// GetMetric получение значения метрики, как /value/{type}/{metric}
+func (s *MetricsServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.Metric, error) {
+	return s.getMetric(req)
+}
+
+// ListMetrics постраничное получение метрик с отбором по началу имени и типу,
+// сначала идут gauge, затем counter, внутри типа метрики отсортированы по ключу
+func (s *MetricsServer) ListMetrics(ctx context.Context, req *pb.ListStoredMetricsRequest) (*pb.ListStoredMetricsResponse, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case pageSize == 0:
+		pageSize = DefaultPageSize
+	case pageSize > MaxPageSize:
+		pageSize = MaxPageSize
+	}
+
+	after, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	types := req.GetTypes()
+	if len(types) == 0 {
+		types = []pb.Metric_MetricType{pb.Metric_gauge, pb.Metric_counter}
+	}
+
+	resp := &pb.ListStoredMetricsResponse{Metrics: make([]*pb.Metric, 0)}
+	last := pageToken{}
+	for _, mType := range []pb.Metric_MetricType{pb.Metric_gauge, pb.Metric_counter} {
+		if !slices.Contains(types, mType) || mType < after.mType {
+			continue
+		}
+
+		metrics, err := s.storedMetrics(mType)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "list metrics failed: %v", err)
+		}
+		for _, m := range metrics {
+			if !strings.HasPrefix(m.metric.GetId(), req.GetPrefix()) {
+				continue
+			}
+			if mType == after.mType && m.key <= after.key {
+				continue
+			}
+			if len(resp.Metrics) == pageSize {
+				resp.NextPageToken = encodePageToken(last)
+				return resp, nil
+			}
+			resp.Metrics = append(resp.Metrics, m.metric)
+			last = pageToken{mType: mType, key: m.key}
+		}
+	}
+	return resp, nil
+}
+
+// GetMetricsBatch получение значений нескольких метрик за один запрос,
+// ненайденные метрики возвращаются в notFound
+func (s *MetricsServer) GetMetricsBatch(ctx context.Context, req *pb.GetMetricsBatchRequest) (*pb.GetMetricsBatchResponse, error) {
+	resp := &pb.GetMetricsBatchResponse{
+		Metrics:  make([]*pb.Metric, 0, len(req.GetMetrics())),
+		NotFound: make([]*pb.GetMetricRequest, 0),
+	}
+	for _, metricReq := range req.GetMetrics() {
+		metric, err := s.getMetric(metricReq)
+		if status.Code(err) == codes.NotFound {
+			resp.NotFound = append(resp.NotFound, metricReq)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Metrics = append(resp.Metrics, metric)
+	}
+	return resp, nil
+}
+
+// Query вычисление выражения языка запросов, как /query
+func (s *MetricsServer) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
+	expr, err := query.Parse(req.GetQuery())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+
+	now := time.Now()
+	var start time.Time
+	end := now
+	switch {
+	case req.GetStart() != 0:
+		start = time.Unix(req.GetStart(), 0)
+		if req.GetEnd() != 0 {
+			end = time.Unix(req.GetEnd(), 0)
+		}
+	case req.GetTime() != 0:
+		end = time.Unix(req.GetTime(), 0)
+	}
+	period := query.NewRange(start, end, time.Duration(req.GetStep())*time.Second)
+	if err = period.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid range: %v", err)
+	}
+
+	series, err := query.Evaluate(s.storage, expr, period, now)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "query failed: %v", err)
+	}
+
+	resp := &pb.QueryResponse{Series: make([]*pb.QuerySeries, 0, len(series))}
+	for _, item := range series {
+		result := &pb.QuerySeries{
+			Name:   item.Name,
+			Type:   item.Type,
+			Labels: item.Labels,
+			Points: make([]*pb.QueryPoint, 0, len(item.Points)),
+		}
+		for _, point := range item.Points {
+			result.Points = append(result.Points, &pb.QueryPoint{Timestamp: point.Timestamp.Unix(), Value: point.Value})
+		}
+		resp.Series = append(resp.Series, result)
+	}
+	return resp, nil
+}
+
+// getMetric поиск метрики по имени, типу и условиям по меткам
+func (s *MetricsServer) getMetric(req *pb.GetMetricRequest) (*pb.Metric, error) {
+	matchers, err := models.ParseLabelMatchers(req.GetLabels())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid labels: %v", err)
+	}
+
+	key, err := server.ResolveMetricKey(s.storage, req.GetType().String(), req.GetId(), matchers)
+	switch {
+	case errors.Is(err, server.ErrMetricNotFound):
+		return nil, status.Errorf(codes.NotFound, "metric %s not found", req.GetId())
+	case errors.Is(err, server.ErrAmbiguousMetric):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "get metric failed: %v", err)
+	}
+
+	_, labels, err := models.ParseMetricKey(key)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "get metric failed: %v", err)
+	}
+	metric := &pb.Metric{
+		Id:     req.GetId(),
+		Type:   req.GetType(),
+		Labels: labels,
+	}
+
+	switch req.GetType() {
+	case pb.Metric_gauge:
+		value, err := s.storage.GetGauge(key)
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "metric %s not found", req.GetId())
+		}
+		metric.Value = value
+	case pb.Metric_counter:
+		delta, err := s.storage.GetCounter(key)
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "metric %s not found", req.GetId())
+		}
+		metric.Delta = delta
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type: %v", req.GetType())
+	}
+	return metric, nil
+}
+
+// storedMetric метрика из хранилища вместе с ключом хранения
+type storedMetric struct {
+	metric *pb.Metric
+	key    string
+}
+
+// storedMetrics получение всех метрик типа mType, отсортированных по ключу
+func (s *MetricsServer) storedMetrics(mType pb.Metric_MetricType) ([]storedMetric, error) {
+	result := make([]storedMetric, 0)
+	switch mType {
+	case pb.Metric_gauge:
+		gauges, err := s.storage.GetGauges()
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range gauges {
+			name, labels, _ := models.ParseMetricKey(key)
+			result = append(result, storedMetric{
+				metric: &pb.Metric{Id: name, Type: mType, Value: float64(value), Labels: labels},
+				key:    key,
+			})
+		}
+	case pb.Metric_counter:
+		counters, err := s.storage.GetCounters()
+		if err != nil {
+			return nil, err
+		}
+		for key, delta := range counters {
+			name, labels, _ := models.ParseMetricKey(key)
+			result = append(result, storedMetric{
+				metric: &pb.Metric{Id: name, Type: mType, Delta: int64(delta), Labels: labels},
+				key:    key,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].key < result[j].key
+	})
+	return result, nil
+}
+
+// pageToken позиция последней отданной метрики
+type pageToken struct {
+	key   string
+	mType pb.Metric_MetricType
+}
+
+// encodePageToken кодирование позиции в непрозрачную строку
+func encodePageToken(token pageToken) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(token.mType.String() + "/" + token.key))
+}
+
+// decodePageToken разбор позиции, пустая строка - начало списка
+func decodePageToken(s string) (pageToken, error) {
+	if s == "" {
+		return pageToken{mType: pb.Metric_gauge}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageToken{}, err
+	}
+	mType, key, ok := strings.Cut(string(data), "/")
+	value, known := pb.Metric_MetricType_value[mType]
+	if !ok || !known || key == "" {
+		return pageToken{}, errors.New("malformed page token")
+	}
+	return pageToken{mType: pb.Metric_MetricType(value), key: key}, nil
 }
 
 // Вспомогательная функция для конвертации типа
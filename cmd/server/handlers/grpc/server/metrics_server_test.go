@@ -2,11 +2,22 @@ package server
 
 import (
 	"context"
+	"net"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers/server"
 	metrics "github.com/ramil063/gometrics/internal/grpc/proto"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 func TestMetricsServer_UpdateMetrics(t *testing.T) {
@@ -29,7 +40,7 @@ func TestMetricsServer_UpdateMetrics(t *testing.T) {
 			name: "test 1",
 			fields: fields{
 				UnimplementedMetricsServer: metrics.UnimplementedMetricsServer{},
-				storage:                    server.GetStorage("", ""),
+				storage:                    server.NewMemStorage(),
 			},
 			args: args{
 				ctx: context.Background(),
@@ -42,6 +53,27 @@ func TestMetricsServer_UpdateMetrics(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "test labels",
+			fields: fields{
+				UnimplementedMetricsServer: metrics.UnimplementedMetricsServer{},
+				storage:                    server.NewMemStorage(),
+			},
+			args: args{
+				ctx: context.Background(),
+				req: &metrics.ListMetricsRequest{
+					Metrics: []*metrics.Metric{
+						{Id: "cpu", Type: metrics.Metric_gauge, Value: 1.5, Labels: map[string]string{"core": "1"}},
+					},
+				},
+			},
+			want: &metrics.ListMetricsResponse{
+				Metrics: []*metrics.Metric{
+					{Id: "cpu", Type: metrics.Metric_gauge, Value: 1.5, Labels: map[string]string{"core": "1"}},
+				},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -65,7 +97,7 @@ func TestNewMetricsServer(t *testing.T) {
 	type args struct {
 		storage server.Storager
 	}
-	s := server.GetStorage("", "")
+	s := server.NewMemStorage()
 	tests := []struct {
 		want *MetricsServer
 		args args
@@ -79,6 +111,7 @@ func TestNewMetricsServer(t *testing.T) {
 			want: &MetricsServer{
 				UnimplementedMetricsServer: metrics.UnimplementedMetricsServer{},
 				storage:                    s,
+				hub:                        NewHub(),
 			},
 		},
 	}
@@ -123,3 +156,331 @@ func Test_mapMetricType(t *testing.T) {
 		})
 	}
 }
+
+// startBufServer запускает сервер метрик в памяти и возвращает клиента к нему
+func startBufServer(t *testing.T, s *MetricsServer) metrics.MetricsClient {
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	metrics.RegisterMetricsServer(grpcServer, s)
+	go func() {
+		_ = grpcServer.Serve(lis)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return metrics.NewMetricsClient(conn)
+}
+
+func TestMetricsServer_StreamUpdates(t *testing.T) {
+	s := NewMetricsServer(server.NewMemStorage())
+	client := startBufServer(t, s)
+
+	stream, err := client.StreamUpdates(context.Background())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		err = stream.Send(&metrics.ListMetricsRequest{
+			Metrics: []*metrics.Metric{
+				{Id: "PollCount", Type: metrics.Metric_counter, Delta: 2},
+				{Id: "cpu", Type: metrics.Metric_gauge, Value: float64(i)},
+			},
+		})
+		require.NoError(t, err)
+	}
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	require.Len(t, resp.GetMetrics(), 2)
+	assert.Equal(t, int64(6), resp.GetMetrics()[0].GetDelta())
+	assert.Equal(t, float64(2), resp.GetMetrics()[1].GetValue())
+
+	counter, err := s.storage.GetCounter("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter)
+}
+
+func TestMetricsServer_StreamUpdates_Error(t *testing.T) {
+	client := startBufServer(t, NewMetricsServer(server.NewMemStorage()))
+
+	stream, err := client.StreamUpdates(context.Background())
+	require.NoError(t, err)
+	_ = stream.Send(&metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{{Id: "cpu", Type: metrics.Metric_MetricType(5)}},
+	})
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_WatchMetrics(t *testing.T) {
+	s := NewMetricsServer(server.NewMemStorage())
+	client := startBufServer(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.WatchMetrics(ctx, &metrics.MetricsFilter{Labels: `{host="a"}`})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return s.hub.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	_, err = client.UpdateMetrics(context.Background(), &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{
+			{Id: "cpu", Type: metrics.Metric_gauge, Value: 1, Labels: map[string]string{"host": "b"}},
+			{Id: "cpu", Type: metrics.Metric_gauge, Value: 2, Labels: map[string]string{"host": "a"}},
+			{Id: "PollCount", Type: metrics.Metric_counter, Delta: 3, Labels: map[string]string{"host": "a"}},
+		},
+	})
+	require.NoError(t, err)
+
+	got, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "cpu", got.GetId())
+	assert.Equal(t, float64(2), got.GetValue())
+
+	got, err = watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "PollCount", got.GetId())
+	assert.Equal(t, int64(3), got.GetDelta())
+
+	cancel()
+	require.Eventually(t, func() bool { return s.hub.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMetricsServer_WatchMetrics_InvalidFilter(t *testing.T) {
+	client := startBufServer(t, NewMetricsServer(server.NewMemStorage()))
+
+	watch, err := client.WatchMetrics(context.Background(), &metrics.MetricsFilter{Labels: `{host=`})
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// newReadTestServer сервер с набором метрик для проверки чтения
+func newReadTestServer(t *testing.T) *MetricsServer {
+	s := NewMetricsServer(server.NewMemStorage())
+	_, err := s.UpdateMetrics(context.Background(), &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{
+			{Id: "Alloc", Type: metrics.Metric_gauge, Value: 10.5},
+			{Id: "cpu", Type: metrics.Metric_gauge, Value: 1, Labels: map[string]string{"core": "1"}},
+			{Id: "cpu", Type: metrics.Metric_gauge, Value: 2, Labels: map[string]string{"core": "2"}},
+			{Id: "PollCount", Type: metrics.Metric_counter, Delta: 7},
+			{Id: "cpuTicks", Type: metrics.Metric_counter, Delta: 3},
+		},
+	})
+	require.NoError(t, err)
+	return s
+}
+
+func TestMetricsServer_GetMetric(t *testing.T) {
+	s := newReadTestServer(t)
+
+	tests := []struct {
+		req      *metrics.GetMetricRequest
+		want     *metrics.Metric
+		name     string
+		wantCode codes.Code
+	}{
+		{
+			name: "gauge",
+			req:  &metrics.GetMetricRequest{Id: "Alloc", Type: metrics.Metric_gauge},
+			want: &metrics.Metric{Id: "Alloc", Type: metrics.Metric_gauge, Value: 10.5},
+		},
+		{
+			name: "counter",
+			req:  &metrics.GetMetricRequest{Id: "PollCount", Type: metrics.Metric_counter},
+			want: &metrics.Metric{Id: "PollCount", Type: metrics.Metric_counter, Delta: 7},
+		},
+		{
+			name: "labels",
+			req:  &metrics.GetMetricRequest{Id: "cpu", Type: metrics.Metric_gauge, Labels: `{core=~"2"}`},
+			want: &metrics.Metric{Id: "cpu", Type: metrics.Metric_gauge, Value: 2, Labels: map[string]string{"core": "2"}},
+		},
+		{
+			name:     "ambiguous labels",
+			req:      &metrics.GetMetricRequest{Id: "cpu", Type: metrics.Metric_gauge, Labels: `{core=~".*"}`},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid labels",
+			req:      &metrics.GetMetricRequest{Id: "cpu", Type: metrics.Metric_gauge, Labels: `{core=`},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "not found",
+			req:      &metrics.GetMetricRequest{Id: "unknown", Type: metrics.Metric_counter},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "wrong type",
+			req:      &metrics.GetMetricRequest{Id: "Alloc", Type: metrics.Metric_counter},
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetMetric(context.Background(), tt.req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMetricsServer_ListMetrics(t *testing.T) {
+	s := newReadTestServer(t)
+
+	ids := func(ms []*metrics.Metric) []string {
+		result := make([]string, 0, len(ms))
+		for _, m := range ms {
+			result = append(result, m.GetId())
+		}
+		return result
+	}
+
+	t.Run("all", func(t *testing.T) {
+		resp, err := s.ListMetrics(context.Background(), &metrics.ListStoredMetricsRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Alloc", "cpu", "cpu", "PollCount", "cpuTicks"}, ids(resp.GetMetrics()))
+		assert.Empty(t, resp.GetNextPageToken())
+	})
+
+	t.Run("prefix and type", func(t *testing.T) {
+		resp, err := s.ListMetrics(context.Background(), &metrics.ListStoredMetricsRequest{
+			Prefix: "cpu",
+			Types:  []metrics.Metric_MetricType{metrics.Metric_counter},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cpuTicks"}, ids(resp.GetMetrics()))
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		var got []string
+		token := ""
+		pages := 0
+		for {
+			resp, err := s.ListMetrics(context.Background(), &metrics.ListStoredMetricsRequest{PageSize: 2, PageToken: token})
+			require.NoError(t, err)
+			got = append(got, ids(resp.GetMetrics())...)
+			pages++
+			token = resp.GetNextPageToken()
+			if token == "" {
+				break
+			}
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, []string{"Alloc", "cpu", "cpu", "PollCount", "cpuTicks"}, got)
+	})
+
+	t.Run("invalid page token", func(t *testing.T) {
+		_, err := s.ListMetrics(context.Background(), &metrics.ListStoredMetricsRequest{PageToken: "???"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("negative page size", func(t *testing.T) {
+		_, err := s.ListMetrics(context.Background(), &metrics.ListStoredMetricsRequest{PageSize: -1})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestMetricsServer_GetMetricsBatch(t *testing.T) {
+	s := newReadTestServer(t)
+
+	unknown := &metrics.GetMetricRequest{Id: "unknown", Type: metrics.Metric_gauge}
+	resp, err := s.GetMetricsBatch(context.Background(), &metrics.GetMetricsBatchRequest{
+		Metrics: []*metrics.GetMetricRequest{
+			{Id: "Alloc", Type: metrics.Metric_gauge},
+			unknown,
+			{Id: "PollCount", Type: metrics.Metric_counter},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetMetrics(), 2)
+	assert.Equal(t, 10.5, resp.GetMetrics()[0].GetValue())
+	assert.Equal(t, int64(7), resp.GetMetrics()[1].GetDelta())
+	assert.Equal(t, []*metrics.GetMetricRequest{unknown}, resp.GetNotFound())
+
+	_, err = s.GetMetricsBatch(context.Background(), &metrics.GetMetricsBatchRequest{
+		Metrics: []*metrics.GetMetricRequest{{Id: "cpu", Type: metrics.Metric_gauge, Labels: `{core=`}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_UpdateMetrics_InvalidKey(t *testing.T) {
+	s := NewMetricsServer(server.NewMemStorage())
+	_, err := s.UpdateMetrics(context.Background(), &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{{Id: "cpu", Type: metrics.Metric_gauge, Labels: map[string]string{"a=b": "1"}}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_Query(t *testing.T) {
+	s := newReadTestServer(t)
+
+	resp, err := s.Query(context.Background(), &metrics.QueryRequest{Query: "sum by (core) (cpu)"})
+	require.NoError(t, err)
+	require.Len(t, resp.GetSeries(), 2)
+	assert.Equal(t, map[string]string{"core": "2"}, resp.GetSeries()[1].GetLabels())
+	require.Len(t, resp.GetSeries()[1].GetPoints(), 1)
+	assert.Equal(t, 2.0, resp.GetSeries()[1].GetPoints()[0].GetValue())
+
+	resp, err = s.Query(context.Background(), &metrics.QueryRequest{Query: `{__name__=~"cpu.*", __type__="counter"}`})
+	require.NoError(t, err)
+	require.Len(t, resp.GetSeries(), 1)
+	assert.Equal(t, "cpuTicks", resp.GetSeries()[0].GetName())
+	assert.Equal(t, "counter", resp.GetSeries()[0].GetType())
+
+	now := time.Now().Unix()
+	resp, err = s.Query(context.Background(), &metrics.QueryRequest{Query: "Alloc", Start: now - 60, End: now + 60, Step: 30})
+	require.NoError(t, err)
+	require.Len(t, resp.GetSeries(), 1)
+	assert.NotEmpty(t, resp.GetSeries()[0].GetPoints())
+
+	_, err = s.Query(context.Background(), &metrics.QueryRequest{Query: "rate(PollCount)"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.Query(context.Background(), &metrics.QueryRequest{Query: "Alloc", Start: now, End: now - 60, Step: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_UpdateMetrics_Policy(t *testing.T) {
+	policy, err := mtls.NewPolicy(map[string][]string{"agent-1": {"cpu*"}})
+	require.NoError(t, err)
+	s := NewMetricsServer(server.NewMemStorage())
+	s.policy = policy
+
+	req := &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{{Id: "cpu", Type: metrics.Metric_gauge, Value: 1.5}},
+	}
+	_, err = s.UpdateMetrics(mtls.WithIdentity(context.Background(), "agent-1"), req)
+	assert.NoError(t, err)
+
+	_, err = s.UpdateMetrics(mtls.WithIdentity(context.Background(), "agent-2"), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.UpdateMetrics(context.Background(), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestMetricsServer_UpdateMetrics_MaxBatchSize(t *testing.T) {
+	s := NewMetricsServer(server.NewMemStorage())
+	s.maxBatchSize = 1
+
+	_, err := s.UpdateMetrics(context.Background(), &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{{Id: "cpu", Type: metrics.Metric_gauge, Value: 1.5}},
+	})
+	assert.NoError(t, err)
+
+	_, err = s.UpdateMetrics(context.Background(), &metrics.ListMetricsRequest{
+		Metrics: []*metrics.Metric{
+			{Id: "cpu", Type: metrics.Metric_gauge, Value: 1.5},
+			{Id: "mem", Type: metrics.Metric_gauge, Value: 2.5},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
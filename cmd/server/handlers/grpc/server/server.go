@@ -1,12 +1,14 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	serverConfig "github.com/ramil063/gometrics/cmd/server/config"
 	grpcHandlers "github.com/ramil063/gometrics/cmd/server/handlers/grpc"
@@ -18,11 +20,15 @@ import (
 	"github.com/ramil063/gometrics/internal/constants"
 	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/ratelimit"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
-// PrepareServerEnvironment подготавливает окружение для работы сервера
-func PrepareServerEnvironment() (*grpcHandlers.ServerConfigFlags, server.Storager, *crypto.Manager, error) {
+// PrepareServerEnvironment подготавливает окружение для работы сервера,
+// фоновые задачи хранилища и ключей шифрования работают до завершения контекста
+func PrepareServerEnvironment(ctx context.Context) (*grpcHandlers.ServerConfigFlags, server.Storager, *crypto.Manager, error) {
 	paramsGRPC := serverConfig.NewConfigParams(
 		constants.ConfigGRPCConsoleShortKey,
 		constants.ConfigGRPCConsoleFullKey,
@@ -39,7 +45,17 @@ func PrepareServerEnvironment() (*grpcHandlers.ServerConfigFlags, server.Storage
 		return nil, nil, nil, err
 	}
 
-	var grpcStorage = server.GetStorage(flagsGRPC.FileStoragePath, flagsGRPC.DatabaseDSN)
+	if flagsGRPC.FileStoragePath != "" && !flagsGRPC.Restore {
+		// работаем с новыми метриками, очищая файлы со старыми
+		if err = file.ClearStorage(flagsGRPC.FileStoragePath); err != nil {
+			logger.WriteErrorLog(err.Error(), "ClearStorage")
+		}
+	}
+
+	grpcStorage, err := server.GetStorage(flagsGRPC.FileStoragePath, flagsGRPC.DatabaseDSN)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	if flagsGRPC.DatabaseDSN != "" {
 		rep, errRepo := dml.NewRepository()
@@ -57,13 +73,6 @@ func PrepareServerEnvironment() (*grpcHandlers.ServerConfigFlags, server.Storage
 
 	writingToFileIsEnabledAndAvailable := flagsGRPC.FileStoragePath != ""
 	if flagsGRPC.StoreInterval > 0 && writingToFileIsEnabledAndAvailable {
-		if !flagsGRPC.Restore {
-			// работаем с новыми метриками, очищая файл со старыми
-			err = file.ClearFileContent(flagsGRPC.FileStoragePath)
-			if err != nil {
-				logger.WriteErrorLog(err.Error(), "ClearFileContent")
-			}
-		}
 		ticker := time.NewTicker(time.Duration(flagsGRPC.StoreInterval) * time.Second)
 		go func() {
 			err = server.SaveMetricsPerTime(server.MaxSaverWorkTime, ticker, grpcStorage)
@@ -72,20 +81,27 @@ func PrepareServerEnvironment() (*grpcHandlers.ServerConfigFlags, server.Storage
 			}
 		}()
 	}
+	if fileStorage, ok := grpcStorage.(*file.FStorage); ok {
+		// журнал изменений периодически сворачивается в снимок
+		go fileStorage.Run(ctx, time.NewTicker(file.CompactInterval(flagsGRPC.StoreInterval)))
+	}
 
 	manager := crypto.NewCryptoManager()
 	if flagsGRPC.CryptoKey != "" {
-		decryptor, err := crypto.NewRSADecryptor(flagsGRPC.CryptoKey)
+		keyRing, err := crypto.NewKeyRing(flagsGRPC.CryptoKey, time.Duration(flagsGRPC.CryptoKeyGrace)*time.Second)
 		if err != nil {
 			logger.WriteErrorLog(err.Error(), "Failed to create grpc decryptor")
 		}
-		manager.SetGRPCDecryptor(decryptor)
+		if keyRing != nil {
+			manager.SetGRPCDecryptor(keyRing)
+			go keyRing.Watch(ctx, time.NewTicker(time.Duration(flagsGRPC.CryptoKeyReload)*time.Second))
+		}
 	}
 	return flagsGRPC, grpcStorage, manager, nil
 }
 
-// GetGRPCServer возвращает настроенный и запущенный gRPC сервер
-func GetGRPCServer(flags *grpcHandlers.ServerConfigFlags, storage server.Storager, manager *crypto.Manager) (*grpc.Server, error) {
+// GetGRPCServer возвращает настроенный и запущенный gRPC сервер, ctx ограничивает фоновое перечитывание списков подсетей
+func GetGRPCServer(ctx context.Context, flags *grpcHandlers.ServerConfigFlags, storage server.Storager, manager *crypto.Manager) (*grpc.Server, error) {
 	var err error
 
 	lis, err := net.Listen("tcp", flags.Address)
@@ -94,16 +110,65 @@ func GetGRPCServer(flags *grpcHandlers.ServerConfigFlags, storage server.Storage
 		return nil, err
 	}
 
-	trustedIPUnaryInterceptor := interceptors.NewTrustedIPInterceptor(flags.TrustedSubnet)
+	policy, err := mtls.LoadPolicy(flags.AgentPolicy)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "LoadPolicy")
+		lis.Close()
+		return nil, err
+	}
+
+	ipFilter, err := ipfilter.NewReloadable(flags.IPFilterConfig(), flags.IPFilterFile)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "ip filter")
+		lis.Close()
+		return nil, err
+	}
+	if flags.IPFilterFile != "" {
+		go ipFilter.Watch(ctx, time.NewTicker(time.Duration(flags.IPFilterReload)*time.Second))
+	}
+
+	limiter := ratelimit.NewLimiter(float64(flags.ClientRateLimit), flags.ClientRateBurst)
+	trustedIPUnaryInterceptor := interceptors.NewTrustedIPInterceptor(ipFilter)
 	decryptUnaryInterceptor := interceptors.NewDecryptUnaryInterceptor(manager)
-	grpcServer := grpc.NewServer(
+	options := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
 			trustedIPUnaryInterceptor,
+			interceptors.IdentityUnaryInterceptor,
+			// до проверки агента отклоняются запросы клиентов, исчерпавших лимит неудачными проверками
+			interceptors.NewRateLimitAuthInterceptor(limiter, ipFilter),
 			decryptUnaryInterceptor,
 			interceptors.HashCheckUnaryInterceptor,
+			// лимит считается по агенту, поэтому ограничитель идет после проверки агента
+			interceptors.NewRateLimitInterceptor(limiter, ipFilter),
 		),
-	)
-	pb.RegisterMetricsServer(grpcServer, NewMetricsServer(storage))
+		grpc.ChainStreamInterceptor(
+			interceptors.NewTrustedIPStreamInterceptor(ipFilter),
+			interceptors.IdentityStreamInterceptor,
+			interceptors.NewRateLimitAuthStreamInterceptor(limiter, ipFilter),
+			interceptors.NewDecryptStreamInterceptor(manager),
+			interceptors.HashCheckStreamInterceptor,
+			interceptors.NewRateLimitStreamInterceptor(limiter, ipFilter),
+		),
+	}
+	if flags.MaxBodySize > 0 {
+		// размер проверяется и после распаковки сообщения
+		options = append(options, grpc.MaxRecvMsgSize(int(flags.MaxBodySize)))
+	}
+	if flags.TLSCert != "" {
+		tlsConfig, tlsErr := mtls.NewServerConfig(flags.TLSCert, flags.TLSKey, flags.TLSClientCA)
+		if tlsErr != nil {
+			logger.WriteErrorLog(tlsErr.Error(), "TLS config")
+			lis.Close()
+			return nil, tlsErr
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(options...)
+
+	metricsServer := NewMetricsServer(storage)
+	metricsServer.policy = policy
+	metricsServer.maxBatchSize = flags.MaxBatchSize
+	pb.RegisterMetricsServer(grpcServer, metricsServer)
 	go func() {
 		fmt.Println("Server gRPC started")
 		if err = grpcServer.Serve(lis); err != nil {
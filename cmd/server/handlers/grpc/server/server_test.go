@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 
 	grpcHandlers "github.com/ramil063/gometrics/cmd/server/handlers/grpc"
@@ -28,7 +30,7 @@ func TestGetGRPCServer1(t *testing.T) {
 	manager := crypto.NewCryptoManager()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetGRPCServer(flags, storage, manager)
+			got, err := GetGRPCServer(context.Background(), flags, storage, manager)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetGRPCServer() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -39,6 +41,9 @@ func TestGetGRPCServer1(t *testing.T) {
 }
 
 func TestPrepareServerEnvironment(t *testing.T) {
+	fileStorage, err := server.NewFileStorage("internal/storage/files/grpc/metrics.json")
+	require.NoError(t, err)
+
 	tests := []struct {
 		want1 server.Storager
 		want  *grpcHandlers.ServerConfigFlags
@@ -51,14 +56,19 @@ func TestPrepareServerEnvironment(t *testing.T) {
 				Address:         "localhost:3202",
 				FileStoragePath: "internal/storage/files/grpc/metrics.json",
 				StoreInterval:   300,
+				CryptoKeyGrace:  86400,
+				CryptoKeyReload: 60,
+				IPFilterReload:  60,
+				MaxBodySize:     10 << 20,
+				MaxBatchSize:    10000,
 			},
-			want1: server.NewFileStorage(),
+			want1: fileStorage,
 			want2: crypto.NewCryptoManager(),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, got2, err := PrepareServerEnvironment()
+			got, got1, got2, err := PrepareServerEnvironment(context.Background())
 			assert.NoError(t, err)
 			assert.Equalf(t, tt.want, got, "PrepareServerEnvironment()")
 			assert.Equalf(t, tt.want1, got1, "PrepareServerEnvironment()")
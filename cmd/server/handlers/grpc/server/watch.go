@@ -0,0 +1,120 @@
+package server
+
+import (
+	"slices"
+	"sync"
+
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// WatchBufferSize размер буфера изменений одного подписчика
+const WatchBufferSize = 256
+
+// Watcher фильтр подписчика на изменения метрик
+type Watcher struct {
+	types    []pb.Metric_MetricType
+	ids      []string
+	matchers []models.LabelMatcher
+}
+
+// NewWatcher создает фильтр по запросу подписчика
+func NewWatcher(filter *pb.MetricsFilter) (*Watcher, error) {
+	matchers, err := models.ParseLabelMatchers(filter.GetLabels())
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		types:    filter.GetTypes(),
+		ids:      filter.GetIds(),
+		matchers: matchers,
+	}, nil
+}
+
+// Matches проверяет подходит ли метрика под фильтр
+func (w *Watcher) Matches(metric *pb.Metric) bool {
+	if len(w.ids) > 0 && !slices.Contains(w.ids, metric.GetId()) {
+		return false
+	}
+	if len(w.types) > 0 && !slices.Contains(w.types, metric.GetType()) {
+		return false
+	}
+	return models.MatchLabels(metric.GetLabels(), w.matchers)
+}
+
+// subscription подписка на изменения метрик
+type subscription struct {
+	watcher *Watcher
+	ch      chan *pb.Metric
+}
+
+// Hub рассылает изменения метрик подписчикам
+type Hub struct {
+	subscribers map[*subscription]struct{}
+	mu          sync.Mutex
+}
+
+// NewHub создает пустой список подписчиков
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+// Subscribe регистрирует подписчика, канал закрывается при отписке
+// или если подписчик не успевает читать изменения
+func (h *Hub) Subscribe(watcher *Watcher) (<-chan *pb.Metric, func()) {
+	sub := &subscription{
+		watcher: watcher,
+		ch:      make(chan *pb.Metric, WatchBufferSize),
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(sub)
+	}
+}
+
+// Publish отправляет изменения всем подходящим подписчикам
+func (h *Hub) Publish(metrics []*pb.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		for _, metric := range metrics {
+			if !sub.watcher.Matches(metric) {
+				continue
+			}
+			select {
+			case sub.ch <- metric:
+			default:
+				// медленный подписчик не должен тормозить запись метрик
+				h.remove(sub)
+			}
+			if _, ok := h.subscribers[sub]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// Len количество активных подписчиков
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// remove удаляет подписчика и закрывает его канал, вызывается под мьютексом
+func (h *Hub) remove(sub *subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.ch)
+}
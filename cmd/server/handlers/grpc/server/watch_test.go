@@ -0,0 +1,91 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	metrics "github.com/ramil063/gometrics/internal/grpc/proto"
+)
+
+func TestWatcher_Matches(t *testing.T) {
+	cpu := &metrics.Metric{Id: "cpu", Type: metrics.Metric_gauge, Value: 1, Labels: map[string]string{"host": "a"}}
+	polls := &metrics.Metric{Id: "PollCount", Type: metrics.Metric_counter, Delta: 1}
+
+	tests := []struct {
+		filter *metrics.MetricsFilter
+		metric *metrics.Metric
+		name   string
+		want   bool
+	}{
+		{name: "empty filter", filter: &metrics.MetricsFilter{}, metric: cpu, want: true},
+		{name: "by id", filter: &metrics.MetricsFilter{Ids: []string{"cpu"}}, metric: cpu, want: true},
+		{name: "other id", filter: &metrics.MetricsFilter{Ids: []string{"cpu"}}, metric: polls, want: false},
+		{name: "by type", filter: &metrics.MetricsFilter{Types: []metrics.Metric_MetricType{metrics.Metric_counter}}, metric: polls, want: true},
+		{name: "other type", filter: &metrics.MetricsFilter{Types: []metrics.Metric_MetricType{metrics.Metric_counter}}, metric: cpu, want: false},
+		{name: "by labels", filter: &metrics.MetricsFilter{Labels: `{host=~"a|b"}`}, metric: cpu, want: true},
+		{name: "labels mismatch", filter: &metrics.MetricsFilter{Labels: `{host="b"}`}, metric: cpu, want: false},
+		{name: "labels on metric without labels", filter: &metrics.MetricsFilter{Labels: `{host="a"}`}, metric: polls, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWatcher(tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, w.Matches(tt.metric))
+		})
+	}
+}
+
+func TestNewWatcher_InvalidLabels(t *testing.T) {
+	_, err := NewWatcher(&metrics.MetricsFilter{Labels: `{host="a"`})
+	assert.Error(t, err)
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub()
+	all, _ := NewWatcher(&metrics.MetricsFilter{})
+	onlyCPU, _ := NewWatcher(&metrics.MetricsFilter{Ids: []string{"cpu"}})
+
+	allCh, unsubscribeAll := hub.Subscribe(all)
+	cpuCh, unsubscribeCPU := hub.Subscribe(onlyCPU)
+	assert.Equal(t, 2, hub.Len())
+
+	cpu := &metrics.Metric{Id: "cpu", Type: metrics.Metric_gauge, Value: 1}
+	mem := &metrics.Metric{Id: "mem", Type: metrics.Metric_gauge, Value: 2}
+	hub.Publish([]*metrics.Metric{cpu, mem})
+
+	assert.Equal(t, cpu, <-allCh)
+	assert.Equal(t, mem, <-allCh)
+	assert.Equal(t, cpu, <-cpuCh)
+	assert.Len(t, cpuCh, 0)
+
+	unsubscribeCPU()
+	unsubscribeCPU()
+	_, ok := <-cpuCh
+	assert.False(t, ok)
+	assert.Equal(t, 1, hub.Len())
+
+	unsubscribeAll()
+	assert.Equal(t, 0, hub.Len())
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	w, _ := NewWatcher(&metrics.MetricsFilter{})
+	ch, unsubscribe := hub.Subscribe(w)
+	defer unsubscribe()
+
+	batch := make([]*metrics.Metric, 0, WatchBufferSize+1)
+	for i := 0; i <= WatchBufferSize; i++ {
+		batch = append(batch, &metrics.Metric{Id: "cpu", Value: float64(i)})
+	}
+	hub.Publish(batch)
+
+	assert.Equal(t, 0, hub.Len())
+	received := 0
+	for range ch {
+		received++
+	}
+	assert.Equal(t, WatchBufferSize, received)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// BodyErrorStatus статус ответа при ошибке чтения тела запроса, превышение MaxBodySize дает 413
+func BodyErrorStatus(err error, defaultStatus int) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return defaultStatus
+}
+
+// LimitBody ограничивает чтение тела запроса размером MaxBodySize
+func LimitBody(w http.ResponseWriter, body io.ReadCloser) io.ReadCloser {
+	if MaxBodySize <= 0 {
+		return body
+	}
+	return http.MaxBytesReader(w, body, MaxBodySize)
+}
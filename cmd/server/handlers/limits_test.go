@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitBody(t *testing.T) {
+	oldMaxBodySize := MaxBodySize
+	defer func() { MaxBodySize = oldMaxBodySize }()
+
+	MaxBodySize = 4
+	body := LimitBody(httptest.NewRecorder(), io.NopCloser(strings.NewReader("0123456789")))
+	_, err := io.ReadAll(body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, BodyErrorStatus(err, http.StatusBadRequest))
+
+	MaxBodySize = 0
+	body = LimitBody(httptest.NewRecorder(), io.NopCloser(strings.NewReader("0123456789")))
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+}
+
+func TestBodyErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, BodyErrorStatus(errors.New("unexpected EOF"), http.StatusBadRequest))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, BodyErrorStatus(&http.MaxBytesError{Limit: 1}, http.StatusBadRequest))
+}
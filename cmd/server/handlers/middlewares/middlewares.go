@@ -3,8 +3,10 @@ package middlewares
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/subtle"
+	"errors"
 	"io"
-	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,7 +15,12 @@ import (
 	"github.com/ramil063/gometrics/cmd/server/handlers/writers"
 	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 // CheckMethodMw middleware для проверки метода запроса
@@ -54,6 +61,11 @@ func CheckUpdateMetricsNameMw(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		if err := models.ValidateMetricName(r.PathValue("metric")); err != nil {
+			logger.WriteDebugLog(err.Error(), "")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -184,9 +196,9 @@ func GZIPMiddleware(next http.Handler) http.Handler {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			// меняем тело запроса на новое
-			r.Body = cr
 			defer cr.Close()
+			// распакованное тело ограничивается так же, как сжатое, чтобы gzip-бомба не заняла всю память
+			r.Body = handlers.LimitBody(w, cr)
 		}
 
 		// передаём управление хендлеру
@@ -194,27 +206,68 @@ func GZIPMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// CheckHashMiddleware проверка полученного и высчитанного хеша(подписи)
+// CheckHashMiddleware проверка полученного и высчитанного хеша(подписи),
+// подпись покрывает время и одноразовое значение запроса, устаревшие и повторные запросы отклоняются.
+// При заданном реестре агентов запрос подписывается ключом агента из заголовка X-Agent-ID
+// или подтверждается API токеном агента, с токеном время и одноразовое значение также обязательны
 func CheckHashMiddleware(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if handlers.HashKey != "" {
-			body, _ := io.ReadAll(r.Body)
+		if agents.Enabled(agents.DefaultRegistry, handlers.HashKey) {
+			agentID := r.Header.Get(agents.AgentIDHeader)
+			key, err := agents.Authenticate(
+				agents.DefaultRegistry,
+				handlers.HashKey,
+				agentID,
+				agents.BearerToken(r.Header.Get(agents.AuthorizationHeader)))
+			if err != nil {
+				logger.WriteErrorLog(err.Error(), "Agent")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if agents.DefaultRegistry != nil {
+				ctx, err := agents.BindIdentity(r.Context(), agentID)
+				if err != nil {
+					logger.WriteErrorLog(err.Error(), "Agent")
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				r = r.WithContext(ctx)
+			}
+			timestamp := r.Header.Get(hash.TimestampHeader)
+			nonce := r.Header.Get(hash.NonceHeader)
+			// агент подтвердил себя токеном, подпись не нужна, но повтор запроса отклоняется
+			if key == "" {
+				if checkReplay(w, timestamp, nonce) {
+					next.ServeHTTP(w, r)
+				}
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.WriteErrorLog(err.Error(), "Body")
+				w.WriteHeader(handlers.BodyErrorStatus(err, http.StatusBadRequest))
+				return
+			}
 
 			headerHashSHA256 := r.Header.Get("HashSHA256")
-			bodyHashSHA256 := hash.CreateSha256(body, handlers.HashKey)
+			bodyHashSHA256 := hash.CreateSignedSha256(body, key, timestamp, nonce)
 
-			if headerHashSHA256 != bodyHashSHA256 {
+			if !hmac.Equal([]byte(headerHashSHA256), []byte(bodyHashSHA256)) {
 				logger.WriteErrorLog("hash isn't correct", "HashSHA256")
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
+			if !checkReplay(w, timestamp, nonce) {
+				return
+			}
 			//возвращаем прочитанное тело обратно
 			r.Body = io.NopCloser(bytes.NewBuffer(body))
 
 			// оборачиваем оригинальный http.ResponseWriter новым с поддержкой добавления заголовка хеша при ответе
-			hw := writers.NewHashWriter(w, body, handlers.HashKey)
+			hw := writers.NewHashWriter(w, body, key)
 			// меняем оригинальный http.ResponseWriter на новый
 			w = hw
 		}
@@ -223,7 +276,24 @@ func CheckHashMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// checkReplay отклоняет устаревший или повторный запрос, false - ответ уже записан
+func checkReplay(w http.ResponseWriter, timestamp string, nonce string) bool {
+	err := hash.DefaultReplayGuard.Check(timestamp, nonce)
+	if err == nil {
+		return true
+	}
+	logger.WriteErrorLog(err.Error(), "ReplayGuard")
+	if errors.Is(err, hash.ErrReplayedRequest) {
+		w.WriteHeader(http.StatusConflict)
+		return false
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	return false
+}
+
 // DecryptMiddleware расшифровка с помощью приватного ключа
+// схема шифрования берется из заголовка X-Encryption-Scheme, без заголовка определяется по данным,
+// ключ выбирается по заголовку X-Encryption-Key-Id, без заголовка ключи перебираются
 func DecryptMiddleware(next http.Handler, decryptor crypto.Decryptor) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if decryptor == nil {
@@ -234,11 +304,11 @@ func DecryptMiddleware(next http.Handler, decryptor crypto.Decryptor) http.Handl
 		encrypted, err := io.ReadAll(r.Body)
 		if err != nil {
 			logger.WriteErrorLog("ReadAll body isn't correct", "Body")
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(handlers.BodyErrorStatus(err, http.StatusBadRequest))
 			return
 		}
 
-		decrypted, err := decryptor.Decrypt(encrypted)
+		decrypted, err := crypto.DecryptWithKey(decryptor, r.Header.Get(crypto.KeyIDHeader), r.Header.Get(crypto.SchemeHeader), encrypted)
 		if err != nil {
 			logger.WriteErrorLog("Decrypting error", "Decryptor")
 			w.WriteHeader(http.StatusBadRequest)
@@ -253,42 +323,120 @@ func DecryptMiddleware(next http.Handler, decryptor crypto.Decryptor) http.Handl
 	})
 }
 
-// CheckTrustedIP проверяет чтобы переданный IP был доверенным
+// CheckTrustedIP проверяет, что адрес клиента разрешен фильтром подсетей,
+// заголовки X-Real-IP и X-Forwarded-For учитываются только от доверенных прокси
 func CheckTrustedIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if handlers.TrustedSubnet == "" {
+		filter := ipfilter.DefaultFilter.Filter()
+		if !filter.Restricted() {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		realIP := r.Header.Get("X-Real-IP")
-		if realIP == "" {
+		if _, err := filter.Check(ipfilter.PeerIP(r.RemoteAddr), r.Header.Get("X-Real-IP"), forwardedFor(r)); err != nil {
+			logger.WriteDebugLog(err.Error(), "trusted ip")
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		if !isIPTrusted(handlers.TrustedSubnet, realIP) {
-			w.WriteHeader(http.StatusForbidden)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitBodyMw ограничивает размер тела запроса, при превышении чтение тела завершается ошибкой и запрос получает 413
+func LimitBodyMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = handlers.LimitBody(w, r.Body)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitAuthMw ограничивает частоту запросов до проверки агента: запрос клиента без токенов
+// отклоняется без проверки подписи, а не прошедший проверку запрос забирает токен клиента,
+// чтобы поток запросов с неверной подписью не заставлял сервер проверять каждую.
+// Прошедший проверку запрос учитывает RateLimitMw, сверх лимита отвечает 429 с заголовком Retry-After
+func RateLimitAuthMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		attempt := ratelimit.DefaultLimiter.NewAuthAttempt(key)
+		if wait := attempt.Start(); wait > 0 {
+			logger.WriteDebugLog("rate limit exceeded before auth", key)
+			w.Header().Set(ratelimit.RetryAfterHeader, ratelimit.RetryAfterSeconds(wait))
+			w.WriteHeader(http.StatusTooManyRequests)
 			return
 		}
+		defer attempt.Finish()
+		next.ServeHTTP(w, r.WithContext(ratelimit.WithAuthAttempt(r.Context(), attempt)))
+	})
+}
 
+// RateLimitMw ограничивает частоту запросов от одного агента или адреса,
+// сверх лимита отвечает 429 с заголовком Retry-After
+func RateLimitMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ratelimit.AuthAttemptFromContext(r.Context()).Pass()
+		key := clientKey(r)
+		if ok, wait := ratelimit.DefaultLimiter.Allow(key); !ok {
+			logger.WriteDebugLog("rate limit exceeded", key)
+			w.Header().Set(ratelimit.RetryAfterHeader, ratelimit.RetryAfterSeconds(wait))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// isIPTrusted проверяет, входит ли IP в доверенную подсеть
-func isIPTrusted(trustedIP string, ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+// clientKey ключ клиента для ограничения частоты запросов,
+// агент из сертификата или адрес клиента с учетом доверенных прокси
+func clientKey(r *http.Request) string {
+	if identity, ok := mtls.IdentityFromContext(r.Context()); ok {
+		return "agent:" + identity
 	}
+	ip := ipfilter.DefaultFilter.Filter().ClientIP(ipfilter.PeerIP(r.RemoteAddr), r.Header.Get("X-Real-IP"), forwardedFor(r))
+	return "ip:" + ip.String()
+}
 
-	_, subnet, err := net.ParseCIDR(trustedIP)
-	if err != nil {
-		return false
-	}
-	if subnet.Contains(ip) {
-		return true
-	}
-	return false
+// forwardedFor все значения заголовка X-Forwarded-For через запятую
+func forwardedFor(r *http.Request) string {
+	return strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+}
+
+// ClientIdentityMw добавляет в контекст запроса идентификатор агента из сертификата клиента
+func ClientIdentityMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity := mtls.Identity(r.TLS); identity != "" {
+			r = r.WithContext(mtls.WithIdentity(r.Context(), identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckAgentPolicyMw проверяет, что агенту разрешено записывать метрику из урла
+func CheckAgentPolicyMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := mtls.DefaultPolicy.Authorize(r.Context(), r.PathValue("metric")); err != nil {
+			logger.WriteDebugLog(err.Error(), "agent policy")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckAdminTokenMw пропускает к администрированию только запросы с токеном администратора,
+// без заданного токена администрирование выключено
+func CheckAdminTokenMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.AdminToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		token := agents.BearerToken(r.Header.Get(agents.AuthorizationHeader))
+		if subtle.ConstantTimeCompare([]byte(token), []byte(handlers.AdminToken)) != 1 {
+			logger.WriteErrorLog("admin token isn't correct", "Admin")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -3,12 +3,24 @@ package middlewares
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,7 +29,13 @@ import (
 	"github.com/ramil063/gometrics/cmd/server/storage/memory"
 	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/crypto/envelope"
+	cryptoRSA "github.com/ramil063/gometrics/internal/security/crypto/rsa"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 func TestCheckMethodMw(t *testing.T) {
@@ -264,6 +282,15 @@ func TestCheckUpdateMetricsNameMw(t *testing.T) {
 				code:        http.StatusBadRequest,
 			},
 		},
+		{
+			name:       "key chars in name",
+			pathValues: map[string]string{"type": "counter", "metric": `a{b="c"}`},
+			want: want{
+				response:    "",
+				contentType: "",
+				code:        http.StatusBadRequest,
+			},
+		},
 		{
 			name:       "test 4",
 			pathValues: map[string]string{"type": "counter", "metric": "a"},
@@ -568,7 +595,11 @@ func TestCheckHashMiddleware(t *testing.T) {
 			body, _ := json.Marshal(tc.body)
 			request := httptest.NewRequest(tc.method, "/update", bytes.NewReader(body))
 
-			request.Header.Set("HashSHA256", hash.CreateSha256(body, handlers.HashKey))
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := hash.NewNonce()
+			request.Header.Set("HashSHA256", hash.CreateSignedSha256(body, handlers.HashKey, timestamp, nonce))
+			request.Header.Set(hash.TimestampHeader, timestamp)
+			request.Header.Set(hash.NonceHeader, nonce)
 			request.Header.Set("Content-Type", "application/json")
 			// создаём новый Recorder
 			w := httptest.NewRecorder()
@@ -585,6 +616,209 @@ func TestCheckHashMiddleware(t *testing.T) {
 	}
 }
 
+func TestCheckHashMiddleware_Replay(t *testing.T) {
+	originalHashKey := handlers.HashKey
+	originalGuard := hash.DefaultReplayGuard
+	handlers.HashKey = "test"
+	hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+	defer func() {
+		handlers.HashKey = originalHashKey
+		hash.DefaultReplayGuard = originalGuard
+	}()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	body := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name         string
+		timestamp    string
+		nonce        string
+		hashSHA256   string
+		expectedCode int
+	}{
+		{
+			name:         "first request",
+			timestamp:    now,
+			nonce:        "nonce-1",
+			hashSHA256:   hash.CreateSignedSha256(body, "test", now, "nonce-1"),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "replayed request",
+			timestamp:    now,
+			nonce:        "nonce-1",
+			hashSHA256:   hash.CreateSignedSha256(body, "test", now, "nonce-1"),
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "stale request",
+			timestamp:    stale,
+			nonce:        "nonce-2",
+			hashSHA256:   hash.CreateSignedSha256(body, "test", stale, "nonce-2"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "nonce not covered by hash",
+			timestamp:    now,
+			nonce:        "nonce-3",
+			hashSHA256:   hash.CreateSignedSha256(body, "test", now, "nonce-1"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unsigned request",
+			hashSHA256:   hash.CreateSha256(body, "test"),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			request.Header.Set("HashSHA256", tt.hashSHA256)
+			request.Header.Set(hash.TimestampHeader, tt.timestamp)
+			request.Header.Set(hash.NonceHeader, tt.nonce)
+			w := httptest.NewRecorder()
+
+			CheckHashMiddleware(handler).ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedCode, res.StatusCode)
+		})
+	}
+}
+
+func TestCheckHashMiddleware_Registry(t *testing.T) {
+	originalHashKey := handlers.HashKey
+	originalRegistry := agents.DefaultRegistry
+	originalGuard := hash.DefaultReplayGuard
+	defer func() {
+		handlers.HashKey = originalHashKey
+		agents.DefaultRegistry = originalRegistry
+		hash.DefaultReplayGuard = originalGuard
+	}()
+	handlers.HashKey = "shared"
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	agent1, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	agent2, err := registry.Add("agent-2")
+	require.NoError(t, err)
+	require.NoError(t, registry.Revoke("agent-2"))
+	agents.DefaultRegistry = registry
+
+	var identity string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = mtls.IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	body := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+
+	tests := []struct {
+		ctx          context.Context
+		name         string
+		agentID      string
+		key          string
+		token        string
+		wantIdentity string
+		expectedCode int
+		noNonce      bool
+		replay       bool
+	}{
+		{name: "agent secret", agentID: "agent-1", key: agent1.Secret, wantIdentity: "agent-1", expectedCode: http.StatusOK},
+		{name: "agent token", agentID: "agent-1", token: agent1.Token, wantIdentity: "agent-1", expectedCode: http.StatusOK},
+		{name: "agent token without nonce", agentID: "agent-1", token: agent1.Token, noNonce: true, expectedCode: http.StatusBadRequest},
+		{name: "agent token replayed", agentID: "agent-1", token: agent1.Token, replay: true, expectedCode: http.StatusConflict},
+		{name: "shared key is not accepted", agentID: "agent-1", key: "shared", expectedCode: http.StatusBadRequest},
+		{name: "other agent secret", agentID: "agent-1", key: agent2.Secret, expectedCode: http.StatusBadRequest},
+		{name: "wrong token", agentID: "agent-1", token: agent2.Token, expectedCode: http.StatusUnauthorized},
+		{name: "missing agent id", key: agent1.Secret, expectedCode: http.StatusUnauthorized},
+		{name: "unknown agent", agentID: "agent-3", key: agent1.Secret, expectedCode: http.StatusUnauthorized},
+		{name: "revoked agent", agentID: "agent-2", key: agent2.Secret, expectedCode: http.StatusUnauthorized},
+		{
+			name:         "certificate of other agent",
+			ctx:          mtls.WithIdentity(context.Background(), "agent-2"),
+			agentID:      "agent-1",
+			key:          agent1.Secret,
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := hash.NewNonce()
+			newRequest := func() *http.Request {
+				request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+				if tt.ctx != nil {
+					request = request.WithContext(tt.ctx)
+				}
+				request.Header.Set(agents.AgentIDHeader, tt.agentID)
+				if tt.token != "" {
+					request.Header.Set(agents.AuthorizationHeader, "Bearer "+tt.token)
+				}
+				if tt.key != "" {
+					request.Header.Set("HashSHA256", hash.CreateSignedSha256(body, tt.key, timestamp, nonce))
+				}
+				if !tt.noNonce {
+					request.Header.Set(hash.TimestampHeader, timestamp)
+					request.Header.Set(hash.NonceHeader, nonce)
+				}
+				return request
+			}
+			if tt.replay {
+				CheckHashMiddleware(handler).ServeHTTP(httptest.NewRecorder(), newRequest())
+			}
+			identity = ""
+			w := httptest.NewRecorder()
+
+			CheckHashMiddleware(handler).ServeHTTP(w, newRequest())
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedCode, res.StatusCode)
+			assert.Equal(t, tt.wantIdentity, identity)
+		})
+	}
+}
+
+func TestCheckAdminTokenMw(t *testing.T) {
+	originalAdminToken := handlers.AdminToken
+	defer func() { handlers.AdminToken = originalAdminToken }()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		expectedCode  int
+	}{
+		{name: "valid token", adminToken: "admin", authorization: "Bearer admin", expectedCode: http.StatusOK},
+		{name: "wrong token", adminToken: "admin", authorization: "Bearer other", expectedCode: http.StatusUnauthorized},
+		{name: "missing token", adminToken: "admin", expectedCode: http.StatusUnauthorized},
+		{name: "administration disabled", authorization: "Bearer ", expectedCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers.AdminToken = tt.adminToken
+			request := httptest.NewRequest(http.MethodGet, "/admin/agents/", nil)
+			request.Header.Set(agents.AuthorizationHeader, tt.authorization)
+			w := httptest.NewRecorder()
+
+			CheckAdminTokenMw(handler).ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.expectedCode, res.StatusCode)
+		})
+	}
+}
+
 // MockDecryptor реализует интерфейс Decryptor для тестов
 type MockDecryptor struct {
 	decryptFunc func([]byte) ([]byte, error)
@@ -675,52 +909,124 @@ func TestDecryptMiddleware(t *testing.T) {
 	}
 }
 
+func TestDecryptMiddleware_Schemes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	plaintext := []byte(`{"id":"Alloc","type":"gauge","value":1}`)
+
+	envelopeData, err := envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+	legacyData, err := cryptoRSA.RsaEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		scheme         string
+		body           []byte
+		expectedStatus int
+	}{
+		{name: "envelope with scheme header", scheme: crypto.SchemeEnvelope, body: envelopeData, expectedStatus: http.StatusOK},
+		{name: "envelope without header", body: envelopeData, expectedStatus: http.StatusOK},
+		{name: "legacy without header", body: legacyData, expectedStatus: http.StatusOK},
+		{name: "legacy with scheme header", scheme: crypto.SchemeRSA, body: legacyData, expectedStatus: http.StatusOK},
+		{name: "unknown scheme", scheme: "rot13", body: envelopeData, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.scheme != "" {
+				req.Header.Set(crypto.SchemeHeader, tt.scheme)
+			}
+
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write(body)
+			})
+			rr := httptest.NewRecorder()
+			DecryptMiddleware(nextHandler, crypto.NewNegotiatingDecryptorWithKey(key)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, string(plaintext), rr.Body.String())
+			}
+		})
+	}
+}
+
 // TestCheckTrustedIP tests the CheckTrustedIP middleware for various trust scenarios
 func TestCheckTrustedIP(t *testing.T) {
-	// Save and restore the original TrustedSubnet after test
-	originalTrustedSubnet := handlers.TrustedSubnet
-	defer func() { handlers.TrustedSubnet = originalTrustedSubnet }()
+	// Save and restore the original filter after test
+	originalFilter := ipfilter.DefaultFilter
+	defer func() { ipfilter.DefaultFilter = originalFilter }()
 
 	tests := []struct {
 		name           string
-		trustedSubnet  string
+		remoteAddr     string
 		realIP         string
+		forwardedFor   string
+		cfg            ipfilter.Config
 		expectedStatus int
 	}{
 		{
 			name:           "No TrustedSubnet set, should pass",
-			trustedSubnet:  "",
-			realIP:         "",
+			remoteAddr:     "10.0.0.1:1234",
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "TrustedSubnet set, X-Real-IP in subnet, should pass",
-			trustedSubnet:  "192.168.1.0/24",
-			realIP:         "192.168.1.42",
+			name:           "TrustedSubnet set, peer in subnet, should pass",
+			cfg:            ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			remoteAddr:     "192.168.1.42:1234",
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "TrustedSubnet set, X-Real-IP not in subnet, should fail",
-			trustedSubnet:  "192.168.1.0/24",
-			realIP:         "10.0.0.1",
+			name:           "TrustedSubnet set, peer not in subnet, should fail",
+			cfg:            ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			remoteAddr:     "10.0.0.1:1234",
 			expectedStatus: http.StatusForbidden,
 		},
 		{
-			name:           "TrustedSubnet set, missing X-Real-IP header, should fail",
-			trustedSubnet:  "192.168.1.0/24",
-			realIP:         "",
+			name:           "X-Real-IP from untrusted peer is ignored, should fail",
+			cfg:            ipfilter.Config{Allow: []string{"192.168.1.0/24"}},
+			remoteAddr:     "10.0.0.1:1234",
+			realIP:         "192.168.1.42",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "X-Real-IP from trusted proxy, should pass",
+			cfg:            ipfilter.Config{Allow: []string{"192.168.1.0/24"}, TrustedProxies: []string{"10.0.0.1"}},
+			remoteAddr:     "10.0.0.1:1234",
+			realIP:         "192.168.1.42",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "X-Forwarded-For from trusted proxy, should pass",
+			cfg:            ipfilter.Config{Allow: []string{"2001:db8::/32"}, TrustedProxies: []string{"10.0.0.0/8"}},
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   "203.0.113.7, 2001:db8::1, 10.0.0.2",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Denied subnet, should fail",
+			cfg:            ipfilter.Config{Deny: []string{"2001:db8::/32"}},
+			remoteAddr:     "[2001:db8::1]:1234",
 			expectedStatus: http.StatusForbidden,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			handlers.TrustedSubnet = tt.trustedSubnet
+			filter, err := ipfilter.NewReloadable(tt.cfg, "")
+			require.NoError(t, err)
+			ipfilter.DefaultFilter = filter
 
 			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
 			if tt.realIP != "" {
 				req.Header.Set("X-Real-IP", tt.realIP)
 			}
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
 
 			called := false
 			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -740,3 +1046,239 @@ func TestCheckTrustedIP(t *testing.T) {
 		})
 	}
 }
+
+func TestClientIdentityMw(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}}
+	tests := []struct {
+		name         string
+		state        *tls.ConnectionState
+		wantIdentity string
+	}{
+		{name: "without tls", state: nil, wantIdentity: ""},
+		{name: "verified certificate", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, wantIdentity: "agent-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/updates", nil)
+			req.TLS = tt.state
+
+			var identity string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ = mtls.IdentityFromContext(r.Context())
+			})
+			ClientIdentityMw(next).ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.wantIdentity, identity)
+		})
+	}
+}
+
+func TestCheckAgentPolicyMw(t *testing.T) {
+	policy, err := mtls.NewPolicy(map[string][]string{"agent-1": {"Alloc"}})
+	require.NoError(t, err)
+	mtls.DefaultPolicy = policy
+	defer func() { mtls.DefaultPolicy = nil }()
+
+	tests := []struct {
+		name           string
+		identity       string
+		metric         string
+		expectedStatus int
+	}{
+		{name: "allowed", identity: "agent-1", metric: "Alloc", expectedStatus: http.StatusOK},
+		{name: "forbidden metric", identity: "agent-1", metric: "Frees", expectedStatus: http.StatusForbidden},
+		{name: "without identity", identity: "", metric: "Alloc", expectedStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/update/gauge/"+tt.metric+"/1", nil)
+			req.SetPathValue("metric", tt.metric)
+			req = req.WithContext(mtls.WithIdentity(req.Context(), tt.identity))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			rr := httptest.NewRecorder()
+			CheckAgentPolicyMw(next).ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestDecryptMiddleware_KeyID(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+	keyRing, err := crypto.NewKeyRing(keyFile, time.Hour)
+	require.NoError(t, err)
+	keyID, err := crypto.KeyID(&key.PublicKey)
+	require.NoError(t, err)
+
+	plaintext := []byte(`{"id":"Alloc","type":"gauge","value":1}`)
+	encrypted, err := envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		keyID          string
+		expectedStatus int
+	}{
+		{name: "known key id", keyID: keyID, expectedStatus: http.StatusOK},
+		{name: "without key id", keyID: "", expectedStatus: http.StatusOK},
+		{name: "unknown key id", keyID: "0000000000000000", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encrypted))
+			req.Header.Set(crypto.SchemeHeader, crypto.SchemeEnvelope)
+			if tt.keyID != "" {
+				req.Header.Set(crypto.KeyIDHeader, tt.keyID)
+			}
+
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write(body)
+			})
+			rr := httptest.NewRecorder()
+			DecryptMiddleware(nextHandler, keyRing).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, string(plaintext), rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGZIPMiddleware_DecompressedLimit(t *testing.T) {
+	oldMaxBodySize := handlers.MaxBodySize
+	defer func() { handlers.MaxBodySize = oldMaxBodySize }()
+	handlers.MaxBodySize = 1024
+
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			rw.WriteHeader(handlers.BodyErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		size         int
+		expectedCode int
+	}{
+		{name: "within limit", size: 512, expectedCode: http.StatusOK},
+		{name: "gzip bomb", size: 256 << 10, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			zb := gzip.NewWriter(buf)
+			_, err := zb.Write(bytes.Repeat([]byte("0"), tt.size))
+			require.NoError(t, err)
+			require.NoError(t, zb.Close())
+			// сжатое тело меньше лимита, превышает его только распакованное
+			require.Less(t, buf.Len(), 1024)
+
+			req := httptest.NewRequest("POST", "/updates/", buf)
+			req.Header.Set("Content-Encoding", "gzip")
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			LimitBodyMw(GZIPMiddleware(handler)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
+
+func TestRateLimitMw(t *testing.T) {
+	oldLimiter, oldFilter := ratelimit.DefaultLimiter, ipfilter.DefaultFilter
+	defer func() { ratelimit.DefaultLimiter, ipfilter.DefaultFilter = oldLimiter, oldFilter }()
+	ratelimit.DefaultLimiter = ratelimit.NewLimiter(1, 2)
+	ipfilter.DefaultFilter = nil
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func(remoteAddr string, identity string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		if identity != "" {
+			req = req.WithContext(mtls.WithIdentity(req.Context(), identity))
+		}
+		rr := httptest.NewRecorder()
+		RateLimitMw(next).ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1000", "").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1001", "").Code)
+	rr := send("10.0.0.1:1002", "")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get(ratelimit.RetryAfterHeader))
+
+	// у другого адреса и у агента с сертификатом свои лимиты
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000", "").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1003", "agent-1").Code)
+}
+
+func TestRateLimitAuthMw(t *testing.T) {
+	oldLimiter, oldFilter := ratelimit.DefaultLimiter, ipfilter.DefaultFilter
+	defer func() { ratelimit.DefaultLimiter, ipfilter.DefaultFilter = oldLimiter, oldFilter }()
+	ratelimit.DefaultLimiter = ratelimit.NewLimiter(1, 1)
+	ipfilter.DefaultFilter = nil
+
+	// проверка агента пропускает запрос дальше только с заголовком X-Auth-Ok
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Auth-Ok") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RateLimitAuthMw(auth(RateLimitMw(next)))
+	send := func(remoteAddr string, authOk bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		if authOk {
+			req.Header.Set("X-Auth-Ok", "1")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1:1000", false).Code)
+	rr := send("10.0.0.1:1001", true)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, "failed auth spends the address token")
+	assert.Equal(t, "1", rr.Header().Get(ratelimit.RetryAfterHeader))
+
+	// прошедший проверку запрос тратит один токен, а не два
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000", true).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.2:1001", true).Code)
+}
+
+func TestCheckHashMiddleware_BodyLimit(t *testing.T) {
+	oldHashKey, oldMaxBodySize := handlers.HashKey, handlers.MaxBodySize
+	defer func() { handlers.HashKey, handlers.MaxBodySize = oldHashKey, oldMaxBodySize }()
+	handlers.HashKey = "secret"
+	handlers.MaxBodySize = 8
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("POST", "/updates/", strings.NewReader(`[{"id":"met1","type":"gauge","value":1}]`))
+	req.Header.Set("HashSHA256", "any")
+	rr := httptest.NewRecorder()
+	LimitBodyMw(CheckHashMiddleware(next)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
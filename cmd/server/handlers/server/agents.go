@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/security/agents"
+)
+
+// addAgentRequest тело запроса добавления агента
+type addAgentRequest struct {
+	ID string `json:"id"`
+}
+
+// ListAgents список зарегистрированных агентов без учетных данных
+func ListAgents(rw http.ResponseWriter, r *http.Request, registry *agents.Registry) {
+	if registry == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeAgentsJSON(rw, http.StatusOK, registry.List())
+}
+
+// AddAgent регистрирует агента, учетные данные возвращаются в ответе один раз
+func AddAgent(rw http.ResponseWriter, r *http.Request, registry *agents.Registry) {
+	if registry == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var request addAgentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.WriteDebugLog("cannot decode request JSON body", err.Error())
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	credentials, err := registry.Add(request.ID)
+	switch {
+	case errors.Is(err, agents.ErrInvalidAgentID):
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	case errors.Is(err, agents.ErrAgentExists):
+		rw.WriteHeader(http.StatusConflict)
+		return
+	case err != nil:
+		logger.WriteErrorLog(err.Error(), "AddAgent")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.WriteInfoLog("agent added", request.ID)
+	writeAgentsJSON(rw, http.StatusCreated, credentials)
+}
+
+// RevokeAgent отзывает агента из урла, его запросы больше не принимаются
+func RevokeAgent(rw http.ResponseWriter, r *http.Request, registry *agents.Registry) {
+	if registry == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id := r.PathValue("id")
+	err := registry.Revoke(id)
+	if errors.Is(err, agents.ErrUnknownAgent) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "RevokeAgent")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.WriteInfoLog("agent revoked", id)
+	rw.WriteHeader(http.StatusOK)
+}
+
+// writeAgentsJSON отправляет ответ в формате JSON
+func writeAgentsJSON(rw http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Agents")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if _, err = rw.Write(body); err != nil {
+		logger.WriteErrorLog(err.Error(), "Agents")
+	}
+}
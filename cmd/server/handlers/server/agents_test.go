@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/internal/security/agents"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+)
+
+func TestAddAgent(t *testing.T) {
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		registry   *agents.Registry
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "added", registry: registry, body: `{"id":"agent-1"}`, wantStatus: http.StatusCreated},
+		{name: "exists", registry: registry, body: `{"id":"agent-1"}`, wantStatus: http.StatusConflict},
+		{name: "invalid id", registry: registry, body: `{"id":"agent 1"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid body", registry: registry, body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "no registry", body: `{"id":"agent-1"}`, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			AddAgent(rw, httptest.NewRequest(http.MethodPost, "/admin/agents/", strings.NewReader(tt.body)), tt.registry)
+
+			res := rw.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var credentials agents.Credentials
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&credentials))
+			assert.Equal(t, "agent-1", credentials.ID)
+			assert.NoError(t, registry.CheckToken("agent-1", credentials.Token))
+		})
+	}
+}
+
+func TestListAndRevokeAgents(t *testing.T) {
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	credentials, err := registry.Add("agent-1")
+	require.NoError(t, err)
+
+	revoke := func(id string, registry *agents.Registry) int {
+		request := httptest.NewRequest(http.MethodPost, "/admin/agents/"+id+"/revoke", nil)
+		request.SetPathValue("id", id)
+		rw := httptest.NewRecorder()
+		RevokeAgent(rw, request, registry)
+		return rw.Code
+	}
+	assert.Equal(t, http.StatusOK, revoke("agent-1", registry))
+	assert.Equal(t, http.StatusNotFound, revoke("agent-2", registry))
+	assert.Equal(t, http.StatusNotFound, revoke("agent-1", nil))
+	assert.ErrorIs(t, registry.CheckToken("agent-1", credentials.Token), agents.ErrRevokedAgent)
+
+	rw := httptest.NewRecorder()
+	ListAgents(rw, httptest.NewRequest(http.MethodGet, "/admin/agents/", nil), registry)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	var list []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "agent-1", list[0]["id"])
+	assert.NotNil(t, list[0]["revoked_at"])
+	assert.NotContains(t, rw.Body.String(), credentials.Secret)
+
+	rw = httptest.NewRecorder()
+	ListAgents(rw, httptest.NewRequest(http.MethodGet, "/admin/agents/", nil), nil)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestRouter_AdminAgentsWithDecryptor(t *testing.T) {
+	originalRegistry := agents.DefaultRegistry
+	originalAdminToken := handlers.AdminToken
+	defer func() {
+		agents.DefaultRegistry = originalRegistry
+		handlers.AdminToken = originalAdminToken
+	}()
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	agents.DefaultRegistry = registry
+	handlers.AdminToken = "admin"
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	manager := crypto.NewCryptoManager()
+	manager.SetDefaultDecryptor(crypto.NewNegotiatingDecryptorWithKey(key))
+	router := Router(NewMemStorage(), manager, nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/admin/agents/", strings.NewReader(`{"id":"agent-1"}`))
+	request.Header.Set(agents.AuthorizationHeader, "Bearer admin")
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, request)
+	require.Equal(t, http.StatusCreated, rw.Code)
+	var credentials agents.Credentials
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &credentials))
+	assert.Equal(t, "agent-1", credentials.ID)
+
+	rw = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/admin/agents/", nil)
+	request.Header.Set(agents.AuthorizationHeader, "Bearer admin")
+	router.ServeHTTP(rw, request)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "agent-1")
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ramil063/gometrics/cmd/server/alerting"
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// Alerts метод выдачи алертов в формате json
+// по умолчанию выдаются сработавшие алерты, параметр state позволяет получить pending или resolved
+func Alerts(rw http.ResponseWriter, r *http.Request, engine *alerting.Engine) {
+	state := alerting.State(r.URL.Query().Get("state"))
+	switch state {
+	case "":
+		state = alerting.StateFiring
+	case alerting.StatePending, alerting.StateFiring, alerting.StateResolved:
+	default:
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := json.Marshal(engine.Alerts(state))
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Alerts")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(body)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Alerts")
+	}
+}
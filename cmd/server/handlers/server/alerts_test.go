@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/server/alerting"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+)
+
+func TestAlerts(t *testing.T) {
+	ms := NewMemStorage()
+	require.NoError(t, ms.SetGauge("Alloc", 150))
+	rule, err := alerting.ParseRule("Alloc > 100")
+	require.NoError(t, err)
+	engine := alerting.NewEngine([]alerting.Rule{rule}, ms)
+	engine.Evaluate(time.Unix(1700000000, 0))
+
+	tests := []struct {
+		engine     *alerting.Engine
+		name       string
+		query      string
+		wantBody   string
+		wantStatus int
+	}{
+		{
+			name:       "firing",
+			engine:     engine,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"active_at":"` + time.Unix(1700000000, 0).Format(time.RFC3339) + `"`,
+		},
+		{
+			name:       "pending empty",
+			engine:     engine,
+			query:      "?state=pending",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "no engine",
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "bad state",
+			engine:     engine,
+			query:      "?state=unknown",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			Alerts(rw, httptest.NewRequest(http.MethodGet, "/alerts"+tt.query, nil), tt.engine)
+
+			assert.Equal(t, tt.wantStatus, rw.Code)
+			if tt.wantBody != "" {
+				assert.Contains(t, rw.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRouter_Alerts(t *testing.T) {
+	ms := NewMemStorage()
+	require.NoError(t, ms.SetGauge("Alloc", 150))
+	rule, err := alerting.ParseRule("Alloc > 100")
+	require.NoError(t, err)
+	engine := alerting.NewEngine([]alerting.Rule{rule}, ms)
+	engine.Evaluate(time.Unix(1700000000, 0))
+
+	rw := httptest.NewRecorder()
+	Router(ms, crypto.NewCryptoManager(), engine).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"metric":"Alloc","state":"firing"`)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// LabelsQueryParam параметр запроса с условиями отбора по меткам
+const LabelsQueryParam = "labels"
+
+// ErrMetricNotFound под условия не подходит ни одна метрика
+var ErrMetricNotFound = errors.New("metric not found")
+
+// ErrAmbiguousMetric под условия подходит больше одной метрики
+var ErrAmbiguousMetric = errors.New("label matchers select more than one metric")
+
+// FindMetricKeys получение отсортированных ключей метрик типа mType с именем name, подходящих под условия по меткам
+func FindMetricKeys(ms Storager, mType string, name string, matchers []models.LabelMatcher) ([]string, error) {
+	var keys []string
+	switch mType {
+	case "gauge":
+		gauges, err := ms.GetGauges()
+		if err != nil {
+			return nil, err
+		}
+		keys = models.SortedKeys(gauges)
+	case "counter":
+		counters, err := ms.GetCounters()
+		if err != nil {
+			return nil, err
+		}
+		keys = models.SortedKeys(counters)
+	default:
+		return nil, errors.New("unknown metric type")
+	}
+
+	result := make([]string, 0)
+	for _, key := range keys {
+		keyName, labels, err := models.ParseMetricKey(key)
+		if err != nil || keyName != name {
+			continue
+		}
+		if models.MatchLabels(labels, matchers) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ResolveMetricKey получение ключа единственной метрики, подходящей под условия по меткам
+// если все условия на равенство, ключ строится без обращения к хранилищу
+func ResolveMetricKey(ms Storager, mType string, name string, matchers []models.LabelMatcher) (string, error) {
+	labels := make(map[string]string, len(matchers))
+	exact := true
+	for _, m := range matchers {
+		if m.Type != models.MatchEqual {
+			exact = false
+			break
+		}
+		labels[m.Name] = m.Value
+	}
+	if exact {
+		return models.MetricKey(name, labels), nil
+	}
+
+	keys, err := FindMetricKeys(ms, mType, name, matchers)
+	if err != nil {
+		return "", err
+	}
+	switch len(keys) {
+	case 0:
+		return "", ErrMetricNotFound
+	case 1:
+		return keys[0], nil
+	}
+	return "", ErrAmbiguousMetric
+}
+
+// metricKeyFromRequest получение ключа метрики по пути запроса и параметру labels
+// в случае ошибки возвращает http статус ответа
+func metricKeyFromRequest(r *http.Request, ms Storager) (string, int, error) {
+	matchers, err := models.ParseLabelMatchers(r.URL.Query().Get(LabelsQueryParam))
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	key, err := ResolveMetricKey(ms, r.PathValue("type"), r.PathValue("metric"), matchers)
+	switch {
+	case errors.Is(err, ErrMetricNotFound):
+		return "", http.StatusNotFound, err
+	case errors.Is(err, ErrAmbiguousMetric):
+		return "", http.StatusBadRequest, err
+	case err != nil:
+		return "", http.StatusInternalServerError, err
+	}
+	return key, http.StatusOK, nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+)
+
+func newLabelsStorage(t *testing.T) Storager {
+	ms := NewMemStorage()
+	require.NoError(t, ms.SetGauge("cpu", 9))
+	require.NoError(t, ms.SetGauge(models.MetricKey("cpu", map[string]string{"core": "0", "host": "a"}), 1))
+	require.NoError(t, ms.SetGauge(models.MetricKey("cpu", map[string]string{"core": "1", "host": "a"}), 2))
+	require.NoError(t, ms.SetGauge(models.MetricKey("mem", map[string]string{"host": "a"}), 3))
+	require.NoError(t, ms.AddCounter(models.MetricKey("requests", map[string]string{"host": "b"}), 4))
+	return ms
+}
+
+func TestFindMetricKeys(t *testing.T) {
+	ms := newLabelsStorage(t)
+
+	tests := []struct {
+		name     string
+		mType    string
+		metric   string
+		matchers string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:   "all series of metric",
+			mType:  "gauge",
+			metric: "cpu",
+			want:   []string{"cpu", `cpu{core="0",host="a"}`, `cpu{core="1",host="a"}`},
+		},
+		{
+			name:     "regexp matcher",
+			mType:    "gauge",
+			metric:   "cpu",
+			matchers: `core=~"1|2"`,
+			want:     []string{`cpu{core="1",host="a"}`},
+		},
+		{
+			name:     "counter",
+			mType:    "counter",
+			metric:   "requests",
+			matchers: `host!="a"`,
+			want:     []string{`requests{host="b"}`},
+		},
+		{
+			name:    "unknown type",
+			mType:   "unknown",
+			metric:  "cpu",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := models.ParseLabelMatchers(tt.matchers)
+			require.NoError(t, err)
+
+			got, err := FindMetricKeys(ms, tt.mType, tt.metric, matchers)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveMetricKey(t *testing.T) {
+	ms := newLabelsStorage(t)
+
+	tests := []struct {
+		wantErr  error
+		name     string
+		matchers string
+		want     string
+	}{
+		{name: "no matchers", want: "cpu"},
+		{name: "exact labels", matchers: `host="a",core="1"`, want: `cpu{core="1",host="a"}`},
+		{name: "single match", matchers: `core=~"0"`, want: `cpu{core="0",host="a"}`},
+		{name: "not found", matchers: `core=~"5"`, wantErr: ErrMetricNotFound},
+		{name: "ambiguous", matchers: `host=~"a"`, wantErr: ErrAmbiguousMetric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := models.ParseLabelMatchers(tt.matchers)
+			require.NoError(t, err)
+
+			got, err := ResolveMetricKey(ms, "gauge", "cpu", matchers)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_getValueWithLabels(t *testing.T) {
+	handlers.Restore = false
+	ms := newLabelsStorage(t)
+	manager := crypto.NewCryptoManager()
+	ts := httptest.NewServer(Router(ms, manager, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		response string
+		code     int
+	}{
+		{name: "without labels", url: "/value/gauge/cpu", code: 200, response: "9"},
+		{name: "exact labels", url: "/value/gauge/cpu?labels=" + url.QueryEscape(`{core="1",host="a"}`), code: 200, response: "2"},
+		{name: "regexp labels", url: "/value/gauge/cpu?labels=" + url.QueryEscape(`core=~"0"`), code: 200, response: "1"},
+		{name: "counter labels", url: "/value/counter/requests?labels=" + url.QueryEscape(`host="b"`), code: 200, response: "4"},
+		{name: "not found", url: "/value/gauge/cpu?labels=" + url.QueryEscape(`core=~"7"`), code: 404},
+		{name: "ambiguous", url: "/value/gauge/cpu?labels=" + url.QueryEscape(`core=~".+"`), code: 400},
+		{name: "bad matchers", url: "/value/gauge/cpu?labels=" + url.QueryEscape(`core=1`), code: 400},
+		{name: "history with labels", url: "/history/gauge/mem?labels=" + url.QueryEscape(`host=~"a"`), code: 200, response: `"value":3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, "GET", tt.url)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+			assert.Contains(t, body, tt.response)
+		})
+	}
+}
@@ -1,12 +1,11 @@
 package server
 
 import (
-	"fmt"
-	"reflect"
-	"strconv"
+	"context"
 	"time"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
+	"github.com/ramil063/gometrics/cmd/agent/collector"
+	metricsHandler "github.com/ramil063/gometrics/cmd/agent/handlers/metrics"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
 )
@@ -20,8 +19,7 @@ func SaveMetricsPerTime(workTime int, ticker *time.Ticker, s Storager) error {
 		select {
 		case <-ticker.C:
 			workSecond++
-			m := storage.NewMonitor()
-			err := PrepareMetricsValues(s, m)
+			err := PrepareMetricsValues(s, collectServerMetrics())
 			if err != nil {
 				ticker.Stop()
 				return err
@@ -34,25 +32,17 @@ func SaveMetricsPerTime(workTime int, ticker *time.Ticker, s Storager) error {
 }
 
 // PrepareMetricsValues подготовка значений метрик
-func PrepareMetricsValues(s Storager, m *storage.Monitor) error {
-	v := reflect.ValueOf(m).Elem()
-	typeOfS := v.Type()
-
-	for i := 0; i < v.NumField(); i++ {
-		metricID := typeOfS.Field(i).Name
-		if metricID == "mx" {
-			continue
-		}
-		metricValue, _ := strconv.ParseFloat(fmt.Sprintf("%v", v.Field(i).Interface()), 64)
-
-		if typeOfS.Field(i).Name == "PollCount" {
-			err := s.AddCounter(metricID, models.Counter(1))
+func PrepareMetricsValues(s Storager, metrics []models.Metrics) error {
+	for _, metric := range metrics {
+		switch {
+		case metric.Delta != nil:
+			err := s.AddCounter(metric.Key(), models.Counter(*metric.Delta))
 			if err != nil {
 				logger.WriteErrorLog(err.Error(), "Counter")
 				return err
 			}
-		} else {
-			err := s.SetGauge(metricID, models.Gauge(metricValue))
+		case metric.Value != nil:
+			err := s.SetGauge(metric.Key(), models.Gauge(*metric.Value))
 			if err != nil {
 				logger.WriteErrorLog(err.Error(), "Gauge")
 				return err
@@ -61,3 +51,12 @@ func PrepareMetricsValues(s Storager, m *storage.Monitor) error {
 	}
 	return nil
 }
+
+// collectServerMetrics собственные метрики сервера: runtime, случайное значение и один опрос PollCount
+func collectServerMetrics() []models.Metrics {
+	registry := collector.NewRegistry()
+	_ = registry.Register(collector.NewRuntimeCollector(), collector.Settings{Enabled: true})
+	_ = registry.Register(collector.NewRandomCollector(), collector.Settings{Enabled: true})
+	registry.Poll(context.Background(), time.Now())
+	return metricsHandler.GetMetricsCollection(registry, 1)
+}
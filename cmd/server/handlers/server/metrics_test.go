@@ -6,33 +6,44 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
-	"github.com/ramil063/gometrics/cmd/agent/storage"
+	"github.com/ramil063/gometrics/internal/models"
 )
 
 func TestPrepareMetricsValues(t *testing.T) {
-	type args struct {
-		ms Storager
-		m  *storage.Monitor
-	}
-	a := args{
-		ms: NewMemStorage(),
-		m:  storage.NewMonitor(),
-	}
+	value := 1.5
+	delta := int64(2)
 	tests := []struct {
-		args args
-		name string
+		name    string
+		metrics []models.Metrics
 	}{
 		{
-			name: "test 1",
-			args: a,
+			name:    "server metrics",
+			metrics: collectServerMetrics(),
+		},
+		{
+			name: "gauge and counter with labels",
+			metrics: []models.Metrics{
+				{ID: "cpu", MType: "gauge", Value: &value, Labels: map[string]string{"core": "0"}},
+				{ID: "PollCount", MType: "counter", Delta: &delta},
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := PrepareMetricsValues(tt.args.ms, tt.args.m)
+			ms := NewMemStorage()
+			err := PrepareMetricsValues(ms, tt.metrics)
 			assert.NoError(t, err)
-			pc, _ := tt.args.ms.GetCounter("PollCount")
-			assert.Equal(t, pc, int64(tt.args.m.PollCount+1))
+			for _, m := range tt.metrics {
+				if m.Delta != nil {
+					got, err := ms.GetCounter(m.Key())
+					assert.NoError(t, err)
+					assert.Equal(t, *m.Delta, got)
+					continue
+				}
+				got, err := ms.GetGauge(m.Key())
+				assert.NoError(t, err)
+				assert.Equal(t, *m.Value, got)
+			}
 		})
 	}
 }
@@ -57,7 +68,7 @@ func TestSaveMetricsPerTime(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			SaveMetricsPerTime(tt.args.workTime, tt.args.ticker, GetStorage("", ""))
+			SaveMetricsPerTime(tt.args.workTime, tt.args.ticker, NewMemStorage())
 		})
 	}
 }
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// PrometheusContentType тип содержимого текстового формата Prometheus
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prometheus метод выдачи всех метрик в текстовом формате Prometheus
+func Prometheus(rw http.ResponseWriter, r *http.Request, ms Storager, prefix string) {
+	gauges, err := ms.GetGauges()
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "GetGauges")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	counters, err := ms.GetCounters()
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "GetCounters")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", PrometheusContentType)
+	rw.WriteHeader(http.StatusOK)
+
+	if err = WritePrometheus(rw, gauges, counters, prefix); err != nil {
+		logger.WriteErrorLog(err.Error(), "WritePrometheus")
+	}
+}
+
+// WritePrometheus запись метрик в текстовом формате Prometheus
+// метрики группируются по имени и выводятся отсортированными, метки ключа хранения выводятся в фигурных скобках,
+// повторяющиеся после очистки имен ряды и имена с другим типом пропускаются
+func WritePrometheus(w io.Writer, gauges map[string]models.Gauge, counters map[string]models.Counter, prefix string) error {
+	families := make([]*prometheusFamily, 0)
+	byName := make(map[string]*prometheusFamily)
+	written := make(map[string]bool, len(gauges)+len(counters))
+
+	add := func(key string, mType string, value string) {
+		name, labels, err := models.ParseMetricKey(key)
+		if err != nil {
+			logger.WriteDebugLog(err.Error(), "ParseMetricKey")
+			name, labels = key, nil
+		}
+		promName := PrometheusName(prefix, name)
+		series := models.MetricKey(promName, prometheusLabels(labels))
+
+		family, ok := byName[promName]
+		if !ok {
+			family = &prometheusFamily{name: promName, mType: mType}
+			byName[promName] = family
+			families = append(families, family)
+		}
+		if family.mType != mType || written[series] {
+			logger.WriteDebugLog("duplicate prometheus metric name", series)
+			return
+		}
+		written[series] = true
+		family.lines = append(family.lines, series+" "+value)
+	}
+
+	for _, key := range models.SortedKeys(gauges) {
+		add(key, "gauge", formatPrometheusFloat(float64(gauges[key])))
+	}
+	for _, key := range models.SortedKeys(counters) {
+		add(key, "counter", strconv.FormatInt(int64(counters[key]), 10))
+	}
+
+	// gauge метрики выводятся перед counter, внутри типа по имени
+	sort.SliceStable(families, func(i, j int) bool {
+		if families[i].mType != families[j].mType {
+			return families[i].mType == "gauge"
+		}
+		return families[i].name < families[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, family := range families {
+		bw.WriteString("# TYPE " + family.name + " " + family.mType + "\n")
+		for _, line := range family.lines {
+			bw.WriteString(line + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// prometheusFamily ряды метрики одного имени
+type prometheusFamily struct {
+	name  string
+	mType string
+	lines []string
+}
+
+// prometheusLabels очистка имен меток до допустимых в Prometheus ([a-zA-Z_][a-zA-Z0-9_]*)
+func prometheusLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(labels))
+	for name, value := range labels {
+		result[strings.ReplaceAll(PrometheusName("", name), ":", "_")] = value
+	}
+	return result
+}
+
+// PrometheusName получение имени метрики, допустимого в Prometheus ([a-zA-Z_:][a-zA-Z0-9_:]*)
+func PrometheusName(prefix string, name string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	full := prefix + name
+
+	var b strings.Builder
+	b.Grow(len(full) + 1)
+	for i, ch := range full {
+		isLetter := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_' || ch == ':'
+		isDigit := ch >= '0' && ch <= '9'
+		switch {
+		case isLetter:
+			b.WriteRune(ch)
+		case isDigit && i == 0:
+			b.WriteByte('_')
+			b.WriteRune(ch)
+		case isDigit:
+			b.WriteRune(ch)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func formatPrometheusFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+)
+
+func TestPrometheusName(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		metric string
+		want   string
+	}{
+		{name: "no prefix", prefix: "", metric: "HeapAlloc", want: "HeapAlloc"},
+		{name: "prefix", prefix: "gometrics", metric: "HeapAlloc", want: "gometrics_HeapAlloc"},
+		{name: "prefix with underscore", prefix: "gometrics_", metric: "HeapAlloc", want: "gometrics_HeapAlloc"},
+		{name: "invalid chars", prefix: "", metric: "cpu.usage-1 %", want: "cpu_usage_1__"},
+		{name: "leading digit", prefix: "", metric: "1metric", want: "_1metric"},
+		{name: "empty", prefix: "", metric: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PrometheusName(tt.prefix, tt.metric))
+		})
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	tests := []struct {
+		gauges   map[string]models.Gauge
+		counters map[string]models.Counter
+		name     string
+		prefix   string
+		want     string
+	}{
+		{
+			name:     "gauges and counters",
+			gauges:   map[string]models.Gauge{"b": 2.5, "a": 1},
+			counters: map[string]models.Counter{"PollCount": 5},
+			prefix:   "app",
+			want: "# TYPE app_a gauge\napp_a 1\n" +
+				"# TYPE app_b gauge\napp_b 2.5\n" +
+				"# TYPE app_PollCount counter\napp_PollCount 5\n",
+		},
+		{
+			name:     "special values and duplicates",
+			gauges:   map[string]models.Gauge{"a.b": models.Gauge(math.Inf(1)), "a_b": 1},
+			counters: map[string]models.Counter{"a-b": 1},
+			want:     "# TYPE a_b gauge\na_b +Inf\n",
+		},
+		{
+			name: "labels",
+			gauges: map[string]models.Gauge{
+				`cpu{core="1",host="a"}`: 2,
+				`cpu{core="0",host="a"}`: 1,
+				"cpu_total":              3,
+			},
+			counters: map[string]models.Counter{`requests{path="/a\\b"}`: 4},
+			want: "# TYPE cpu gauge\n" +
+				`cpu{core="0",host="a"} 1` + "\n" +
+				`cpu{core="1",host="a"} 2` + "\n" +
+				"# TYPE cpu_total gauge\ncpu_total 3\n" +
+				"# TYPE requests counter\n" +
+				`requests{path="/a\\b"} 4` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WritePrometheus(&buf, tt.gauges, tt.counters, tt.prefix)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	handlers.Restore = false
+	handlers.MetricsPrefix = "gometrics"
+	defer func() { handlers.MetricsPrefix = "" }()
+	ms := NewMemStorage()
+	manager := crypto.NewCryptoManager()
+	ts := httptest.NewServer(Router(ms, manager, nil))
+	defer ts.Close()
+
+	assert.NoError(t, ms.SetGauge("HeapAlloc", 100))
+	assert.NoError(t, ms.AddCounter("PollCount", 3))
+
+	resp, body := testRequest(t, ts, "GET", "/metrics")
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, PrometheusContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# TYPE gometrics_HeapAlloc gauge\ngometrics_HeapAlloc 100\n"+
+		"# TYPE gometrics_PollCount counter\ngometrics_PollCount 3\n", body)
+}
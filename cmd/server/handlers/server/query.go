@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/query"
+	"github.com/ramil063/gometrics/cmd/server/retention"
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// Query метод вычисления выражения языка запросов (параметр query), результат - ряды в формате json
+// мгновенный запрос вычисляется в момент time (по умолчанию текущее время),
+// запрос по диапазону - от start до end (по умолчанию текущее время) с шагом step (длительность или секунды),
+// время задается как в GetHistory, ошибка разбора запроса возвращается в теле ответа
+func Query(rw http.ResponseWriter, r *http.Request, ms Storager) {
+	params := r.URL.Query()
+	expr, err := query.Parse(params.Get("query"))
+	if err != nil {
+		writeQueryError(rw, err)
+		return
+	}
+
+	now := time.Now()
+	var start, end time.Time
+	var step time.Duration
+	if params.Get("start") != "" {
+		if start, err = parseTimeParam(params.Get("start"), now); err != nil {
+			writeQueryError(rw, fmt.Errorf("invalid start: %w", err))
+			return
+		}
+		if end, err = parseTimeParam(params.Get("end"), now); err != nil {
+			writeQueryError(rw, fmt.Errorf("invalid end: %w", err))
+			return
+		}
+		if step, err = parseStepParam(params.Get("step")); err != nil {
+			writeQueryError(rw, fmt.Errorf("invalid step: %w", err))
+			return
+		}
+	} else if end, err = parseTimeParam(params.Get("time"), now); err != nil {
+		writeQueryError(rw, fmt.Errorf("invalid time: %w", err))
+		return
+	}
+
+	period := query.NewRange(start, end, step)
+	if err = period.Validate(); err != nil {
+		writeQueryError(rw, err)
+		return
+	}
+
+	series, err := query.Evaluate(ms, expr, period, now)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Query")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.Marshal(series)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "Query")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if _, err = rw.Write(body); err != nil {
+		logger.WriteErrorLog(err.Error(), "Query")
+	}
+}
+
+// parseStepParam разбор шага запроса по диапазону: длительность (15s, 1m) или число секунд, пустое значение - шаг по умолчанию
+func parseStepParam(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		value = strconv.FormatFloat(seconds, 'f', -1, 64) + "s"
+	}
+	step, err := retention.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if step <= 0 {
+		return 0, fmt.Errorf("step %q must be positive", value)
+	}
+	return step, nil
+}
+
+// writeQueryError ответ на некорректный запрос с текстом ошибки
+func writeQueryError(rw http.ResponseWriter, err error) {
+	logger.WriteDebugLog(err.Error(), "Query")
+	rw.WriteHeader(http.StatusBadRequest)
+	if _, err = rw.Write([]byte(err.Error())); err != nil {
+		logger.WriteErrorLog(err.Error(), "Query")
+	}
+}
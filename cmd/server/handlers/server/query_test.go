@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/query"
+	"github.com/ramil063/gometrics/internal/security/crypto"
+)
+
+func TestQuery(t *testing.T) {
+	handlers.Restore = false
+	ms := NewMemStorage()
+	ts := httptest.NewServer(Router(ms, crypto.NewCryptoManager(), nil))
+	defer ts.Close()
+
+	require.NoError(t, ms.SetGauge(`cpu{host="a"}`, 10))
+	require.NoError(t, ms.SetGauge(`cpu{host="b"}`, 30))
+	require.NoError(t, ms.AddCounter("PollCount", 5))
+
+	start := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	end := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	tests := []struct {
+		name       string
+		params     url.Values
+		wantBody   string
+		wantSeries int
+		wantStatus int
+	}{
+		{
+			name:       "selector",
+			params:     url.Values{"query": {`cpu{host="a"}`}},
+			wantStatus: http.StatusOK,
+			wantSeries: 1,
+		},
+		{
+			name:       "aggregation",
+			params:     url.Values{"query": {"sum(cpu)"}},
+			wantStatus: http.StatusOK,
+			wantSeries: 1,
+			wantBody:   `"value":40`,
+		},
+		{
+			name:       "range",
+			params:     url.Values{"query": {"cpu*"}, "start": {start}, "end": {end}, "step": {"15"}},
+			wantStatus: http.StatusOK,
+			wantSeries: 2,
+		},
+		{
+			name:       "past time",
+			params:     url.Values{"query": {"cpu"}, "time": {"0"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "parse error",
+			params:     url.Values{"query": {"sum(cpu"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "expected ')'",
+		},
+		{
+			name:       "bad step",
+			params:     url.Values{"query": {"cpu"}, "start": {start}, "step": {"-1m"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too many steps",
+			params:     url.Values{"query": {"cpu"}, "start": {"0"}, "step": {"1s"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad time",
+			params:     url.Values{"query": {"cpu"}, "time": {"yesterday"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/query?" + tt.params.Encode())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantBody != "" {
+				assert.Contains(t, string(body), tt.wantBody)
+			}
+			if tt.wantSeries > 0 {
+				var series []query.Series
+				require.NoError(t, json.Unmarshal(body, &series))
+				assert.Len(t, series, tt.wantSeries)
+			}
+		})
+	}
+}
+
+func Test_parseStepParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "15", want: 15 * time.Second},
+		{value: "0.5", want: 500 * time.Millisecond},
+		{value: "1m", want: time.Minute},
+		{value: "1d", want: 24 * time.Hour},
+		{value: "0", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseStepParam(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,21 +2,27 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/pprof"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
-	agentStorage "github.com/ramil063/gometrics/cmd/agent/storage"
+	"github.com/ramil063/gometrics/cmd/server/alerting"
+	"github.com/ramil063/gometrics/cmd/server/handlers"
 	"github.com/ramil063/gometrics/cmd/server/handlers/middlewares"
+	"github.com/ramil063/gometrics/cmd/server/retention"
 	"github.com/ramil063/gometrics/cmd/server/storage/db"
 	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 // MaxSaverWorkTime максимальное время работы сохранения метрик
@@ -36,83 +42,148 @@ type Counterer interface {
 	GetCounters() (map[string]models.Counter, error)
 }
 
+// Historian получает историю значений метрик
+type Historian interface {
+	GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error)
+}
+
+// Batcher сохраняет пачку метрик атомарно, результат содержит итоговые значения в порядке пачки
+type Batcher interface {
+	UpdateBatch(metrics []models.Metrics) ([]models.Metrics, error)
+}
+
 // Storager сохраняет и получает метрики
 type Storager interface {
 	Gauger
 	Counterer
+	Historian
 }
 
-// Router маршрутизация
-func Router(s Storager, manager *crypto.Manager) chi.Router {
+// Router маршрутизация, engine движок алертинга для /alerts, nil если правила не заданы
+func Router(s Storager, manager *crypto.Manager, engine *alerting.Engine) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(logger.ResponseLogger)
 	r.Use(logger.RequestLogger)
 	r.Use(middlewares.CheckTrustedIP)
+	r.Use(middlewares.ClientIdentityMw)
+	r.Use(middlewares.LimitBodyMw)
 	r.Use(middlewares.GZIPMiddleware)
-	PreparedDecryptMiddleware := func(next http.Handler) http.Handler {
-		return middlewares.DecryptMiddleware(next, manager.GetDefaultDecryptor())
-	}
-	r.Use(PreparedDecryptMiddleware)
-	r.Use(middlewares.CheckMethodMw)
 
-	homeHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
-		Home(rw, r, s)
-	}
-	r.Get("/", homeHandlerFunction)
+	// администратор шифрованием агентов не пользуется, поэтому его запросы не расшифровываются
+	r.Route("/admin/agents", func(r chi.Router) {
+		r.Use(middlewares.CheckMethodMw)
+		r.Use(middlewares.CheckAdminTokenMw)
+		r.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+			ListAgents(rw, r, agents.DefaultRegistry)
+		})
+		r.Post("/", func(rw http.ResponseWriter, r *http.Request) {
+			AddAgent(rw, r, agents.DefaultRegistry)
+		})
+		r.Post("/{id}/revoke", func(rw http.ResponseWriter, r *http.Request) {
+			RevokeAgent(rw, r, agents.DefaultRegistry)
+		})
+	})
 
-	r.Get("/ping", Ping)
+	r.Group(func(r chi.Router) {
+		PreparedDecryptMiddleware := func(next http.Handler) http.Handler {
+			return middlewares.DecryptMiddleware(next, manager.GetDefaultDecryptor())
+		}
+		r.Use(PreparedDecryptMiddleware)
+		r.Use(middlewares.CheckMethodMw)
 
-	r.Route("/updates", func(r chi.Router) {
-		r.Use(middlewares.CheckHashMiddleware)
-		updatesHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
-			Updates(rw, r, s)
+		homeHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
+			Home(rw, r, s)
 		}
-		r.With(middlewares.CheckPostMethodMw).Post("/", updatesHandlerFunction)
-	})
+		r.Get("/", homeHandlerFunction)
 
-	r.Route("/update", func(r chi.Router) {
-		r.Route("/{type}/{metric}", func(r chi.Router) {
-			r.Use(middlewares.CheckMetricsTypeMw)
-			r.Use(middlewares.CheckUpdateMetricsNameMw)
-			updateHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
-				Update(rw, req, s)
+		r.Get("/ping", Ping)
+
+		prometheusHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
+			Prometheus(rw, r, s, handlers.MetricsPrefix)
+		}
+		r.Get("/metrics", prometheusHandlerFunction)
+
+		alertsHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
+			Alerts(rw, r, engine)
+		}
+		r.Get("/alerts", alertsHandlerFunction)
+
+		queryHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
+			Query(rw, r, s)
+		}
+		r.Get("/query", queryHandlerFunction)
+
+		r.Route("/updates", func(r chi.Router) {
+			// лимит считается по агенту, поэтому ограничитель идет после проверки агента,
+			// а до проверки отклоняются запросы клиентов, исчерпавших лимит неудачными проверками
+			r.Use(middlewares.RateLimitAuthMw)
+			r.Use(middlewares.CheckHashMiddleware)
+			r.Use(middlewares.RateLimitMw)
+			updatesHandlerFunction := func(rw http.ResponseWriter, r *http.Request) {
+				Updates(rw, r, s)
 			}
-			r.With(middlewares.CheckUpdateMetricsValueMw).Post("/", updateHandlerFunction)
-			r.With(middlewares.CheckUpdateMetricsValueMw).Post("/{value}", updateHandlerFunction)
+			r.With(middlewares.CheckPostMethodMw).Post("/", updatesHandlerFunction)
 		})
 
-		updateMetricsJSONHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
-			UpdateMetricsJSON(rw, req, s)
-		}
-		r.With(middlewares.CheckPostMethodMw).Post("/", updateMetricsJSONHandlerFunction)
-	})
-	r.Route("/value", func(r chi.Router) {
-		r.Route("/{type}/{metric}", func(r chi.Router) {
+		r.Route("/update", func(r chi.Router) {
+			// лимит считается по агенту, поэтому ограничитель идет после проверки агента,
+			// а до проверки отклоняются запросы клиентов, исчерпавших лимит неудачными проверками
+			r.Use(middlewares.RateLimitAuthMw)
+			r.Use(middlewares.CheckHashMiddleware)
+			r.Use(middlewares.RateLimitMw)
+			r.Route("/{type}/{metric}", func(r chi.Router) {
+				r.Use(middlewares.CheckMetricsTypeMw)
+				r.Use(middlewares.CheckUpdateMetricsNameMw)
+				r.Use(middlewares.CheckAgentPolicyMw)
+				updateHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
+					Update(rw, req, s)
+				}
+				r.With(middlewares.CheckUpdateMetricsValueMw).Post("/", updateHandlerFunction)
+				r.With(middlewares.CheckUpdateMetricsValueMw).Post("/{value}", updateHandlerFunction)
+			})
+
+			updateMetricsJSONHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
+				UpdateMetricsJSON(rw, req, s)
+			}
+			r.With(middlewares.CheckPostMethodMw).Post("/", updateMetricsJSONHandlerFunction)
+		})
+		r.Route("/value", func(r chi.Router) {
+			r.Route("/{type}/{metric}", func(r chi.Router) {
+				r.Use(middlewares.CheckMetricsTypeMw)
+				r.Use(middlewares.CheckValueMetricsMw)
+				getValueHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
+					GetValue(rw, req, s)
+				}
+				r.Get("/", getValueHandlerFunction)
+			})
+
+			getValueMetricsJSONHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
+				GetValueMetricsJSON(rw, req, s)
+			}
+			r.With(middlewares.CheckPostMethodMw).Post("/", getValueMetricsJSONHandlerFunction)
+		})
+
+		r.Route("/history/{type}/{metric}", func(r chi.Router) {
 			r.Use(middlewares.CheckMetricsTypeMw)
 			r.Use(middlewares.CheckValueMetricsMw)
-			getValueHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
-				GetValue(rw, req, s)
+			getHistoryHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
+				GetHistory(rw, req, s)
 			}
-			r.Get("/", getValueHandlerFunction)
+			r.Get("/", getHistoryHandlerFunction)
 		})
 
-		getValueMetricsJSONHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
-			GetValueMetricsJSON(rw, req, s)
-		}
-		r.With(middlewares.CheckPostMethodMw).Post("/", getValueMetricsJSONHandlerFunction)
+		r.HandleFunc("/debug/pprof/", pprof.Index)
+		r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		// Для heap/goroutine/block:
+		r.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+		r.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+		r.Handle("/debug/pprof/block", pprof.Handler("block"))
 	})
 
-	r.HandleFunc("/debug/pprof/", pprof.Index)
-	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	// Для heap/goroutine/block:
-	r.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-	r.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-	r.Handle("/debug/pprof/block", pprof.Handler("block"))
-
 	return r
 }
 
@@ -147,9 +218,15 @@ func Update(rw http.ResponseWriter, r *http.Request, ms Storager) {
 }
 
 // GetValue метод получения данных из метрики
+// условия отбора по меткам передаются параметром labels, например labels={host="a",core=~"1|2"}
 func GetValue(rw http.ResponseWriter, r *http.Request, ms Storager) {
 	metricType := r.PathValue("type")
-	metricName := r.PathValue("metric")
+	metricName, statusCode, err := metricKeyFromRequest(r, ms)
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "GetValue labels")
+		rw.WriteHeader(statusCode)
+		return
+	}
 
 	switch metricType {
 	case "gauge":
@@ -183,6 +260,85 @@ func GetValue(rw http.ResponseWriter, r *http.Request, ms Storager) {
 	}
 }
 
+// GetHistory метод получения истории значений метрики за период
+// период задается параметрами from и to (unix время в секундах или RFC3339)
+// метрика с метками выбирается параметром labels, как в GetValue
+// шаг истории выбирается по политике хранения, параметр resolution (raw или длительность) задает его явно,
+// фактический шаг возвращается в заголовке X-Resolution
+func GetHistory(rw http.ResponseWriter, r *http.Request, ms Storager) {
+	metricType := r.PathValue("type")
+	metricName, statusCode, err := metricKeyFromRequest(r, ms)
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "GetHistory labels")
+		rw.WriteHeader(statusCode)
+		return
+	}
+
+	from, err := parseTimeParam(r.URL.Query().Get("from"), time.Time{})
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "GetHistory from")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "GetHistory to")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resolution := retention.DefaultCompactor.Resolution(metricName, from, to, time.Now())
+	if value := r.URL.Query().Get("resolution"); value != "" {
+		if resolution, err = parseResolutionParam(value); err != nil {
+			logger.WriteDebugLog(err.Error(), "GetHistory resolution")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	samples, resolution, err := retention.ReadHistory(ms, metricType, metricName, resolution, from, to)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "GetHistory")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("X-Resolution", retention.FormatResolution(resolution))
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	if err = enc.Encode(samples); err != nil {
+		logger.WriteErrorLog("error encoding response", err.Error())
+	}
+}
+
+// parseTimeParam разбор параметра времени запроса, пустое значение заменяется значением по умолчанию
+func parseTimeParam(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseResolutionParam разбор параметра шага истории: raw или длительность
+func parseResolutionParam(value string) (time.Duration, error) {
+	if value == "raw" {
+		return retention.RawResolution, nil
+	}
+	resolution, err := retention.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if resolution <= 0 {
+		return 0, fmt.Errorf("invalid resolution %q", value)
+	}
+	return resolution, nil
+}
+
 // Home метод получения данных из всех метрик
 func Home(rw http.ResponseWriter, r *http.Request, ms Storager) {
 	rw.Header().Set("Content-Type", "text/html")
@@ -242,7 +398,19 @@ func UpdateMetricsJSON(rw http.ResponseWriter, r *http.Request, s Storager) {
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&metrics); err != nil {
 		logger.WriteDebugLog("cannot decode request JSON body", err.Error())
-		rw.WriteHeader(http.StatusInternalServerError)
+		rw.WriteHeader(handlers.BodyErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if err := models.ValidateMetricKey(metrics.ID, metrics.Labels); err != nil {
+		logger.WriteDebugLog(err.Error(), "UpdateMetricsJSON")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := mtls.DefaultPolicy.Authorize(r.Context(), metrics.ID); err != nil {
+		logger.WriteDebugLog(err.Error(), "agent policy")
+		rw.WriteHeader(http.StatusForbidden)
 		return
 	}
 
@@ -253,20 +421,20 @@ func UpdateMetricsJSON(rw http.ResponseWriter, r *http.Request, s Storager) {
 
 	switch metrics.MType {
 	case "gauge":
-		err := s.SetGauge(metrics.ID, models.Gauge(*metrics.Value))
+		err := s.SetGauge(metrics.Key(), models.Gauge(*metrics.Value))
 		if err != nil {
 			logger.WriteErrorLog(err.Error(), "SetGauge")
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	case "counter":
-		err := s.AddCounter(metrics.ID, models.Counter(*metrics.Delta))
+		err := s.AddCounter(metrics.Key(), models.Counter(*metrics.Delta))
 		if err != nil {
 			logger.WriteErrorLog(err.Error(), "AddCounter")
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		newCounter, err := s.GetCounter(metrics.ID)
+		newCounter, err := s.GetCounter(metrics.Key())
 		if err != nil {
 			logger.WriteDebugLog(err.Error(), "GetCounter")
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -297,18 +465,18 @@ func GetValueMetricsJSON(rw http.ResponseWriter, r *http.Request, s Storager) {
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	logger.WriteInfoLog("request body in value/", "metrics{ID, MType}"+metrics.ID+","+metrics.MType)
+	logger.WriteInfoLog("request body in value/", "metrics{ID, MType}"+metrics.Key()+","+metrics.MType)
 
 	rw.Header().Set("Content-Type", "application/json")
 
 	switch metrics.MType {
 	case "gauge":
-		value, err := s.GetGauge(metrics.ID)
+		value, err := s.GetGauge(metrics.Key())
 		if err != nil {
-			logger.WriteInfoLog(err.Error(), "GetGauge ID:"+metrics.ID)
-			err = s.SetGauge(metrics.ID, 0)
+			logger.WriteInfoLog(err.Error(), "GetGauge ID:"+metrics.Key())
+			err = s.SetGauge(metrics.Key(), 0)
 			if err != nil {
-				logger.WriteInfoLog(err.Error(), "SetGauge ID:"+metrics.ID)
+				logger.WriteInfoLog(err.Error(), "SetGauge ID:"+metrics.Key())
 				rw.WriteHeader(http.StatusInternalServerError)
 				return
 			}
@@ -316,23 +484,22 @@ func GetValueMetricsJSON(rw http.ResponseWriter, r *http.Request, s Storager) {
 		}
 		metrics.Value = &value
 	case "counter":
-		err := s.AddCounter(metrics.ID, models.Counter(0))
+		err := s.AddCounter(metrics.Key(), models.Counter(0))
 		if err != nil {
-			logger.WriteInfoLog(err.Error(), "AddCounter ID:"+metrics.ID)
+			logger.WriteInfoLog(err.Error(), "AddCounter ID:"+metrics.Key())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		delta, err := s.GetCounter(metrics.ID)
+		delta, err := s.GetCounter(metrics.Key())
 		if err != nil {
-			logger.WriteInfoLog(err.Error(), "GetCounter ID:"+metrics.ID)
+			logger.WriteInfoLog(err.Error(), "GetCounter ID:"+metrics.Key())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		metrics.Delta = &delta
 	}
 
-	m := agentStorage.NewMonitor()
-	err := PrepareMetricsValues(s, m)
+	err := PrepareMetricsValues(s, collectServerMetrics())
 
 	if err != nil {
 		logger.WriteErrorLog(err.Error(), "PrepareMetricsValues GetValueMetricsJSON")
@@ -375,7 +542,13 @@ func Updates(rw http.ResponseWriter, r *http.Request, dbs Storager) {
 
 	if err != nil {
 		logger.WriteDebugLog("cannot decode request JSON body", err.Error())
-		rw.WriteHeader(http.StatusInternalServerError)
+		rw.WriteHeader(handlers.BodyErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if handlers.MaxBatchSize > 0 && len(metrics) > handlers.MaxBatchSize {
+		logger.WriteDebugLog("too many metrics in batch", strconv.Itoa(len(metrics)))
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
 		return
 	}
 
@@ -383,6 +556,21 @@ func Updates(rw http.ResponseWriter, r *http.Request, dbs Storager) {
 	//logMsg, _ := json.Marshal(metrics)
 	//logger.WriteInfoLog("request body in Updates/", string(logMsg))
 
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		if err = models.ValidateMetricKey(m.ID, m.Labels); err != nil {
+			logger.WriteDebugLog(err.Error(), "Updates")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		names = append(names, m.ID)
+	}
+	if err = mtls.DefaultPolicy.Authorize(r.Context(), names...); err != nil {
+		logger.WriteDebugLog(err.Error(), "agent policy")
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	result, err := UpdateMetrics(dbs, metrics)
 
 	if err != nil {
@@ -403,10 +591,10 @@ func Updates(rw http.ResponseWriter, r *http.Request, dbs Storager) {
 	logger.WriteDebugLog("", "sending HTTP 200 response")
 }
 
-// UpdateMetrics обновление значений метрик
+// UpdateMetrics обновление значений метрик,
+// хранилища с поддержкой Batcher сохраняют всю пачку одной операцией
 func UpdateMetrics(dbs Storager, metrics []models.Metrics) ([]models.Metrics, error) {
-	result := make([]models.Metrics, 0, len(metrics))
-
+	normalized := make([]models.Metrics, 0, len(metrics))
 	for _, m := range metrics {
 		current := m
 
@@ -416,22 +604,40 @@ func UpdateMetrics(dbs Storager, metrics []models.Metrics) ([]models.Metrics, er
 				zero := 0.0
 				current.Value = &zero
 			}
-			if err := dbs.SetGauge(current.ID, models.Gauge(*current.Value)); err != nil {
-				logger.WriteErrorLog(err.Error(), "SetGauge ID:"+current.ID)
-				return nil, err
-			}
 		case "counter":
 			if current.Delta == nil {
 				zero := int64(0)
 				current.Delta = &zero
 			}
-			if err := dbs.AddCounter(current.ID, models.Counter(*current.Delta)); err != nil {
-				logger.WriteErrorLog(err.Error(), "AddCounter ID:"+current.ID)
+		}
+		normalized = append(normalized, current)
+	}
+
+	if batcher, ok := dbs.(Batcher); ok {
+		result, err := batcher.UpdateBatch(normalized)
+		if err != nil {
+			logger.WriteErrorLog(err.Error(), "UpdateBatch")
+			return nil, err
+		}
+		return result, nil
+	}
+
+	result := make([]models.Metrics, 0, len(normalized))
+	for _, current := range normalized {
+		switch current.MType {
+		case "gauge":
+			if err := dbs.SetGauge(current.Key(), models.Gauge(*current.Value)); err != nil {
+				logger.WriteErrorLog(err.Error(), "SetGauge ID:"+current.Key())
+				return nil, err
+			}
+		case "counter":
+			if err := dbs.AddCounter(current.Key(), models.Counter(*current.Delta)); err != nil {
+				logger.WriteErrorLog(err.Error(), "AddCounter ID:"+current.Key())
 				return nil, err
 			}
-			newCounter, err := dbs.GetCounter(current.ID)
+			newCounter, err := dbs.GetCounter(current.Key())
 			if err != nil {
-				logger.WriteErrorLog(err.Error(), "GetCounter ID:"+m.ID)
+				logger.WriteErrorLog(err.Error(), "GetCounter ID:"+current.Key())
 				return nil, err
 			}
 			current.Delta = &newCounter
@@ -4,8 +4,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-resty/resty/v2"
@@ -14,9 +18,15 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/retention"
 	"github.com/ramil063/gometrics/cmd/server/storage/db"
 	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
 )
 
 func Test_update(t *testing.T) {
@@ -69,7 +79,7 @@ func TestRouter(t *testing.T) {
 	handlers.Restore = false
 	ms := NewMemStorage()
 	manager := crypto.NewCryptoManager()
-	ts := httptest.NewServer(Router(ms, manager))
+	ts := httptest.NewServer(Router(ms, manager, nil))
 	defer ts.Close()
 
 	var testTable = []struct {
@@ -93,7 +103,7 @@ func Test_getValue(t *testing.T) {
 	handlers.Restore = false
 	ms := NewMemStorage()
 	manager := crypto.NewCryptoManager()
-	ts := httptest.NewServer(Router(ms, manager))
+	ts := httptest.NewServer(Router(ms, manager, nil))
 	defer ts.Close()
 
 	type want struct {
@@ -192,7 +202,7 @@ func Test_home(t *testing.T) {
 	handlers.Restore = false
 	ms := NewMemStorage()
 	manager := crypto.NewCryptoManager()
-	ts := httptest.NewServer(Router(ms, manager))
+	ts := httptest.NewServer(Router(ms, manager, nil))
 	defer ts.Close()
 
 	type want struct {
@@ -227,6 +237,156 @@ func Test_home(t *testing.T) {
 	}
 }
 
+func Test_getHistory(t *testing.T) {
+	handlers.Restore = false
+	ms := NewMemStorage()
+	manager := crypto.NewCryptoManager()
+	ts := httptest.NewServer(Router(ms, manager, nil))
+	defer ts.Close()
+
+	err := ms.SetGauge("a", 1.1)
+	assert.NoError(t, err)
+	err = ms.SetGauge("a", 2.2)
+	assert.NoError(t, err)
+
+	type want struct {
+		response   string
+		resolution string
+		code       int
+	}
+	tests := []struct {
+		name string
+		url  string
+		want want
+	}{
+		{
+			name: "gauge history",
+			url:  "/history/gauge/a",
+			want: want{
+				code:     200,
+				response: `"value":2.2`,
+			},
+		},
+		{
+			name: "unknown metric",
+			url:  "/history/gauge/unknown",
+			want: want{
+				code:     200,
+				response: "[]",
+			},
+		},
+		{
+			name: "empty range",
+			url:  "/history/gauge/a?from=0&to=1",
+			want: want{
+				code:     200,
+				response: "[]",
+			},
+		},
+		{
+			name: "bad from",
+			url:  "/history/gauge/a?from=yesterday",
+			want: want{
+				code:     400,
+				response: "",
+			},
+		},
+		{
+			name: "bad type",
+			url:  "/history/unknown/a",
+			want: want{
+				code:     400,
+				response: "",
+			},
+		},
+		{
+			name: "explicit raw resolution",
+			url:  "/history/gauge/a?resolution=raw",
+			want: want{
+				code:       200,
+				response:   `"value":1.1`,
+				resolution: "raw",
+			},
+		},
+		{
+			name: "bad resolution",
+			url:  "/history/gauge/a?resolution=often",
+			want: want{
+				code:     400,
+				response: "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, "GET", test.url)
+			defer resp.Body.Close()
+			assert.Equal(t, test.want.code, resp.StatusCode)
+			assert.Contains(t, body, test.want.response)
+			if test.want.resolution != "" {
+				assert.Equal(t, test.want.resolution, resp.Header.Get("X-Resolution"))
+			}
+		})
+	}
+}
+
+func Test_getHistoryRollups(t *testing.T) {
+	handlers.Restore = false
+	ms := NewMemStorage()
+	manager := crypto.NewCryptoManager()
+	ts := httptest.NewServer(Router(ms, manager, nil))
+	defer ts.Close()
+
+	assert.NoError(t, ms.SetGauge("a", 1))
+	assert.NoError(t, ms.SetGauge("a", 3))
+
+	policy, err := retention.ParsePolicy("a raw=1h 1m=1d")
+	require.NoError(t, err)
+	retention.DefaultCompactor = retention.NewCompactor([]retention.Policy{policy}, ms.(retention.Store))
+	defer func() { retention.DefaultCompactor = nil }()
+	require.NoError(t, retention.DefaultCompactor.Compact(time.Now().Add(2*time.Minute)))
+
+	// период старше хранения сырых значений отдается агрегатами
+	from := strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10)
+	resp, body := testRequest(t, ts, "GET", "/history/gauge/a?from="+from)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1m0s", resp.Header.Get("X-Resolution"))
+	assert.Contains(t, body, `"rollup":{`)
+
+	from = strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	resp2, body := testRequest(t, ts, "GET", "/history/gauge/a?from="+from)
+	defer resp2.Body.Close()
+	assert.Equal(t, "raw", resp2.Header.Get("X-Resolution"))
+	assert.NotContains(t, body, "rollup")
+}
+
+func Test_parseTimeParam(t *testing.T) {
+	defaultValue := time.Unix(100, 0)
+	tests := []struct {
+		want    time.Time
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: defaultValue},
+		{name: "unix", value: "1700000000", want: time.Unix(1700000000, 0)},
+		{name: "rfc3339", value: "2025-01-01T10:00:00Z", want: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{name: "bad", value: "bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeParam(tt.value, defaultValue)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(got))
+		})
+	}
+}
+
 func TestNewMemStorage(t *testing.T) {
 	tests := []struct {
 		name string
@@ -301,7 +461,7 @@ func Test_getValueMetricsJSON(t *testing.T) {
 
 	handlers.FileStoragePath = filePath
 	getValueMetricsJSONHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
-		s := GetStorage("", "")
+		s := NewMemStorage()
 		_ = s.SetGauge("met1", 1.1)
 		GetValueMetricsJSON(rw, req, s)
 	}
@@ -359,12 +519,14 @@ func Test_updates(t *testing.T) {
 	dml.DBRepository.Database, mock, _ = sqlmock.New()
 	defer dml.DBRepository.Database.Close()
 
-	mock.ExpectExec("^INSERT INTO gauge *").
-		WithArgs("met1", float64(1.1)).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec("^INSERT INTO gauge *").
-		WithArgs("met2", float64(2.2)).
-		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO gauge \\(name, value\\) VALUES \\(\\$1, \\$2\\), \\(\\$3, \\$4\\) *").
+		WithArgs("met1", float64(1.1), "met2", float64(2.2)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("^INSERT INTO gauge_history *").
+		WithArgs("met1", sqlmock.AnyArg(), float64(1.1), "met2", sqlmock.AnyArg(), float64(2.2)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectCommit()
 
 	updatesHandlerFunction := func(rw http.ResponseWriter, req *http.Request) {
 		s := &db.Storage{}
@@ -416,6 +578,7 @@ func Test_updates(t *testing.T) {
 			}
 		})
 	}
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func Test_updateMetrics(t *testing.T) {
@@ -443,6 +606,24 @@ func Test_updateMetrics(t *testing.T) {
 			},
 			delta: 1,
 		},
+		{
+			name: "test labels",
+			metrics: []models.Metrics{
+				{
+					ID:     "met2",
+					MType:  "counter",
+					Labels: map[string]string{"host": "a"},
+				},
+			},
+			want: []models.Metrics{
+				{
+					ID:     "met2",
+					MType:  "counter",
+					Labels: map[string]string{"host": "a"},
+				},
+			},
+			delta: 2,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -452,7 +633,12 @@ func Test_updateMetrics(t *testing.T) {
 			assert.NoError(t, err, "error making HTTP request")
 			assert.Equal(t, tt.want[0].ID, got[0].ID)
 			assert.Equal(t, tt.want[0].MType, got[0].MType)
+			assert.Equal(t, tt.want[0].Labels, got[0].Labels)
 			assert.Equal(t, tt.delta, *(got[0].Delta))
+
+			stored, err := dbs.GetCounter(tt.want[0].Key())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.delta, stored)
 		})
 	}
 }
@@ -471,3 +657,159 @@ func BenchmarkUpdateMetrics(b *testing.B) {
 		_, _ = UpdateMetrics(dbs, metrics)
 	}
 }
+
+func Test_updates_Policy(t *testing.T) {
+	policy, err := mtls.NewPolicy(map[string][]string{"agent-1": {"met*"}})
+	require.NoError(t, err)
+	mtls.DefaultPolicy = policy
+	defer func() { mtls.DefaultPolicy = nil }()
+
+	testCases := []struct {
+		name         string
+		identity     string
+		body         string
+		expectedCode int
+	}{
+		{name: "allowed", identity: "agent-1", body: `[{"id": "met1", "type": "gauge", "value":1.1}]`, expectedCode: http.StatusOK},
+		{name: "forbidden metric", identity: "agent-1", body: `[{"id": "met1", "type": "gauge", "value":1.1},{"id": "cpu", "type": "gauge", "value":2.2}]`, expectedCode: http.StatusForbidden},
+		{name: "unknown agent", identity: "agent-2", body: `[{"id": "met1", "type": "gauge", "value":1.1}]`, expectedCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewMemStorage()
+			req := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(tc.body))
+			req = req.WithContext(mtls.WithIdentity(req.Context(), tc.identity))
+			rr := httptest.NewRecorder()
+
+			Updates(rr, req, s)
+			assert.Equal(t, tc.expectedCode, rr.Code)
+
+			_, getErr := s.GetGauge("cpu")
+			assert.Error(t, getErr, "forbidden batch must not be saved")
+		})
+	}
+}
+
+func Test_updates_InvalidKey(t *testing.T) {
+	bodies := []string{
+		`[{"id": "met1", "type": "gauge", "value":1.1},{"id": "met{a=\"b\"}", "type": "gauge", "value":2.2}]`,
+		`[{"id": "met1", "type": "gauge", "value":1.1, "labels": {"a,b": "c"}}]`,
+	}
+	for _, body := range bodies {
+		s := NewMemStorage()
+		rr := httptest.NewRecorder()
+		Updates(rr, httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(body)), s)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		_, getErr := s.GetGauge("met1")
+		assert.Error(t, getErr, "invalid batch must not be saved")
+	}
+}
+
+func TestRouter_RateLimitPerAgent(t *testing.T) {
+	oldLimiter, oldFilter := ratelimit.DefaultLimiter, ipfilter.DefaultFilter
+	oldRegistry, oldGuard := agents.DefaultRegistry, hash.DefaultReplayGuard
+	defer func() {
+		ratelimit.DefaultLimiter, ipfilter.DefaultFilter = oldLimiter, oldFilter
+		agents.DefaultRegistry, hash.DefaultReplayGuard = oldRegistry, oldGuard
+	}()
+	ratelimit.DefaultLimiter = ratelimit.NewLimiter(1, 1)
+	ipfilter.DefaultFilter = nil
+	hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	agents.DefaultRegistry = registry
+	agent1, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	agent2, err := registry.Add("agent-2")
+	require.NoError(t, err)
+
+	router := Router(NewMemStorage(), crypto.NewCryptoManager(), nil)
+	send := func(credentials agents.Credentials) int {
+		request := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"met1","type":"gauge","value":1.1}]`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(agents.AgentIDHeader, credentials.ID)
+		request.Header.Set(agents.AuthorizationHeader, "Bearer "+credentials.Token)
+		request.Header.Set(hash.TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+		request.Header.Set(hash.NonceHeader, hash.NewNonce())
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, request)
+		return rw.Code
+	}
+
+	// агенты за одним адресом ограничиваются каждый своим лимитом
+	assert.Equal(t, http.StatusOK, send(agent1))
+	assert.Equal(t, http.StatusOK, send(agent2))
+	assert.Equal(t, http.StatusTooManyRequests, send(agent1))
+}
+
+func TestRouter_RateLimitFailedAuth(t *testing.T) {
+	oldLimiter, oldFilter := ratelimit.DefaultLimiter, ipfilter.DefaultFilter
+	oldRegistry, oldGuard := agents.DefaultRegistry, hash.DefaultReplayGuard
+	defer func() {
+		ratelimit.DefaultLimiter, ipfilter.DefaultFilter = oldLimiter, oldFilter
+		agents.DefaultRegistry, hash.DefaultReplayGuard = oldRegistry, oldGuard
+	}()
+	ratelimit.DefaultLimiter = ratelimit.NewLimiter(1, 2)
+	ipfilter.DefaultFilter = nil
+	hash.DefaultReplayGuard = hash.NewReplayGuard(time.Minute, 10)
+	registry, err := agents.NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	agents.DefaultRegistry = registry
+	agent, err := registry.Add("agent-1")
+	require.NoError(t, err)
+
+	router := Router(NewMemStorage(), crypto.NewCryptoManager(), nil)
+	send := func(remoteAddr string, token string) int {
+		request := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"met1","type":"gauge","value":1.1}]`))
+		request.RemoteAddr = remoteAddr
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(agents.AgentIDHeader, agent.ID)
+		request.Header.Set(agents.AuthorizationHeader, "Bearer "+token)
+		request.Header.Set(hash.TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+		request.Header.Set(hash.NonceHeader, hash.NewNonce())
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, request)
+		return rw.Code
+	}
+
+	// неудачные проверки исчерпывают лимит адреса, дальше запросы с него отклоняются до проверки агента
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1:1000", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1:1000", "wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1:1000", "wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1:1000", agent.Token))
+
+	// успешные запросы лимит адреса не тратят
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, send("10.0.0.2:1000", agent.Token))
+	}
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.2:1000", "wrong"))
+}
+
+func Test_updates_Limits(t *testing.T) {
+	oldMaxBatchSize, oldMaxBodySize := handlers.MaxBatchSize, handlers.MaxBodySize
+	defer func() { handlers.MaxBatchSize, handlers.MaxBodySize = oldMaxBatchSize, oldMaxBodySize }()
+	handlers.MaxBatchSize = 1
+	handlers.MaxBodySize = 128
+
+	srv := httptest.NewServer(Router(NewMemStorage(), crypto.NewCryptoManager(), nil))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "batch within limit", body: `[{"id":"met1","type":"gauge","value":1.1}]`, expectedCode: http.StatusOK},
+		{name: "too many metrics", body: `[{"id":"met1","type":"gauge","value":1.1},{"id":"met2","type":"gauge","value":2.2}]`, expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "body too large", body: `[{"id":"` + strings.Repeat("m", 200) + `","type":"gauge","value":1.1}]`, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL+"/updates/", "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/ramil063/gometrics/cmd/server/storage/db"
 	"github.com/ramil063/gometrics/cmd/server/storage/file"
 	"github.com/ramil063/gometrics/cmd/server/storage/memory"
+	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
 )
 
@@ -14,24 +15,28 @@ func NewMemStorage() Storager {
 	}
 }
 
-func NewFileStorage() Storager {
-	return &file.FStorage{
-		Gauges:   make(map[string]models.Gauge),
-		Counters: make(map[string]models.Counter),
+// NewFileStorage файловое хранилище, состояние восстанавливается из снимка и журнала,
+// сервер не запускается, если восстановить состояние не удалось
+func NewFileStorage(filePath string) (Storager, error) {
+	s, err := file.NewStorage(filePath)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "restore file storage")
+		return nil, err
 	}
+	return s, nil
 }
 
 func NewDBStorage() Storager {
 	return &db.Storage{}
 }
 
-// GetStorage получить хранителя данных
-func GetStorage(fileStoragePath string, dsn string) Storager {
+// GetStorage получить хранителя данных, DSN вида sqlite://path выбирает встроенную БД SQLite
+func GetStorage(fileStoragePath string, dsn string) (Storager, error) {
 	if dsn != "" {
-		return NewDBStorage()
+		return NewDBStorage(), nil
 	}
 	if fileStoragePath != "" {
-		return NewFileStorage()
+		return NewFileStorage(fileStoragePath)
 	}
-	return NewMemStorage()
+	return NewMemStorage(), nil
 }
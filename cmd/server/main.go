@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,16 +14,25 @@ import (
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ramil063/gometrics/cmd/server/alerting"
 	serverConfig "github.com/ramil063/gometrics/cmd/server/config"
 	"github.com/ramil063/gometrics/cmd/server/handlers"
 	serverGRPC "github.com/ramil063/gometrics/cmd/server/handlers/grpc/server"
 	"github.com/ramil063/gometrics/cmd/server/handlers/server"
+	"github.com/ramil063/gometrics/cmd/server/retention"
 	"github.com/ramil063/gometrics/cmd/server/storage/db"
 	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
 	"github.com/ramil063/gometrics/cmd/server/storage/file"
 	"github.com/ramil063/gometrics/internal/constants"
+	"github.com/ramil063/gometrics/internal/hash"
 	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/ratelimit"
+	"github.com/ramil063/gometrics/internal/security/agents"
 	"github.com/ramil063/gometrics/internal/security/crypto"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+	"github.com/ramil063/gometrics/internal/security/mtls"
+	"github.com/ramil063/gometrics/internal/statsd"
+	_ "modernc.org/sqlite"
 )
 
 var (
@@ -45,21 +55,45 @@ func main() {
 		logger.WriteErrorLog(err.Error(), "config")
 	}
 	handlers.InitFlags(config)
+	if err = handlers.ValidateFlags(); err != nil {
+		logger.WriteErrorLog(err.Error(), "flags")
+		return
+	}
+	hash.DefaultReplayGuard = hash.NewReplayGuard(time.Duration(handlers.ReplayWindow)*time.Second, hash.DefaultNonceCacheSize)
 
 	manager := crypto.NewCryptoManager()
+	var keyRing *crypto.KeyRing
 	if handlers.CryptoKey != "" {
-		defaultDecryptor, decryptorErr := crypto.NewRSADecryptor(handlers.CryptoKey)
+		var decryptorErr error
+		keyRing, decryptorErr = crypto.NewKeyRing(handlers.CryptoKey, time.Duration(handlers.CryptoKeyGrace)*time.Second)
 		if decryptorErr != nil {
 			logger.WriteErrorLog(decryptorErr.Error(), "Failed to create decryptor")
 		}
-		manager.SetDefaultDecryptor(defaultDecryptor)
+		if keyRing != nil {
+			manager.SetDefaultDecryptor(keyRing)
+		}
 	}
 
 	fmt.Printf("Build version: %s\n", buildVersion)
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
-	var s = server.GetStorage(handlers.FileStoragePath, handlers.DatabaseDSN)
+	if args := flag.Args(); len(args) > 0 && args[0] == db.MigrateCommand {
+		os.Exit(runMigrateCommand(args[1:]))
+	}
+
+	if handlers.FileStoragePath != "" && !handlers.Restore {
+		// работаем с новыми метриками, очищая файлы со старыми
+		if err = file.ClearStorage(handlers.FileStoragePath); err != nil {
+			logger.WriteErrorLog(err.Error(), "ClearStorage")
+		}
+	}
+
+	s, err := server.GetStorage(handlers.FileStoragePath, handlers.DatabaseDSN)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "GetStorage")
+		return
+	}
 
 	if handlers.DatabaseDSN != "" {
 		rep, errRepo := dml.NewRepository()
@@ -78,13 +112,6 @@ func main() {
 
 	writingToFileIsEnabledAndAvailable := handlers.FileStoragePath != ""
 	if handlers.StoreInterval > 0 && writingToFileIsEnabledAndAvailable {
-		if !handlers.Restore {
-			// работаем с новыми метриками, очищая файл со старыми
-			err = file.ClearFileContent(handlers.FileStoragePath)
-			if err != nil {
-				logger.WriteErrorLog(err.Error(), "ClearFileContent")
-			}
-		}
 		ticker := time.NewTicker(time.Duration(handlers.StoreInterval) * time.Second)
 		go func() {
 			err = server.SaveMetricsPerTime(server.MaxSaverWorkTime, ticker, s)
@@ -94,19 +121,48 @@ func main() {
 		}()
 	}
 
-	srv := &http.Server{
-		Addr:    handlers.MainURL,
-		Handler: server.Router(s, manager),
+	mtls.DefaultPolicy, err = mtls.LoadPolicy(handlers.AgentPolicy)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "LoadPolicy")
+		return
 	}
 
-	grpcFlags, grpcStorage, manager, err := serverGRPC.PrepareServerEnvironment()
+	agents.DefaultRegistry, err = agents.NewRegistry(handlers.AgentRegistry)
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "serverGRPC.PrepareServerEnvironment")
+		logger.WriteErrorLog(err.Error(), "NewRegistry")
+		return
 	}
 
-	grpcServer, err := serverGRPC.GetGRPCServer(grpcFlags, grpcStorage, manager)
+	ipfilter.DefaultFilter, err = ipfilter.NewReloadable(handlers.IPFilterConfig(), handlers.IPFilterFile)
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "GetGRPCServer init error")
+		logger.WriteErrorLog(err.Error(), "ip filter")
+		return
+	}
+	ratelimit.DefaultLimiter = ratelimit.NewLimiter(float64(handlers.ClientRateLimit), handlers.ClientRateBurst)
+
+	var alertEngine *alerting.Engine
+	rules, err := alerting.LoadRules(config.GetAlertRules(), handlers.AlertRulesFile)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "LoadRules")
+	}
+	if len(rules) > 0 {
+		notifiers := []alerting.Notifier{alerting.NewLogNotifier()}
+		if handlers.AlertWebhook != "" {
+			notifiers = append(notifiers, alerting.NewWebhookNotifier(handlers.AlertWebhook))
+		}
+		alertEngine = alerting.NewEngine(rules, s, notifiers...)
+	}
+
+	srv := &http.Server{
+		Addr:    handlers.MainURL,
+		Handler: server.Router(s, manager, alertEngine),
+	}
+	if handlers.TLSCert != "" {
+		srv.TLSConfig, err = mtls.NewServerConfig(handlers.TLSCert, handlers.TLSKey, handlers.TLSClientCA)
+		if err != nil {
+			logger.WriteErrorLog(err.Error(), "TLS config")
+			return
+		}
 	}
 
 	// через этот канал сообщим основному потоку, что соединения закрыты
@@ -115,6 +171,70 @@ func main() {
 	ctxGrSh, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
+	grpcFlags, grpcStorage, manager, err := serverGRPC.PrepareServerEnvironment(ctxGrSh)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "serverGRPC.PrepareServerEnvironment")
+		return
+	}
+
+	grpcServer, err := serverGRPC.GetGRPCServer(ctxGrSh, grpcFlags, grpcStorage, manager)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "GetGRPCServer init error")
+	}
+
+	if keyRing != nil {
+		// новые ключи подхватываются из каталога без перезапуска
+		go keyRing.Watch(ctxGrSh, time.NewTicker(time.Duration(handlers.CryptoKeyReload)*time.Second))
+	}
+
+	fileStorage, isFileStorage := s.(*file.FStorage)
+	if isFileStorage {
+		// журнал изменений периодически сворачивается в снимок
+		go fileStorage.Run(ctxGrSh, time.NewTicker(file.CompactInterval(handlers.StoreInterval)))
+	}
+
+	if handlers.IPFilterFile != "" {
+		// списки подсетей подхватываются из файла без перезапуска
+		go ipfilter.DefaultFilter.Watch(ctxGrSh, time.NewTicker(time.Duration(handlers.IPFilterReload)*time.Second))
+	}
+
+	if alertEngine != nil {
+		go alertEngine.Run(ctxGrSh, time.NewTicker(time.Duration(handlers.AlertInterval)*time.Second))
+	}
+
+	policies, err := retention.LoadPolicies(config.GetRetentionRules(), handlers.RetentionRulesFile)
+	if err != nil {
+		logger.WriteErrorLog(err.Error(), "LoadPolicies")
+	}
+	if len(policies) > 0 {
+		retentionInterval := time.Duration(handlers.RetentionInterval) * time.Second
+		if store, ok := s.(retention.Store); ok {
+			retention.DefaultCompactor = retention.NewCompactor(policies, store)
+			go retention.DefaultCompactor.Run(ctxGrSh, time.NewTicker(retentionInterval))
+		}
+		// у gRPC сервера может быть свое хранилище, общая БД прореживается один раз
+		_, httpDB := s.(*db.Storage)
+		_, grpcDB := grpcStorage.(*db.Storage)
+		if store, ok := grpcStorage.(retention.Store); ok && grpcStorage != s && !(httpDB && grpcDB) {
+			go retention.NewCompactor(policies, store).Run(ctxGrSh, time.NewTicker(retentionInterval))
+		}
+	}
+
+	if handlers.StatsdAddress != "" || handlers.StatsdSocket != "" {
+		statsdServer := statsd.NewServer(s, ipfilter.DefaultFilter)
+		if handlers.StatsdAddress != "" {
+			if statsdErr := statsdServer.ListenAndServe(ctxGrSh, "udp", handlers.StatsdAddress); statsdErr != nil {
+				logger.WriteErrorLog(statsdErr.Error(), "statsd listen udp")
+			}
+		}
+		if handlers.StatsdSocket != "" {
+			if statsdErr := statsdServer.ListenAndServe(ctxGrSh, "unixgram", handlers.StatsdSocket); statsdErr != nil {
+				logger.WriteErrorLog(statsdErr.Error(), "statsd listen unixgram")
+			}
+		}
+		go statsdServer.Run(ctxGrSh, time.NewTicker(time.Duration(handlers.StatsdFlushInterval)*time.Second))
+	}
+
 	// запускаем горутину обработки пойманных прерываний
 	go func() {
 		<-ctxGrSh.Done()
@@ -136,7 +256,13 @@ func main() {
 		log.Println("All connections closed")
 	}()
 
-	if err = srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	if srv.TLSConfig != nil {
+		// сертификат уже загружен в TLSConfig
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
 		log.Printf("HTTP server ListenAndServe error: %v", err)
 		stop() // Триггерим shutdown при ошибке сервера
 	}
@@ -152,9 +278,40 @@ func main() {
 	if err = dml.DBRepository.Close(); err != nil {
 		log.Printf("Error closing DB: %v", err)
 	}
+	if isFileStorage {
+		if err = fileStorage.Compact(); err != nil {
+			log.Printf("Error compacting file storage: %v", err)
+		}
+		if err = fileStorage.Close(); err != nil {
+			log.Printf("Error closing file storage: %v", err)
+		}
+	}
 	// 2) файловая система - то файл закроется,
 	//    так как везде при открытии файла рядом есть defer Reader.Close() или defer Writer.Close()
 	// 3) оперативная память - то все мьютексы освободятся,
 	//    так как везде при доступе к мапе есть defer ms.mx.Unlock() и defer ms.mx.RUnlock()
 	fmt.Println("Server Shutdown gracefully")
 }
+
+// runMigrateCommand выполнение подкоманды migrate и получение кода завершения процесса
+func runMigrateCommand(args []string) int {
+	if handlers.DatabaseDSN == "" {
+		log.Println("migrate: database DSN is not set")
+		return 2
+	}
+	rep, err := dml.NewRepository()
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	defer rep.Close()
+
+	if err = db.RunMigrateCommand(rep, args, os.Stdout); err != nil {
+		log.Printf("migrate: %v", err)
+		if errors.Is(err, db.ErrMigrateUsage) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,6 @@
+// Package query пакет с языком запросов к метрикам
+// - отбор метрик по шаблону имени (`cpu_*`), регулярному выражению (`{__name__=~"cpu_.*"}`) и меткам
+// - скорость и прирост счетчиков за окно: `rate(PollCount[5m])`, `increase(PollCount[1h])`
+// - агрегации `sum/avg/min/max/count by (label)`
+// - вычисление в момент времени и по диапазону с шагом по хранилищу метрик
+package query
@@ -0,0 +1,372 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/retention"
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Lookback насколько далеко в прошлое ищется значение метрики для момента вычисления
+var Lookback = 5 * time.Minute
+
+// MaxSteps максимальное количество моментов вычисления запроса по диапазону
+var MaxSteps = 11000
+
+// DefaultSteps количество моментов вычисления запроса по диапазону, если шаг не задан
+var DefaultSteps = 250
+
+// Source источник метрик для вычисления запросов
+type Source interface {
+	GetGauges() (map[string]models.Gauge, error)
+	GetCounters() (map[string]models.Counter, error)
+	retention.Historian
+}
+
+// Series ряд результата запроса
+// у агрегированных рядов имя и тип не заполняются, метки содержат только метки группировки
+type Series struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Type   string            `json:"type,omitempty"`
+	Points []models.Sample   `json:"points"`
+}
+
+// Range моменты вычисления запроса: от Start до End с шагом Step, при Step = 0 только End
+type Range struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// NewRange период запроса: при нулевом start мгновенный запрос в момент end,
+// при нулевом step шаг подбирается под DefaultSteps моментов и округляется до секунды
+func NewRange(start, end time.Time, step time.Duration) Range {
+	if start.IsZero() {
+		return Range{Start: end, End: end}
+	}
+	if step == 0 {
+		step = (end.Sub(start) / time.Duration(DefaultSteps)).Truncate(time.Second) + time.Second
+	}
+	return Range{Start: start, End: end, Step: step}
+}
+
+// Validate проверка периода запроса
+func (r Range) Validate() error {
+	switch {
+	case r.Step < 0:
+		return errors.New("step must not be negative")
+	case r.Step == 0:
+		return nil
+	case r.End.Before(r.Start):
+		return errors.New("end is before start")
+	case int64(r.End.Sub(r.Start)/r.Step) >= int64(MaxSteps):
+		return fmt.Errorf("range has more than %d steps, increase step", MaxSteps)
+	}
+	return nil
+}
+
+// times моменты вычисления
+func (r Range) times() []time.Time {
+	if r.Step <= 0 {
+		return []time.Time{r.End}
+	}
+	result := make([]time.Time, 0, r.End.Sub(r.Start)/r.Step+1)
+	for t := r.Start; !t.After(r.End); t = t.Add(r.Step) {
+		result = append(result, t)
+	}
+	return result
+}
+
+// Evaluate вычисление выражения по хранилищу в моменты r, период должен пройти Validate
+// значения берутся из истории с шагом по политике хранения,
+// мгновенный запрос на текущий момент (End не раньше now) берет значения метрик из текущих значений хранилища
+func Evaluate(source Source, e Expr, r Range, now time.Time) ([]Series, error) {
+	ev := &evaluator{source: source, r: r, now: now, times: r.times()}
+	return ev.eval(e)
+}
+
+// evaluator вычисление одного запроса
+type evaluator struct {
+	now    time.Time
+	source Source
+	times  []time.Time
+	r      Range
+}
+
+// metric метрика хранилища, подошедшая под селектор
+type metric struct {
+	labels map[string]string
+	key    string
+	name   string
+	mType  string
+	value  float64
+}
+
+func (m metric) historyKey() models.HistoryKey {
+	return models.HistoryKey{MType: m.mType, Name: m.key}
+}
+
+func (m metric) series() Series {
+	return Series{Name: m.name, Type: m.mType, Labels: m.labels, Points: make([]models.Sample, 0)}
+}
+
+func (ev *evaluator) eval(e Expr) ([]Series, error) {
+	switch e := e.(type) {
+	case *Selector:
+		return ev.selector(e)
+	case *Call:
+		return ev.call(e)
+	case *Aggregation:
+		input, err := ev.eval(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return aggregate(e, input), nil
+	}
+	return nil, fmt.Errorf("unknown expression %T", e)
+}
+
+// current берутся ли значения из текущих значений хранилища
+func (ev *evaluator) current() bool {
+	return ev.r.Step == 0 && !ev.r.End.Before(ev.now)
+}
+
+// selector значения метрик в моменты вычисления: последнее значение не старше Lookback
+// или не старше шага прореженной истории
+func (ev *evaluator) selector(sel *Selector) ([]Series, error) {
+	metrics, err := ev.match(sel)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Series, 0, len(metrics))
+	if ev.current() {
+		for _, m := range metrics {
+			series := m.series()
+			series.Points = append(series.Points, models.Sample{Timestamp: ev.r.End, Value: m.value})
+			result = append(result, series)
+		}
+		return result, nil
+	}
+
+	histories, err := ev.histories(metrics, Lookback)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range metrics {
+		series := m.series()
+		history := histories[m.historyKey()]
+		samples := history.Samples
+		lookback := max(Lookback, history.Resolution)
+		for _, t := range ev.times {
+			i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(t) })
+			if i == 0 || t.Sub(samples[i-1].Timestamp) > lookback {
+				continue
+			}
+			series.Points = append(series.Points, models.Sample{Timestamp: t, Value: samples[i-1].Value})
+		}
+		if len(series.Points) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+// call прирост или скорость счетчиков за окно, метрики типа gauge пропускаются
+func (ev *evaluator) call(call *Call) ([]Series, error) {
+	matched, err := ev.match(call.Selector)
+	if err != nil {
+		return nil, err
+	}
+	metrics := slices.DeleteFunc(matched, func(m metric) bool { return m.mType != "counter" })
+	histories, err := ev.histories(metrics, call.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Series, 0, len(metrics))
+	for _, m := range metrics {
+		samples := histories[m.historyKey()].Samples
+		if ev.current() {
+			samples = append(samples, models.Sample{Timestamp: ev.r.End, Value: m.value})
+		}
+
+		series := m.series()
+		for _, t := range ev.times {
+			from := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(t.Add(-call.Window)) })
+			to := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(t) })
+			if to-from < 2 {
+				continue
+			}
+			value := increase(samples[from:to])
+			if call.Func == FuncRate {
+				value /= call.Window.Seconds()
+			}
+			series.Points = append(series.Points, models.Sample{Timestamp: t, Value: value})
+		}
+		if len(series.Points) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+// histories значения метрик, нужные для всех моментов вычисления с окном window,
+// шаг истории каждой метрики выбирается по ее политике хранения, история читается одним запросом к источнику
+func (ev *evaluator) histories(metrics []metric, window time.Duration) (map[models.HistoryKey]retention.History, error) {
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	from := ev.times[0].Add(-window)
+	resolutions := make(map[models.HistoryKey]time.Duration, len(metrics))
+	for _, m := range metrics {
+		resolutions[m.historyKey()] = retention.DefaultCompactor.Resolution(m.key, from, ev.r.End, ev.now)
+	}
+	return retention.ReadHistories(ev.source, resolutions, from, ev.r.End)
+}
+
+// match метрики хранилища, подходящие под селектор, сначала gauge, затем counter, внутри типа по ключу
+func (ev *evaluator) match(sel *Selector) ([]metric, error) {
+	gauges, err := ev.source.GetGauges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gauges: %w", err)
+	}
+	counters, err := ev.source.GetCounters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counters: %w", err)
+	}
+
+	result := make([]metric, 0)
+	add := func(mType string, key string, value float64) {
+		name, labels, err := models.ParseMetricKey(key)
+		if err != nil {
+			logger.WriteDebugLog(err.Error(), key)
+			return
+		}
+		if ok, _ := path.Match(sel.Name, name); sel.Name != "" && !ok {
+			return
+		}
+		if !models.MatchLabels(withPseudoLabels(labels, name, mType), sel.Matchers) {
+			return
+		}
+		result = append(result, metric{key: key, name: name, mType: mType, labels: labels, value: value})
+	}
+	for _, key := range models.SortedKeys(gauges) {
+		add("gauge", key, float64(gauges[key]))
+	}
+	for _, key := range models.SortedKeys(counters) {
+		add("counter", key, float64(counters[key]))
+	}
+	return result, nil
+}
+
+// increase прирост счетчика по значениям, сброс счетчика считается приростом от нуля
+func increase(samples []models.Sample) float64 {
+	var result float64
+	for i := 1; i < len(samples); i++ {
+		delta := samples[i].Value - samples[i-1].Value
+		if delta < 0 {
+			delta = samples[i].Value
+		}
+		result += delta
+	}
+	return result
+}
+
+// accumulator накопление значений одного момента группы
+type accumulator struct {
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (a *accumulator) add(value float64) {
+	if a.count == 0 || value < a.min {
+		a.min = value
+	}
+	if a.count == 0 || value > a.max {
+		a.max = value
+	}
+	a.count++
+	a.sum += value
+}
+
+func (a *accumulator) value(op string) float64 {
+	switch op {
+	case "avg":
+		return a.sum / a.count
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "count":
+		return a.count
+	}
+	return a.sum
+}
+
+// aggregate агрегация рядов по группам меток, значения объединяются по моментам вычисления
+func aggregate(agg *Aggregation, input []Series) []Series {
+	type group struct {
+		labels map[string]string
+		points map[time.Time]*accumulator
+	}
+	groups := make(map[string]*group)
+	for _, series := range input {
+		all := withPseudoLabels(series.Labels, series.Name, series.Type)
+		labels := make(map[string]string)
+		for _, label := range agg.By {
+			if value := all[label]; value != "" {
+				labels[label] = value
+			}
+		}
+
+		key := models.MetricKey("", labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: labels, points: make(map[time.Time]*accumulator)}
+			groups[key] = g
+		}
+		for _, point := range series.Points {
+			if g.points[point.Timestamp] == nil {
+				g.points[point.Timestamp] = &accumulator{}
+			}
+			g.points[point.Timestamp].add(point.Value)
+		}
+	}
+
+	result := make([]Series, 0, len(groups))
+	for _, key := range models.SortedKeys(groups) {
+		g := groups[key]
+		series := Series{Points: make([]models.Sample, 0, len(g.points))}
+		if len(g.labels) > 0 {
+			series.Labels = g.labels
+		}
+		for at, acc := range g.points {
+			series.Points = append(series.Points, models.Sample{Timestamp: at, Value: acc.value(agg.Op)})
+		}
+		sort.Slice(series.Points, func(i, j int) bool {
+			return series.Points[i].Timestamp.Before(series.Points[j].Timestamp)
+		})
+		result = append(result, series)
+	}
+	return result
+}
+
+// withPseudoLabels метки вместе с псевдометками имени и типа метрики
+func withPseudoLabels(labels map[string]string, name string, mType string) map[string]string {
+	result := make(map[string]string, len(labels)+2)
+	maps.Copy(result, labels)
+	result[NameLabel] = name
+	result[TypeLabel] = mType
+	return result
+}
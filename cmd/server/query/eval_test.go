@@ -0,0 +1,212 @@
+package query
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+type fakeSource struct {
+	gauges   map[string]models.Gauge
+	counters map[string]models.Counter
+	history  map[string][]models.Sample
+	reads    int
+}
+
+func (s *fakeSource) GetGauges() (map[string]models.Gauge, error) {
+	return s.gauges, nil
+}
+
+func (s *fakeSource) GetCounters() (map[string]models.Counter, error) {
+	return s.counters, nil
+}
+
+func (s *fakeSource) GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	result := make([]models.Sample, 0)
+	for _, sample := range s.history[mType+"/"+name] {
+		if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeSource) GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	s.reads++
+	result := make(map[models.HistoryKey][]models.Sample, len(keys))
+	for _, key := range keys {
+		samples, err := s.GetHistory(key.MType, key.Name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = samples
+	}
+	return result, nil
+}
+
+func newFakeSource(start time.Time) *fakeSource {
+	s := &fakeSource{
+		gauges: map[string]models.Gauge{
+			`cpu{core="1",host="a"}`: 10,
+			`cpu{core="2",host="a"}`: 30,
+			`cpu{core="1",host="b"}`: 50,
+			"Alloc":                  100,
+		},
+		counters: map[string]models.Counter{
+			`requests{host="a"}`: 160,
+			`requests{host="b"}`: 20,
+		},
+		history: make(map[string][]models.Sample),
+	}
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		s.history[`gauge/cpu{core="1",host="a"}`] = append(s.history[`gauge/cpu{core="1",host="a"}`],
+			models.Sample{Timestamp: at, Value: float64(i)})
+		s.history[`counter/requests{host="a"}`] = append(s.history[`counter/requests{host="a"}`],
+			models.Sample{Timestamp: at, Value: float64(i * 60)})
+	}
+	// сброс счетчика после перезапуска агента
+	s.history[`counter/requests{host="a"}`][3].Value = 30
+	return s
+}
+
+func evaluate(t *testing.T, source Source, input string, r Range, now time.Time) []Series {
+	e, err := Parse(input)
+	require.NoError(t, err)
+	series, err := Evaluate(source, e, r, now)
+	require.NoError(t, err)
+	return series
+}
+
+func TestEvaluate_Instant(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := newFakeSource(now.Add(-3 * time.Minute))
+	instant := NewRange(time.Time{}, now, 0)
+
+	series := evaluate(t, source, `cpu{host="a"}`, instant, now)
+	require.Len(t, series, 2)
+	assert.Equal(t, Series{
+		Name:   "cpu",
+		Type:   "gauge",
+		Labels: map[string]string{"core": "1", "host": "a"},
+		Points: []models.Sample{{Timestamp: now, Value: 10}},
+	}, series[0])
+
+	series = evaluate(t, source, `{__name__=~"A.*|req.*", __type__="counter"}`, instant, now)
+	require.Len(t, series, 2)
+	assert.Equal(t, "requests", series[0].Name)
+
+	series = evaluate(t, source, "sum by (host) (cpu)", instant, now)
+	require.Len(t, series, 2)
+	assert.Equal(t, map[string]string{"host": "a"}, series[0].Labels)
+	assert.Equal(t, 40.0, series[0].Points[0].Value)
+	assert.Equal(t, 50.0, series[1].Points[0].Value)
+
+	series = evaluate(t, source, "count(cpu)", instant, now)
+	require.Len(t, series, 1)
+	assert.Nil(t, series[0].Labels)
+	assert.Equal(t, 3.0, series[0].Points[0].Value)
+
+	series = evaluate(t, source, "avg(*) by (__type__)", instant, now)
+	require.Len(t, series, 2)
+	assert.Equal(t, map[string]string{TypeLabel: "counter"}, series[0].Labels)
+	assert.Equal(t, 90.0, series[0].Points[0].Value)
+
+	// текущее значение 160 после сброса до 30 за окно: 60+60+30+130
+	series = evaluate(t, source, `increase(requests[5m])`, instant, now)
+	require.Len(t, series, 1, "counter without history has no increase")
+	assert.Equal(t, 280.0, series[0].Points[0].Value)
+
+	assert.Empty(t, evaluate(t, source, "rate(cpu[5m])", instant, now), "gauges have no rate")
+	assert.Empty(t, evaluate(t, source, "unknown", instant, now))
+}
+
+func TestEvaluate_History(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := newFakeSource(start)
+	now := start.Add(time.Hour)
+
+	// мгновенный запрос в прошлом берет значение из истории
+	series := evaluate(t, source, `cpu{core="1",host="a"}`, NewRange(time.Time{}, start.Add(90*time.Second), 0), now)
+	require.Len(t, series, 1)
+	assert.Equal(t, []models.Sample{{Timestamp: start.Add(90 * time.Second), Value: 1}}, series[0].Points)
+
+	r := Range{Start: start, End: start.Add(10 * time.Minute), Step: 2 * time.Minute}
+	series = evaluate(t, source, "cpu", r, now)
+	require.Len(t, series, 1, "series without history are skipped")
+	assert.Equal(t, []models.Sample{
+		{Timestamp: start, Value: 0},
+		{Timestamp: start.Add(2 * time.Minute), Value: 2},
+		{Timestamp: start.Add(4 * time.Minute), Value: 3},
+		{Timestamp: start.Add(6 * time.Minute), Value: 3},
+		{Timestamp: start.Add(8 * time.Minute), Value: 3},
+	}, series[0].Points, "values older than lookback are not used")
+
+	series = evaluate(t, source, "rate(requests[2m])", r, now)
+	require.Len(t, series, 1)
+	assert.Equal(t, []models.Sample{
+		{Timestamp: start.Add(2 * time.Minute), Value: 1},
+		{Timestamp: start.Add(4 * time.Minute), Value: 0.25},
+	}, series[0].Points)
+
+	series = evaluate(t, source, "max(cpu)", r, now)
+	require.Len(t, series, 1)
+	assert.Len(t, series[0].Points, 5)
+}
+
+func TestEvaluate_HistoryBatchRead(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	source := newFakeSource(start)
+	r := Range{Start: start, End: start.Add(10 * time.Minute), Step: 2 * time.Minute}
+
+	series := evaluate(t, source, "*", r, start.Add(time.Hour))
+	assert.Len(t, series, 2)
+	assert.Equal(t, 1, source.reads, "history of all matched series is read at once")
+
+	source.reads = 0
+	evaluate(t, source, "increase(requests[2m])", r, start.Add(time.Hour))
+	assert.Equal(t, 1, source.reads)
+}
+
+func TestRange(t *testing.T) {
+	end := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	instant := NewRange(time.Time{}, end, time.Minute)
+	assert.Equal(t, Range{Start: end, End: end}, instant)
+	assert.Equal(t, []time.Time{end}, instant.times())
+
+	r := NewRange(end.Add(-time.Hour), end, 0)
+	assert.Equal(t, 15*time.Second, r.Step)
+	assert.NoError(t, r.Validate())
+	assert.Len(t, r.times(), 241)
+
+	assert.Error(t, Range{Start: end, End: end.Add(-time.Hour), Step: time.Minute}.Validate())
+	assert.Error(t, Range{Start: end, End: end, Step: -time.Minute}.Validate())
+	assert.Error(t, NewRange(end.Add(-24*time.Hour), end, time.Second).Validate())
+}
+
+type errorSource struct {
+	*fakeSource
+}
+
+func (s errorSource) GetHistory(string, string, time.Time, time.Time) ([]models.Sample, error) {
+	return nil, errors.New("history unavailable")
+}
+
+func (s errorSource) GetHistories([]models.HistoryKey, time.Time, time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	return nil, errors.New("history unavailable")
+}
+
+func TestEvaluate_Error(t *testing.T) {
+	now := time.Now()
+	e, err := Parse("cpu")
+	require.NoError(t, err)
+
+	_, err = Evaluate(errorSource{newFakeSource(now)}, e, Range{Start: now.Add(-time.Hour), End: now, Step: time.Minute}, now)
+	assert.Error(t, err)
+}
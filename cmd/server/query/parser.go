@@ -0,0 +1,280 @@
+package query
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/retention"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Функции над счетчиками
+const (
+	FuncRate     = "rate"
+	FuncIncrease = "increase"
+)
+
+// Псевдометки с именем и типом метрики, по ним можно отбирать и группировать метрики
+const (
+	NameLabel = "__name__"
+	TypeLabel = "__type__"
+)
+
+// aggregations операторы агрегации
+var aggregations = []string{"sum", "avg", "min", "max", "count"}
+
+// Expr выражение языка запросов: *Selector, *Call или *Aggregation
+type Expr interface {
+	expr()
+}
+
+// Selector отбор метрик
+// Name шаблон имени метрики (path.Match), пустой - любое имя
+// Matchers условия по меткам, в том числе по псевдометкам __name__ и __type__
+type Selector struct {
+	Name     string
+	Matchers []models.LabelMatcher
+}
+
+// Call функция Func над счетчиками, отобранными Selector, за окно Window
+type Call struct {
+	Selector *Selector
+	Func     string
+	Window   time.Duration
+}
+
+// Aggregation агрегация Op значений выражения Expr с группировкой по меткам By
+type Aggregation struct {
+	Expr Expr
+	Op   string
+	By   []string
+}
+
+func (*Selector) expr()    {}
+func (*Call) expr()        {}
+func (*Aggregation) expr() {}
+
+// parser разбор выражения языка запросов рекурсивным спуском
+type parser struct {
+	input string
+	pos   int
+}
+
+// Parse разбор выражения вида
+// `<selector>`, `rate(<selector>[<window>])`, `increase(<selector>[<window>])`
+// или `<sum|avg|min|max|count> [by (<label>, ...)] (<expr>)`,
+// где <selector> это `[<name>][{<label matchers>}]`, окно задается как в политиках хранения (5m, 1d)
+func Parse(input string) (Expr, error) {
+	p := &parser{input: input}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	return e, nil
+}
+
+// parseExpr разбор выражения любого вида
+func (p *parser) parseExpr() (Expr, error) {
+	p.skipSpaces()
+	start := p.pos
+	ident := p.ident()
+	switch {
+	case slices.Contains(aggregations, ident) && (p.peek() == '(' || p.peekKeyword("by")):
+		return p.parseAggregation(ident)
+	case (ident == FuncRate || ident == FuncIncrease) && p.peek() == '(':
+		return p.parseCall(ident)
+	}
+	// имя совпало с оператором, но это обычная метрика
+	p.pos = start
+	return p.parseSelector()
+}
+
+// parseSelector разбор отбора метрик по имени и меткам
+func (p *parser) parseSelector() (*Selector, error) {
+	p.skipSpaces()
+	sel := &Selector{Name: p.ident()}
+	if sel.Name != "" {
+		if _, err := path.Match(sel.Name, ""); err != nil {
+			return nil, p.errorf("invalid metric name %q", sel.Name)
+		}
+	}
+	if p.peek() == '{' {
+		body, err := p.enclosed('{', '}')
+		if err != nil {
+			return nil, err
+		}
+		if sel.Matchers, err = models.ParseLabelMatchers(body); err != nil {
+			return nil, p.errorf("invalid label matchers: %v", err)
+		}
+	}
+	if sel.Name == "" && len(sel.Matchers) == 0 {
+		return nil, p.errorf("metric selector expected")
+	}
+	return sel, nil
+}
+
+// parseCall разбор вызова функции над счетчиками, имя функции уже прочитано
+func (p *parser) parseCall(fn string) (*Call, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	sel, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '[' {
+		return nil, p.errorf("%s requires a window like [5m]", fn)
+	}
+	body, err := p.enclosed('[', ']')
+	if err != nil {
+		return nil, err
+	}
+	window, err := retention.ParseDuration(strings.TrimSpace(body))
+	if err != nil || window <= 0 {
+		return nil, p.errorf("invalid window %q", body)
+	}
+	if err = p.expect(')'); err != nil {
+		return nil, err
+	}
+	return &Call{Func: fn, Selector: sel, Window: window}, nil
+}
+
+// parseAggregation разбор агрегации, оператор уже прочитан, by допускается до и после выражения
+func (p *parser) parseAggregation(op string) (*Aggregation, error) {
+	agg := &Aggregation{Op: op}
+	grouped := false
+	if p.peekKeyword("by") {
+		by, err := p.parseBy()
+		if err != nil {
+			return nil, err
+		}
+		agg.By, grouped = by, true
+	}
+
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	inner, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(')'); err != nil {
+		return nil, err
+	}
+	agg.Expr = inner
+
+	if !grouped && p.peekKeyword("by") {
+		if agg.By, err = p.parseBy(); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+// parseBy разбор списка меток группировки `by (<label>, ...)`
+func (p *parser) parseBy() ([]string, error) {
+	p.skipSpaces()
+	p.ident()
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0)
+	if p.peek() == ')' {
+		p.pos++
+		return labels, nil
+	}
+	for {
+		p.skipSpaces()
+		label := p.ident()
+		if label == "" || strings.ContainsAny(label, "*?.:") {
+			return nil, p.errorf("label name expected")
+		}
+		labels = append(labels, label)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return labels, nil
+		default:
+			return nil, p.errorf("expected , or ) in label list")
+		}
+	}
+}
+
+// enclosed чтение содержимого скобок open ... close с учетом строк в кавычках
+func (p *parser) enclosed(open byte, close byte) (string, error) {
+	if err := p.expect(open); err != nil {
+		return "", err
+	}
+	start := p.pos
+	quoted := false
+	for ; p.pos < len(p.input); p.pos++ {
+		switch c := p.input[p.pos]; {
+		case quoted && c == '\\':
+			p.pos++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == close:
+			p.pos++
+			return p.input[start : p.pos-1], nil
+		}
+	}
+	return "", p.errorf("unclosed %q", open)
+}
+
+// expect пропуск пробелов и ожидаемого символа
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// peek следующий символ после пробелов, 0 в конце выражения
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// peekKeyword следует ли дальше слово keyword, позиция не меняется
+func (p *parser) peekKeyword(keyword string) bool {
+	p.skipSpaces()
+	start := p.pos
+	defer func() { p.pos = start }()
+	return p.ident() == keyword
+}
+
+// ident чтение имени метрики, метки или ключевого слова, имя метрики может содержать * и ?
+func (p *parser) ident() string {
+	start := p.pos
+	for p.pos < len(p.input) && isIdentChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_:.*?", c) >= 0
+}
@@ -0,0 +1,134 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func mustMatchers(t *testing.T, input string) []models.LabelMatcher {
+	matchers, err := models.ParseLabelMatchers(input)
+	require.NoError(t, err)
+	return matchers
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		want    Expr
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "name",
+			input: "Alloc",
+			want:  &Selector{Name: "Alloc"},
+		},
+		{
+			name:  "glob with labels",
+			input: ` cpu_* {host="a", core=~"1|2"} `,
+			want:  &Selector{Name: "cpu_*", Matchers: mustMatchers(t, `host="a", core=~"1|2"`)},
+		},
+		{
+			name:  "regex name",
+			input: `{__name__=~"Heap.*"}`,
+			want:  &Selector{Matchers: mustMatchers(t, `__name__=~"Heap.*"`)},
+		},
+		{
+			name:  "rate",
+			input: "rate(PollCount[5m])",
+			want:  &Call{Func: FuncRate, Selector: &Selector{Name: "PollCount"}, Window: 5 * time.Minute},
+		},
+		{
+			name:  "increase with days",
+			input: `increase(requests{code="500"} [1d])`,
+			want: &Call{
+				Func:     FuncIncrease,
+				Selector: &Selector{Name: "requests", Matchers: mustMatchers(t, `code="500"`)},
+				Window:   24 * time.Hour,
+			},
+		},
+		{
+			name:  "aggregation with by before",
+			input: "sum by (host, env) (rate(requests[1m]))",
+			want: &Aggregation{
+				Op:   "sum",
+				By:   []string{"host", "env"},
+				Expr: &Call{Func: FuncRate, Selector: &Selector{Name: "requests"}, Window: time.Minute},
+			},
+		},
+		{
+			name:  "aggregation with by after",
+			input: "max(cpu_*) by (__name__)",
+			want:  &Aggregation{Op: "max", By: []string{"__name__"}, Expr: &Selector{Name: "cpu_*"}},
+		},
+		{
+			name:  "nested aggregation",
+			input: "count(avg by (host) (cpu))",
+			want: &Aggregation{
+				Op:   "count",
+				Expr: &Aggregation{Op: "avg", By: []string{"host"}, Expr: &Selector{Name: "cpu"}},
+			},
+		},
+		{
+			name:  "metric named like operator",
+			input: `sum{host="a"}`,
+			want:  &Selector{Name: "sum", Matchers: mustMatchers(t, `host="a"`)},
+		},
+		{
+			name:    "empty",
+			input:   " ",
+			wantErr: true,
+		},
+		{
+			name:    "rate without window",
+			input:   "rate(PollCount)",
+			wantErr: true,
+		},
+		{
+			name:    "bad window",
+			input:   "rate(PollCount[soon])",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed labels",
+			input:   `cpu{host="}"`,
+			wantErr: true,
+		},
+		{
+			name:    "bad matcher",
+			input:   `cpu{host}`,
+			wantErr: true,
+		},
+		{
+			name:    "glob in by",
+			input:   "sum by (ho*) (cpu)",
+			wantErr: true,
+		},
+		{
+			name:    "trailing input",
+			input:   "cpu mem",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed aggregation",
+			input:   "sum(cpu",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Historian источник сырой истории значений метрик
+type Historian interface {
+	GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error)
+}
+
+// BatchHistorian источник сырой истории, читающий историю нескольких метрик за один проход,
+// значения каждой метрики возвращаются по возрастанию времени
+type BatchHistorian interface {
+	GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error)
+}
+
+// RollupReader источник агрегатов истории метрик
+type RollupReader interface {
+	GetRollups(mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Rollup, error)
+}
+
+// Store хранилище истории с агрегатами и удалением устаревших значений
+// HistoryNames возвращает ключи метрик всех типов, у которых есть сырая история или агрегаты, по возрастанию
+// SaveRollups сохраняет агрегаты, агрегат за тот же интервал заменяется
+// PruneHistory удаляет значения и агрегаты старше границ
+type Store interface {
+	Historian
+	BatchHistorian
+	RollupReader
+	HistoryNames() ([]models.HistoryKey, error)
+	SaveRollups(mType string, name string, resolution time.Duration, rollups []models.Rollup) error
+	PruneHistory(cutoffs []models.HistoryCutoff) error
+}
+
+// Compactor периодически сворачивает историю в агрегаты и удаляет устаревшие значения по политикам
+type Compactor struct {
+	store    Store
+	done     map[string]time.Time // конец последнего свернутого интервала по метрике и шагу
+	policies []Policy
+	mx       sync.Mutex
+}
+
+// DefaultCompactor компактор истории сервера, nil если политики хранения не заданы
+var DefaultCompactor *Compactor
+
+// NewCompactor создание компактора истории
+func NewCompactor(policies []Policy, store Store) *Compactor {
+	return &Compactor{
+		store:    store,
+		done:     make(map[string]time.Time),
+		policies: policies,
+	}
+}
+
+// Run свертка и удаление устаревшей истории по тикеру до завершения контекста
+func (c *Compactor) Run(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := c.Compact(now); err != nil {
+				logger.WriteErrorLog(err.Error(), "retention compact")
+			}
+		}
+	}
+}
+
+// Compact однократная свертка завершенных интервалов и удаление устаревших значений,
+// сырая история всех сворачиваемых метрик читается одним запросом,
+// история метрики, которую не удалось свернуть, не удаляется
+func (c *Compactor) Compact(now time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	keys, err := c.store.HistoryNames()
+	if err != nil {
+		return err
+	}
+
+	policies := make(map[models.HistoryKey]Policy, len(keys))
+	windows := make(map[models.HistoryKey][]rollupWindow, len(keys))
+	readKeys := make([]models.HistoryKey, 0, len(keys))
+	var from, to time.Time
+	for _, key := range keys {
+		policy, ok := FindPolicy(c.policies, key.Name)
+		if !ok {
+			continue
+		}
+		policies[key] = policy
+		windows[key] = c.windows(key, policy, now)
+		if len(windows[key]) == 0 {
+			continue
+		}
+		for i, w := range windows[key] {
+			if (len(readKeys) == 0 && i == 0) || w.from().Before(from) {
+				from = w.from()
+			}
+			if w.end.After(to) {
+				to = w.end
+			}
+		}
+		readKeys = append(readKeys, key)
+	}
+
+	histories := make(map[models.HistoryKey][]models.Sample)
+	if len(readKeys) > 0 {
+		if histories, err = c.store.GetHistories(readKeys, from, to.Add(-time.Nanosecond)); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	cutoffs := make([]models.HistoryCutoff, 0)
+	for _, key := range keys {
+		policy, ok := policies[key]
+		if !ok {
+			continue
+		}
+		if err = c.rollup(key, windows[key], histories[key]); err != nil {
+			errs = append(errs, fmt.Errorf("rollup %s %s: %w", key.MType, key.Name, err))
+			continue
+		}
+		cutoffs = append(cutoffs, policy.cutoffs(key.MType, key.Name, now)...)
+	}
+	if len(cutoffs) > 0 {
+		if err := c.store.PruneHistory(cutoffs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resolution шаг истории метрики для периода [from, to] по ее политике хранения,
+// без компактора или подходящей политики - сырые значения
+func (c *Compactor) Resolution(name string, from, to, now time.Time) time.Duration {
+	if c == nil {
+		return RawResolution
+	}
+	policy, ok := FindPolicy(c.policies, name)
+	if !ok {
+		return RawResolution
+	}
+	return policy.Resolution(from, to, now)
+}
+
+// ReadHistory получение истории метрики за период с шагом resolution,
+// если хранилище не поддерживает агрегаты, возвращаются сырые значения,
+// вторым значением возвращается фактический шаг
+func ReadHistory(store Historian, mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Sample, time.Duration, error) {
+	reader, ok := store.(RollupReader)
+	if resolution == RawResolution || !ok {
+		samples, err := store.GetHistory(mType, name, from, to)
+		return samples, RawResolution, err
+	}
+	// агрегат, начавшийся до from, тоже попадает в период
+	rollups, err := reader.GetRollups(mType, name, resolution, from.Truncate(resolution), to)
+	if err != nil {
+		return nil, resolution, err
+	}
+	return RollupSamples(mType, rollups), resolution, nil
+}
+
+// History история метрики вместе с шагом, с которым она прочитана
+type History struct {
+	Samples    []models.Sample
+	Resolution time.Duration
+}
+
+// ReadHistories получение истории нескольких метрик за период с шагами resolutions,
+// сырая история всех метрик читается за один проход, если хранилище это поддерживает
+func ReadHistories(store Historian, resolutions map[models.HistoryKey]time.Duration, from, to time.Time) (map[models.HistoryKey]History, error) {
+	result := make(map[models.HistoryKey]History, len(resolutions))
+	raw := make([]models.HistoryKey, 0, len(resolutions))
+	for key, resolution := range resolutions {
+		if _, ok := store.(RollupReader); resolution == RawResolution || !ok {
+			raw = append(raw, key)
+			continue
+		}
+		samples, resolution, err := ReadHistory(store, key.MType, key.Name, resolution, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of %s: %w", key.Name, err)
+		}
+		result[key] = History{Samples: samples, Resolution: resolution}
+	}
+	if len(raw) == 0 {
+		return result, nil
+	}
+	slices.SortFunc(raw, models.CompareHistoryKeys)
+
+	batch, ok := store.(BatchHistorian)
+	if !ok {
+		for _, key := range raw {
+			samples, err := store.GetHistory(key.MType, key.Name, from, to)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read history of %s: %w", key.Name, err)
+			}
+			result[key] = History{Samples: samples, Resolution: RawResolution}
+		}
+		return result, nil
+	}
+	histories, err := batch.GetHistories(raw, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	for _, key := range raw {
+		result[key] = History{Samples: histories[key], Resolution: RawResolution}
+	}
+	return result, nil
+}
+
+// rollupWindow еще не свернутые завершенные интервалы метрики с шагом уровня политики
+type rollupWindow struct {
+	start time.Time
+	end   time.Time
+	done  string // ключ конца последнего свернутого интервала
+	tier  Tier
+}
+
+// from начало чтения истории окна, значение перед первым интервалом нужно для прироста счетчика
+func (w rollupWindow) from() time.Time {
+	if w.start.IsZero() {
+		return w.start
+	}
+	return w.start.Add(-w.tier.Resolution)
+}
+
+// windows окна свертки метрики для всех уровней политики,
+// после перезапуска свертка начинается с первого интервала, сырые значения которого целиком сохранились
+func (c *Compactor) windows(key models.HistoryKey, policy Policy, now time.Time) []rollupWindow {
+	result := make([]rollupWindow, 0, len(policy.Tiers))
+	for _, tier := range policy.Tiers {
+		done := fmt.Sprintf("%s/%s/%s", key.MType, key.Name, tier.Resolution)
+		end := now.Truncate(tier.Resolution)
+		start, ok := c.done[done]
+		if !ok && policy.Raw != 0 {
+			start = ceil(now.Add(-policy.Raw), tier.Resolution)
+		}
+		if !start.Before(end) {
+			continue
+		}
+		result = append(result, rollupWindow{start: start, end: end, done: done, tier: tier})
+	}
+	return result
+}
+
+// rollup свертка окон метрики по ее сырой истории, прочитанной за все окна сразу
+func (c *Compactor) rollup(key models.HistoryKey, windows []rollupWindow, samples []models.Sample) error {
+	for _, w := range windows {
+		from := w.from()
+		var previous *models.Sample
+		window := make([]models.Sample, 0, len(samples))
+		for i := range samples {
+			at := samples[i].Timestamp
+			switch {
+			case at.Before(from) || !at.Before(w.end):
+			case at.Before(w.start):
+				previous = &samples[i]
+			default:
+				window = append(window, samples[i])
+			}
+		}
+
+		if rollups := Downsample(key.MType, window, w.tier.Resolution, previous); len(rollups) > 0 {
+			if err := c.store.SaveRollups(key.MType, key.Name, w.tier.Resolution, rollups); err != nil {
+				return err
+			}
+		}
+		c.done[w.done] = w.end
+	}
+	return nil
+}
+
+// cutoffs границы удаления сырых значений и агрегатов метрики по политике
+func (p Policy) cutoffs(mType string, name string, now time.Time) []models.HistoryCutoff {
+	result := make([]models.HistoryCutoff, 0, len(p.Tiers)+1)
+	if p.Raw != 0 {
+		result = append(result, models.HistoryCutoff{Before: now.Add(-p.Raw), MType: mType, Name: name})
+	}
+	for _, tier := range p.Tiers {
+		if tier.Retention != 0 {
+			result = append(result, models.HistoryCutoff{
+				Before:     now.Add(-tier.Retention),
+				MType:      mType,
+				Name:       name,
+				Resolution: tier.Resolution,
+			})
+		}
+	}
+	return result
+}
+
+// ceil округление времени вверх до шага
+func ceil(t time.Time, step time.Duration) time.Time {
+	truncated := t.Truncate(step)
+	if truncated.Before(t) {
+		return truncated.Add(step)
+	}
+	return truncated
+}
@@ -0,0 +1,266 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+type fakeStore struct {
+	history map[string][]models.Sample
+	rollups map[string]map[time.Time]models.Rollup
+	pruned  []models.HistoryCutoff
+	saves   int
+	reads   int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		history: make(map[string][]models.Sample),
+		rollups: make(map[string]map[time.Time]models.Rollup),
+	}
+}
+
+func rollupsKey(mType string, name string, resolution time.Duration) string {
+	return mType + "/" + name + "/" + resolution.String()
+}
+
+func (s *fakeStore) GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	s.reads++
+	result := make([]models.Sample, 0)
+	for _, sample := range s.history[mType+"/"+name] {
+		if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+			result = append(result, sample)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeStore) GetRollups(mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	result := make([]models.Rollup, 0)
+	for _, rollup := range s.rollups[rollupsKey(mType, name, resolution)] {
+		if !rollup.Timestamp.Before(from) && !rollup.Timestamp.After(to) {
+			result = append(result, rollup)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+func (s *fakeStore) GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	s.reads++
+	result := make(map[models.HistoryKey][]models.Sample, len(keys))
+	for _, key := range keys {
+		for _, sample := range s.history[key.MType+"/"+key.Name] {
+			if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+				result[key] = append(result[key], sample)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeStore) HistoryNames() ([]models.HistoryKey, error) {
+	return []models.HistoryKey{
+		{MType: "counter", Name: "PollCount"},
+		{MType: "gauge", Name: "Alloc"},
+		{MType: "gauge", Name: "other"},
+	}, nil
+}
+
+func (s *fakeStore) SaveRollups(mType string, name string, resolution time.Duration, rollups []models.Rollup) error {
+	key := rollupsKey(mType, name, resolution)
+	if s.rollups[key] == nil {
+		s.rollups[key] = make(map[time.Time]models.Rollup)
+	}
+	for _, rollup := range rollups {
+		s.rollups[key][rollup.Timestamp] = rollup
+	}
+	s.saves++
+	return nil
+}
+
+func (s *fakeStore) PruneHistory(cutoffs []models.HistoryCutoff) error {
+	s.pruned = append(s.pruned, cutoffs...)
+	return nil
+}
+
+func TestCompactor_Compact(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	for i := 0; i < 6; i++ {
+		at := start.Add(time.Duration(i) * 30 * time.Second)
+		store.history["gauge/Alloc"] = append(store.history["gauge/Alloc"], models.Sample{Timestamp: at, Value: float64(i)})
+		store.history["counter/PollCount"] = append(store.history["counter/PollCount"], models.Sample{Timestamp: at, Value: float64(i * 10)})
+	}
+	policies := []Policy{
+		{Pattern: "Alloc", Raw: time.Hour, Tiers: []Tier{{Resolution: time.Minute, Retention: day}}},
+		{Pattern: "PollCount", Tiers: []Tier{{Resolution: time.Minute}}},
+	}
+	compactor := NewCompactor(policies, store)
+
+	// третья минута еще не завершена и не сворачивается
+	now := start.Add(2*time.Minute + 40*time.Second)
+	require.NoError(t, compactor.Compact(now))
+	assert.Equal(t, 1, store.reads, "history of all metrics must be read at once")
+
+	gauges, err := store.GetRollups("gauge", "Alloc", time.Minute, time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+	assert.Equal(t, models.Rollup{Timestamp: start, Count: 2, Min: 0, Max: 1, Avg: 0.5, Last: 1, Sum: 1}, gauges[0])
+
+	counters, err := store.GetRollups("counter", "PollCount", time.Minute, time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, counters, 2)
+	assert.Equal(t, 10.0, counters[0].Sum)
+	assert.Equal(t, 20.0, counters[1].Sum, "increase of the second minute counts the previous value")
+
+	assert.Equal(t, []models.HistoryCutoff{
+		{Before: now.Add(-time.Hour), MType: "gauge", Name: "Alloc"},
+		{Before: now.Add(-day), MType: "gauge", Name: "Alloc", Resolution: time.Minute},
+	}, store.pruned)
+
+	// повторный проход в той же минуте ничего не пересчитывает
+	saves := store.saves
+	require.NoError(t, compactor.Compact(now.Add(time.Second)))
+	assert.Equal(t, saves, store.saves)
+
+	require.NoError(t, compactor.Compact(now.Add(time.Minute)))
+	counters, err = store.GetRollups("counter", "PollCount", time.Minute, time.Time{}, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, counters, 3)
+	assert.Equal(t, 20.0, counters[2].Sum)
+}
+
+func TestCompactor_CompactAfterRestart(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i)*time.Minute + 30*time.Second)
+		store.history["gauge/Alloc"] = append(store.history["gauge/Alloc"], models.Sample{Timestamp: at, Value: float64(i)})
+	}
+	policies := []Policy{{Pattern: "Alloc", Raw: 150 * time.Second, Tiers: []Tier{{Resolution: time.Minute}}}}
+
+	// сырые значения до 10:01:30 уже могли быть удалены, поэтому свертка начинается с 10:02
+	now := start.Add(4 * time.Minute)
+	require.NoError(t, NewCompactor(policies, store).Compact(now))
+
+	rollups, err := store.GetRollups("gauge", "Alloc", time.Minute, time.Time{}, now)
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.Equal(t, start.Add(2*time.Minute), rollups[0].Timestamp)
+}
+
+type errorStore struct {
+	*fakeStore
+}
+
+func (s errorStore) GetHistories([]models.HistoryKey, time.Time, time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	return nil, errors.New("history unavailable")
+}
+
+func TestCompactor_CompactErrorKeepsHistory(t *testing.T) {
+	store := errorStore{newFakeStore()}
+	policies := []Policy{{Pattern: "*", Raw: time.Hour, Tiers: []Tier{{Resolution: time.Minute}}}}
+
+	assert.Error(t, NewCompactor(policies, store).Compact(time.Now()))
+	assert.Empty(t, store.pruned)
+}
+
+func TestCompactor_Resolution(t *testing.T) {
+	now := time.Now()
+	var empty *Compactor
+	assert.Equal(t, RawResolution, empty.Resolution("Alloc", time.Time{}, now, now))
+
+	compactor := NewCompactor([]Policy{{Pattern: "Alloc", Raw: time.Hour, Tiers: []Tier{{Resolution: time.Hour}}}}, newFakeStore())
+	assert.Equal(t, time.Hour, compactor.Resolution("Alloc", time.Time{}, now, now))
+	assert.Equal(t, RawResolution, compactor.Resolution("other", time.Time{}, now, now))
+}
+
+func TestReadHistory(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	store.history["gauge/Alloc"] = []models.Sample{{Timestamp: start.Add(90 * time.Second), Value: 7}}
+	require.NoError(t, store.SaveRollups("gauge", "Alloc", time.Minute, []models.Rollup{
+		{Timestamp: start, Count: 1, Avg: 1},
+		{Timestamp: start.Add(time.Minute), Count: 1, Avg: 2},
+	}))
+
+	samples, resolution, err := ReadHistory(store, "gauge", "Alloc", time.Minute, start.Add(30*time.Second), start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, resolution)
+	require.Len(t, samples, 2, "rollup started before from is included")
+	assert.Equal(t, 1.0, samples[0].Value)
+	assert.NotNil(t, samples[0].Rollup)
+
+	samples, resolution, err = ReadHistory(store, "gauge", "Alloc", RawResolution, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, RawResolution, resolution)
+	assert.Equal(t, []models.Sample{{Timestamp: start.Add(90 * time.Second), Value: 7}}, samples)
+
+	// хранилище без агрегатов отдает сырые значения
+	var raw Historian = struct{ Historian }{store}
+	samples, resolution, err = ReadHistory(raw, "gauge", "Alloc", time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, RawResolution, resolution)
+	assert.Len(t, samples, 1)
+}
+
+func TestReadHistories(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := newFakeStore()
+	store.history["gauge/Alloc"] = []models.Sample{{Timestamp: start.Add(90 * time.Second), Value: 7}}
+	store.history["counter/PollCount"] = []models.Sample{{Timestamp: start.Add(time.Minute), Value: 3}}
+	store.history["gauge/other"] = []models.Sample{{Timestamp: start, Value: 1}}
+	require.NoError(t, store.SaveRollups("gauge", "other", time.Minute, []models.Rollup{{Timestamp: start, Count: 1, Avg: 5}}))
+
+	alloc := models.HistoryKey{MType: "gauge", Name: "Alloc"}
+	pollCount := models.HistoryKey{MType: "counter", Name: "PollCount"}
+	other := models.HistoryKey{MType: "gauge", Name: "other"}
+	resolutions := map[models.HistoryKey]time.Duration{alloc: RawResolution, pollCount: RawResolution, other: time.Minute}
+
+	histories, err := ReadHistories(store, resolutions, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.reads, "raw history is read at once")
+	assert.Equal(t, History{Samples: store.history["gauge/Alloc"], Resolution: RawResolution}, histories[alloc])
+	assert.Equal(t, History{Samples: store.history["counter/PollCount"], Resolution: RawResolution}, histories[pollCount])
+	assert.Equal(t, time.Minute, histories[other].Resolution)
+	require.Len(t, histories[other].Samples, 1)
+	assert.Equal(t, 5.0, histories[other].Samples[0].Value)
+
+	// хранилище без пакетного чтения читает историю по одной метрике
+	store.reads = 0
+	var raw Historian = struct{ Historian }{store}
+	histories, err = ReadHistories(raw, resolutions, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.reads)
+	assert.Equal(t, RawResolution, histories[other].Resolution)
+	assert.Equal(t, store.history["gauge/other"], histories[other].Samples)
+}
+
+func TestCompactor_Run(t *testing.T) {
+	store := newFakeStore()
+	store.history["gauge/Alloc"] = []models.Sample{{Timestamp: time.Now().Add(-time.Minute), Value: 1}}
+	compactor := NewCompactor([]Policy{{Pattern: "*", Raw: time.Hour, Tiers: []Tier{{Resolution: time.Second}}}}, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		compactor.Run(ctx, time.NewTicker(10*time.Millisecond))
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		compactor.mx.Lock()
+		defer compactor.mx.Unlock()
+		return store.saves > 0
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
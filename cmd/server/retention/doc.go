@@ -0,0 +1,6 @@
+// Package retention пакет с политиками хранения и прореживанием истории метрик
+// - разбор политик вида `cpu* raw=24h 1m=30d 1h=1y` по шаблону имени метрики
+// - свертка сырых значений в агрегаты min/max/avg/last для gauge и sum/rate для counter
+// - периодическое удаление устаревших значений и агрегатов в хранилище
+// - выбор шага истории под запрошенный период
+package retention
@@ -0,0 +1,191 @@
+package retention
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// RawResolution шаг сырой (непрореженной) истории
+const RawResolution time.Duration = 0
+
+// MaxPoints максимальное количество точек, на которое рассчитан выбор шага истории под период
+var MaxPoints = 1500
+
+// Tier уровень прореживания: агрегаты с шагом Resolution хранятся в течение Retention
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration // 0 - без ограничения
+}
+
+// Policy политика хранения истории метрик, имя которых подходит под шаблон
+// Expr исходная строка политики
+// Pattern шаблон имени метрики (path.Match), метки не учитываются
+// Raw сколько хранятся сырые значения, 0 - без ограничения
+// Tiers уровни прореживания по возрастанию шага
+type Policy struct {
+	Expr    string
+	Pattern string
+	Tiers   []Tier
+	Raw     time.Duration
+}
+
+// ParsePolicy разбор политики вида `<pattern> raw=<duration> [<resolution>=<retention> ...]`,
+// длительности задаются как в time.ParseDuration, дополнительно поддерживаются дни (d) и годы (y)
+func ParsePolicy(expr string) (Policy, error) {
+	policy := Policy{Expr: strings.TrimSpace(expr)}
+	fields := strings.Fields(policy.Expr)
+	if len(fields) < 2 {
+		return policy, fmt.Errorf("policy %q must have a pattern and at least one retention", expr)
+	}
+	if _, err := path.Match(fields[0], ""); err != nil {
+		return policy, fmt.Errorf("invalid pattern in policy %q: %w", expr, err)
+	}
+	policy.Pattern = fields[0]
+
+	rawSet := false
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid retention %q in policy %q", field, expr)
+		}
+		retention, err := ParseDuration(value)
+		if err != nil || retention < 0 {
+			return policy, fmt.Errorf("invalid retention %q in policy %q", field, expr)
+		}
+		if key == "raw" {
+			if rawSet {
+				return policy, fmt.Errorf("duplicate raw retention in policy %q", expr)
+			}
+			policy.Raw, rawSet = retention, true
+			continue
+		}
+		resolution, err := ParseDuration(key)
+		// шаг хранится в секундах
+		if err != nil || resolution < time.Second || resolution%time.Second != 0 {
+			return policy, fmt.Errorf("invalid resolution %q in policy %q", field, expr)
+		}
+		policy.Tiers = append(policy.Tiers, Tier{Resolution: resolution, Retention: retention})
+	}
+
+	sort.Slice(policy.Tiers, func(i, j int) bool {
+		return policy.Tiers[i].Resolution < policy.Tiers[j].Resolution
+	})
+	for i, tier := range policy.Tiers {
+		if i > 0 && tier.Resolution == policy.Tiers[i-1].Resolution {
+			return policy, fmt.Errorf("duplicate resolution %s in policy %q", tier.Resolution, expr)
+		}
+		if tier.Retention != 0 && tier.Retention < tier.Resolution {
+			return policy, fmt.Errorf("retention of %s rollups is shorter than resolution in policy %q", tier.Resolution, expr)
+		}
+		// агрегаты всех уровней строятся по сырым значениям, поэтому они должны дожить до конца интервала
+		if policy.Raw != 0 && policy.Raw < tier.Resolution {
+			return policy, fmt.Errorf("raw retention is shorter than resolution %s in policy %q", tier.Resolution, expr)
+		}
+	}
+	return policy, nil
+}
+
+// LoadPolicies загрузка политик из конфигурации и файла политик (одна политика на строку, # комментарий),
+// для метрики применяется первая подходящая политика
+func LoadPolicies(exprs []string, filePath string) ([]Policy, error) {
+	all := append([]string{}, exprs...)
+
+	if filePath != "" {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open retention file %s: %w", filePath, err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			all = append(all, scanner.Text())
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read retention file %s: %w", filePath, err)
+		}
+	}
+
+	policies := make([]Policy, 0, len(all))
+	var errs []error
+	for _, expr := range all {
+		expr = strings.TrimSpace(expr)
+		if expr == "" || strings.HasPrefix(expr, "#") {
+			continue
+		}
+		policy, err := ParsePolicy(expr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies, errors.Join(errs...)
+}
+
+// ParseDuration разбор длительности с поддержкой дней (30d) и лет (1y = 365d)
+func ParseDuration(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// FindPolicy поиск первой политики, под шаблон которой подходит метрика с ключом key
+func FindPolicy(policies []Policy, key string) (Policy, bool) {
+	name, _, err := models.ParseMetricKey(key)
+	if err != nil {
+		name = key
+	}
+	for _, policy := range policies {
+		if ok, _ := path.Match(policy.Pattern, name); ok {
+			return policy, true
+		}
+	}
+	return Policy{}, false
+}
+
+// Resolution выбор шага истории для периода [from, to]:
+// сырые значения, если они еще хранятся с начала периода,
+// иначе самый мелкий уровень, который хранится с начала периода и дает не больше MaxPoints точек,
+// если такого нет - самый крупный уровень
+func (p Policy) Resolution(from, to, now time.Time) time.Duration {
+	if covers(p.Raw, from, now) || len(p.Tiers) == 0 {
+		return RawResolution
+	}
+	for _, tier := range p.Tiers {
+		if covers(tier.Retention, from, now) && to.Sub(from)/tier.Resolution <= time.Duration(MaxPoints) {
+			return tier.Resolution
+		}
+	}
+	return p.Tiers[len(p.Tiers)-1].Resolution
+}
+
+// covers хранятся ли значения с момента from при сроке хранения retention
+func covers(retention time.Duration, from, now time.Time) bool {
+	return retention == 0 || !from.Before(now.Add(-retention))
+}
+
+// FormatResolution представление шага истории для ответа: raw или длительность
+func FormatResolution(resolution time.Duration) string {
+	if resolution == RawResolution {
+		return "raw"
+	}
+	return resolution.String()
+}
@@ -0,0 +1,185 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const day = 24 * time.Hour
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "raw and tiers",
+			expr: " cpu* raw=24h 1h=1y 1m=30d ",
+			want: Policy{
+				Expr:    "cpu* raw=24h 1h=1y 1m=30d",
+				Pattern: "cpu*",
+				Raw:     day,
+				Tiers: []Tier{
+					{Resolution: time.Minute, Retention: 30 * day},
+					{Resolution: time.Hour, Retention: 365 * day},
+				},
+			},
+		},
+		{
+			name: "raw only",
+			expr: "* raw=7d",
+			want: Policy{Expr: "* raw=7d", Pattern: "*", Raw: 7 * day},
+		},
+		{
+			name: "unlimited rollups",
+			expr: "Alloc 5m=0",
+			want: Policy{Expr: "Alloc 5m=0", Pattern: "Alloc", Tiers: []Tier{{Resolution: 5 * time.Minute}}},
+		},
+		{
+			name:    "no retention",
+			expr:    "cpu*",
+			wantErr: true,
+		},
+		{
+			name:    "bad pattern",
+			expr:    "cpu[ raw=1h",
+			wantErr: true,
+		},
+		{
+			name:    "bad duration",
+			expr:    "cpu raw=soon",
+			wantErr: true,
+		},
+		{
+			name:    "sub second resolution",
+			expr:    "cpu raw=1h 500ms=1h",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate resolution",
+			expr:    "cpu 1m=1h 60s=2h",
+			wantErr: true,
+		},
+		{
+			name:    "retention shorter than resolution",
+			expr:    "cpu 1h=30m",
+			wantErr: true,
+		},
+		{
+			name:    "raw shorter than resolution",
+			expr:    "cpu raw=30m 1h=1d",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "retention.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("# system metrics\ncpu* raw=1h 1m=1d\n\nbroken\n"), 0666))
+
+	policies, err := LoadPolicies([]string{"Alloc raw=24h"}, filePath)
+	assert.Error(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "Alloc", policies[0].Pattern)
+	assert.Equal(t, "cpu*", policies[1].Pattern)
+
+	_, err = LoadPolicies(nil, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "90s", want: 90 * time.Second},
+		{value: "30d", want: 30 * day},
+		{value: "1.5d", want: 36 * time.Hour},
+		{value: "1y", want: 365 * day},
+		{value: "xd", wantErr: true},
+		{value: "1w", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindPolicy(t *testing.T) {
+	policies := []Policy{
+		{Pattern: "cpu*", Raw: time.Hour},
+		{Pattern: "*", Raw: day},
+	}
+
+	policy, ok := FindPolicy(policies, `cpu_usage{core="1"}`)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, policy.Raw)
+
+	policy, ok = FindPolicy(policies, "Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, day, policy.Raw)
+
+	_, ok = FindPolicy(policies[:1], "Alloc")
+	assert.False(t, ok)
+}
+
+func TestPolicy_Resolution(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{
+		Raw: day,
+		Tiers: []Tier{
+			{Resolution: time.Minute, Retention: 30 * day},
+			{Resolution: time.Hour, Retention: 365 * day},
+		},
+	}
+	tests := []struct {
+		from time.Time
+		to   time.Time
+		name string
+		want time.Duration
+	}{
+		{name: "raw", from: now.Add(-time.Hour), to: now, want: RawResolution},
+		{name: "minutes", from: now.Add(-2 * day), to: now.Add(-2*day + 12*time.Hour), want: time.Minute},
+		{name: "too many minutes", from: now.Add(-7 * day), to: now, want: time.Hour},
+		{name: "hours", from: now.Add(-100 * day), to: now, want: time.Hour},
+		{name: "older than everything", from: time.Time{}, to: now, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Resolution(tt.from, tt.to, now))
+		})
+	}
+
+	assert.Equal(t, RawResolution, Policy{Raw: time.Hour}.Resolution(time.Time{}, now, now))
+}
+
+func TestFormatResolution(t *testing.T) {
+	assert.Equal(t, "raw", FormatResolution(RawResolution))
+	assert.Equal(t, "1m0s", FormatResolution(time.Minute))
+}
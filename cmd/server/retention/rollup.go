@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"math"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Downsample свертка упорядоченных по времени значений в агрегаты с шагом resolution,
+// previous - последнее значение перед первым интервалом, нужно для прироста счетчика,
+// сброс счетчика (уменьшение накопленного значения) считается приростом от нуля
+func Downsample(mType string, samples []models.Sample, resolution time.Duration, previous *models.Sample) []models.Rollup {
+	result := make([]models.Rollup, 0)
+	if resolution <= 0 {
+		return result
+	}
+
+	var current *models.Rollup
+	var sum float64
+	for _, sample := range samples {
+		start := sample.Timestamp.Truncate(resolution)
+		if current == nil || !current.Timestamp.Equal(start) {
+			if current != nil {
+				result = append(result, finish(mType, *current, sum, resolution))
+			}
+			current = &models.Rollup{Timestamp: start, Min: math.Inf(1), Max: math.Inf(-1)}
+			sum = 0
+		}
+
+		current.Count++
+		current.Min = math.Min(current.Min, sample.Value)
+		current.Max = math.Max(current.Max, sample.Value)
+		current.Last = sample.Value
+		sum += sample.Value
+
+		if mType == "counter" && previous != nil {
+			increase := sample.Value - previous.Value
+			if increase < 0 {
+				increase = sample.Value
+			}
+			current.Sum += increase
+		}
+		prev := sample
+		previous = &prev
+	}
+	if current != nil {
+		result = append(result, finish(mType, *current, sum, resolution))
+	}
+	return result
+}
+
+// finish расчет средних и скорости по накопленному агрегату
+func finish(mType string, rollup models.Rollup, sum float64, resolution time.Duration) models.Rollup {
+	rollup.Avg = sum / float64(rollup.Count)
+	switch mType {
+	case "counter":
+		rollup.Rate = rollup.Sum / resolution.Seconds()
+	default:
+		rollup.Sum = sum
+	}
+	return rollup
+}
+
+// RollupSamples представление агрегатов в виде значений истории:
+// значение - среднее для gauge и последнее накопленное для counter
+func RollupSamples(mType string, rollups []models.Rollup) []models.Sample {
+	result := make([]models.Sample, 0, len(rollups))
+	for i := range rollups {
+		rollup := rollups[i]
+		value := rollup.Avg
+		if mType == "counter" {
+			value = rollup.Last
+		}
+		result = append(result, models.Sample{Timestamp: rollup.Timestamp, Value: value, Rollup: &rollup})
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestDownsample_Gauge(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	samples := []models.Sample{
+		{Timestamp: start.Add(10 * time.Second), Value: 4},
+		{Timestamp: start.Add(20 * time.Second), Value: 2},
+		{Timestamp: start.Add(50 * time.Second), Value: 6},
+		{Timestamp: start.Add(70 * time.Second), Value: 1},
+	}
+
+	got := Downsample("gauge", samples, time.Minute, nil)
+	require.Len(t, got, 2)
+	assert.Equal(t, models.Rollup{Timestamp: start, Count: 3, Min: 2, Max: 6, Avg: 4, Last: 6, Sum: 12}, got[0])
+	assert.Equal(t, models.Rollup{Timestamp: start.Add(time.Minute), Count: 1, Min: 1, Max: 1, Avg: 1, Last: 1, Sum: 1}, got[1])
+}
+
+func TestDownsample_Counter(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	previous := models.Sample{Timestamp: start.Add(-10 * time.Second), Value: 100}
+	samples := []models.Sample{
+		{Timestamp: start.Add(10 * time.Second), Value: 130},
+		{Timestamp: start.Add(40 * time.Second), Value: 160},
+		// сброс счетчика после перезапуска агента
+		{Timestamp: start.Add(70 * time.Second), Value: 15},
+		{Timestamp: start.Add(100 * time.Second), Value: 45},
+	}
+
+	got := Downsample("counter", samples, time.Minute, &previous)
+	require.Len(t, got, 2)
+	assert.Equal(t, 60.0, got[0].Sum)
+	assert.Equal(t, 1.0, got[0].Rate)
+	assert.Equal(t, 160.0, got[0].Last)
+	assert.Equal(t, 45.0, got[1].Sum)
+	assert.Equal(t, 0.75, got[1].Rate)
+	assert.Equal(t, 15.0, got[1].Min)
+
+	// без предыдущего значения прирост считается с первого значения интервала
+	got = Downsample("counter", samples[:2], time.Minute, nil)
+	require.Len(t, got, 1)
+	assert.Equal(t, 30.0, got[0].Sum)
+
+	assert.Empty(t, Downsample("counter", samples, 0, nil))
+}
+
+func TestRollupSamples(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	rollups := []models.Rollup{{Timestamp: start, Count: 2, Avg: 3, Last: 5}}
+
+	gauges := RollupSamples("gauge", rollups)
+	require.Len(t, gauges, 1)
+	assert.Equal(t, 3.0, gauges[0].Value)
+	assert.Equal(t, start, gauges[0].Timestamp)
+	assert.Equal(t, &rollups[0], gauges[0].Rollup)
+
+	counters := RollupSamples("counter", rollups)
+	require.Len(t, counters, 1)
+	assert.Equal(t, 5.0, counters[0].Value)
+}
@@ -1,7 +1,11 @@
 package db
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
 	"github.com/ramil063/gometrics/internal/logger"
@@ -30,6 +34,11 @@ func (s *Storage) SetGauge(name string, value models.Gauge) error {
 		logger.WriteErrorLog("SetGauge error", "expected to affect 1 row")
 		return errors.New("SetGauge expected to affect 1 row")
 	}
+
+	if _, err = dml.AddGaugeHistory(&dml.DBRepository, name, value, time.Now().UTC()); err != nil {
+		logger.WriteErrorLog("SetGauge error in history sql", err.Error())
+		return err
+	}
 	return nil
 }
 
@@ -55,5 +64,118 @@ func (s *Storage) AddCounter(name string, value models.Counter) error {
 		logger.WriteErrorLog("AddCounter error", "expected to affect 1 row")
 		return errors.New("AddCounter expected to affect 1 row")
 	}
+
+	if _, err = dml.AddCounterHistory(&dml.DBRepository, name, time.Now().UTC()); err != nil {
+		logger.WriteErrorLog("AddCounter error in history sql", err.Error())
+		return err
+	}
 	return nil
 }
+
+// UpdateBatch сохранение пачки метрик в одной транзакции,
+// повторы метрик внутри пачки сворачиваются: для Gauge остается последнее значение, для Counter суммируются приращения,
+// строки блокируются в порядке (тип, имя), чтобы параллельные пачки с общими метриками не взаимоблокировались
+func (s *Storage) UpdateBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	if err := models.ValidateBatch(metrics); err != nil {
+		return nil, err
+	}
+
+	gauges := make([]dml.GaugeValue, 0, len(metrics))
+	gaugeIndex := make(map[string]int)
+	counters := make([]dml.CounterValue, 0, len(metrics))
+	counterIndex := make(map[string]int)
+	for _, m := range metrics {
+		key := m.Key()
+		switch m.MType {
+		case "gauge":
+			if i, ok := gaugeIndex[key]; ok {
+				gauges[i].Value = models.Gauge(*m.Value)
+				continue
+			}
+			gaugeIndex[key] = len(gauges)
+			gauges = append(gauges, dml.GaugeValue{Name: key, Value: models.Gauge(*m.Value)})
+		case "counter":
+			if i, ok := counterIndex[key]; ok {
+				counters[i].Value += models.Counter(*m.Delta)
+				continue
+			}
+			counterIndex[key] = len(counters)
+			counters = append(counters, dml.CounterValue{Name: key, Value: models.Counter(*m.Delta)})
+		}
+	}
+	// таблицы пишутся всегда в одном порядке (gauge, затем counter), внутри таблицы строки сортируются по имени
+	slices.SortFunc(gauges, func(a, b dml.GaugeValue) int { return cmp.Compare(a.Name, b.Name) })
+	slices.SortFunc(counters, func(a, b dml.CounterValue) int { return cmp.Compare(a.Name, b.Name) })
+
+	ctx := context.Background()
+	tx, err := dml.DBRepository.BeginTx(ctx)
+	if err != nil {
+		logger.WriteErrorLog("UpdateBatch begin transaction error", err.Error())
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.WriteErrorLog("UpdateBatch rollback error", rbErr.Error())
+			}
+		}
+	}()
+
+	now := time.Now().UTC()
+	if err = dml.UpsertGauges(ctx, tx, gauges); err != nil {
+		logger.WriteErrorLog("UpdateBatch error in gauge sql", err.Error())
+		return nil, err
+	}
+	if err = dml.AddGaugesHistory(ctx, tx, gauges, now); err != nil {
+		logger.WriteErrorLog("UpdateBatch error in gauge history sql", err.Error())
+		return nil, err
+	}
+
+	totals, err := dml.UpsertCounters(ctx, tx, counters)
+	if err != nil {
+		logger.WriteErrorLog("UpdateBatch error in counter sql", err.Error())
+		return nil, err
+	}
+	counterTotals := make([]dml.CounterValue, 0, len(counters))
+	for _, c := range counters {
+		total, ok := totals[c.Name]
+		if !ok {
+			err = errors.New("UpdateBatch counter " + c.Name + " not returned")
+			logger.WriteErrorLog("UpdateBatch error in counter sql", err.Error())
+			return nil, err
+		}
+		counterTotals = append(counterTotals, dml.CounterValue{Name: c.Name, Value: total})
+	}
+	if err = dml.AddCountersHistory(ctx, tx, counterTotals, now); err != nil {
+		logger.WriteErrorLog("UpdateBatch error in counter history sql", err.Error())
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.WriteErrorLog("UpdateBatch commit error", err.Error())
+		return nil, err
+	}
+
+	return batchResult(metrics, totals), nil
+}
+
+// batchResult результат сохранения пачки в исходном порядке,
+// для повторяющихся счетчиков значение восстанавливается на момент каждого приращения
+func batchResult(metrics []models.Metrics, totals map[string]models.Counter) []models.Metrics {
+	running := make(map[string]int64, len(totals))
+	for name, total := range totals {
+		running[name] = int64(total)
+	}
+	result := make([]models.Metrics, len(metrics))
+	for i := len(metrics) - 1; i >= 0; i-- {
+		current := metrics[i]
+		if current.MType == "counter" {
+			key := current.Key()
+			value := running[key]
+			running[key] = value - *current.Delta
+			current.Delta = &value
+		}
+		result[i] = current
+	}
+	return result
+}
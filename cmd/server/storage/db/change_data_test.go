@@ -1,10 +1,12 @@
 package db
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
 	"github.com/ramil063/gometrics/internal/models"
@@ -18,6 +20,9 @@ func TestStorage_AddCounter(t *testing.T) {
 	mock.ExpectExec("^INSERT INTO counter *").
 		WithArgs("metric1", int64(1)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO counter_history *").
+		WithArgs("metric1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	type args struct {
 		name  string
@@ -40,6 +45,7 @@ func TestStorage_AddCounter(t *testing.T) {
 			s := &Storage{}
 			err := s.AddCounter(tt.args.name, tt.args.value)
 			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
@@ -52,6 +58,9 @@ func TestStorage_SetGauge(t *testing.T) {
 	mock.ExpectExec("^INSERT INTO gauge *").
 		WithArgs("metric1", float64(1)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO gauge_history *").
+		WithArgs("metric1", sqlmock.AnyArg(), float64(1)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	type args struct {
 		name  string
@@ -73,6 +82,119 @@ func TestStorage_SetGauge(t *testing.T) {
 			s := &Storage{}
 			err := s.SetGauge(tt.args.name, tt.args.value)
 			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStorage_UpdateBatch(t *testing.T) {
+	gauge1, gauge2 := 1.5, 2.5
+	delta1, delta2 := int64(2), int64(3)
+	metrics := []models.Metrics{
+		{ID: "cpu", MType: "gauge", Value: &gauge1},
+		{ID: "PollCount", MType: "counter", Delta: &delta1},
+		{ID: "cpu", MType: "gauge", Value: &gauge2},
+		{ID: "PollCount", MType: "counter", Delta: &delta2},
+	}
+
+	tests := []struct {
+		name       string
+		prepare    func(mock sqlmock.Sqlmock)
+		wantErr    bool
+		wantDeltas []int64
+	}{
+		{
+			name: "commit",
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("^INSERT INTO gauge *").
+					WithArgs("cpu", float64(2.5)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO gauge_history *").
+					WithArgs("cpu", sqlmock.AnyArg(), float64(2.5)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("^INSERT INTO counter *").
+					WithArgs("PollCount", int64(5)).
+					WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).AddRow("PollCount", int64(15)))
+				mock.ExpectExec("^INSERT INTO counter_history *").
+					WithArgs("PollCount", sqlmock.AnyArg(), int64(15)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantDeltas: []int64{12, 15},
+		},
+		{
+			name: "rollback on error",
+			prepare: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("^INSERT INTO gauge *").
+					WithArgs("cpu", float64(2.5)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO gauge_history *").
+					WithArgs("cpu", sqlmock.AnyArg(), float64(2.5)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("^INSERT INTO counter *").
+					WithArgs("PollCount", int64(5)).
+					WillReturnError(errors.New("counter error"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mock sqlmock.Sqlmock
+			dml.DBRepository.Database, mock, _ = sqlmock.New()
+			defer dml.DBRepository.Database.Close()
+			tt.prepare(mock)
+
+			s := &Storage{}
+			got, err := s.UpdateBatch(metrics)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, got, len(metrics))
+				assert.Equal(t, tt.wantDeltas[0], *got[1].Delta)
+				assert.Equal(t, tt.wantDeltas[1], *got[3].Delta)
+				assert.Equal(t, 2.5, *got[2].Value)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestStorage_UpdateBatch_SortedRows(t *testing.T) {
+	gauge1, gauge2 := 1.5, 2.5
+	delta1, delta2 := int64(2), int64(3)
+	metrics := []models.Metrics{
+		{ID: "mem", MType: "gauge", Value: &gauge1},
+		{ID: "PollCount", MType: "counter", Delta: &delta1},
+		{ID: "cpu", MType: "gauge", Value: &gauge2},
+		{ID: "Errors", MType: "counter", Delta: &delta2},
+	}
+
+	var mock sqlmock.Sqlmock
+	dml.DBRepository.Database, mock, _ = sqlmock.New()
+	defer dml.DBRepository.Database.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO gauge *").
+		WithArgs("cpu", float64(2.5), "mem", float64(1.5)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("^INSERT INTO gauge_history *").
+		WithArgs("cpu", sqlmock.AnyArg(), float64(2.5), "mem", sqlmock.AnyArg(), float64(1.5)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectQuery("^INSERT INTO counter *").
+		WithArgs("Errors", int64(3), "PollCount", int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).AddRow("Errors", int64(3)).AddRow("PollCount", int64(2)))
+	mock.ExpectExec("^INSERT INTO counter_history *").
+		WithArgs("Errors", sqlmock.AnyArg(), int64(3), "PollCount", sqlmock.AnyArg(), int64(2)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectCommit()
+
+	s := &Storage{}
+	got, err := s.UpdateBatch(metrics)
+	require.NoError(t, err)
+	assert.Equal(t, "mem", got[0].ID, "result keeps the original order")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+)
+
+// MigrateCommand имя подкоманды сервера для работы с миграциями
+const MigrateCommand = "migrate"
+
+// ErrMigrateUsage неверные аргументы подкоманды migrate
+var ErrMigrateUsage = errors.New("usage: migrate up [version] | down [version] | status")
+
+// RunMigrateCommand выполнение подкоманды migrate:
+// up [version] - применить миграции до версии (по умолчанию до последней),
+// down [version] - откатить миграции до версии (по умолчанию на одну назад),
+// status - вывести состояние миграций
+func RunMigrateCommand(dbr *dml.Repository, args []string, out io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return ErrMigrateUsage
+	}
+
+	version := -1
+	if len(args) == 2 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return ErrMigrateUsage
+		}
+		version = v
+	}
+
+	if err := CheckPing(dbr); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		if version < 0 {
+			version = 0
+		}
+		if err := Migrate(dbr, version); err != nil {
+			return err
+		}
+	case "down":
+		if version < 0 {
+			current, err := CurrentVersion(dbr)
+			if err != nil {
+				return err
+			}
+			version = previousVersion(dbr, current)
+		}
+		if err := Rollback(dbr, version); err != nil {
+			return err
+		}
+	case "status":
+		if len(args) != 1 {
+			return ErrMigrateUsage
+		}
+	default:
+		return ErrMigrateUsage
+	}
+
+	return printStatus(dbr, out)
+}
+
+// previousVersion версия известной миграции перед current, 0 если такой нет
+func previousVersion(dbr *dml.Repository, current int) int {
+	migrations, err := LoadMigrations(dialectOf(dbr))
+	if err != nil {
+		return current
+	}
+	previous := 0
+	for _, m := range migrations {
+		if m.Version >= current {
+			break
+		}
+		previous = m.Version
+	}
+	return previous
+}
+
+// printStatus вывод состояния миграций в виде таблицы
+func printStatus(dbr *dml.Repository, out io.Writer) error {
+	statuses, err := Status(dbr)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		state := "pending"
+		if s.AppliedAt != nil {
+			state = "applied " + s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		if !s.Known {
+			state += " (unknown to this server)"
+		}
+		if _, err = fmt.Fprintf(out, "%04d %-30s %s\n", s.Version, s.Name, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,8 +11,10 @@ import (
 // Storage хранилище данных
 type Storage struct{}
 
-// Init инициализация таблиц и общих настроек БД
-func Init(dbr dml.DataBaser) error {
+// Init проверка доступности БД и схемы, миграции применяются сами только к пустой БД,
+// сервер не запускается на схеме новее или старее своих миграций,
+// чтобы не отменять молча откат, сделанный подкомандой migrate down
+func Init(dbr *dml.Repository) error {
 	var err error
 
 	if err = CheckPing(dbr); err != nil {
@@ -20,8 +22,14 @@ func Init(dbr dml.DataBaser) error {
 		return err
 	}
 
-	err = CreateTables(dbr)
-	return err
+	current, err := CurrentVersion(dbr)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return Migrate(dbr, 0)
+	}
+	return CheckSchemaUpToDate(dbr)
 }
 
 // CheckPing проверка доступности БД
@@ -32,32 +40,10 @@ func CheckPing(dbr dml.DataBaser) error {
 	return dbr.PingContext(ctx)
 }
 
-// CreateTables создание таблиц БД(инициализация)
-func CreateTables(dbr dml.DataBaser) error {
-	var err error
-
-	createTablesSQL := `
-	
-	CREATE TABLE IF NOT EXISTS public.gauge
-	(
-	    id    serial constraint gauge_pk primary key,
-	    name  varchar          not null constraint gauge_pk_2 unique,
-	    value double precision not null
-	);
-	comment on table public.gauge is 'Gauge метрики';
-	comment on column public.gauge.name is 'Название метрики';
-	comment on column public.gauge.value is 'Значение метрики';
-	        
-	CREATE TABLE IF NOT EXISTS public.counter
-	(
-	    id    serial constraint counter_pk primary key,
-	    name  varchar not null constraint counter_pk_2 unique,
-	    value bigint not null
-	);
-	comment on table public.counter is 'Counter метрики';
-	comment on column public.counter.name is 'Название метрики';
-	comment on column public.counter.value is 'Значение метрики';`
-
-	_, err = dbr.ExecContext(context.Background(), createTablesSQL)
-	return err
+// dialectOf получение драйвера репозитория, по умолчанию PostgreSQL
+func dialectOf(dbr dml.DataBaser) string {
+	if r, ok := dbr.(*dml.Repository); ok && r.Driver != "" {
+		return r.Driver
+	}
+	return dml.DriverPostgres
 }
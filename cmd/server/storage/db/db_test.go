@@ -1,11 +1,16 @@
 package db
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
 
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
 	db "github.com/ramil063/gometrics/cmd/server/storage/db/dml/mocks"
 )
 
@@ -22,33 +27,24 @@ func TestCheckPing(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestCreateTables(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	dataBaser := db.NewMockDataBaser(ctrl)
+func TestInit(t *testing.T) {
+	handlers.DatabaseDSN = dml.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+	defer func() { handlers.DatabaseDSN = "" }()
 
-	dataBaser.EXPECT().
-		ExecContext(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(nil, nil)
+	rep, err := dml.NewRepository()
+	require.NoError(t, err)
+	defer rep.Close()
 
-	err := CreateTables(dataBaser)
-	assert.NoError(t, err)
+	assert.NoError(t, Init(rep))
+	// повторная инициализация не должна падать на существующих таблицах
+	assert.NoError(t, Init(rep))
 }
 
-func TestInit(t *testing.T) {
+func Test_dialectOf(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	dataBaser := db.NewMockDataBaser(ctrl)
-
-	dataBaser.EXPECT().
-		PingContext(gomock.Any()).
-		Return(nil)
-	dataBaser.EXPECT().
-		ExecContext(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(nil, nil)
-
-	err := Init(dataBaser)
-	assert.NoError(t, err)
+	assert.Equal(t, dml.DriverPostgres, dialectOf(db.NewMockDataBaser(ctrl)))
+	assert.Equal(t, dml.DriverPostgres, dialectOf(&dml.Repository{}))
+	assert.Equal(t, dml.DriverSQLite, dialectOf(&dml.Repository{Driver: dml.DriverSQLite}))
 }
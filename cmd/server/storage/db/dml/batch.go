@@ -0,0 +1,153 @@
+package dml
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// BatchChunkSize максимальное количество строк в одной команде,
+// ограничивает число параметров запроса для PostgreSQL и SQLite
+var BatchChunkSize = 1000
+
+// Execer выполнение команд внутри транзакции
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// GaugeValue значение метрики типа Gauge для пакетной записи
+type GaugeValue struct {
+	Name  string
+	Value models.Gauge
+}
+
+// CounterValue значение метрики типа Counter для пакетной записи
+type CounterValue struct {
+	Name  string
+	Value models.Counter
+}
+
+// UpsertGauges создать или обновить метрики типа Gauge многострочными командами,
+// имена в пачке должны быть уникальны
+func UpsertGauges(ctx context.Context, tx Execer, gauges []GaugeValue) error {
+	for start := 0; start < len(gauges); start += BatchChunkSize {
+		chunk := gauges[start:min(start+BatchChunkSize, len(gauges))]
+		args := make([]any, 0, len(chunk)*2)
+		for _, g := range chunk {
+			args = append(args, g.Name, float64(g.Value))
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO gauge (name, value) VALUES "+placeholders(len(chunk), 2)+" "+
+				"ON CONFLICT (name) "+
+				"DO UPDATE SET value = EXCLUDED.value",
+			args...)
+		if err != nil {
+			return internalErrors.NewDBError(err)
+		}
+	}
+	return nil
+}
+
+// UpsertCounters создать или увеличить счетчики метрик типа Counter многострочными командами,
+// имена в пачке должны быть уникальны, возвращает накопленные значения счетчиков
+func UpsertCounters(ctx context.Context, tx Execer, counters []CounterValue) (map[string]models.Counter, error) {
+	result := make(map[string]models.Counter, len(counters))
+	for start := 0; start < len(counters); start += BatchChunkSize {
+		chunk := counters[start:min(start+BatchChunkSize, len(counters))]
+		args := make([]any, 0, len(chunk)*2)
+		for _, c := range chunk {
+			args = append(args, c.Name, int64(c.Value))
+		}
+		rows, err := tx.QueryContext(ctx,
+			"INSERT INTO counter (name, value) VALUES "+placeholders(len(chunk), 2)+" "+
+				"ON CONFLICT (name) "+
+				"DO UPDATE SET value = counter.value + EXCLUDED.value "+
+				"RETURNING name, value",
+			args...)
+		if err != nil {
+			return nil, internalErrors.NewDBError(err)
+		}
+		for rows.Next() {
+			var name string
+			var value int64
+			if err = rows.Scan(&name, &value); err != nil {
+				rows.Close()
+				return nil, internalErrors.NewDBError(err)
+			}
+			result[name] = models.Counter(value)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, internalErrors.NewDBError(err)
+		}
+	}
+	return result, nil
+}
+
+// AddGaugesHistory сохранить значения метрик типа Gauge в историю многострочными командами
+func AddGaugesHistory(ctx context.Context, tx Execer, gauges []GaugeValue, ts time.Time) error {
+	for start := 0; start < len(gauges); start += BatchChunkSize {
+		chunk := gauges[start:min(start+BatchChunkSize, len(gauges))]
+		args := make([]any, 0, len(chunk)*3)
+		for _, g := range chunk {
+			args = append(args, g.Name, ts, float64(g.Value))
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO gauge_history (name, ts, value) VALUES "+placeholders(len(chunk), 3)+" "+
+				"ON CONFLICT (name, ts) "+
+				"DO UPDATE SET value = EXCLUDED.value",
+			args...)
+		if err != nil {
+			return internalErrors.NewDBError(err)
+		}
+	}
+	return nil
+}
+
+// AddCountersHistory сохранить накопленные значения метрик типа Counter в историю многострочными командами
+func AddCountersHistory(ctx context.Context, tx Execer, counters []CounterValue, ts time.Time) error {
+	for start := 0; start < len(counters); start += BatchChunkSize {
+		chunk := counters[start:min(start+BatchChunkSize, len(counters))]
+		args := make([]any, 0, len(chunk)*3)
+		for _, c := range chunk {
+			args = append(args, c.Name, ts, int64(c.Value))
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO counter_history (name, ts, value) VALUES "+placeholders(len(chunk), 3)+" "+
+				"ON CONFLICT (name, ts) "+
+				"DO UPDATE SET value = EXCLUDED.value",
+			args...)
+		if err != nil {
+			return internalErrors.NewDBError(err)
+		}
+	}
+	return nil
+}
+
+// placeholders список строк параметров вида ($1, $2), ($3, $4)
+func placeholders(rows int, columns int) string {
+	var sb strings.Builder
+	n := 1
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for j := 0; j < columns; j++ {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "$%d", n)
+			n++
+		}
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
@@ -0,0 +1,80 @@
+package dml
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func Test_placeholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    int
+		columns int
+		want    string
+	}{
+		{name: "single row", rows: 1, columns: 2, want: "($1, $2)"},
+		{name: "several rows", rows: 2, columns: 3, want: "($1, $2, $3), ($4, $5, $6)"},
+		{name: "empty", rows: 0, columns: 2, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, placeholders(tt.rows, tt.columns))
+		})
+	}
+}
+
+func TestUpsertGauges(t *testing.T) {
+	oldChunkSize := BatchChunkSize
+	defer func() { BatchChunkSize = oldChunkSize }()
+	BatchChunkSize = 2
+
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO gauge \(name, value\) VALUES \(\$1, \$2\), \(\$3, \$4\) *`).
+		WithArgs("met1", float64(1), "met2", float64(2)).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec(`^INSERT INTO gauge \(name, value\) VALUES \(\$1, \$2\) *`).
+		WithArgs("met3", float64(3)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := database.Begin()
+	require.NoError(t, err)
+	err = UpsertGauges(context.Background(), tx, []GaugeValue{
+		{Name: "met1", Value: 1},
+		{Name: "met2", Value: 2},
+		{Name: "met3", Value: 3},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpsertCounters(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+
+	mock.ExpectQuery(`^INSERT INTO counter .* RETURNING name, value$`).
+		WithArgs("met1", int64(1), "met2", int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "value"}).
+			AddRow("met1", int64(11)).
+			AddRow("met2", int64(2)))
+
+	got, err := UpsertCounters(context.Background(), database, []CounterValue{
+		{Name: "met1", Value: 1},
+		{Name: "met2", Value: 2},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.Counter{"met1": 11, "met2": 2}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
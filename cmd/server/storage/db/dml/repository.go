@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgerrcode"
@@ -17,9 +18,19 @@ import (
 	"github.com/ramil063/gometrics/internal/models"
 )
 
+// DriverPostgres драйвер PostgreSQL
+const DriverPostgres = "pgx"
+
+// DriverSQLite драйвер встроенной БД SQLite
+const DriverSQLite = "sqlite"
+
+// SQLiteScheme префикс DSN встроенной БД SQLite, например sqlite:///var/lib/gometrics/metrics.db
+const SQLiteScheme = "sqlite://"
+
 // Repository репозиторий для работы с БД
 type Repository struct {
 	Database *sql.DB
+	Driver   string
 }
 
 // DataBaser вся логика работы с БД
@@ -52,6 +63,22 @@ func (dbr *Repository) ExecContext(ctx context.Context, query string, args ...an
 	return result, nil
 }
 
+// BeginTx начать транзакцию в БД
+func (dbr *Repository) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := dbr.Database.BeginTx(ctx, nil)
+	if err != nil {
+		var pgconnErr *pgconn.PgError
+		if errors.As(err, &pgconnErr) && pgerrcode.IsConnectionException(pgconnErr.Code) {
+			tx, err = retryBeginTx(dbr, ctx, internalErrors.TriesTimes)
+			if err == nil {
+				return tx, nil
+			}
+		}
+		return nil, internalErrors.NewDBError(err)
+	}
+	return tx, nil
+}
+
 // QueryRowContext выполнить команду в БД с возвратом данных(1 строчка)
 func (dbr *Repository) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
 	row := dbr.Database.QueryRowContext(ctx, query, args...)
@@ -118,6 +145,12 @@ func (dbr *Repository) SetDatabase() error {
 
 // Open открыть соединения с БД
 func (dbr *Repository) Open() (*sql.DB, error) {
+	driver, dataSource := ParseDSN(handlers.DatabaseDSN)
+	dbr.Driver = driver
+	if driver == DriverSQLite {
+		return openSQLite(dataSource)
+	}
+
 	result, err := sql.Open("pgx", handlers.DatabaseDSN)
 	if err != nil {
 		var pgconnErr *pgconn.PgError
@@ -131,6 +164,32 @@ func (dbr *Repository) Open() (*sql.DB, error) {
 	return result, nil
 }
 
+// ParseDSN получение драйвера и строки подключения по DSN
+func ParseDSN(dsn string) (string, string) {
+	if path, ok := strings.CutPrefix(dsn, SQLiteScheme); ok {
+		return DriverSQLite, path
+	}
+	return DriverPostgres, dsn
+}
+
+// openSQLite открыть файл встроенной БД, запись идет через одно соединение,
+// чтобы конкурентные запросы не получали SQLITE_BUSY
+func openSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, internalErrors.NewDBError(errors.New("empty sqlite path"))
+	}
+	result, err := sql.Open(DriverSQLite, path)
+	if err != nil {
+		return nil, internalErrors.NewDBError(err)
+	}
+	result.SetMaxOpenConns(1)
+	if _, err = result.Exec("PRAGMA journal_mode = WAL; PRAGMA synchronous = NORMAL; PRAGMA busy_timeout = 5000"); err != nil {
+		_ = result.Close()
+		return nil, internalErrors.NewDBError(err)
+	}
+	return result, nil
+}
+
 func NewRepository() (*Repository, error) {
 	rep := &Repository{}
 	err := rep.SetDatabase()
@@ -170,6 +229,38 @@ func CreateOrUpdateGauge(dbr *Repository, name string, value models.Gauge) (sql.
 	return exec, nil
 }
 
+// AddCounterHistory сохранить текущее значение метрики типа Counter в историю
+func AddCounterHistory(dbr *Repository, name string, ts time.Time) (sql.Result, error) {
+	exec, err := dbr.ExecContext(
+		context.Background(),
+		"INSERT INTO counter_history (name, ts, value) "+
+			"SELECT name, $2, value FROM counter WHERE name = $1 "+
+			"ON CONFLICT (name, ts) "+
+			"DO UPDATE SET value = EXCLUDED.value",
+		name,
+		ts)
+	if err != nil {
+		return nil, internalErrors.NewDBError(err)
+	}
+	return exec, nil
+}
+
+// AddGaugeHistory сохранить значение метрики типа Gauge в историю
+func AddGaugeHistory(dbr *Repository, name string, value models.Gauge, ts time.Time) (sql.Result, error) {
+	exec, err := dbr.ExecContext(
+		context.Background(),
+		"INSERT INTO gauge_history (name, ts, value) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (name, ts) "+
+			"DO UPDATE SET value = EXCLUDED.value",
+		name,
+		ts,
+		float64(value))
+	if err != nil {
+		return nil, internalErrors.NewDBError(err)
+	}
+	return exec, nil
+}
+
 func retryQueryRowContext(dbr *Repository, tries []int, ctx context.Context, query string, args ...any) *sql.Row {
 	var row *sql.Row
 	for try := 0; try < len(tries); try++ {
@@ -208,6 +299,19 @@ func retryExecContext(dbr *Repository, tries []int, ctx context.Context, query s
 	return result, err
 }
 
+func retryBeginTx(dbr *Repository, ctx context.Context, tries []int) (*sql.Tx, error) {
+	var tx *sql.Tx
+	var err error
+	for try := 0; try < len(tries); try++ {
+		time.Sleep(time.Duration(tries[try]) * time.Second)
+		tx, err = dbr.Database.BeginTx(ctx, nil)
+		if err == nil {
+			break
+		}
+	}
+	return tx, err
+}
+
 func retryOpen(driverName, dataSourceName string, tries []int) (*sql.DB, error) {
 	var result *sql.DB
 	var err error
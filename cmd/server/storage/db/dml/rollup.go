@@ -0,0 +1,31 @@
+package dml
+
+import (
+	"context"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// UpsertRollups создать или заменить агрегаты истории метрики многострочными командами,
+// шаг прореживания передается в секундах, интервалы в пачке должны быть уникальны
+func UpsertRollups(ctx context.Context, tx Execer, mType string, name string, resolution int64, rollups []models.Rollup) error {
+	for start := 0; start < len(rollups); start += BatchChunkSize {
+		chunk := rollups[start:min(start+BatchChunkSize, len(rollups))]
+		args := make([]any, 0, len(chunk)*11)
+		for _, r := range chunk {
+			args = append(args, mType, name, resolution, r.Timestamp.UTC(), r.Count, r.Min, r.Max, r.Avg, r.Last, r.Sum, r.Rate)
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO history_rollup (type, name, resolution, ts, count, min, max, avg, last, sum, rate) VALUES "+
+				placeholders(len(chunk), 11)+" "+
+				"ON CONFLICT (type, name, resolution, ts) "+
+				"DO UPDATE SET count = EXCLUDED.count, min = EXCLUDED.min, max = EXCLUDED.max, avg = EXCLUDED.avg, "+
+				"last = EXCLUDED.last, sum = EXCLUDED.sum, rate = EXCLUDED.rate",
+			args...)
+		if err != nil {
+			return internalErrors.NewDBError(err)
+		}
+	}
+	return nil
+}
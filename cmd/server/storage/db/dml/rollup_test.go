@@ -0,0 +1,43 @@
+package dml
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestUpsertRollups(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+
+	ts := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO history_rollup \(type, name, resolution, ts, count, min, max, avg, last, sum, rate\) VALUES \(\$1, .*\$11\), \(\$12, .*\$22\) ON CONFLICT \(type, name, resolution, ts\) DO UPDATE *`).
+		WithArgs("gauge", "cpu", int64(60), ts, int64(2), 1.0, 3.0, 2.0, 3.0, 4.0, 0.0,
+			"gauge", "cpu", int64(60), ts.Add(time.Minute), int64(1), 5.0, 5.0, 5.0, 5.0, 5.0, 0.0).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec(`^INSERT INTO history_rollup *`).
+		WillReturnError(errors.New("db down"))
+	mock.ExpectRollback()
+
+	tx, err := database.Begin()
+	require.NoError(t, err)
+	err = UpsertRollups(context.Background(), tx, "gauge", "cpu", 60, []models.Rollup{
+		{Timestamp: ts, Count: 2, Min: 1, Max: 3, Avg: 2, Last: 3, Sum: 4},
+		{Timestamp: ts.Add(time.Minute), Count: 1, Min: 5, Max: 5, Avg: 5, Last: 5, Sum: 5},
+	})
+	assert.NoError(t, err)
+
+	err = UpsertRollups(context.Background(), tx, "gauge", "cpu", 60, []models.Rollup{{Timestamp: ts}})
+	assert.Error(t, err)
+	assert.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// GetHistory получение истории значений метрики за период
+func (s *Storage) GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	var query string
+	switch mType {
+	case "gauge":
+		query = "SELECT ts, value FROM gauge_history WHERE name = $1 AND ts BETWEEN $2 AND $3 ORDER BY ts"
+	case "counter":
+		query = "SELECT ts, value FROM counter_history WHERE name = $1 AND ts BETWEEN $2 AND $3 ORDER BY ts"
+	default:
+		return nil, errors.New("unknown metric type")
+	}
+
+	result := make([]models.Sample, 0)
+	// время хранится в UTC, SQLite сравнивает его как строку
+	rows, err := dml.DBRepository.QueryContext(context.Background(), query, name, from.UTC(), to.UTC())
+	if err != nil {
+		logger.WriteErrorLog("QueryContext error when GetHistory worked", err.Error())
+		return nil, err
+	}
+	// обязательно закрываем перед возвратом функции
+	defer rows.Close()
+
+	for rows.Next() {
+		var sample models.Sample
+		if err = rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			logger.WriteErrorLog("GetHistory error in sql", err.Error())
+			return nil, err
+		}
+		result = append(result, sample)
+	}
+
+	// проверяем на ошибки
+	if err = rows.Err(); err != nil {
+		logger.WriteErrorLog("GetHistory error in rows", err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetHistories получение истории значений нескольких метрик за период,
+// для каждого типа метрик выполняется один запрос на dml.BatchChunkSize имен
+func (s *Storage) GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	result := make(map[models.HistoryKey][]models.Sample, len(keys))
+	names := make(map[string][]string)
+	for _, key := range keys {
+		if _, err := historyTable(key.MType); err != nil {
+			return nil, err
+		}
+		result[key] = make([]models.Sample, 0)
+		names[key.MType] = append(names[key.MType], key.Name)
+	}
+
+	for mType, typeNames := range names {
+		table, _ := historyTable(mType)
+		for start := 0; start < len(typeNames); start += dml.BatchChunkSize {
+			chunk := typeNames[start:min(start+dml.BatchChunkSize, len(typeNames))]
+			if err := readHistories(result, mType, table, chunk, from, to); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// readHistories чтение истории метрик одного типа по списку имен в result
+func readHistories(result map[models.HistoryKey][]models.Sample, mType string, table string, names []string, from, to time.Time) error {
+	args := make([]any, 0, len(names)+2)
+	// время хранится в UTC, SQLite сравнивает его как строку
+	args = append(args, from.UTC(), to.UTC())
+	var in strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			in.WriteString(", ")
+		}
+		fmt.Fprintf(&in, "$%d", i+3)
+		args = append(args, name)
+	}
+
+	rows, err := dml.DBRepository.QueryContext(context.Background(),
+		"SELECT name, ts, value FROM "+table+" WHERE ts BETWEEN $1 AND $2 AND name IN ("+in.String()+") ORDER BY name, ts",
+		args...)
+	if err != nil {
+		logger.WriteErrorLog("QueryContext error when GetHistories worked", err.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var sample models.Sample
+		if err = rows.Scan(&name, &sample.Timestamp, &sample.Value); err != nil {
+			logger.WriteErrorLog("GetHistories error in sql", err.Error())
+			return err
+		}
+		key := models.HistoryKey{MType: mType, Name: name}
+		result[key] = append(result[key], sample)
+	}
+	if err = rows.Err(); err != nil {
+		logger.WriteErrorLog("GetHistories error in rows", err.Error())
+		return err
+	}
+	return nil
+}
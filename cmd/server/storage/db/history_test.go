@@ -0,0 +1,66 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestStorage_GetHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	dml.DBRepository.Database = db
+
+	ts := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	from := ts.Add(-time.Hour)
+	to := ts.Add(time.Hour)
+
+	rows := sqlmock.NewRows([]string{"ts", "value"}).
+		AddRow(ts, 1.5).
+		AddRow(ts.Add(time.Minute), 2.5)
+	mock.ExpectQuery("^SELECT ts, value FROM gauge_history WHERE name = *").
+		WithArgs("metric1", from, to).
+		WillReturnRows(rows)
+
+	tests := []struct {
+		name    string
+		mType   string
+		want    []models.Sample
+		wantErr bool
+	}{
+		{
+			name:  "gauge history",
+			mType: "gauge",
+			want: []models.Sample{
+				{Timestamp: ts, Value: 1.5},
+				{Timestamp: ts.Add(time.Minute), Value: 2.5},
+			},
+		},
+		{
+			name:    "unknown type",
+			mType:   "unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Storage{}
+			got, err := s.GetHistory(tt.mType, "metric1", from, to)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
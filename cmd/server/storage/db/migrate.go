@@ -0,0 +1,330 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// ErrSchemaTooNew схема БД новее, чем известные серверу миграции
+var ErrSchemaTooNew = errors.New("database schema is newer than the server")
+
+// ErrSchemaTooOld схема БД старее последней миграции сервера
+var ErrSchemaTooOld = errors.New("database schema is older than the server")
+
+// migrationLockID ключ advisory блокировки PostgreSQL, чтобы несколько серверов не применяли миграции одновременно
+const migrationLockID = 7316298410
+
+// migrationFileRe имя файла миграции вида 0001_init.up.sql
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration версия схемы БД
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus состояние миграции в БД
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil, если миграция еще не применена
+	Known     bool       // false, если миграция применена более новой версией сервера
+}
+
+// LoadMigrations загрузка встроенных миграций для драйвера БД по возрастанию версий
+func LoadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	if driver == dml.DriverPostgres {
+		dir = path.Join("migrations", "postgres")
+	}
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations for %s: %w", driver, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(migrationsFS, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have up and down files", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// LatestVersion последняя версия схемы, известная серверу
+func LatestVersion(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// CurrentVersion текущая версия схемы БД, 0 для пустой БД
+func CurrentVersion(dbr *dml.Repository) (int, error) {
+	if err := createMigrationsTable(dbr); err != nil {
+		return 0, err
+	}
+	var version int
+	err := dbr.QueryRowContext(context.Background(), "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// CheckSchemaVersion проверка, что схема БД не новее сервера
+func CheckSchemaVersion(dbr *dml.Repository) error {
+	current, latest, err := schemaVersions(dbr)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: schema version %d, server supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// CheckSchemaUpToDate проверка, что схема БД совпадает с последней миграцией сервера
+func CheckSchemaUpToDate(dbr *dml.Repository) error {
+	if err := CheckSchemaVersion(dbr); err != nil {
+		return err
+	}
+	current, latest, err := schemaVersions(dbr)
+	if err != nil {
+		return err
+	}
+	if current < latest {
+		return fmt.Errorf("%w: schema version %d, server requires %d, run \"%s up\"", ErrSchemaTooOld, current, latest, MigrateCommand)
+	}
+	return nil
+}
+
+// schemaVersions текущая версия схемы БД и последняя версия, известная серверу
+func schemaVersions(dbr *dml.Repository) (int, int, error) {
+	migrations, err := LoadMigrations(dialectOf(dbr))
+	if err != nil {
+		return 0, 0, err
+	}
+	current, err := CurrentVersion(dbr)
+	if err != nil {
+		return 0, 0, err
+	}
+	return current, LatestVersion(migrations), nil
+}
+
+// Migrate применение миграций до версии target, 0 - до последней известной версии
+func Migrate(dbr *dml.Repository, target int) error {
+	migrations, err := LoadMigrations(dialectOf(dbr))
+	if err != nil {
+		return err
+	}
+	if err = CheckSchemaVersion(dbr); err != nil {
+		return err
+	}
+	if target <= 0 {
+		target = LatestVersion(migrations)
+	}
+
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+		if err = applyMigration(dbr, m, true); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Rollback откат примененных миграций до версии target, в БД остаются миграции с версией не больше target
+func Rollback(dbr *dml.Repository, target int) error {
+	migrations, err := LoadMigrations(dialectOf(dbr))
+	if err != nil {
+		return err
+	}
+	if err = CheckSchemaVersion(dbr); err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if err = applyMigration(dbr, m, false); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Status состояние всех известных и примененных миграций по возрастанию версий
+func Status(dbr *dml.Repository) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(dialectOf(dbr))
+	if err != nil {
+		return nil, err
+	}
+	if err = createMigrationsTable(dbr); err != nil {
+		return nil, err
+	}
+
+	rows, err := dbr.QueryContext(context.Background(), "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var s MigrationStatus
+		var appliedAt time.Time
+		if err = rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		applied[s.Version] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(migrations)+len(applied))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name, Known: true}
+		if a, ok := applied[m.Version]; ok {
+			s.AppliedAt = a.AppliedAt
+			delete(applied, m.Version)
+		}
+		result = append(result, s)
+	}
+	for _, a := range applied {
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// applyMigration применение или откат одной миграции в отдельной транзакции,
+// уже примененная (или уже откаченная) миграция пропускается
+func applyMigration(dbr *dml.Repository, m Migration, up bool) (err error) {
+	ctx := context.Background()
+	tx, err := dbr.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.WriteErrorLog("migration rollback error", rbErr.Error())
+			}
+		}
+	}()
+
+	if dialectOf(dbr) == dml.DriverPostgres {
+		if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return err
+		}
+	}
+
+	applied, err := isMigrationApplied(ctx, tx, m.Version)
+	if err != nil {
+		return err
+	}
+	if applied == up {
+		return tx.Commit()
+	}
+
+	if up {
+		if _, err = tx.ExecContext(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			m.Version, m.Name, time.Now().UTC())
+	} else {
+		if _, err = tx.ExecContext(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logger.WriteInfoLog("migration applied", fmt.Sprintf("%d_%s up=%t", m.Version, m.Name, up))
+	return nil
+}
+
+func isMigrationApplied(ctx context.Context, tx *sql.Tx, version int) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&count)
+	return count > 0, err
+}
+
+// createMigrationsTable создание таблицы версий схемы БД
+func createMigrationsTable(dbr *dml.Repository) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations
+	(
+	    version    bigint      not null primary key,
+	    name       varchar     not null,
+	    applied_at timestamptz not null
+	)`
+	if dialectOf(dbr) == dml.DriverSQLite {
+		query = `
+	CREATE TABLE IF NOT EXISTS schema_migrations
+	(
+	    version    INTEGER   NOT NULL PRIMARY KEY,
+	    name       TEXT      NOT NULL,
+	    applied_at TIMESTAMP NOT NULL
+	)`
+	}
+	_, err := dbr.ExecContext(context.Background(), query)
+	return err
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+)
+
+func newSQLiteRepository(t *testing.T) *dml.Repository {
+	t.Helper()
+	handlers.DatabaseDSN = dml.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+	defer func() { handlers.DatabaseDSN = "" }()
+
+	rep, err := dml.NewRepository()
+	require.NoError(t, err)
+	t.Cleanup(func() { rep.Close() })
+	return rep
+}
+
+func tableExists(t *testing.T, rep *dml.Repository, name string) bool {
+	t.Helper()
+	var count int
+	err := rep.QueryRowContext(context.Background(),
+		"SELECT COUNT(*) FROM sqlite_master WHERE type IN ('table', 'index') AND name = $1", name).Scan(&count)
+	require.NoError(t, err)
+	return count > 0
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		wantErr bool
+	}{
+		{name: "postgres", driver: dml.DriverPostgres},
+		{name: "sqlite", driver: dml.DriverSQLite},
+		{name: "unknown driver", driver: "mysql", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadMigrations(tt.driver)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, got)
+			for i, m := range got {
+				assert.Equal(t, i+1, m.Version, "versions must be sequential")
+				assert.NotEmpty(t, m.Up)
+				assert.NotEmpty(t, m.Down)
+			}
+		})
+	}
+
+	postgres, _ := LoadMigrations(dml.DriverPostgres)
+	sqlite, _ := LoadMigrations(dml.DriverSQLite)
+	assert.Equal(t, LatestVersion(postgres), LatestVersion(sqlite), "dialects must have the same versions")
+}
+
+func TestMigrate_SQLite(t *testing.T) {
+	rep := newSQLiteRepository(t)
+	migrations, err := LoadMigrations(dml.DriverSQLite)
+	require.NoError(t, err)
+	latest := LatestVersion(migrations)
+
+	require.NoError(t, Migrate(rep, 1))
+	current, err := CurrentVersion(rep)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+	assert.True(t, tableExists(t, rep, "gauge"))
+	assert.False(t, tableExists(t, rep, "gauge_history_ts_idx"))
+
+	require.NoError(t, Migrate(rep, 0))
+	current, err = CurrentVersion(rep)
+	require.NoError(t, err)
+	assert.Equal(t, latest, current)
+	assert.True(t, tableExists(t, rep, "gauge_history_ts_idx"))
+	assert.True(t, tableExists(t, rep, "history_rollup"))
+
+	statuses, err := Status(rep)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrations))
+	for _, s := range statuses {
+		assert.True(t, s.Known)
+		assert.NotNil(t, s.AppliedAt)
+	}
+
+	require.NoError(t, Rollback(rep, 1))
+	current, err = CurrentVersion(rep)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+	assert.False(t, tableExists(t, rep, "gauge_history_ts_idx"))
+
+	require.NoError(t, Rollback(rep, 0))
+	current, err = CurrentVersion(rep)
+	require.NoError(t, err)
+	assert.Equal(t, 0, current)
+	assert.False(t, tableExists(t, rep, "gauge"))
+}
+
+func TestMigrate_SchemaTooNew(t *testing.T) {
+	rep := newSQLiteRepository(t)
+	require.NoError(t, Migrate(rep, 0))
+
+	_, err := rep.ExecContext(context.Background(),
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, CURRENT_TIMESTAMP)", 9999, "future")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, CheckSchemaVersion(rep), ErrSchemaTooNew)
+	assert.ErrorIs(t, Init(rep), ErrSchemaTooNew)
+	assert.ErrorIs(t, Rollback(rep, 0), ErrSchemaTooNew)
+
+	statuses, err := Status(rep)
+	require.NoError(t, err)
+	last := statuses[len(statuses)-1]
+	assert.Equal(t, 9999, last.Version)
+	assert.False(t, last.Known)
+}
+
+func TestInit_SchemaTooOld(t *testing.T) {
+	rep := newSQLiteRepository(t)
+	require.NoError(t, Init(rep))
+
+	// откат не отменяется следующим запуском сервера
+	require.NoError(t, Rollback(rep, 1))
+	assert.ErrorIs(t, CheckSchemaUpToDate(rep), ErrSchemaTooOld)
+	assert.ErrorIs(t, Init(rep), ErrSchemaTooOld)
+	current, err := CurrentVersion(rep)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current)
+
+	require.NoError(t, Migrate(rep, 0))
+	assert.NoError(t, Init(rep))
+}
+
+func TestMigrate_PostgresLock(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer database.Close()
+	rep := &dml.Repository{Database: database}
+
+	m := Migration{Version: 1, Name: "init", Up: "CREATE TABLE gauge (name varchar)", Down: "DROP TABLE gauge"}
+	mock.ExpectBegin()
+	mock.ExpectExec("^SELECT pg_advisory_xact_lock").
+		WithArgs(migrationLockID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^SELECT COUNT\\(\\*\\) FROM schema_migrations").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("^CREATE TABLE gauge").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO schema_migrations").
+		WithArgs(1, "init", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, applyMigration(rep, m, true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunMigrateCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     error
+		wantVersion int
+		wantOutput  string
+	}{
+		{name: "no args", args: nil, wantErr: ErrMigrateUsage},
+		{name: "unknown action", args: []string{"sideways"}, wantErr: ErrMigrateUsage},
+		{name: "bad version", args: []string{"up", "x"}, wantErr: ErrMigrateUsage},
+		{name: "status with version", args: []string{"status", "1"}, wantErr: ErrMigrateUsage},
+		{name: "status", args: []string{"status"}, wantVersion: 0, wantOutput: "0001 init"},
+		{name: "up to version", args: []string{"up", "1"}, wantVersion: 1, wantOutput: "0001 init"},
+		{name: "up", args: []string{"up"}, wantVersion: 3, wantOutput: "applied"},
+		{name: "down one step", args: []string{"down"}, wantVersion: 2, wantOutput: "pending"},
+		{name: "down to version", args: []string{"down", "0"}, wantVersion: 0, wantOutput: "pending"},
+	}
+	rep := newSQLiteRepository(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := RunMigrateCommand(rep, tt.args, &out)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, out.String(), tt.wantOutput)
+
+			current, err := CurrentVersion(rep)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, current)
+		})
+	}
+}
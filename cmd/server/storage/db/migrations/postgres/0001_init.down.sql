@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.counter_history;
+DROP TABLE IF EXISTS public.gauge_history;
+DROP TABLE IF EXISTS public.counter;
+DROP TABLE IF EXISTS public.gauge;
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS public.gauge
+(
+    id    serial constraint gauge_pk primary key,
+    name  varchar          not null constraint gauge_pk_2 unique,
+    value double precision not null
+);
+comment on table public.gauge is 'Gauge метрики';
+comment on column public.gauge.name is 'Название метрики с метками в виде name{k="v"}';
+comment on column public.gauge.value is 'Значение метрики';
+
+CREATE TABLE IF NOT EXISTS public.counter
+(
+    id    serial constraint counter_pk primary key,
+    name  varchar not null constraint counter_pk_2 unique,
+    value bigint not null
+);
+comment on table public.counter is 'Counter метрики';
+comment on column public.counter.name is 'Название метрики с метками в виде name{k="v"}';
+comment on column public.counter.value is 'Значение метрики';
+
+CREATE TABLE IF NOT EXISTS public.gauge_history
+(
+    name  varchar          not null,
+    ts    timestamptz      not null,
+    value double precision not null,
+    constraint gauge_history_pk primary key (name, ts)
+);
+comment on table public.gauge_history is 'История значений Gauge метрик';
+comment on column public.gauge_history.name is 'Название метрики';
+comment on column public.gauge_history.ts is 'Время сохранения значения';
+comment on column public.gauge_history.value is 'Значение метрики';
+
+CREATE TABLE IF NOT EXISTS public.counter_history
+(
+    name  varchar     not null,
+    ts    timestamptz not null,
+    value bigint      not null,
+    constraint counter_history_pk primary key (name, ts)
+);
+comment on table public.counter_history is 'История значений Counter метрик';
+comment on column public.counter_history.name is 'Название метрики';
+comment on column public.counter_history.ts is 'Время сохранения значения';
+comment on column public.counter_history.value is 'Накопленное значение метрики';
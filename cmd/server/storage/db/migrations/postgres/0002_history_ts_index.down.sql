@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS public.counter_history_ts_idx;
+DROP INDEX IF EXISTS public.gauge_history_ts_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS gauge_history_ts_idx ON public.gauge_history (ts);
+CREATE INDEX IF NOT EXISTS counter_history_ts_idx ON public.counter_history (ts);
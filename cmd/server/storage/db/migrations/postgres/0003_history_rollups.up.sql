@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS public.history_rollup
+(
+    type       varchar          not null,
+    name       varchar          not null,
+    resolution bigint           not null,
+    ts         timestamptz      not null,
+    count      bigint           not null,
+    min        double precision not null,
+    max        double precision not null,
+    avg        double precision not null,
+    last       double precision not null,
+    sum        double precision not null,
+    rate       double precision not null,
+    constraint history_rollup_pk primary key (type, name, resolution, ts)
+);
+comment on table public.history_rollup is 'Агрегаты прореженной истории метрик';
+comment on column public.history_rollup.resolution is 'Шаг прореживания в секундах';
+comment on column public.history_rollup.ts is 'Начало интервала';
+comment on column public.history_rollup.sum is 'Сумма значений gauge или прирост counter за интервал';
+comment on column public.history_rollup.rate is 'Прирост counter в секунду';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS counter_history;
+DROP TABLE IF EXISTS gauge_history;
+DROP TABLE IF EXISTS counter;
+DROP TABLE IF EXISTS gauge;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS gauge
+(
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name  TEXT    NOT NULL UNIQUE,
+    value REAL    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS counter
+(
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name  TEXT    NOT NULL UNIQUE,
+    value INTEGER NOT NULL
+);
+
+-- тип TIMESTAMP нужен драйверу, чтобы читать время истории в time.Time
+CREATE TABLE IF NOT EXISTS gauge_history
+(
+    name  TEXT      NOT NULL,
+    ts    TIMESTAMP NOT NULL,
+    value REAL      NOT NULL,
+    PRIMARY KEY (name, ts)
+);
+
+CREATE TABLE IF NOT EXISTS counter_history
+(
+    name  TEXT      NOT NULL,
+    ts    TIMESTAMP NOT NULL,
+    value INTEGER   NOT NULL,
+    PRIMARY KEY (name, ts)
+);
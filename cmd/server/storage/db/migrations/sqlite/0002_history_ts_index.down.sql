@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS counter_history_ts_idx;
+DROP INDEX IF EXISTS gauge_history_ts_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS gauge_history_ts_idx ON gauge_history (ts);
+CREATE INDEX IF NOT EXISTS counter_history_ts_idx ON counter_history (ts);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS history_rollup
+(
+    type       TEXT      NOT NULL,
+    name       TEXT      NOT NULL,
+    resolution INTEGER   NOT NULL,
+    ts         TIMESTAMP NOT NULL,
+    count      INTEGER   NOT NULL,
+    min        REAL      NOT NULL,
+    max        REAL      NOT NULL,
+    avg        REAL      NOT NULL,
+    last       REAL      NOT NULL,
+    sum        REAL      NOT NULL,
+    rate       REAL      NOT NULL,
+    PRIMARY KEY (type, name, resolution, ts)
+);
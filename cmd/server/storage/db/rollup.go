@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// HistoryNames получение ключей метрик всех типов, у которых есть история или агрегаты
+func (s *Storage) HistoryNames() ([]models.HistoryKey, error) {
+	rows, err := dml.DBRepository.QueryContext(context.Background(),
+		"SELECT 'gauge' AS type, name FROM gauge_history "+
+			"UNION SELECT 'counter' AS type, name FROM counter_history "+
+			"UNION SELECT type, name FROM history_rollup ORDER BY type, name")
+	if err != nil {
+		logger.WriteErrorLog("QueryContext error when HistoryNames worked", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]models.HistoryKey, 0)
+	for rows.Next() {
+		var key models.HistoryKey
+		if err = rows.Scan(&key.MType, &key.Name); err != nil {
+			logger.WriteErrorLog("HistoryNames error in sql", err.Error())
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	if err = rows.Err(); err != nil {
+		logger.WriteErrorLog("HistoryNames error in rows", err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+// SaveRollups сохранение агрегатов метрики в одной транзакции, агрегат за тот же интервал заменяется
+func (s *Storage) SaveRollups(mType string, name string, resolution time.Duration, rollups []models.Rollup) error {
+	ctx := context.Background()
+	tx, err := dml.DBRepository.BeginTx(ctx)
+	if err != nil {
+		logger.WriteErrorLog("SaveRollups begin transaction error", err.Error())
+		return err
+	}
+
+	if err = dml.UpsertRollups(ctx, tx, mType, name, int64(resolution.Seconds()), rollups); err != nil {
+		logger.WriteErrorLog("SaveRollups error in sql", err.Error())
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.WriteErrorLog("SaveRollups rollback error", rbErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRollups получение агрегатов метрики с шагом resolution, начавшихся в период [from, to]
+func (s *Storage) GetRollups(mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	if _, err := historyTable(mType); err != nil {
+		return nil, err
+	}
+
+	// время хранится в UTC, SQLite сравнивает его как строку
+	rows, err := dml.DBRepository.QueryContext(context.Background(),
+		"SELECT ts, count, min, max, avg, last, sum, rate FROM history_rollup "+
+			"WHERE type = $1 AND name = $2 AND resolution = $3 AND ts BETWEEN $4 AND $5 ORDER BY ts",
+		mType, name, int64(resolution.Seconds()), from.UTC(), to.UTC())
+	if err != nil {
+		logger.WriteErrorLog("QueryContext error when GetRollups worked", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]models.Rollup, 0)
+	for rows.Next() {
+		var r models.Rollup
+		if err = rows.Scan(&r.Timestamp, &r.Count, &r.Min, &r.Max, &r.Avg, &r.Last, &r.Sum, &r.Rate); err != nil {
+			logger.WriteErrorLog("GetRollups error in sql", err.Error())
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	if err = rows.Err(); err != nil {
+		logger.WriteErrorLog("GetRollups error in rows", err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+// PruneHistory удаление значений истории и агрегатов старше границ в одной транзакции
+func (s *Storage) PruneHistory(cutoffs []models.HistoryCutoff) (err error) {
+	ctx := context.Background()
+	tx, err := dml.DBRepository.BeginTx(ctx)
+	if err != nil {
+		logger.WriteErrorLog("PruneHistory begin transaction error", err.Error())
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.WriteErrorLog("PruneHistory rollback error", rbErr.Error())
+			}
+		}
+	}()
+
+	for _, cutoff := range cutoffs {
+		if cutoff.Resolution == 0 {
+			var table string
+			if table, err = historyTable(cutoff.MType); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE name = $1 AND ts < $2",
+				cutoff.Name, cutoff.Before.UTC())
+		} else {
+			_, err = tx.ExecContext(ctx,
+				"DELETE FROM history_rollup WHERE type = $1 AND name = $2 AND resolution = $3 AND ts < $4",
+				cutoff.MType, cutoff.Name, int64(cutoff.Resolution.Seconds()), cutoff.Before.UTC())
+		}
+		if err != nil {
+			logger.WriteErrorLog("PruneHistory error in sql", err.Error())
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// historyTable таблица истории значений по типу метрики
+func historyTable(mType string) (string, error) {
+	switch mType {
+	case "gauge":
+		return "gauge_history", nil
+	case "counter":
+		return "counter_history", nil
+	}
+	return "", errors.New("unknown metric type")
+}
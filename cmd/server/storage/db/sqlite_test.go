@@ -0,0 +1,172 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/ramil063/gometrics/cmd/server/handlers"
+	"github.com/ramil063/gometrics/cmd/server/storage/db/dml"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestStorage_SQLite(t *testing.T) {
+	handlers.DatabaseDSN = dml.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+	defer func() { handlers.DatabaseDSN = "" }()
+
+	rep, err := dml.NewRepository()
+	require.NoError(t, err)
+	dml.DBRepository = *rep
+	defer func() {
+		dml.DBRepository.Close()
+		dml.DBRepository = dml.Repository{}
+	}()
+	require.NoError(t, Init(&dml.DBRepository))
+	// повторная инициализация не должна падать на существующих таблицах
+	require.NoError(t, Init(&dml.DBRepository))
+
+	from := time.Now().Add(-time.Minute)
+	s := &Storage{}
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+	require.NoError(t, s.SetGauge("cpu", 2.5))
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.AddCounter("PollCount", 3))
+	to := time.Now().Add(time.Minute)
+
+	gauge, err := s.GetGauge("cpu")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+
+	counter, err := s.GetCounter("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	gauges, err := s.GetGauges()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.Gauge{"cpu": 2.5}, gauges)
+
+	counters, err := s.GetCounters()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 5}, counters)
+
+	history, err := s.GetHistory("counter", "PollCount", from, to)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, float64(2), history[0].Value)
+	assert.Equal(t, float64(5), history[1].Value)
+
+	history, err = s.GetHistory("gauge", "cpu", to, to.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestStorage_SQLiteUpdateBatch(t *testing.T) {
+	handlers.DatabaseDSN = dml.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+	defer func() { handlers.DatabaseDSN = "" }()
+
+	rep, err := dml.NewRepository()
+	require.NoError(t, err)
+	dml.DBRepository = *rep
+	defer func() {
+		dml.DBRepository.Close()
+		dml.DBRepository = dml.Repository{}
+	}()
+	require.NoError(t, Init(&dml.DBRepository))
+
+	gauge1, gauge2 := 1.5, 2.5
+	delta1, delta2 := int64(2), int64(3)
+	s := &Storage{}
+	require.NoError(t, s.AddCounter("PollCount", 10))
+
+	got, err := s.UpdateBatch([]models.Metrics{
+		{ID: "cpu", MType: "gauge", Value: &gauge1},
+		{ID: "PollCount", MType: "counter", Delta: &delta1},
+		{ID: "cpu", MType: "gauge", Value: &gauge2},
+		{ID: "PollCount", MType: "counter", Delta: &delta2},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+	assert.Equal(t, int64(12), *got[1].Delta)
+	assert.Equal(t, int64(15), *got[3].Delta)
+
+	gauge, err := s.GetGauge("cpu")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+
+	counter, err := s.GetCounter("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), counter)
+}
+
+func TestStorage_SQLiteRollups(t *testing.T) {
+	handlers.DatabaseDSN = dml.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+	defer func() { handlers.DatabaseDSN = "" }()
+
+	rep, err := dml.NewRepository()
+	require.NoError(t, err)
+	dml.DBRepository = *rep
+	defer func() {
+		dml.DBRepository.Close()
+		dml.DBRepository = dml.Repository{}
+	}()
+	require.NoError(t, Init(&dml.DBRepository))
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	s := &Storage{}
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+	require.NoError(t, s.AddCounter("PollCount", 2))
+
+	require.NoError(t, s.SaveRollups("gauge", "mem", time.Minute, []models.Rollup{
+		{Timestamp: start, Count: 1, Min: 1, Max: 1, Avg: 1, Last: 1, Sum: 1},
+		{Timestamp: start.Add(time.Minute), Count: 1, Min: 2, Max: 2, Avg: 2, Last: 2, Sum: 2},
+	}))
+	// повторная свертка интервала заменяет агрегат
+	require.NoError(t, s.SaveRollups("gauge", "mem", time.Minute, []models.Rollup{
+		{Timestamp: start.Add(time.Minute), Count: 2, Min: 2, Max: 4, Avg: 3, Last: 4, Sum: 6},
+	}))
+
+	rollups, err := s.GetRollups("gauge", "mem", time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.True(t, start.Equal(rollups[0].Timestamp))
+	assert.Equal(t, int64(2), rollups[1].Count)
+	assert.Equal(t, 3.0, rollups[1].Avg)
+
+	names, err := s.HistoryNames()
+	require.NoError(t, err)
+	assert.Equal(t, []models.HistoryKey{
+		{MType: "counter", Name: "PollCount"},
+		{MType: "gauge", Name: "cpu"},
+		{MType: "gauge", Name: "mem"},
+	}, names)
+
+	histories, err := s.GetHistories(names, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+	assert.Equal(t, 2.0, histories[models.HistoryKey{MType: "counter", Name: "PollCount"}][0].Value)
+	assert.Equal(t, 1.5, histories[models.HistoryKey{MType: "gauge", Name: "cpu"}][0].Value)
+	assert.Empty(t, histories[models.HistoryKey{MType: "gauge", Name: "mem"}])
+	_, err = s.GetHistories([]models.HistoryKey{{MType: "unknown", Name: "cpu"}}, time.Time{}, start)
+	assert.Error(t, err)
+
+	require.NoError(t, s.PruneHistory([]models.HistoryCutoff{
+		{Before: time.Now().Add(time.Minute), MType: "gauge", Name: "cpu"},
+		{Before: start.Add(time.Minute), MType: "gauge", Name: "mem", Resolution: time.Minute},
+	}))
+	history, err := s.GetHistory("gauge", "cpu", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	history, err = s.GetHistory("counter", "PollCount", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+	rollups, err = s.GetRollups("gauge", "mem", time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.True(t, start.Add(time.Minute).Equal(rollups[0].Timestamp))
+
+	assert.Error(t, s.PruneHistory([]models.HistoryCutoff{{MType: "unknown", Name: "cpu"}}))
+}
@@ -1,19 +1,58 @@
 package file
 
 import (
+	"context"
 	"errors"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers"
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
 )
 
-// FStorage хранилище данных
+// FStorage хранилище данных, состояние обслуживается из памяти,
+// изменения пишутся в журнал и периодически сворачиваются в снимок
 type FStorage struct {
 	Gauges   map[string]models.Gauge
 	Counters map[string]models.Counter
+	Seq      uint64 `json:"Seq,omitempty"` // номер последней записи журнала, вошедшей в снимок
 	mx       sync.RWMutex
+	pruneMx  sync.Mutex // одно прореживание истории за раз
+
+	path    string
+	wal     *os.File
+	walSize int64
+}
+
+var (
+	storages   = make(map[string]*FStorage)
+	storagesMx sync.Mutex
+)
+
+// NewStorage получение хранилища для файла снимка filePath,
+// при первом открытии состояние восстанавливается из снимка и хвоста журнала,
+// повторные вызовы с тем же путем возвращают то же хранилище.
+// Если восстановить состояние не удалось, хранилище не создается,
+// иначе следующее сворачивание затерло бы снимок неполным состоянием
+func NewStorage(filePath string) (*FStorage, error) {
+	storagesMx.Lock()
+	defer storagesMx.Unlock()
+
+	if s, ok := storages[filePath]; ok {
+		return s, nil
+	}
+	s := &FStorage{
+		Gauges:   make(map[string]models.Gauge),
+		Counters: make(map[string]models.Counter),
+		path:     filePath,
+	}
+	if err := s.restore(); err != nil {
+		return nil, err
+	}
+	storages[filePath] = s
+	return s, nil
 }
 
 // StoreGaugeValue сохранение значения метрики типа Gauge
@@ -82,112 +121,196 @@ func (s *FStorage) GetAllCounters() map[string]models.Counter {
 	return mapCopy
 }
 
-// SetGauge установка значения метрики типа Gauge с сохранением в файле
+// SetGauge установка значения метрики типа Gauge с записью в журнал
 func (s *FStorage) SetGauge(name string, value models.Gauge) error {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
+	_, err := s.update([]walEntry{{MType: "gauge", Name: name, Value: float64(value)}})
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile SetGauge")
-	}
-	if metrics == nil {
-		metrics = s
-	}
-	metrics.StoreGaugeValue(name, value)
-
-	err = WriteMetricsToFile(metrics, handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "WriteMetricsToFile SetGauge")
+		logger.WriteErrorLog(err.Error(), "WAL SetGauge")
 	}
 	return err
 }
 
-// GetGauge получение значения метрики типа Gauge из файла
+// GetGauge получение значения метрики типа Gauge
 func (s *FStorage) GetGauge(name string) (float64, error) {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile GetGauge")
-	}
-	if metrics == nil {
-		return 0.0, errors.New("no metrics found")
-	}
-	val, err := metrics.GetGaugeValue(name)
-
+	val, err := s.GetGaugeValue(name)
 	return float64(val), err
 }
 
-// GetGauges получение значений всех метрик типа Gauge из файла
+// GetGauges получение значений всех метрик типа Gauge
 func (s *FStorage) GetGauges() (map[string]models.Gauge, error) {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
+	return s.GetAllGauges(), nil
+}
+
+// AddCounter добавление(сохранение/обновление) значения метрики типа Counter с записью в журнал
+func (s *FStorage) AddCounter(name string, value models.Counter) error {
+	_, err := s.update([]walEntry{{MType: "counter", Name: name, Delta: int64(value)}})
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile GetGauges")
+		logger.WriteErrorLog(err.Error(), "WAL AddCounter")
+	}
+	return err
+}
+
+// UpdateBatch сохранение пачки метрик одной записью журнала,
+// при ошибке записи состояние хранилища не меняется
+func (s *FStorage) UpdateBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	if err := models.ValidateBatch(metrics); err != nil {
+		return nil, err
 	}
-	if metrics != nil {
-		return metrics.GetAllGauges(), nil
+
+	entries := make([]walEntry, 0, len(metrics))
+	for _, m := range metrics {
+		switch m.MType {
+		case "gauge":
+			entries = append(entries, walEntry{MType: "gauge", Name: m.Key(), Value: *m.Value})
+		case "counter":
+			entries = append(entries, walEntry{MType: "counter", Name: m.Key(), Delta: *m.Delta})
+		}
 	}
-	metrics = s
-	err = WriteMetricsToFile(metrics, handlers.FileStoragePath)
+
+	totals, err := s.update(entries)
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "WriteMetricsToFile GetGauges")
+		logger.WriteErrorLog(err.Error(), "WAL UpdateBatch")
 		return nil, err
 	}
-	return metrics.GetAllGauges(), err
+
+	result := make([]models.Metrics, 0, len(metrics))
+	i := 0
+	for _, m := range metrics {
+		updated := m
+		switch updated.MType {
+		case "gauge":
+			i++
+		case "counter":
+			total := totals[i]
+			updated.Delta = &total
+			i++
+		}
+		result = append(result, updated)
+	}
+	return result, nil
 }
 
-// AddCounter добавление(сохранение/обновление) значения метрики типа Counter
-func (s *FStorage) AddCounter(name string, value models.Counter) error {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
+// GetCounter получение значения метрики типа Counter по имени
+func (s *FStorage) GetCounter(name string) (int64, error) {
+	val, err := s.GetCounterValue(name)
 	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile AddCounter")
+		err = errors.New("can't get counter")
 	}
-	if metrics == nil {
-		metrics = s
-		metrics.StoreCounterValue(name, models.Counter(0))
+	return int64(val), err
+}
+
+// GetCounters получение значений всех метрик типа Counter
+func (s *FStorage) GetCounters() (map[string]models.Counter, error) {
+	return s.GetAllCounters(), nil
+}
+
+// Compact сворачивание состояния в снимок и очистка журнала,
+// снимок пишется во временный файл и атомарно подменяет прежний
+func (s *FStorage) Compact() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	snapshot := &FStorage{
+		Gauges:   make(map[string]models.Gauge, len(s.Gauges)),
+		Counters: make(map[string]models.Counter, len(s.Counters)),
+		Seq:      s.Seq,
+	}
+	for key, val := range s.Gauges {
+		snapshot.Gauges[key] = val
+	}
+	for key, val := range s.Counters {
+		snapshot.Counters[key] = val
 	}
 
-	oldValue, err := metrics.GetCounterValue(name)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "GetCounterValue AddCounter")
+	if err := WriteMetricsToFile(snapshot, s.filePath()); err != nil {
+		return err
 	}
-	metrics.StoreCounterValue(name, oldValue+value)
+	// после подмены снимка записи журнала до Seq уже не нужны,
+	// если процесс упадет до очистки, при восстановлении они будут пропущены по номеру
+	return s.truncateWAL()
+}
 
-	err = WriteMetricsToFile(metrics, handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "WriteMetricsToFile AddCounter")
+// Run периодическое сворачивание журнала в снимок до отмены контекста
+func (s *FStorage) Run(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				logger.WriteErrorLog(err.Error(), "Compact file storage")
+			}
+		}
 	}
+}
+
+// Close закрытие журнала
+func (s *FStorage) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.Close()
+	s.wal = nil
 	return err
 }
 
-// GetCounter получение значения метрики типа Counter по имени
-func (s *FStorage) GetCounter(name string) (int64, error) {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile GetCounter")
-		return 0, err
+// filePath путь до файла снимка, для хранилища без пути используется путь из флагов
+func (s *FStorage) filePath() string {
+	if s.path != "" {
+		return s.path
 	}
-	if metrics == nil {
-		return 0, errors.New("metrics not found")
+	return handlers.FileStoragePath
+}
+
+// update запись изменений в журнал и применение их к состоянию,
+// возвращает накопленные значения счетчиков по позициям изменений
+func (s *FStorage) update(entries []walEntry) ([]int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if err := s.appendWAL(entries); err != nil {
+		return nil, err
 	}
+	totals := s.apply(entries)
 
-	val, err := metrics.GetCounterValue(name)
-	if err != nil {
-		err = errors.New("can't get counter")
+	now := time.Now()
+	records := make([]historyRecord, 0, len(entries))
+	for i, e := range entries {
+		value := e.Value
+		if e.MType == "counter" {
+			value = float64(totals[i])
+		}
+		records = append(records, historyRecord{Timestamp: now, MType: e.MType, Name: e.Name, Value: value})
 	}
-	return int64(val), err
+	if err := appendHistoryRecords(HistoryFilePath(s.filePath()), records); err != nil {
+		logger.WriteErrorLog(err.Error(), "AppendHistory")
+	}
+	return totals, nil
 }
 
-// GetCounters получение значений всех метрик типа Counter
-func (s *FStorage) GetCounters() (map[string]models.Counter, error) {
-	metrics, err := ReadMetricsFromFile(handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "ReadMetricsFromFile GetCounters")
+// apply применение изменений к состоянию, вызывается под блокировкой
+func (s *FStorage) apply(entries []walEntry) []int64 {
+	if s.Gauges == nil {
+		s.Gauges = make(map[string]models.Gauge)
 	}
-	if metrics != nil {
-		return metrics.GetAllCounters(), nil
+	if s.Counters == nil {
+		s.Counters = make(map[string]models.Counter)
 	}
 
-	metrics = s
-	err = WriteMetricsToFile(metrics, handlers.FileStoragePath)
-	if err != nil {
-		logger.WriteErrorLog(err.Error(), "WriteMetricsToFile GetCounters")
+	totals := make([]int64, len(entries))
+	for i, e := range entries {
+		switch e.MType {
+		case "gauge":
+			s.Gauges[e.Name] = models.Gauge(e.Value)
+		case "counter":
+			s.Counters[e.Name] += models.Counter(e.Delta)
+			totals[i] = int64(s.Counters[e.Name])
+		}
 	}
-	return metrics.GetAllCounters(), err
+	return totals
 }
@@ -1,10 +1,13 @@
 package file
 
 import (
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ramil063/gometrics/cmd/server/handlers"
 	"github.com/ramil063/gometrics/internal/logger"
@@ -46,11 +49,12 @@ func TestFStorage_AddCounter(t *testing.T) {
 				Counters: tt.storage.Counters,
 				mx:       sync.RWMutex{},
 			}
+			want := int64(tt.storage.Counters[tt.args.name] + tt.args.value)
 			err := s.AddCounter(tt.args.name, tt.args.value)
 			assert.NoError(t, err)
 			got, err := s.GetCounter(tt.args.name)
 			assert.NoError(t, err)
-			assert.Equal(t, got+int64(tt.args.value), got+int64(tt.storage.Counters[tt.args.name]))
+			assert.Equal(t, want, got)
 		})
 	}
 }
@@ -251,6 +255,14 @@ func TestFStorage_SetGauge(t *testing.T) {
 				value: 1.1,
 			},
 		},
+		{
+			want: map[string]models.Gauge{"met1": 1.1, `cpu{core="0",host="a"}`: 2.2},
+			name: "test labels",
+			args: args{
+				name:  models.MetricKey("cpu", map[string]string{"host": "a", "core": "0"}),
+				value: 2.2,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -510,3 +522,37 @@ func TestFStorage_GetAllCounters(t *testing.T) {
 		})
 	}
 }
+
+func TestFStorage_UpdateBatch(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+
+	gauge := 1.5
+	delta1, delta2 := int64(2), int64(3)
+
+	from := time.Now().Add(-time.Minute)
+	got, err := s.UpdateBatch([]models.Metrics{
+		{ID: "cpu", MType: "gauge", Value: &gauge},
+		{ID: "PollCount", MType: "counter", Delta: &delta1},
+		{ID: "PollCount", MType: "counter", Delta: &delta2},
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, int64(2), *got[1].Delta)
+	assert.Equal(t, int64(5), *got[2].Delta)
+
+	history, err := s.GetHistory("counter", "PollCount", from, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, float64(5), history[1].Value)
+
+	_, err = s.UpdateBatch([]models.Metrics{
+		{ID: "cpu", MType: "gauge"},
+	})
+	assert.Error(t, err)
+
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Gauge{"cpu": 1.5}, restored.GetAllGauges())
+	assert.Equal(t, map[string]models.Counter{"PollCount": 5}, restored.GetAllCounters())
+	assert.Equal(t, uint64(1), restored.Seq, "batch must be written as one WAL record")
+}
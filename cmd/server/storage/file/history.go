@@ -0,0 +1,145 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// historyRecord строка файла истории значений метрик
+type historyRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	MType     string    `json:"type"`
+	Name      string    `json:"name"`
+	Value     float64   `json:"value"`
+}
+
+// HistoryFilePath путь до файла истории рядом с основным файлом хранилища
+func HistoryFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_history.jsonl"
+}
+
+// AppendHistory дописывание значения метрики в конец файла истории
+func AppendHistory(filePath string, mType string, name string, value float64) error {
+	return appendHistoryRecords(filePath, []historyRecord{{
+		Timestamp: time.Now(),
+		MType:     mType,
+		Name:      name,
+		Value:     value,
+	}})
+}
+
+// appendHistoryRecords дописывание значений метрик в конец файла истории одной записью
+func appendHistoryRecords(filePath string, records []historyRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return internalErrors.NewFileError(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		file, err = retryOpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666, internalErrors.TriesTimes)
+		if err != nil {
+			return internalErrors.NewFileError(err)
+		}
+	}
+	defer file.Close()
+
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	return nil
+}
+
+// ReadHistory чтение из файла истории значений метрики за период
+func ReadHistory(filePath string, mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	result := make([]models.Sample, 0)
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, internalErrors.NewFileError(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record historyRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, internalErrors.NewFileError(err)
+		}
+		if record.MType != mType || record.Name != name {
+			continue
+		}
+		if record.Timestamp.Before(from) || record.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, models.Sample{
+			Timestamp: record.Timestamp,
+			Value:     record.Value,
+		})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, internalErrors.NewFileError(err)
+	}
+	return result, nil
+}
+
+// GetHistory получение истории значений метрики за период из файла
+func (s *FStorage) GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	if mType != "gauge" && mType != "counter" {
+		return nil, errors.New("unknown metric type")
+	}
+	return ReadHistory(HistoryFilePath(s.filePath()), mType, name, from, to)
+}
+
+// GetHistories получение истории значений нескольких метрик за период одним проходом по файлу истории
+func (s *FStorage) GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	result := make(map[models.HistoryKey][]models.Sample, len(keys))
+	for _, key := range keys {
+		if key.MType != "gauge" && key.MType != "counter" {
+			return nil, errors.New("unknown metric type")
+		}
+		result[key] = make([]models.Sample, 0)
+	}
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	err := scanLines(HistoryFilePath(s.filePath()), func(line []byte) error {
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		key := models.HistoryKey{MType: record.MType, Name: record.Name}
+		samples, ok := result[key]
+		if !ok || record.Timestamp.Before(from) || record.Timestamp.After(to) {
+			return nil
+		}
+		result[key] = append(samples, models.Sample{Timestamp: record.Timestamp, Value: record.Value})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package file
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryFilePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		filePath string
+		want     string
+	}{
+		{name: "json", filePath: "dir/metrics.json", want: "dir/metrics_history.jsonl"},
+		{name: "no ext", filePath: "dir/metrics", want: "dir/metrics_history.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HistoryFilePath(tt.filePath))
+		})
+	}
+}
+
+func TestAppendHistory_ReadHistory(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics_history.jsonl")
+
+	samples, err := ReadHistory(filePath, "gauge", "met1", time.Time{}, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+
+	assert.NoError(t, AppendHistory(filePath, "gauge", "met1", 1.1))
+	assert.NoError(t, AppendHistory(filePath, "counter", "met1", 5))
+	assert.NoError(t, AppendHistory(filePath, "gauge", "met1", 2.2))
+	assert.NoError(t, AppendHistory(filePath, "gauge", "met2", 3.3))
+
+	tests := []struct {
+		from  time.Time
+		to    time.Time
+		name  string
+		mType string
+		want  []float64
+	}{
+		{name: "gauge", mType: "gauge", from: time.Time{}, to: time.Now().Add(time.Minute), want: []float64{1.1, 2.2}},
+		{name: "counter", mType: "counter", from: time.Time{}, to: time.Now().Add(time.Minute), want: []float64{5}},
+		{name: "out of range", mType: "gauge", from: time.Now().Add(time.Hour), to: time.Now().Add(2 * time.Hour), want: []float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := ReadHistory(filePath, tt.mType, "met1", tt.from, tt.to)
+			assert.NoError(t, err)
+			got := make([]float64, 0)
+			for _, sample := range samples {
+				got = append(got, sample.Value)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
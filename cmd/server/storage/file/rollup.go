@@ -0,0 +1,290 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// rollupRecord строка файла агрегатов истории, шаг хранится в секундах
+type rollupRecord struct {
+	MType      string        `json:"type"`
+	Name       string        `json:"name"`
+	Resolution int64         `json:"resolution"`
+	Rollup     models.Rollup `json:"rollup"`
+}
+
+// RollupsFilePath путь до файла агрегатов истории рядом с основным файлом хранилища
+func RollupsFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_rollups.jsonl"
+}
+
+// HistoryNames получение ключей метрик всех типов, у которых есть история или агрегаты,
+// каждый файл читается один раз
+func (s *FStorage) HistoryNames() ([]models.HistoryKey, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	keys := make(map[models.HistoryKey]struct{})
+	err := scanLines(HistoryFilePath(s.filePath()), func(line []byte) error {
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		keys[models.HistoryKey{MType: record.MType, Name: record.Name}] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanLines(RollupsFilePath(s.filePath()), func(line []byte) error {
+		var record rollupRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		keys[models.HistoryKey{MType: record.MType, Name: record.Name}] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.HistoryKey, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	slices.SortFunc(result, models.CompareHistoryKeys)
+	return result, nil
+}
+
+// SaveRollups дописывание агрегатов метрики в файл агрегатов,
+// при чтении агрегат за тот же интервал берется из последней записи
+func (s *FStorage) SaveRollups(mType string, name string, resolution time.Duration, rollups []models.Rollup) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var buf bytes.Buffer
+	for _, rollup := range rollups {
+		data, err := json.Marshal(rollupRecord{
+			MType:      mType,
+			Name:       name,
+			Resolution: int64(resolution.Seconds()),
+			Rollup:     rollup,
+		})
+		if err != nil {
+			return internalErrors.NewFileError(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(RollupsFilePath(s.filePath()), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	return nil
+}
+
+// GetRollups получение агрегатов метрики с шагом resolution, начавшихся в период [from, to]
+func (s *FStorage) GetRollups(mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	if mType != "gauge" && mType != "counter" {
+		return nil, errors.New("unknown metric type")
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	byStart := make(map[time.Time]models.Rollup)
+	err := scanLines(RollupsFilePath(s.filePath()), func(line []byte) error {
+		var record rollupRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		if record.MType != mType || record.Name != name || record.Resolution != int64(resolution.Seconds()) {
+			return nil
+		}
+		if record.Rollup.Timestamp.Before(from) || record.Rollup.Timestamp.After(to) {
+			return nil
+		}
+		byStart[record.Rollup.Timestamp] = record.Rollup
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Rollup, 0, len(byStart))
+	for _, rollup := range byStart {
+		result = append(result, rollup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result, nil
+}
+
+// PruneHistory удаление значений истории и агрегатов старше границ,
+// файлы перезаписываются атомарно и только если из них есть что удалить,
+// запись в хранилище на время перезаписи не останавливается
+func (s *FStorage) PruneHistory(cutoffs []models.HistoryCutoff) error {
+	raw := make(map[string]time.Time)
+	rollups := make(map[string]time.Time)
+	for _, cutoff := range cutoffs {
+		key := cutoff.MType + "/" + cutoff.Name
+		if cutoff.Resolution == 0 {
+			raw[key] = cutoff.Before
+			continue
+		}
+		rollups[key+"/"+cutoff.Resolution.String()] = cutoff.Before
+	}
+
+	s.pruneMx.Lock()
+	defer s.pruneMx.Unlock()
+
+	err := s.pruneLines(HistoryFilePath(s.filePath()), func(line []byte) (bool, error) {
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return false, err
+		}
+		before, ok := raw[record.MType+"/"+record.Name]
+		return !ok || !record.Timestamp.Before(before), nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.pruneLines(RollupsFilePath(s.filePath()), func(line []byte) (bool, error) {
+		var record rollupRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return false, err
+		}
+		resolution := time.Duration(record.Resolution) * time.Second
+		before, ok := rollups[record.MType+"/"+record.Name+"/"+resolution.String()]
+		return !ok || !record.Rollup.Timestamp.Before(before), nil
+	})
+}
+
+// scanLines построчное чтение файла, отсутствующий файл считается пустым
+func scanLines(filePath string, fn func(line []byte) error) error {
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	defer file.Close()
+
+	return scanReader(file, fn)
+}
+
+// scanReader построчное чтение, пустые строки пропускаются
+func scanReader(r io.Reader, fn func(line []byte) error) error {
+	var err error
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err = fn(scanner.Bytes()); err != nil {
+			return internalErrors.NewFileError(err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	return nil
+}
+
+// beforePruneSwap вызывается после записи прореженной копии перед ее подменой, используется в тестах
+var beforePruneSwap func()
+
+// pruneLines атомарная перезапись файла без строк, для которых keep вернул false.
+// Прореженная копия пишется без блокировки хранилища, под блокировкой в нее дописываются только
+// строки, добавленные за это время, и копия подменяет файл
+func (s *FStorage) pruneLines(filePath string, keep func(line []byte) (bool, error)) error {
+	// строки дописываются под блокировкой, поэтому размер, снятый под ней, приходится на границу строки
+	s.mx.RLock()
+	info, err := os.Stat(filePath)
+	s.mx.RUnlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	size := info.Size()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	defer file.Close()
+
+	dir := filepath.Dir(filePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	kept := bufio.NewWriter(tmp)
+	dropped := 0
+	err = scanReader(io.LimitReader(file, size), func(line []byte) error {
+		ok, err := keep(line)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			dropped++
+			return nil
+		}
+		kept.Write(line)
+		return kept.WriteByte('\n')
+	})
+	if err != nil || dropped == 0 {
+		return err
+	}
+	if err = kept.Flush(); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	if beforePruneSwap != nil {
+		beforePruneSwap()
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// строки, дописанные во время прореживания, переносятся в копию как есть
+	if _, err = file.Seek(size, io.SeekStart); err == nil {
+		_, err = io.Copy(tmp, file)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	if err = os.Rename(tmp.Name(), filePath); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,130 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func TestRollupsFilePath(t *testing.T) {
+	assert.Equal(t, "dir/metrics_rollups.jsonl", RollupsFilePath("dir/metrics.json"))
+}
+
+func TestFStorage_Rollups(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.SetGauge("gauge1", 1.5))
+	require.NoError(t, s.AddCounter("counter1", 2))
+
+	require.NoError(t, s.SaveRollups("gauge", "gauge2", time.Minute, []models.Rollup{
+		{Timestamp: start, Count: 1, Avg: 1},
+		{Timestamp: start.Add(time.Minute), Count: 1, Avg: 2},
+	}))
+	// повторная свертка интервала заменяет агрегат
+	require.NoError(t, s.SaveRollups("gauge", "gauge2", time.Minute, []models.Rollup{
+		{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3},
+	}))
+	require.NoError(t, s.SaveRollups("gauge", "gauge2", time.Hour, []models.Rollup{
+		{Timestamp: start, Count: 3, Avg: 2},
+	}))
+
+	rollups, err := s.GetRollups("gauge", "gauge2", time.Minute, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.Rollup{
+		{Timestamp: start, Count: 1, Avg: 1},
+		{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3},
+	}, rollups)
+	_, err = s.GetRollups("unknown", "gauge2", time.Minute, time.Time{}, start)
+	assert.Error(t, err)
+
+	names, err := s.HistoryNames()
+	require.NoError(t, err)
+	assert.Equal(t, []models.HistoryKey{
+		{MType: "counter", Name: "counter1"},
+		{MType: "gauge", Name: "gauge1"},
+		{MType: "gauge", Name: "gauge2"},
+	}, names)
+
+	histories, err := s.GetHistories(names, time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+	assert.Equal(t, 2.0, histories[models.HistoryKey{MType: "counter", Name: "counter1"}][0].Value)
+	assert.Equal(t, 1.5, histories[models.HistoryKey{MType: "gauge", Name: "gauge1"}][0].Value)
+	assert.Empty(t, histories[models.HistoryKey{MType: "gauge", Name: "gauge2"}])
+	_, err = s.GetHistories([]models.HistoryKey{{MType: "unknown", Name: "gauge1"}}, time.Time{}, start)
+	assert.Error(t, err)
+
+	require.NoError(t, s.PruneHistory([]models.HistoryCutoff{
+		{Before: time.Now().Add(time.Minute), MType: "gauge", Name: "gauge1"},
+		{Before: start.Add(time.Minute), MType: "gauge", Name: "gauge2", Resolution: time.Minute},
+	}))
+
+	samples, err := s.GetHistory("gauge", "gauge1", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	samples, err = s.GetHistory("counter", "counter1", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, samples, 1)
+
+	rollups, err = s.GetRollups("gauge", "gauge2", time.Minute, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.Rollup{{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3}}, rollups)
+	rollups, err = s.GetRollups("gauge", "gauge2", time.Hour, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, rollups, 1)
+}
+
+func TestFStorage_PruneHistoryUnchanged(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.SetGauge("gauge1", 1.5))
+
+	info, err := os.Stat(HistoryFilePath(filePath))
+	require.NoError(t, err)
+
+	// без устаревших значений файл не перезаписывается
+	require.NoError(t, s.PruneHistory([]models.HistoryCutoff{
+		{Before: time.Now().Add(-time.Hour), MType: "gauge", Name: "gauge1"},
+	}))
+	after, err := os.Stat(HistoryFilePath(filePath))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(info, after))
+}
+
+func TestFStorage_PruneHistoryConcurrentWrite(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.SetGauge("gauge1", 1.5))
+	require.NoError(t, s.SetGauge("gauge2", 2.5))
+
+	// запись в хранилище не ждет, пока пишется прореженная копия истории
+	defer func() { beforePruneSwap = nil }()
+	beforePruneSwap = func() {
+		written := make(chan error, 1)
+		go func() { written <- s.SetGauge("gauge1", 3.5) }()
+		select {
+		case err := <-written:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Error("write is blocked by history pruning")
+		}
+	}
+	require.NoError(t, s.PruneHistory([]models.HistoryCutoff{
+		{Before: time.Now().Add(time.Millisecond), MType: "gauge", Name: "gauge2"},
+	}))
+
+	samples, err := s.GetHistory("gauge", "gauge1", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 2, "values written during pruning must be kept")
+	assert.Equal(t, 3.5, samples[1].Value)
+	samples, err = s.GetHistory("gauge", "gauge2", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
@@ -0,0 +1,230 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	internalErrors "github.com/ramil063/gometrics/internal/errors"
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// maxWALRecordSize максимальный размер одной записи журнала (пачки метрик) вместе с переносом строки
+var maxWALRecordSize = 64 << 20
+
+// walRecord строка журнала, одна запись на одно обновление или пачку метрик
+type walRecord struct {
+	Seq     uint64     `json:"seq"`
+	Entries []walEntry `json:"entries"`
+}
+
+// walEntry изменение одной метрики: значение для gauge, приращение для counter
+type walEntry struct {
+	MType string  `json:"type"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value,omitempty"`
+	Delta int64   `json:"delta,omitempty"`
+}
+
+// WALFilePath путь до журнала изменений рядом с файлом снимка
+func WALFilePath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_wal.jsonl"
+}
+
+// ClearStorage затирание снимка, журнала, истории и агрегатов истории хранилища
+func ClearStorage(filePath string) error {
+	for _, path := range []string{filePath, WALFilePath(filePath), HistoryFilePath(filePath), RollupsFilePath(filePath)} {
+		if err := ClearFileContent(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendWAL дописывание записи в журнал с fsync, вызывается под блокировкой,
+// при неполной записи журнал обрезается до прежнего размера,
+// запись больше maxWALRecordSize не пишется, иначе ее нельзя будет прочитать при восстановлении
+func (s *FStorage) appendWAL(entries []walEntry) error {
+	if s.wal == nil {
+		if err := s.openWAL(); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(walRecord{Seq: s.Seq + 1, Entries: entries})
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	data = append(data, '\n')
+	if len(data) > maxWALRecordSize {
+		return internalErrors.NewFileError(fmt.Errorf("WAL record of %d bytes exceeds %d bytes", len(data), maxWALRecordSize))
+	}
+
+	if _, err = s.wal.Write(data); err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		if truncErr := s.wal.Truncate(s.walSize); truncErr != nil {
+			logger.WriteErrorLog(truncErr.Error(), "WAL truncate after failed write")
+		}
+		return internalErrors.NewFileError(err)
+	}
+	s.walSize += int64(len(data))
+	s.Seq++
+	return nil
+}
+
+// openWAL открытие журнала на дописывание
+func (s *FStorage) openWAL() error {
+	path := WALFilePath(s.filePath())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	wal, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		_ = wal.Close()
+		return internalErrors.NewFileError(err)
+	}
+	s.wal = wal
+	s.walSize = info.Size()
+	return nil
+}
+
+// truncateWAL очистка журнала после записи снимка, вызывается под блокировкой
+func (s *FStorage) truncateWAL() error {
+	if s.wal == nil {
+		return ClearFileContent(WALFilePath(s.filePath()))
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	s.walSize = 0
+	return nil
+}
+
+// restore восстановление состояния: загрузка снимка и применение записей журнала новее снимка,
+// при поврежденном снимке применяется весь журнал и нумерация продолжается с его последней записи
+func (s *FStorage) restore() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if err := s.loadSnapshot(); err != nil {
+		return err
+	}
+	return s.replayWAL()
+}
+
+// loadSnapshot загрузка снимка, поврежденный снимок откладывается в файл .corrupt,
+// и восстановление продолжается с пустого состояния
+func (s *FStorage) loadSnapshot() error {
+	path := s.filePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	// снимок занимает первую строку файла
+	line, _, _ := bytes.Cut(data, []byte{'\n'})
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	snapshot := FStorage{}
+	if err = json.Unmarshal(line, &snapshot); err != nil {
+		// снимок нельзя оставлять на месте: следующее сворачивание его перезапишет
+		if renameErr := os.Rename(path, path+".corrupt"); renameErr != nil {
+			return internalErrors.NewFileError(fmt.Errorf("corrupt snapshot %s: %w", path, renameErr))
+		}
+		logger.WriteErrorLog(fmt.Sprintf("corrupt snapshot moved to %s.corrupt: %v", path, err), path)
+		return nil
+	}
+	for key, val := range snapshot.Gauges {
+		s.Gauges[key] = val
+	}
+	for key, val := range snapshot.Counters {
+		s.Counters[key] = val
+	}
+	s.Seq = snapshot.Seq
+	return nil
+}
+
+// replayWAL применение записей журнала с номером больше номера снимка,
+// оборванная при падении последняя запись без переноса строки отбрасывается и журнал обрезается по ней,
+// нечитаемая запись в середине журнала - ошибка восстановления, журнал при этом не меняется
+func (s *FStorage) replayWAL() error {
+	path := WALFilePath(s.filePath())
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return internalErrors.NewFileError(err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxWALRecordSize)), maxWALRecordSize)
+	var offset int64
+	var replayed int
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		end := offset + int64(len(line)) + 1
+		// запись без переноса строки в конце файла считается оборванной
+		if end > info.Size() {
+			break
+		}
+		var record walRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			return internalErrors.NewFileError(fmt.Errorf("corrupt WAL record at offset %d of %s: %w", offset, path, err))
+		}
+		offset = end
+		if record.Seq <= s.Seq {
+			continue
+		}
+		s.apply(record.Entries)
+		s.Seq = record.Seq
+		replayed++
+	}
+	if err = scanner.Err(); err != nil {
+		return internalErrors.NewFileError(fmt.Errorf("unreadable WAL record at offset %d of %s: %w", offset, path, err))
+	}
+	if offset < info.Size() {
+		logger.WriteErrorLog(fmt.Sprintf("dropped %d bytes of torn WAL tail", info.Size()-offset), path)
+		if err = os.Truncate(path, offset); err != nil {
+			return internalErrors.NewFileError(err)
+		}
+	}
+	logger.WriteInfoLog(fmt.Sprintf("replayed %d WAL records", replayed), path)
+	return nil
+}
+
+// DefaultCompactInterval интервал сворачивания журнала, если интервал сохранения не задан
+const DefaultCompactInterval = 300 * time.Second
+
+// CompactInterval интервал сворачивания журнала в снимок по интервалу сохранения в секундах
+func CompactInterval(storeInterval int) time.Duration {
+	if storeInterval <= 0 {
+		return DefaultCompactInterval
+	}
+	return time.Duration(storeInterval) * time.Second
+}
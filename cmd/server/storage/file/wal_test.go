@@ -0,0 +1,263 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// reopenStorage открытие хранилища заново, как после перезапуска сервера
+func reopenStorage(t *testing.T, filePath string) *FStorage {
+	t.Helper()
+	storagesMx.Lock()
+	if s, ok := storages[filePath]; ok {
+		_ = s.Close()
+		delete(storages, filePath)
+	}
+	storagesMx.Unlock()
+
+	s, err := NewStorage(filePath)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestNewStorage_Shared(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s1 := reopenStorage(t, filePath)
+	s2, err := NewStorage(filePath)
+	require.NoError(t, err)
+	assert.Same(t, s1, s2)
+}
+
+func TestFStorage_RestoreFromWAL(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.AddCounter("PollCount", 3))
+	_, err := os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "snapshot must not be written on every update")
+
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Gauge{"cpu": 1.5}, restored.GetAllGauges())
+	assert.Equal(t, map[string]models.Counter{"PollCount": 5}, restored.GetAllCounters())
+	assert.Equal(t, uint64(3), restored.Seq)
+}
+
+func TestFStorage_Compact(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.Compact())
+
+	info, err := os.Stat(WALFilePath(filePath))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "WAL must be truncated after compaction")
+
+	require.NoError(t, s.AddCounter("PollCount", 3))
+
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Gauge{"cpu": 1.5}, restored.GetAllGauges())
+	assert.Equal(t, map[string]models.Counter{"PollCount": 5}, restored.GetAllCounters())
+
+	matches, err := filepath.Glob(filePath + ".tmp*")
+	require.NoError(t, err)
+	assert.Empty(t, matches, "temp snapshot must be renamed")
+}
+
+func TestFStorage_RestoreSkipsCompactedRecords(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.AddCounter("PollCount", 3))
+	// падение после подмены снимка, но до очистки журнала
+	require.NoError(t, WriteMetricsToFile(&FStorage{
+		Gauges:   map[string]models.Gauge{},
+		Counters: map[string]models.Counter{"PollCount": 5},
+		Seq:      2,
+	}, filePath))
+	require.NoError(t, s.AddCounter("PollCount", 4))
+
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 9}, restored.GetAllCounters())
+	assert.Equal(t, uint64(3), restored.Seq)
+}
+
+func TestFStorage_RestoreTornTail(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.Close())
+
+	walPath := WALFilePath(filePath)
+	valid, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	torn := append(append([]byte{}, valid...), []byte(`{"seq":2,"entries":[{"type":"counter","na`)...)
+	require.NoError(t, os.WriteFile(walPath, torn, 0666))
+
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 2}, restored.GetAllCounters())
+	data, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	assert.Equal(t, valid, data, "torn tail must be cut off")
+
+	require.NoError(t, restored.AddCounter("PollCount", 3))
+	restored = reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 5}, restored.GetAllCounters())
+}
+
+func TestNewStorage_CorruptWALRecord(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.Close())
+
+	walPath := WALFilePath(filePath)
+	valid, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	corrupt := append(append([]byte{}, `{"seq":1,"entr`+"\n"...), valid...)
+	require.NoError(t, os.WriteFile(walPath, corrupt, 0666))
+	storagesMx.Lock()
+	delete(storages, filePath)
+	storagesMx.Unlock()
+
+	// записи после нечитаемой нельзя отбрасывать как оборванный хвост
+	restored, err := NewStorage(filePath)
+	assert.Error(t, err)
+	assert.Nil(t, restored)
+	data, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	assert.Equal(t, corrupt, data, "WAL must be left intact")
+}
+
+func TestFStorage_WALRecordTooLarge(t *testing.T) {
+	oldMaxWALRecordSize := maxWALRecordSize
+	defer func() { maxWALRecordSize = oldMaxWALRecordSize }()
+
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.AddCounter("PollCount", 3))
+
+	walPath := WALFilePath(filePath)
+	valid, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	maxWALRecordSize = 100
+
+	// запись журнала, которую нельзя прочитать, не пишется
+	assert.Error(t, s.SetGauge(strings.Repeat("g", 100), 1.5))
+	assert.Empty(t, s.GetAllGauges())
+	data, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	assert.Equal(t, valid, data)
+	require.NoError(t, s.Close())
+
+	// журнал с записью больше допустимой не обрезается при восстановлении
+	maxWALRecordSize = 40
+	storagesMx.Lock()
+	delete(storages, filePath)
+	storagesMx.Unlock()
+	restored, err := NewStorage(filePath)
+	assert.Error(t, err)
+	assert.Nil(t, restored)
+	data, err = os.ReadFile(walPath)
+	require.NoError(t, err)
+	assert.Equal(t, valid, data, "WAL must be left intact")
+}
+
+func TestFStorage_RestoreCorruptSnapshot(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.AddCounter("PollCount", 2))
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.AddCounter("PollCount", 3))
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+	require.NoError(t, os.WriteFile(filePath, []byte("{broken\n"), 0666))
+
+	// журнал применяется и без снимка, нумерация продолжается с последней записи журнала
+	restored := reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 3}, restored.GetAllCounters())
+	assert.Equal(t, map[string]models.Gauge{"cpu": 1.5}, restored.GetAllGauges())
+	assert.Equal(t, uint64(3), restored.Seq)
+	_, err := os.Stat(filePath + ".corrupt")
+	assert.NoError(t, err, "corrupt snapshot must be kept aside")
+
+	// записи после первого перезапуска не теряются при втором
+	require.NoError(t, restored.AddCounter("PollCount", 4))
+	restored = reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 7}, restored.GetAllCounters())
+	assert.Equal(t, uint64(4), restored.Seq)
+
+	require.NoError(t, restored.Compact())
+	require.NoError(t, restored.AddCounter("PollCount", 1))
+	restored = reopenStorage(t, filePath)
+	assert.Equal(t, map[string]models.Counter{"PollCount": 8}, restored.GetAllCounters())
+	assert.Equal(t, map[string]models.Gauge{"cpu": 1.5}, restored.GetAllGauges())
+}
+
+func TestNewStorage_RestoreError(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	// снимок, который нельзя прочитать, не должен затираться сворачиванием
+	require.NoError(t, os.Mkdir(filePath, 0755))
+
+	s, err := NewStorage(filePath)
+	assert.Error(t, err)
+	assert.Nil(t, s)
+
+	storagesMx.Lock()
+	_, ok := storages[filePath]
+	storagesMx.Unlock()
+	assert.False(t, ok, "storage that failed to restore must not be shared")
+}
+
+func TestFStorage_Run(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	s := reopenStorage(t, filePath)
+	require.NoError(t, s.SetGauge("cpu", 1.5))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, time.NewTicker(10*time.Millisecond))
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filePath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestClearStorage(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	for _, path := range []string{filePath, WALFilePath(filePath), HistoryFilePath(filePath), RollupsFilePath(filePath)} {
+		require.NoError(t, os.WriteFile(path, []byte("data\n"), 0666))
+	}
+
+	require.NoError(t, ClearStorage(filePath))
+	for _, path := range []string{filePath, WALFilePath(filePath), HistoryFilePath(filePath), RollupsFilePath(filePath)} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	}
+}
+
+func TestCompactInterval(t *testing.T) {
+	assert.Equal(t, DefaultCompactInterval, CompactInterval(0))
+	assert.Equal(t, 10*time.Second, CompactInterval(10))
+}
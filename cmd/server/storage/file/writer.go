@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/ramil063/gometrics/internal/errors"
 	"github.com/ramil063/gometrics/internal/logger"
@@ -32,18 +33,47 @@ func NewWriter(filename string) (*Writer, error) {
 	}, nil
 }
 
-// WriteMetricsToFile запись метрик в файл
-func WriteMetricsToFile(metrics *FStorage, filepath string) error {
-	Writer, err := NewWriter(filepath)
+// WriteMetricsToFile атомарная запись метрик в файл:
+// данные пишутся во временный файл рядом, сбрасываются на диск и подменяют файл переименованием
+func WriteMetricsToFile(metrics *FStorage, filePath string) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.NewFileError(err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp*")
 	if err != nil {
-		logger.WriteErrorLog("error create metrics writer", err.Error())
+		logger.WriteErrorLog("error create metrics temp file", err.Error())
+		return errors.NewFileError(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := &Writer{file: tmp, writer: bufio.NewWriter(tmp)}
+	if err = w.WriteMetrics(metrics); err != nil {
+		_ = tmp.Close()
+		logger.WriteErrorLog("error write metrics", err.Error())
 		return err
 	}
-	defer Writer.Close()
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.NewFileError(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.NewFileError(err)
+	}
+	if err = os.Rename(tmp.Name(), filePath); err != nil {
+		return errors.NewFileError(err)
+	}
+	return syncDir(dir)
+}
 
-	err = Writer.WriteMetrics(metrics)
+// syncDir сброс на диск записи каталога, чтобы переименование пережило падение
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
-		logger.WriteErrorLog("error write metrics", err.Error())
+		return errors.NewFileError(err)
+	}
+	defer d.Close()
+	if err = d.Sync(); err != nil {
 		return errors.NewFileError(err)
 	}
 	return nil
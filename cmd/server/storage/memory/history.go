@@ -0,0 +1,226 @@
+package memory
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// HistoryLimit максимальное количество хранимых значений истории одной метрики
+var HistoryLimit = 10000
+
+// ring кольцевой буфер значений метрики, при переполнении затираются самые старые значения,
+// память под значения выделяется по мере добавления до размера буфера
+type ring struct {
+	samples []models.Sample
+	size    int
+	next    int
+	full    bool
+}
+
+func newRing(size int) *ring {
+	if size <= 0 {
+		size = 1
+	}
+	return &ring{size: size}
+}
+
+// push добавление значения в буфер
+func (r *ring) push(sample models.Sample) {
+	if len(r.samples) < r.size {
+		r.samples = append(r.samples, sample)
+		r.next = len(r.samples)
+		if r.next == r.size {
+			r.next, r.full = 0, true
+		}
+		return
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % r.size
+}
+
+// between получение значений за период [from, to] в порядке добавления
+func (r *ring) between(from, to time.Time) []models.Sample {
+	result := make([]models.Sample, 0)
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.samples)
+	}
+	for i := 0; i < count; i++ {
+		sample := r.samples[(start+i)%len(r.samples)]
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// dropBefore удаление значений старше before с сохранением порядка значений
+func (r *ring) dropBefore(before time.Time) {
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.samples)
+	}
+	kept := make([]models.Sample, 0, count)
+	for i := 0; i < count; i++ {
+		sample := r.samples[(start+i)%len(r.samples)]
+		if !sample.Timestamp.Before(before) {
+			kept = append(kept, sample)
+		}
+	}
+	if len(kept) == count {
+		return
+	}
+
+	r.samples = make([]models.Sample, 0, len(kept))
+	r.next, r.full = 0, false
+	for _, sample := range kept {
+		r.push(sample)
+	}
+}
+
+// rollupKey ключ агрегатов метрики с шагом прореживания
+type rollupKey struct {
+	mType      string
+	name       string
+	resolution time.Duration
+}
+
+// HistoryNames получение ключей метрик всех типов, у которых есть история или агрегаты
+func (ms *MemStorage) HistoryNames() ([]models.HistoryKey, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	keys := make(map[models.HistoryKey]struct{})
+	for _, mType := range []string{"gauge", "counter"} {
+		history, err := ms.history(mType)
+		if err != nil {
+			return nil, err
+		}
+		for name := range history {
+			keys[models.HistoryKey{MType: mType, Name: name}] = struct{}{}
+		}
+	}
+	for key := range ms.rollups {
+		keys[models.HistoryKey{MType: key.mType, Name: key.name}] = struct{}{}
+	}
+
+	result := make([]models.HistoryKey, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	slices.SortFunc(result, models.CompareHistoryKeys)
+	return result, nil
+}
+
+// GetHistories получение истории значений нескольких метрик за период
+func (ms *MemStorage) GetHistories(keys []models.HistoryKey, from, to time.Time) (map[models.HistoryKey][]models.Sample, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	result := make(map[models.HistoryKey][]models.Sample, len(keys))
+	for _, key := range keys {
+		history, err := ms.history(key.MType)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := history[key.Name]; ok {
+			result[key] = r.between(from, to)
+			continue
+		}
+		result[key] = []models.Sample{}
+	}
+	return result, nil
+}
+
+// SaveRollups сохранение агрегатов метрики, агрегат за тот же интервал заменяется
+func (ms *MemStorage) SaveRollups(mType string, name string, resolution time.Duration, rollups []models.Rollup) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if ms.rollups == nil {
+		ms.rollups = make(map[rollupKey][]models.Rollup)
+	}
+	key := rollupKey{mType: mType, name: name, resolution: resolution}
+	byStart := make(map[time.Time]models.Rollup, len(ms.rollups[key])+len(rollups))
+	for _, rollup := range ms.rollups[key] {
+		byStart[rollup.Timestamp] = rollup
+	}
+	for _, rollup := range rollups {
+		byStart[rollup.Timestamp] = rollup
+	}
+
+	merged := make([]models.Rollup, 0, len(byStart))
+	for _, rollup := range byStart {
+		merged = append(merged, rollup)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	ms.rollups[key] = merged
+	return nil
+}
+
+// GetRollups получение агрегатов метрики с шагом resolution, начавшихся в период [from, to]
+func (ms *MemStorage) GetRollups(mType string, name string, resolution time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	if _, err := ms.history(mType); err != nil {
+		return nil, err
+	}
+	result := make([]models.Rollup, 0)
+	for _, rollup := range ms.rollups[rollupKey{mType: mType, name: name, resolution: resolution}] {
+		if rollup.Timestamp.Before(from) || rollup.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, rollup)
+	}
+	return result, nil
+}
+
+// PruneHistory удаление значений истории и агрегатов старше границ
+func (ms *MemStorage) PruneHistory(cutoffs []models.HistoryCutoff) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	for _, cutoff := range cutoffs {
+		if cutoff.Resolution == 0 {
+			history, err := ms.history(cutoff.MType)
+			if err != nil {
+				return err
+			}
+			if r, ok := history[cutoff.Name]; ok {
+				r.dropBefore(cutoff.Before)
+			}
+			continue
+		}
+
+		key := rollupKey{mType: cutoff.MType, name: cutoff.Name, resolution: cutoff.Resolution}
+		rollups := ms.rollups[key]
+		i := sort.Search(len(rollups), func(i int) bool {
+			return !rollups[i].Timestamp.Before(cutoff.Before)
+		})
+		if i == len(rollups) {
+			delete(ms.rollups, key)
+			continue
+		}
+		ms.rollups[key] = append([]models.Rollup{}, rollups[i:]...)
+	}
+	return nil
+}
+
+// history история значений метрик по типу, вызывается под блокировкой
+func (ms *MemStorage) history(mType string) (map[string]*ring, error) {
+	switch mType {
+	case "gauge":
+		return ms.gaugesHistory, nil
+	case "counter":
+		return ms.countersHistory, nil
+	}
+	return nil, errors.New("unknown metric type")
+}
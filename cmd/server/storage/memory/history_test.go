@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+func Test_ring_between(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		want   []float64
+		size   int
+		values int
+	}{
+		{
+			name:   "not full",
+			size:   5,
+			values: 3,
+			from:   start,
+			to:     start.Add(time.Hour),
+			want:   []float64{0, 1, 2},
+		},
+		{
+			name:   "overwritten",
+			size:   3,
+			values: 5,
+			from:   start,
+			to:     start.Add(time.Hour),
+			want:   []float64{2, 3, 4},
+		},
+		{
+			name:   "range",
+			size:   10,
+			values: 5,
+			from:   start.Add(time.Minute),
+			to:     start.Add(3 * time.Minute),
+			want:   []float64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRing(tt.size)
+			for i := 0; i < tt.values; i++ {
+				r.push(models.Sample{
+					Timestamp: start.Add(time.Duration(i) * time.Minute),
+					Value:     float64(i),
+				})
+			}
+			got := make([]float64, 0)
+			for _, sample := range r.between(tt.from, tt.to) {
+				got = append(got, sample.Value)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ring_grows(t *testing.T) {
+	r := newRing(HistoryLimit)
+	assert.Zero(t, cap(r.samples), "memory is not allocated before the first value")
+
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		r.push(models.Sample{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: float64(i)})
+	}
+	assert.Len(t, r.samples, 3)
+	assert.Less(t, cap(r.samples), HistoryLimit)
+	assert.False(t, r.full)
+}
+
+func TestMemStorage_GetHistory(t *testing.T) {
+	ms := &MemStorage{
+		Gauges:   map[string]models.Gauge{},
+		Counters: map[string]models.Counter{},
+	}
+	assert.NoError(t, ms.SetGauge("gauge1", 1.5))
+	assert.NoError(t, ms.SetGauge("gauge1", 2.5))
+	assert.NoError(t, ms.AddCounter("counter1", 2))
+	assert.NoError(t, ms.AddCounter("counter1", 3))
+
+	tests := []struct {
+		name    string
+		mType   string
+		metric  string
+		want    []float64
+		wantErr bool
+	}{
+		{name: "gauge", mType: "gauge", metric: "gauge1", want: []float64{1.5, 2.5}},
+		{name: "counter", mType: "counter", metric: "counter1", want: []float64{2, 5}},
+		{name: "unknown metric", mType: "gauge", metric: "unknown", want: []float64{}},
+		{name: "unknown type", mType: "unknown", metric: "gauge1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := ms.GetHistory(tt.mType, tt.metric, time.Time{}, time.Now())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			got := make([]float64, 0)
+			for _, sample := range samples {
+				got = append(got, sample.Value)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ring_dropBefore(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := newRing(3)
+	for i := 0; i < 5; i++ {
+		r.push(models.Sample{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: float64(i)})
+	}
+
+	r.dropBefore(start.Add(3 * time.Minute))
+	r.push(models.Sample{Timestamp: start.Add(5 * time.Minute), Value: 5})
+
+	got := make([]float64, 0)
+	for _, sample := range r.between(time.Time{}, start.Add(time.Hour)) {
+		got = append(got, sample.Value)
+	}
+	assert.Equal(t, []float64{3, 4, 5}, got)
+}
+
+func TestMemStorage_Rollups(t *testing.T) {
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	ms := &MemStorage{
+		Gauges:   map[string]models.Gauge{},
+		Counters: map[string]models.Counter{},
+	}
+	assert.NoError(t, ms.SetGauge("gauge1", 1.5))
+
+	require.NoError(t, ms.SaveRollups("gauge", "gauge2", time.Minute, []models.Rollup{
+		{Timestamp: start.Add(time.Minute), Count: 1, Avg: 2},
+		{Timestamp: start, Count: 1, Avg: 1},
+	}))
+	require.NoError(t, ms.SaveRollups("gauge", "gauge2", time.Minute, []models.Rollup{
+		{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3},
+	}))
+
+	rollups, err := ms.GetRollups("gauge", "gauge2", time.Minute, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.Rollup{
+		{Timestamp: start, Count: 1, Avg: 1},
+		{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3},
+	}, rollups)
+
+	rollups, err = ms.GetRollups("gauge", "gauge2", time.Hour, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+	_, err = ms.GetRollups("unknown", "gauge2", time.Minute, time.Time{}, start)
+	assert.Error(t, err)
+
+	names, err := ms.HistoryNames()
+	require.NoError(t, err)
+	assert.Equal(t, []models.HistoryKey{{MType: "gauge", Name: "gauge1"}, {MType: "gauge", Name: "gauge2"}}, names)
+
+	histories, err := ms.GetHistories(append(names, models.HistoryKey{MType: "counter", Name: "counter1"}), time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+	assert.Equal(t, 1.5, histories[models.HistoryKey{MType: "gauge", Name: "gauge1"}][0].Value)
+	assert.Empty(t, histories[models.HistoryKey{MType: "gauge", Name: "gauge2"}])
+	assert.Empty(t, histories[models.HistoryKey{MType: "counter", Name: "counter1"}])
+
+	require.NoError(t, ms.PruneHistory([]models.HistoryCutoff{
+		{Before: time.Now().Add(time.Minute), MType: "gauge", Name: "gauge1"},
+		{Before: start.Add(time.Minute), MType: "gauge", Name: "gauge2", Resolution: time.Minute},
+	}))
+	samples, err := ms.GetHistory("gauge", "gauge1", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	rollups, err = ms.GetRollups("gauge", "gauge2", time.Minute, time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.Rollup{{Timestamp: start.Add(time.Minute), Count: 2, Avg: 3}}, rollups)
+
+	require.NoError(t, ms.PruneHistory([]models.HistoryCutoff{
+		{Before: start.Add(time.Hour), MType: "gauge", Name: "gauge2", Resolution: time.Minute},
+	}))
+	names, err = ms.HistoryNames()
+	require.NoError(t, err)
+	assert.Equal(t, []models.HistoryKey{{MType: "gauge", Name: "gauge1"}}, names)
+}
@@ -3,6 +3,7 @@ package memory
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/ramil063/gometrics/internal/logger"
 	"github.com/ramil063/gometrics/internal/models"
@@ -13,6 +14,10 @@ type MemStorage struct {
 	Gauges   map[string]models.Gauge
 	Counters map[string]models.Counter
 	mx       sync.RWMutex
+
+	gaugesHistory   map[string]*ring
+	countersHistory map[string]*ring
+	rollups         map[rollupKey][]models.Rollup
 }
 
 // StoreGaugeValue сохранение значения метрики типа Gauge
@@ -84,6 +89,7 @@ func (ms *MemStorage) GetAllCounters() map[string]models.Counter {
 // SetGauge установка значения метрики типа Gauge
 func (ms *MemStorage) SetGauge(name string, value models.Gauge) error {
 	ms.StoreGaugeValue(name, value)
+	ms.storeGaugeSample(name, value)
 	return nil
 }
 
@@ -106,6 +112,7 @@ func (ms *MemStorage) AddCounter(name string, value models.Counter) error {
 		logger.WriteInfoLog("Can't find counter", "AddCounter")
 	}
 	ms.StoreCounterValue(name, oldValue+value)
+	ms.storeCounterSample(name, oldValue+value)
 	return nil
 }
 
@@ -119,3 +126,91 @@ func (ms *MemStorage) GetCounter(name string) (int64, error) {
 func (ms *MemStorage) GetCounters() (map[string]models.Counter, error) {
 	return ms.GetAllCounters(), nil
 }
+
+// UpdateBatch сохранение пачки метрик под одной блокировкой,
+// для метрик типа Counter в результат записывается накопленное значение
+func (ms *MemStorage) UpdateBatch(metrics []models.Metrics) ([]models.Metrics, error) {
+	if err := models.ValidateBatch(metrics); err != nil {
+		return nil, err
+	}
+
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if ms.gaugesHistory == nil {
+		ms.gaugesHistory = make(map[string]*ring)
+	}
+	if ms.countersHistory == nil {
+		ms.countersHistory = make(map[string]*ring)
+	}
+
+	result := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		current := m
+		key := current.Key()
+
+		switch current.MType {
+		case "gauge":
+			ms.Gauges[key] = models.Gauge(*current.Value)
+			storeSample(ms.gaugesHistory, key, *current.Value)
+		case "counter":
+			total := int64(ms.Counters[key]) + *current.Delta
+			ms.Counters[key] = models.Counter(total)
+			storeSample(ms.countersHistory, key, float64(total))
+			current.Delta = &total
+		}
+		result = append(result, current)
+	}
+	return result, nil
+}
+
+// GetHistory получение истории значений метрики за период
+func (ms *MemStorage) GetHistory(mType string, name string, from, to time.Time) ([]models.Sample, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+
+	history, err := ms.history(mType)
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := history[name]
+	if !ok {
+		return []models.Sample{}, nil
+	}
+	return r.between(from, to), nil
+}
+
+// storeGaugeSample сохранение значения метрики типа Gauge в историю
+func (ms *MemStorage) storeGaugeSample(key string, value models.Gauge) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if ms.gaugesHistory == nil {
+		ms.gaugesHistory = make(map[string]*ring)
+	}
+	storeSample(ms.gaugesHistory, key, float64(value))
+}
+
+// storeCounterSample сохранение значения метрики типа Counter в историю
+func (ms *MemStorage) storeCounterSample(key string, value models.Counter) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+
+	if ms.countersHistory == nil {
+		ms.countersHistory = make(map[string]*ring)
+	}
+	storeSample(ms.countersHistory, key, float64(value))
+}
+
+func storeSample(history map[string]*ring, key string, value float64) {
+	r, ok := history[key]
+	if !ok {
+		r = newRing(HistoryLimit)
+		history[key] = r
+	}
+	r.push(models.Sample{
+		Timestamp: time.Now(),
+		Value:     value,
+	})
+}
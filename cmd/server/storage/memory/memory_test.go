@@ -501,3 +501,59 @@ func TestMemStorage_StoreGaugeValue(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_UpdateBatch(t *testing.T) {
+	gauge := 1.5
+	delta1, delta2 := int64(2), int64(3)
+
+	tests := []struct {
+		name         string
+		metrics      []models.Metrics
+		wantErr      bool
+		wantGauges   map[string]models.Gauge
+		wantCounters map[string]models.Counter
+		wantDeltas   []int64
+	}{
+		{
+			name: "apply batch",
+			metrics: []models.Metrics{
+				{ID: "cpu", MType: "gauge", Value: &gauge},
+				{ID: "PollCount", MType: "counter", Delta: &delta1},
+				{ID: "PollCount", MType: "counter", Delta: &delta2},
+			},
+			wantGauges:   map[string]models.Gauge{"cpu": 1.5},
+			wantCounters: map[string]models.Counter{"PollCount": 6},
+			wantDeltas:   []int64{3, 6},
+		},
+		{
+			name: "invalid metric leaves storage untouched",
+			metrics: []models.Metrics{
+				{ID: "cpu", MType: "gauge", Value: &gauge},
+				{ID: "PollCount", MType: "counter"},
+			},
+			wantErr:      true,
+			wantGauges:   map[string]models.Gauge{},
+			wantCounters: map[string]models.Counter{"PollCount": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &MemStorage{
+				Gauges:   map[string]models.Gauge{},
+				Counters: map[string]models.Counter{"PollCount": 1},
+			}
+			got, err := ms.UpdateBatch(tt.metrics)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, got, len(tt.metrics))
+				assert.Equal(t, tt.wantDeltas[0], *got[1].Delta)
+				assert.Equal(t, tt.wantDeltas[1], *got[2].Delta)
+				assert.Equal(t, delta1, *tt.metrics[1].Delta, "input batch must not be modified")
+			}
+			assert.Equal(t, tt.wantGauges, ms.Gauges)
+			assert.Equal(t, tt.wantCounters, ms.Counters)
+		})
+	}
+}
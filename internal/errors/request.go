@@ -11,6 +11,8 @@ type RequestError struct {
 	Time       time.Time
 	StatusCode int
 	Err        error
+	// RetryAfter через сколько сервер разрешил повторить запрос, отклоненный из-за ограничения частоты
+	RetryAfter time.Duration
 }
 
 func (e *RequestError) Error() string {
@@ -29,3 +31,14 @@ func NewRequestError(status string, statusCode int) error {
 		Err:        errors.New(status),
 	}
 }
+
+// NewRetryAfterError записывает ошибку err в тип RequestError c текущим временем, статусом
+// и паузой, которую сервер попросил выдержать перед повтором.
+func NewRetryAfterError(status string, statusCode int, retryAfter time.Duration) error {
+	return &RequestError{
+		Time:       time.Now(),
+		StatusCode: statusCode,
+		Err:        errors.New(status),
+		RetryAfter: retryAfter,
+	}
+}
@@ -134,3 +134,15 @@ func TestRequestError_Unwrap(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRetryAfterError(t *testing.T) {
+	err := NewRetryAfterError("429 Too Many Requests", http.StatusTooManyRequests, 3*time.Second)
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("NewRetryAfterError() = %T, want *RequestError", err)
+	}
+	if reqErr.StatusCode != http.StatusTooManyRequests || reqErr.RetryAfter != 3*time.Second {
+		t.Errorf("NewRetryAfterError() = %+v", reqErr)
+	}
+}
@@ -0,0 +1,5 @@
+package metrics
+
+// AppliedBatchesMetadataKey ключ трейлера потока StreamUpdates с количеством пачек,
+// которые сервер успел сохранить до закрытия потока
+const AppliedBatchesMetadataKey = "x-applied-batches"
@@ -73,6 +73,7 @@ type Metric struct {
 	Type          Metric_MetricType      `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_MetricType" json:"type,omitempty"`
 	Delta         int64                  `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
 	Value         float64                `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -135,10 +136,25 @@ func (x *Metric) GetValue() float64 {
 	return 0
 }
 
+func (x *Metric) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
 type ListMetricsRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
 	CryptoMetrics []byte                 `protobuf:"bytes,2,opt,name=cryptoMetrics,proto3" json:"cryptoMetrics,omitempty"`
+	// hashsha256 хеш пачки для потоковой передачи, где метаданные общие на весь поток
+	Hashsha256 string `protobuf:"bytes,3,opt,name=hashsha256,proto3" json:"hashsha256,omitempty"`
+	// keyId идентификатор ключа, которым зашифрованы cryptoMetrics, передается в каждом сообщении потока
+	KeyId string `protobuf:"bytes,4,opt,name=keyId,proto3" json:"keyId,omitempty"`
+	// timestamp время подписи пачки в секундах unix, входит в хеш, передается в каждом сообщении потока
+	Timestamp int64 `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// nonce одноразовое значение пачки, входит в хеш, передается в каждом сообщении потока
+	Nonce         string `protobuf:"bytes,6,opt,name=nonce,proto3" json:"nonce,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -187,6 +203,34 @@ func (x *ListMetricsRequest) GetCryptoMetrics() []byte {
 	return nil
 }
 
+func (x *ListMetricsRequest) GetHashsha256() string {
+	if x != nil {
+		return x.Hashsha256
+	}
+	return ""
+}
+
+func (x *ListMetricsRequest) GetKeyId() string {
+	if x != nil {
+		return x.KeyId
+	}
+	return ""
+}
+
+func (x *ListMetricsRequest) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *ListMetricsRequest) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
 type ListMetricsResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
@@ -247,29 +291,679 @@ func (x *ListMetricsResponse) GetCryptoMetrics() []byte {
 	return nil
 }
 
+type MetricsFilter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ids имена метрик, пустой список - все метрики
+	Ids []string `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	// types типы метрик, пустой список - все типы
+	Types []Metric_MetricType `protobuf:"varint,2,rep,packed,name=types,proto3,enum=metrics.Metric_MetricType" json:"types,omitempty"`
+	// labels селектор меток в формате {host="a",env=~"prod.*"}
+	Labels        string `protobuf:"bytes,3,opt,name=labels,proto3" json:"labels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricsFilter) Reset() {
+	*x = MetricsFilter{}
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricsFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricsFilter) ProtoMessage() {}
+
+func (x *MetricsFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricsFilter.ProtoReflect.Descriptor instead.
+func (*MetricsFilter) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MetricsFilter) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *MetricsFilter) GetTypes() []Metric_MetricType {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *MetricsFilter) GetLabels() string {
+	if x != nil {
+		return x.Labels
+	}
+	return ""
+}
+
+type GetMetricRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type  Metric_MetricType      `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_MetricType" json:"type,omitempty"`
+	// labels селектор меток, как параметр labels у /value
+	Labels        string `protobuf:"bytes,3,opt,name=labels,proto3" json:"labels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricRequest) Reset() {
+	*x = GetMetricRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricRequest) ProtoMessage() {}
+
+func (x *GetMetricRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetMetricRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetMetricRequest) GetType() Metric_MetricType {
+	if x != nil {
+		return x.Type
+	}
+	return Metric_gauge
+}
+
+func (x *GetMetricRequest) GetLabels() string {
+	if x != nil {
+		return x.Labels
+	}
+	return ""
+}
+
+type ListStoredMetricsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// prefix начало имени метрики, пустая строка - все метрики
+	Prefix string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// types типы метрик, пустой список - все типы
+	Types []Metric_MetricType `protobuf:"varint,2,rep,packed,name=types,proto3,enum=metrics.Metric_MetricType" json:"types,omitempty"`
+	// pageSize размер страницы, 0 - размер по умолчанию
+	PageSize int32 `protobuf:"varint,3,opt,name=pageSize,proto3" json:"pageSize,omitempty"`
+	// pageToken значение nextPageToken предыдущей страницы
+	PageToken     string `protobuf:"bytes,4,opt,name=pageToken,proto3" json:"pageToken,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStoredMetricsRequest) Reset() {
+	*x = ListStoredMetricsRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStoredMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStoredMetricsRequest) ProtoMessage() {}
+
+func (x *ListStoredMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStoredMetricsRequest.ProtoReflect.Descriptor instead.
+func (*ListStoredMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListStoredMetricsRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ListStoredMetricsRequest) GetTypes() []Metric_MetricType {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *ListStoredMetricsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListStoredMetricsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListStoredMetricsResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Metrics []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// nextPageToken пустой на последней странице
+	NextPageToken string `protobuf:"bytes,2,opt,name=nextPageToken,proto3" json:"nextPageToken,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStoredMetricsResponse) Reset() {
+	*x = ListStoredMetricsResponse{}
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStoredMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStoredMetricsResponse) ProtoMessage() {}
+
+func (x *ListStoredMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStoredMetricsResponse.ProtoReflect.Descriptor instead.
+func (*ListStoredMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListStoredMetricsResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *ListStoredMetricsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type GetMetricsBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*GetMetricRequest    `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsBatchRequest) Reset() {
+	*x = GetMetricsBatchRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsBatchRequest) ProtoMessage() {}
+
+func (x *GetMetricsBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsBatchRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricsBatchRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetMetricsBatchRequest) GetMetrics() []*GetMetricRequest {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+type GetMetricsBatchResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Metrics []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// notFound запросы, для которых метрика не найдена
+	NotFound      []*GetMetricRequest `protobuf:"bytes,2,rep,name=notFound,proto3" json:"notFound,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsBatchResponse) Reset() {
+	*x = GetMetricsBatchResponse{}
+	mi := &file_proto_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsBatchResponse) ProtoMessage() {}
+
+func (x *GetMetricsBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsBatchResponse.ProtoReflect.Descriptor instead.
+func (*GetMetricsBatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetMetricsBatchResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *GetMetricsBatchResponse) GetNotFound() []*GetMetricRequest {
+	if x != nil {
+		return x.NotFound
+	}
+	return nil
+}
+
+type QueryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// query выражение языка запросов, как параметр query у /query
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// time момент мгновенного запроса в секундах unix, 0 - текущее время
+	Time int64 `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	// start начало запроса по диапазону в секундах unix, 0 - мгновенный запрос
+	Start int64 `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
+	// end конец запроса по диапазону в секундах unix, 0 - текущее время
+	End int64 `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	// step шаг запроса по диапазону в секундах, 0 - шаг по умолчанию
+	Step          int64 `protobuf:"varint,5,opt,name=step,proto3" json:"step,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *QueryRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetStart() int64 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetEnd() int64 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetStep() int64 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+type QueryPoint struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// timestamp момент вычисления в секундах unix
+	Timestamp     int64   `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Value         float64 `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryPoint) Reset() {
+	*x = QueryPoint{}
+	mi := &file_proto_metrics_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryPoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryPoint) ProtoMessage() {}
+
+func (x *QueryPoint) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryPoint.ProtoReflect.Descriptor instead.
+func (*QueryPoint) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *QueryPoint) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *QueryPoint) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+type QuerySeries struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name и type не заполняются у агрегированных рядов
+	Name          string            `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string            `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Labels        map[string]string `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Points        []*QueryPoint     `protobuf:"bytes,4,rep,name=points,proto3" json:"points,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QuerySeries) Reset() {
+	*x = QuerySeries{}
+	mi := &file_proto_metrics_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QuerySeries) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QuerySeries) ProtoMessage() {}
+
+func (x *QuerySeries) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QuerySeries.ProtoReflect.Descriptor instead.
+func (*QuerySeries) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *QuerySeries) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *QuerySeries) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *QuerySeries) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *QuerySeries) GetPoints() []*QueryPoint {
+	if x != nil {
+		return x.Points
+	}
+	return nil
+}
+
+type QueryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Series        []*QuerySeries         `protobuf:"bytes,1,rep,name=series,proto3" json:"series,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryResponse) Reset() {
+	*x = QueryResponse{}
+	mi := &file_proto_metrics_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryResponse) ProtoMessage() {}
+
+func (x *QueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryResponse.ProtoReflect.Descriptor instead.
+func (*QueryResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *QueryResponse) GetSeries() []*QuerySeries {
+	if x != nil {
+		return x.Series
+	}
+	return nil
+}
+
 var File_proto_metrics_proto protoreflect.FileDescriptor
 
 const file_proto_metrics_proto_rawDesc = "" +
 	"\n" +
-	"\x13proto/metrics.proto\x12\ametrics\"\x9a\x01\n" +
+	"\x13proto/metrics.proto\x12\ametrics\"\x8a\x02\n" +
 	"\x06Metric\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12.\n" +
 	"\x04type\x18\x02 \x01(\x0e2\x1a.metrics.Metric.MetricTypeR\x04type\x12\x14\n" +
 	"\x05delta\x18\x03 \x01(\x03R\x05delta\x12\x14\n" +
-	"\x05value\x18\x04 \x01(\x01R\x05value\"$\n" +
+	"\x05value\x18\x04 \x01(\x01R\x05value\x123\n" +
+	"\x06labels\x18\x05 \x03(\v2\x1b.metrics.Metric.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"$\n" +
 	"\n" +
 	"MetricType\x12\t\n" +
 	"\x05gauge\x10\x00\x12\v\n" +
-	"\acounter\x10\x01\"e\n" +
+	"\acounter\x10\x01\"\xcf\x01\n" +
 	"\x12ListMetricsRequest\x12)\n" +
 	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12$\n" +
-	"\rcryptoMetrics\x18\x02 \x01(\fR\rcryptoMetrics\"|\n" +
+	"\rcryptoMetrics\x18\x02 \x01(\fR\rcryptoMetrics\x12\x1e\n" +
+	"\n" +
+	"hashsha256\x18\x03 \x01(\tR\n" +
+	"hashsha256\x12\x14\n" +
+	"\x05keyId\x18\x04 \x01(\tR\x05keyId\x12\x1c\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12\x14\n" +
+	"\x05nonce\x18\x06 \x01(\tR\x05nonce\"|\n" +
 	"\x13ListMetricsResponse\x12)\n" +
 	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12\x14\n" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12$\n" +
-	"\rcryptoMetrics\x18\x03 \x01(\fR\rcryptoMetrics2U\n" +
+	"\rcryptoMetrics\x18\x03 \x01(\fR\rcryptoMetrics\"k\n" +
+	"\rMetricsFilter\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\x120\n" +
+	"\x05types\x18\x02 \x03(\x0e2\x1a.metrics.Metric.MetricTypeR\x05types\x12\x16\n" +
+	"\x06labels\x18\x03 \x01(\tR\x06labels\"j\n" +
+	"\x10GetMetricRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12.\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x1a.metrics.Metric.MetricTypeR\x04type\x12\x16\n" +
+	"\x06labels\x18\x03 \x01(\tR\x06labels\"\x9e\x01\n" +
+	"\x18ListStoredMetricsRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x120\n" +
+	"\x05types\x18\x02 \x03(\x0e2\x1a.metrics.Metric.MetricTypeR\x05types\x12\x1a\n" +
+	"\bpageSize\x18\x03 \x01(\x05R\bpageSize\x12\x1c\n" +
+	"\tpageToken\x18\x04 \x01(\tR\tpageToken\"l\n" +
+	"\x19ListStoredMetricsResponse\x12)\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12$\n" +
+	"\rnextPageToken\x18\x02 \x01(\tR\rnextPageToken\"M\n" +
+	"\x16GetMetricsBatchRequest\x123\n" +
+	"\ametrics\x18\x01 \x03(\v2\x19.metrics.GetMetricRequestR\ametrics\"{\n" +
+	"\x17GetMetricsBatchResponse\x12)\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x125\n" +
+	"\bnotFound\x18\x02 \x03(\v2\x19.metrics.GetMetricRequestR\bnotFound\"t\n" +
+	"\fQueryRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x12\n" +
+	"\x04time\x18\x02 \x01(\x03R\x04time\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\x03R\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\x03R\x03end\x12\x12\n" +
+	"\x04step\x18\x05 \x01(\x03R\x04step\"@\n" +
+	"\n" +
+	"QueryPoint\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\"\xd7\x01\n" +
+	"\vQuerySeries\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x128\n" +
+	"\x06labels\x18\x03 \x03(\v2 .metrics.QuerySeries.LabelsEntryR\x06labels\x12+\n" +
+	"\x06points\x18\x04 \x03(\v2\x13.metrics.QueryPointR\x06points\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"=\n" +
+	"\rQueryResponse\x12,\n" +
+	"\x06series\x18\x01 \x03(\v2\x14.metrics.QuerySeriesR\x06series2\xfb\x03\n" +
 	"\aMetrics\x12J\n" +
-	"\rUpdateMetrics\x12\x1b.metrics.ListMetricsRequest\x1a\x1c.metrics.ListMetricsResponseB\x0eZ\fgrpc/metricsb\x06proto3"
+	"\rUpdateMetrics\x12\x1b.metrics.ListMetricsRequest\x1a\x1c.metrics.ListMetricsResponse\x12L\n" +
+	"\rStreamUpdates\x12\x1b.metrics.ListMetricsRequest\x1a\x1c.metrics.ListMetricsResponse(\x01\x129\n" +
+	"\fWatchMetrics\x12\x16.metrics.MetricsFilter\x1a\x0f.metrics.Metric0\x01\x127\n" +
+	"\tGetMetric\x12\x19.metrics.GetMetricRequest\x1a\x0f.metrics.Metric\x12T\n" +
+	"\vListMetrics\x12!.metrics.ListStoredMetricsRequest\x1a\".metrics.ListStoredMetricsResponse\x12T\n" +
+	"\x0fGetMetricsBatch\x12\x1f.metrics.GetMetricsBatchRequest\x1a .metrics.GetMetricsBatchResponse\x126\n" +
+	"\x05Query\x12\x15.metrics.QueryRequest\x1a\x16.metrics.QueryResponseB\x0eZ\fgrpc/metricsb\x06proto3"
 
 var (
 	file_proto_metrics_proto_rawDescOnce sync.Once
@@ -284,24 +978,59 @@ func file_proto_metrics_proto_rawDescGZIP() []byte {
 }
 
 var file_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
 var file_proto_metrics_proto_goTypes = []any{
-	(Metric_MetricType)(0),      // 0: metrics.Metric.MetricType
-	(*Metric)(nil),              // 1: metrics.Metric
-	(*ListMetricsRequest)(nil),  // 2: metrics.ListMetricsRequest
-	(*ListMetricsResponse)(nil), // 3: metrics.ListMetricsResponse
+	(Metric_MetricType)(0),            // 0: metrics.Metric.MetricType
+	(*Metric)(nil),                    // 1: metrics.Metric
+	(*ListMetricsRequest)(nil),        // 2: metrics.ListMetricsRequest
+	(*ListMetricsResponse)(nil),       // 3: metrics.ListMetricsResponse
+	(*MetricsFilter)(nil),             // 4: metrics.MetricsFilter
+	(*GetMetricRequest)(nil),          // 5: metrics.GetMetricRequest
+	(*ListStoredMetricsRequest)(nil),  // 6: metrics.ListStoredMetricsRequest
+	(*ListStoredMetricsResponse)(nil), // 7: metrics.ListStoredMetricsResponse
+	(*GetMetricsBatchRequest)(nil),    // 8: metrics.GetMetricsBatchRequest
+	(*GetMetricsBatchResponse)(nil),   // 9: metrics.GetMetricsBatchResponse
+	(*QueryRequest)(nil),              // 10: metrics.QueryRequest
+	(*QueryPoint)(nil),                // 11: metrics.QueryPoint
+	(*QuerySeries)(nil),               // 12: metrics.QuerySeries
+	(*QueryResponse)(nil),             // 13: metrics.QueryResponse
+	nil,                               // 14: metrics.Metric.LabelsEntry
+	nil,                               // 15: metrics.QuerySeries.LabelsEntry
 }
 var file_proto_metrics_proto_depIdxs = []int32{
-	0, // 0: metrics.Metric.type:type_name -> metrics.Metric.MetricType
-	1, // 1: metrics.ListMetricsRequest.metrics:type_name -> metrics.Metric
-	1, // 2: metrics.ListMetricsResponse.metrics:type_name -> metrics.Metric
-	2, // 3: metrics.Metrics.UpdateMetrics:input_type -> metrics.ListMetricsRequest
-	3, // 4: metrics.Metrics.UpdateMetrics:output_type -> metrics.ListMetricsResponse
-	4, // [4:5] is the sub-list for method output_type
-	3, // [3:4] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	0,  // 0: metrics.Metric.type:type_name -> metrics.Metric.MetricType
+	14, // 1: metrics.Metric.labels:type_name -> metrics.Metric.LabelsEntry
+	1,  // 2: metrics.ListMetricsRequest.metrics:type_name -> metrics.Metric
+	1,  // 3: metrics.ListMetricsResponse.metrics:type_name -> metrics.Metric
+	0,  // 4: metrics.MetricsFilter.types:type_name -> metrics.Metric.MetricType
+	0,  // 5: metrics.GetMetricRequest.type:type_name -> metrics.Metric.MetricType
+	0,  // 6: metrics.ListStoredMetricsRequest.types:type_name -> metrics.Metric.MetricType
+	1,  // 7: metrics.ListStoredMetricsResponse.metrics:type_name -> metrics.Metric
+	5,  // 8: metrics.GetMetricsBatchRequest.metrics:type_name -> metrics.GetMetricRequest
+	1,  // 9: metrics.GetMetricsBatchResponse.metrics:type_name -> metrics.Metric
+	5,  // 10: metrics.GetMetricsBatchResponse.notFound:type_name -> metrics.GetMetricRequest
+	15, // 11: metrics.QuerySeries.labels:type_name -> metrics.QuerySeries.LabelsEntry
+	11, // 12: metrics.QuerySeries.points:type_name -> metrics.QueryPoint
+	12, // 13: metrics.QueryResponse.series:type_name -> metrics.QuerySeries
+	2,  // 14: metrics.Metrics.UpdateMetrics:input_type -> metrics.ListMetricsRequest
+	2,  // 15: metrics.Metrics.StreamUpdates:input_type -> metrics.ListMetricsRequest
+	4,  // 16: metrics.Metrics.WatchMetrics:input_type -> metrics.MetricsFilter
+	5,  // 17: metrics.Metrics.GetMetric:input_type -> metrics.GetMetricRequest
+	6,  // 18: metrics.Metrics.ListMetrics:input_type -> metrics.ListStoredMetricsRequest
+	8,  // 19: metrics.Metrics.GetMetricsBatch:input_type -> metrics.GetMetricsBatchRequest
+	10, // 20: metrics.Metrics.Query:input_type -> metrics.QueryRequest
+	3,  // 21: metrics.Metrics.UpdateMetrics:output_type -> metrics.ListMetricsResponse
+	3,  // 22: metrics.Metrics.StreamUpdates:output_type -> metrics.ListMetricsResponse
+	1,  // 23: metrics.Metrics.WatchMetrics:output_type -> metrics.Metric
+	1,  // 24: metrics.Metrics.GetMetric:output_type -> metrics.Metric
+	7,  // 25: metrics.Metrics.ListMetrics:output_type -> metrics.ListStoredMetricsResponse
+	9,  // 26: metrics.Metrics.GetMetricsBatch:output_type -> metrics.GetMetricsBatchResponse
+	13, // 27: metrics.Metrics.Query:output_type -> metrics.QueryResponse
+	21, // [21:28] is the sub-list for method output_type
+	14, // [14:21] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
 }
 
 func init() { file_proto_metrics_proto_init() }
@@ -315,7 +1044,7 @@ func file_proto_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   3,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -0,0 +1,26 @@
+package hash
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+)
+
+// CreateMetricsSha256 создаем хеш пачки gRPC метрик, сериализация детерминированная,
+// чтобы порядок меток не влиял на хеш на агенте и сервере
+func CreateMetricsSha256(metrics []*pb.Metric, key string) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pb.ListMetricsRequest{Metrics: metrics})
+	if err != nil {
+		return "", err
+	}
+	return CreateSha256(body, key), nil
+}
+
+// CreateSignedMetricsSha256 подпись пачки gRPC метрик вместе со временем и одноразовым значением
+func CreateSignedMetricsSha256(metrics []*pb.Metric, key string, timestamp string, nonce string) (string, error) {
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pb.ListMetricsRequest{Metrics: metrics})
+	if err != nil {
+		return "", err
+	}
+	return CreateSignedSha256(body, key, timestamp, nonce), nil
+}
@@ -0,0 +1,177 @@
+package hash
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TimestampHeader http заголовок со временем подписи запроса в секундах unix
+	TimestampHeader = "X-Timestamp"
+	// NonceHeader http заголовок с одноразовым значением запроса
+	NonceHeader = "X-Nonce"
+	// TimestampMetadataKey ключ метаданных gRPC со временем подписи
+	TimestampMetadataKey = "x-timestamp"
+	// NonceMetadataKey ключ метаданных gRPC с одноразовым значением
+	NonceMetadataKey = "x-nonce"
+
+	// DefaultReplayWindow допустимое расхождение времени подписи и времени сервера
+	DefaultReplayWindow = 5 * time.Minute
+	// DefaultNonceCacheSize сколько одноразовых значений помнит сервер
+	DefaultNonceCacheSize = 100000
+	// nonceSize размер одноразового значения в байтах до кодирования в hex
+	nonceSize = 16
+	// maxNonceLen максимальная длина одноразового значения, длиннее не запоминаем
+	maxNonceLen = 64
+)
+
+var (
+	// ErrMissingNonce не передано время подписи или одноразовое значение
+	ErrMissingNonce = errors.New("timestamp and nonce are required")
+	// ErrStaleRequest время подписи вне допустимого окна
+	ErrStaleRequest = errors.New("request is stale")
+	// ErrReplayedRequest запрос с таким одноразовым значением уже был
+	ErrReplayedRequest = errors.New("request is replayed")
+)
+
+// DefaultReplayGuard защита от повтора запросов HTTP и gRPC серверов
+var DefaultReplayGuard = NewReplayGuard(DefaultReplayWindow, DefaultNonceCacheSize)
+
+// NewNonce случайное одноразовое значение для подписи запроса
+func NewNonce() string {
+	b := make([]byte, nonceSize)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CreateSignedSha256 подпись тела вместе со временем и одноразовым значением,
+// так перехваченный запрос нельзя повторить с другим временем или значением
+func CreateSignedSha256(body []byte, key string, timestamp string, nonce string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(timestamp))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(nonce))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReplayGuard отклоняет устаревшие и повторные запросы, помнит ограниченное число одноразовых значений
+type ReplayGuard struct {
+	seen map[string]*list.Element
+	// order значения в порядке времени подписи
+	order    *list.List
+	floor    time.Time
+	now      func() time.Time
+	window   time.Duration
+	capacity int
+	mx       sync.Mutex
+}
+
+// seenNonce одноразовое значение и время подписи запроса
+type seenNonce struct {
+	signedAt time.Time
+	nonce    string
+}
+
+// NewReplayGuard создает защиту от повтора с окном window и кэшем на capacity значений
+func NewReplayGuard(window time.Duration, capacity int) *ReplayGuard {
+	return &ReplayGuard{
+		seen:     make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+		window:   window,
+		capacity: capacity,
+	}
+}
+
+// Check проверяет время подписи и одноразовое значение и запоминает его,
+// вызывается после проверки подписи, чтобы чужие запросы не вытесняли значения из кэша
+func (g *ReplayGuard) Check(timestamp string, nonce string) error {
+	if timestamp == "" || nonce == "" || len(nonce) > maxNonceLen {
+		return ErrMissingNonce
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrMissingNonce, timestamp)
+	}
+	signedAt := time.Unix(seconds, 0)
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	now := g.now()
+	if signedAt.Before(now.Add(-g.window)) || signedAt.After(now.Add(g.window)) {
+		return ErrStaleRequest
+	}
+	// значения из окна, вытесненные при переполнении кэша, проверить нельзя,
+	// поэтому запросы не новее вытесненных отклоняются как устаревшие
+	if !signedAt.After(g.floor) {
+		return ErrStaleRequest
+	}
+
+	g.expire(now)
+	if _, ok := g.seen[nonce]; ok {
+		return ErrReplayedRequest
+	}
+	if g.order.Len() >= g.capacity {
+		g.evictOldestSecond()
+	}
+	g.seen[nonce] = g.insert(seenNonce{signedAt: signedAt, nonce: nonce})
+	return nil
+}
+
+// insert добавляет значение, сохраняя порядок по времени подписи, вызывается под мьютексом
+func (g *ReplayGuard) insert(entry seenNonce) *list.Element {
+	for e := g.order.Back(); e != nil; e = e.Prev() {
+		if !e.Value.(seenNonce).signedAt.After(entry.signedAt) {
+			return g.order.InsertAfter(entry, e)
+		}
+	}
+	return g.order.PushFront(entry)
+}
+
+// Len количество запомненных значений
+func (g *ReplayGuard) Len() int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	return g.order.Len()
+}
+
+// expire удаляет значения, время подписи которых вышло из окна, вызывается под мьютексом
+func (g *ReplayGuard) expire(now time.Time) {
+	for e := g.order.Front(); e != nil; e = g.order.Front() {
+		entry := e.Value.(seenNonce)
+		if !entry.signedAt.Before(now.Add(-g.window)) {
+			return
+		}
+		g.order.Remove(e)
+		delete(g.seen, entry.nonce)
+	}
+}
+
+// evictOldestSecond вытесняет все значения с самым ранним временем подписи и поднимает до него
+// нижнюю границу, так отклоняются только запросы, подписанные не позже самой старой секунды в кэше,
+// вызывается под мьютексом
+func (g *ReplayGuard) evictOldestSecond() {
+	oldest := g.order.Front()
+	if oldest == nil {
+		return
+	}
+	signedAt := oldest.Value.(seenNonce).signedAt
+	for e := g.order.Front(); e != nil && e.Value.(seenNonce).signedAt.Equal(signedAt); e = g.order.Front() {
+		g.order.Remove(e)
+		delete(g.seen, e.Value.(seenNonce).nonce)
+	}
+	if signedAt.After(g.floor) {
+		g.floor = signedAt
+	}
+}
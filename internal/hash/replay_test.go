@@ -0,0 +1,129 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
+)
+
+// unixString время в формате заголовка
+func unixString(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestCreateSignedSha256(t *testing.T) {
+	signed := CreateSignedSha256([]byte("body"), "key", "100", "nonce")
+
+	assert.Equal(t, signed, CreateSignedSha256([]byte("body"), "key", "100", "nonce"))
+	assert.NotEqual(t, signed, CreateSignedSha256([]byte("body"), "key", "101", "nonce"))
+	assert.NotEqual(t, signed, CreateSignedSha256([]byte("body"), "key", "100", "other"))
+	assert.NotEqual(t, signed, CreateSignedSha256([]byte("other"), "key", "100", "nonce"))
+	assert.NotEqual(t, signed, CreateSha256([]byte("body"), "key"))
+}
+
+func TestCreateSignedMetricsSha256(t *testing.T) {
+	metrics := []*pb.Metric{{Id: "cpu", Value: 1.5, Labels: map[string]string{"host": "a", "env": "prod"}}}
+
+	first, err := CreateSignedMetricsSha256(metrics, "key", "100", "nonce")
+	require.NoError(t, err)
+	second, err := CreateSignedMetricsSha256(metrics, "key", "100", "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	other, err := CreateSignedMetricsSha256(metrics, "key", "100", "other")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
+
+func TestNewNonce(t *testing.T) {
+	first := NewNonce()
+	assert.Len(t, first, nonceSize*2)
+	assert.NotEqual(t, first, NewNonce())
+}
+
+func TestReplayGuard_Check(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		wantErr   error
+		name      string
+		timestamp string
+		nonce     string
+	}{
+		{name: "fresh request", timestamp: unixString(now), nonce: "n1"},
+		{name: "missing nonce", timestamp: unixString(now), wantErr: ErrMissingNonce},
+		{name: "missing timestamp", nonce: "n1", wantErr: ErrMissingNonce},
+		{name: "bad timestamp", timestamp: "yesterday", nonce: "n1", wantErr: ErrMissingNonce},
+		{name: "too long nonce", timestamp: unixString(now), nonce: string(make([]byte, maxNonceLen+1)), wantErr: ErrMissingNonce},
+		{name: "stale request", timestamp: unixString(now.Add(-time.Hour)), nonce: "n1", wantErr: ErrStaleRequest},
+		{name: "request from future", timestamp: unixString(now.Add(time.Hour)), nonce: "n1", wantErr: ErrStaleRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewReplayGuard(time.Minute, 10)
+			guard.now = func() time.Time { return now }
+
+			err := guard.Check(tt.timestamp, tt.nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, 0, guard.Len())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 1, guard.Len())
+		})
+	}
+}
+
+func TestReplayGuard_Replay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 10)
+	guard.now = func() time.Time { return now }
+
+	require.NoError(t, guard.Check(unixString(now), "n1"))
+	assert.ErrorIs(t, guard.Check(unixString(now), "n1"), ErrReplayedRequest)
+	assert.NoError(t, guard.Check(unixString(now), "n2"))
+
+	// значение вышло из окна и забыто, но запрос с ним уже устарел
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, guard.Check(unixString(now.Add(-2*time.Minute)), "n1"), ErrStaleRequest)
+	assert.NoError(t, guard.Check(unixString(now), "n3"))
+	assert.Equal(t, 1, guard.Len())
+}
+
+func TestReplayGuard_Bounded(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 2)
+	guard.now = func() time.Time { return now }
+
+	require.NoError(t, guard.Check(unixString(now.Add(-30*time.Second)), "n1"))
+	require.NoError(t, guard.Check(unixString(now.Add(-20*time.Second)), "n2"))
+	require.NoError(t, guard.Check(unixString(now), "n3"))
+	assert.Equal(t, 2, guard.Len())
+
+	// n1 вытеснено из кэша, повтор отклоняется по времени подписи
+	assert.ErrorIs(t, guard.Check(unixString(now.Add(-30*time.Second)), "n1"), ErrStaleRequest)
+	assert.ErrorIs(t, guard.Check(unixString(now), "n3"), ErrReplayedRequest)
+}
+
+func TestReplayGuard_EvictsOldestSecond(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 3)
+	guard.now = func() time.Time { return now }
+
+	// запросы приходят не в порядке времени подписи
+	require.NoError(t, guard.Check(unixString(now), "n1"))
+	require.NoError(t, guard.Check(unixString(now.Add(-30*time.Second)), "n2"))
+	require.NoError(t, guard.Check(unixString(now.Add(-30*time.Second)), "n3"))
+
+	// вытесняется вся самая старая секунда, запросы текущей секунды принимаются
+	require.NoError(t, guard.Check(unixString(now), "n4"))
+	assert.Equal(t, 2, guard.Len())
+	require.NoError(t, guard.Check(unixString(now), "n5"))
+	assert.ErrorIs(t, guard.Check(unixString(now.Add(-30*time.Second)), "n2"), ErrStaleRequest)
+	assert.ErrorIs(t, guard.Check(unixString(now), "n1"), ErrReplayedRequest)
+}
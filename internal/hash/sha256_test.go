@@ -4,6 +4,10 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/ramil063/gometrics/internal/grpc/proto"
 )
 
 func TestCreateSha256(t *testing.T) {
@@ -25,3 +29,17 @@ func TestCreateSha256(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateMetricsSha256(t *testing.T) {
+	metrics := []*pb.Metric{
+		{Id: "cpu", Value: 1.5, Labels: map[string]string{"host": "a", "core": "1", "env": "prod"}},
+	}
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pb.ListMetricsRequest{Metrics: metrics})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		got, err := CreateMetricsSha256(metrics, "key")
+		require.NoError(t, err)
+		assert.Equal(t, CreateSha256(body, "key"), got)
+	}
+}
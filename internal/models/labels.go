@@ -0,0 +1,252 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MatchType тип сравнения метки
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher условие отбора метрик по значению метки
+type LabelMatcher struct {
+	re    *regexp.Regexp
+	Name  string
+	Value string
+	Type  MatchType
+}
+
+// keyChars символы, разделяющие части ключа хранения, недопустимы в именах метрик и меток
+const keyChars = `{}"=,`
+
+// ValidateMetricName проверка, что имя метрики не содержит символов ключа хранения
+func ValidateMetricName(name string) error {
+	if strings.ContainsAny(name, keyChars) {
+		return fmt.Errorf("metric name %q must not contain any of %s", name, keyChars)
+	}
+	return nil
+}
+
+// ValidateLabelName проверка имени метки: непустое, без символов ключа хранения, операторов сравнения и пробелов
+func ValidateLabelName(name string) error {
+	if name == "" || strings.ContainsAny(name, keyChars+"!~ \t\r\n") {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	return nil
+}
+
+// ValidateMetricKey проверка имени и меток метрики перед построением ключа хранения,
+// значения меток экранируются в MetricKey и могут содержать любые символы
+func ValidateMetricKey(name string, labels map[string]string) error {
+	if err := ValidateMetricName(name); err != nil {
+		return err
+	}
+	for labelName := range labels {
+		if err := ValidateLabelName(labelName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SortedKeys ключи в алфавитном порядке для стабильного порядка метрик и меток
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricKey ключ хранения метрики вида name{k1="v1",k2="v2"}
+// метки сортируются по имени, без меток ключ совпадает с именем метрики
+func MetricKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, labelName := range SortedKeys(labels) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labelName)
+		b.WriteString(`="`)
+		b.WriteString(EscapeLabelValue(labels[labelName]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseMetricKey разбор ключа хранения на имя и метки
+func ParseMetricKey(key string) (string, map[string]string, error) {
+	idx := strings.IndexByte(key, '{')
+	if idx < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil, nil
+	}
+
+	matchers, err := ParseLabelMatchers(key[idx:])
+	if err != nil {
+		return key, nil, err
+	}
+	labels := make(map[string]string, len(matchers))
+	for _, m := range matchers {
+		if m.Type != MatchEqual {
+			return key, nil, fmt.Errorf("invalid metric key %q", key)
+		}
+		labels[m.Name] = m.Value
+	}
+	return key[:idx], labels, nil
+}
+
+// EscapeLabelValue экранирование значения метки
+func EscapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// NewLabelMatcher создание условия отбора по метке
+func NewLabelMatcher(matchType MatchType, name string, value string) (LabelMatcher, error) {
+	m := LabelMatcher{Name: name, Value: value, Type: matchType}
+	switch matchType {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("invalid regexp for label %s: %w", name, err)
+		}
+		m.re = re
+	default:
+		return m, fmt.Errorf("unknown match type %q", matchType)
+	}
+	return m, nil
+}
+
+// Matches проверка значения метки, отсутствующая метка считается пустой
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// MatchLabels проверка меток по всем условиям
+func MatchLabels(labels map[string]string, matchers []LabelMatcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelMatchers разбор условий вида {host="a",env!="dev",core=~"1|2"}, фигурные скобки необязательны
+func ParseLabelMatchers(input string) ([]LabelMatcher, error) {
+	s := strings.TrimSpace(input)
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return nil, errors.New("unclosed label matchers")
+		}
+		s = s[1 : len(s)-1]
+	}
+
+	matchers := make([]LabelMatcher, 0)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return matchers, nil
+		}
+
+		nameEnd := strings.IndexAny(s, "=!")
+		if nameEnd <= 0 {
+			return nil, fmt.Errorf("invalid label matcher %q", s)
+		}
+		name := strings.TrimSpace(s[:nameEnd])
+		if err := ValidateLabelName(name); err != nil {
+			return nil, err
+		}
+		s = s[nameEnd:]
+
+		var matchType MatchType
+		for _, t := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(s, string(t)) {
+				matchType = t
+				break
+			}
+		}
+		if matchType == "" {
+			return nil, fmt.Errorf("invalid operator for label %s", name)
+		}
+		s = strings.TrimLeft(s[len(matchType):], " ")
+
+		value, rest, err := unquoteLabelValue(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %s: %w", name, err)
+		}
+		m, err := NewLabelMatcher(matchType, name, value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+
+		s = strings.TrimLeft(rest, " ")
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("expected comma after label %s", name)
+			}
+			s = s[1:]
+		}
+	}
+}
+
+// unquoteLabelValue чтение значения метки в двойных кавычках, возвращает остаток строки
+func unquoteLabelValue(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, errors.New("value must be quoted")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", s, errors.New("unterminated escape")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", s, errors.New("unterminated value")
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricKey(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		name   string
+		metric string
+		want   string
+	}{
+		{name: "no labels", metric: "Alloc", want: "Alloc"},
+		{name: "sorted labels", metric: "cpu", labels: map[string]string{"host": "a", "core": "1"}, want: `cpu{core="1",host="a"}`},
+		{name: "escaped value", metric: "m", labels: map[string]string{"path": "a\"b\\c\nd"}, want: `m{path="a\"b\\c\nd"}`},
+		{name: "key chars in value", metric: "m", labels: map[string]string{"a": `x},b="y`, "b": "{=,}"}, want: `m{a="x},b=\"y",b="{=,}"}`},
+		{name: "dotted name", metric: "api.latency", labels: map[string]string{"env": ""}, want: `api.latency{env=""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := MetricKey(tt.metric, tt.labels)
+			assert.Equal(t, tt.want, key)
+
+			name, labels, err := ParseMetricKey(key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.metric, name)
+			if len(tt.labels) == 0 {
+				assert.Empty(t, labels)
+			} else {
+				assert.Equal(t, tt.labels, labels)
+			}
+		})
+	}
+}
+
+func TestParseMetricKey_Invalid(t *testing.T) {
+	_, _, err := ParseMetricKey(`cpu{core!="1"}`)
+	assert.Error(t, err)
+
+	_, _, err = ParseMetricKey(`cpu{core=1}`)
+	assert.Error(t, err)
+
+	_, _, err = ParseMetricKey(`cpu{a{b="1"}`)
+	assert.Error(t, err)
+}
+
+func TestValidateMetricKey(t *testing.T) {
+	tests := []struct {
+		labels  map[string]string
+		name    string
+		metric  string
+		wantErr bool
+	}{
+		{name: "valid", metric: "cpu.usage", labels: map[string]string{"host": "a{b}"}},
+		{name: "brace in name", metric: `cpu{host="a"}`, wantErr: true},
+		{name: "comma in name", metric: "cpu,mem", wantErr: true},
+		{name: "quote in name", metric: `cpu"`, wantErr: true},
+		{name: "equal sign in label name", metric: "cpu", labels: map[string]string{"a=b": "1"}, wantErr: true},
+		{name: "comma in label name", metric: "cpu", labels: map[string]string{"a,b": "1"}, wantErr: true},
+		{name: "space in label name", metric: "cpu", labels: map[string]string{"a b": "1"}, wantErr: true},
+		{name: "empty label name", metric: "cpu", labels: map[string]string{"": "1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMetricKey(tt.metric, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// допустимые имя и метки однозначно восстанавливаются из ключа
+			name, labels, err := ParseMetricKey(MetricKey(tt.metric, tt.labels))
+			require.NoError(t, err)
+			assert.Equal(t, tt.metric, name)
+			assert.Equal(t, tt.labels, labels)
+		})
+	}
+}
+
+func TestMetrics_Key(t *testing.T) {
+	m := Metrics{ID: "cpu", Labels: map[string]string{"core": "0"}}
+	assert.Equal(t, `cpu{core="0"}`, m.Key())
+}
+
+func TestParseLabelMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []LabelMatcher
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: []LabelMatcher{}},
+		{name: "braces only", input: "{}", want: []LabelMatcher{}},
+		{
+			name:  "all operators",
+			input: `{host="a", env!="dev",core=~"1|2",dc!~"eu.*"}`,
+			want: []LabelMatcher{
+				{Name: "host", Value: "a", Type: MatchEqual},
+				{Name: "env", Value: "dev", Type: MatchNotEqual},
+				{Name: "core", Value: "1|2", Type: MatchRegexp},
+				{Name: "dc", Value: "eu.*", Type: MatchNotRegexp},
+			},
+		},
+		{name: "without braces", input: `host="a,b"`, want: []LabelMatcher{{Name: "host", Value: "a,b", Type: MatchEqual}}},
+		{name: "unquoted", input: `host=a`, wantErr: true},
+		{name: "no operator", input: `host`, wantErr: true},
+		{name: "unclosed brace", input: `{host="a"`, wantErr: true},
+		{name: "unterminated value", input: `host="a`, wantErr: true},
+		{name: "missing comma", input: `host="a" env="b"`, wantErr: true},
+		{name: "bad regexp", input: `host=~"("`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabelMatchers(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].Name, got[i].Name)
+				assert.Equal(t, tt.want[i].Value, got[i].Value)
+				assert.Equal(t, tt.want[i].Type, got[i].Type)
+			}
+		})
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"host": "a", "core": "1"}
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "no matchers", input: "", want: true},
+		{name: "equal", input: `host="a"`, want: true},
+		{name: "not equal", input: `host!="a"`, want: false},
+		{name: "regexp anchored", input: `core=~"1|2"`, want: true},
+		{name: "regexp partial", input: `host=~"b|aa"`, want: false},
+		{name: "not regexp", input: `core!~"[2-9]"`, want: true},
+		{name: "missing label is empty", input: `env=""`, want: true},
+		{name: "combined", input: `host="a",core="2"`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers, err := ParseLabelMatchers(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, MatchLabels(labels, matchers))
+		})
+	}
+}
+
+func TestNewLabelMatcher_UnknownType(t *testing.T) {
+	_, err := NewLabelMatcher("<>", "host", "a")
+	assert.Error(t, err)
+}
@@ -1,13 +1,88 @@
 // Package models пакет с моделями
 package models
 
+import (
+	"cmp"
+	"fmt"
+	"time"
+)
+
 type Gauge float64
 type Counter int64
 
 // Metrics описывает метрики
 type Metrics struct {
-	ID    string   `json:"id"`              // Имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // Значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // Значение метрики в случае передачи gauge
+	ID     string            `json:"id"`               // Имя метрики
+	MType  string            `json:"type"`             // параметр, принимающий значение gauge или counter
+	Delta  *int64            `json:"delta,omitempty"`  // Значение метрики в случае передачи counter
+	Value  *float64          `json:"value,omitempty"`  // Значение метрики в случае передачи gauge
+	Labels map[string]string `json:"labels,omitempty"` // Метки метрики (host, core, env и т.д.)
+}
+
+// Key ключ хранения метрики с учетом меток
+func (m Metrics) Key() string {
+	return MetricKey(m.ID, m.Labels)
+}
+
+// Sample значение метрики в момент времени
+// для метрики типа counter хранится накопленное значение счетчика
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`        // Время сохранения значения
+	Value     float64   `json:"value"`            // Значение метрики
+	Rollup    *Rollup   `json:"rollup,omitempty"` // Агрегат, если значение взято из прореженной истории
+}
+
+// Rollup агрегат значений метрики за интервал прореживания
+// для gauge Sum - сумма значений, для counter - прирост счетчика за интервал,
+// Rate - прирост счетчика в секунду, Min, Max, Avg и Last считаются по накопленным значениям
+type Rollup struct {
+	Timestamp time.Time `json:"timestamp"` // Начало интервала
+	Count     int64     `json:"count"`     // Количество исходных значений
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Avg       float64   `json:"avg"`
+	Last      float64   `json:"last"`
+	Sum       float64   `json:"sum"`
+	Rate      float64   `json:"rate"`
+}
+
+// HistoryKey ключ истории метрики: тип и ключ метрики с метками
+type HistoryKey struct {
+	MType string
+	Name  string
+}
+
+// CompareHistoryKeys сравнение ключей истории по типу, затем по имени, для сортировки
+func CompareHistoryKeys(a, b HistoryKey) int {
+	if c := cmp.Compare(a.MType, b.MType); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Name, b.Name)
+}
+
+// HistoryCutoff граница удаления истории метрики: значения до Before удаляются
+// Resolution 0 - сырые значения, иначе агрегаты с этим шагом
+type HistoryCutoff struct {
+	Before     time.Time
+	MType      string
+	Name       string
+	Resolution time.Duration
+}
+
+// ValidateBatch проверка пачки метрик перед атомарным сохранением,
+// у метрики типа gauge должно быть значение, у метрики типа counter - приращение
+func ValidateBatch(metrics []Metrics) error {
+	for _, m := range metrics {
+		switch m.MType {
+		case "gauge":
+			if m.Value == nil {
+				return fmt.Errorf("empty value for gauge %s", m.Key())
+			}
+		case "counter":
+			if m.Delta == nil {
+				return fmt.Errorf("empty delta for counter %s", m.Key())
+			}
+		}
+	}
+	return nil
 }
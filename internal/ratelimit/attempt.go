@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// authAttemptKey ключ попытки проверки агента в контексте
+type authAttemptKey struct{}
+
+// AuthAttempt запрос клиента, ожидающий проверки агента,
+// nil попытка ничего не учитывает
+type AuthAttempt struct {
+	limiter *Limiter
+	key     string
+	pending atomic.Bool
+}
+
+// NewAuthAttempt попытка проверки агента для клиента key
+func (l *Limiter) NewAuthAttempt(key string) *AuthAttempt {
+	if l == nil {
+		return nil
+	}
+	return &AuthAttempt{limiter: l, key: key}
+}
+
+// Start начало проверки очередного запроса, токен клиента не расходуется,
+// если токенов нет - возвращает время до появления следующего и запрос нужно отклонить без проверки
+func (a *AuthAttempt) Start() time.Duration {
+	if a == nil {
+		return 0
+	}
+	if wait := a.limiter.Wait(a.key); wait > 0 {
+		return wait
+	}
+	a.pending.Store(true)
+	return 0
+}
+
+// Pass запрос прошел проверку агента, дальше токен забирает ограничитель агента
+func (a *AuthAttempt) Pass() {
+	if a != nil {
+		a.pending.Store(false)
+	}
+}
+
+// Finish завершение проверки, не прошедший ее запрос забирает токен клиента
+func (a *AuthAttempt) Finish() {
+	if a != nil && a.pending.Swap(false) {
+		a.limiter.Allow(a.key)
+	}
+}
+
+// WithAuthAttempt добавляет попытку проверки агента в контекст
+func WithAuthAttempt(ctx context.Context, a *AuthAttempt) context.Context {
+	return context.WithValue(ctx, authAttemptKey{}, a)
+}
+
+// AuthAttemptFromContext попытка проверки агента из контекста, nil если ее нет
+func AuthAttemptFromContext(ctx context.Context) *AuthAttempt {
+	a, _ := ctx.Value(authAttemptKey{}).(*AuthAttempt)
+	return a
+}
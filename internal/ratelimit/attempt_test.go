@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthAttempt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	// прошедший проверку запрос токен клиента не тратит
+	a := l.NewAuthAttempt("ip:10.0.0.1")
+	assert.Zero(t, a.Start())
+	a.Pass()
+	a.Finish()
+	assert.Zero(t, l.Wait("ip:10.0.0.1"))
+	assert.Zero(t, l.Len())
+
+	// не прошедшие проверку запросы исчерпывают лимит клиента
+	for i := 0; i < 2; i++ {
+		assert.Zero(t, a.Start())
+		a.Finish()
+	}
+	assert.Equal(t, time.Second, a.Start())
+	assert.Equal(t, time.Second, l.Wait("ip:10.0.0.1"))
+	// отклоненный до проверки запрос токен не забирает
+	a.Finish()
+	assert.Equal(t, time.Second, l.Wait("ip:10.0.0.1"))
+
+	now = now.Add(time.Second)
+	assert.Zero(t, a.Start())
+}
+
+func TestAuthAttempt_Disabled(t *testing.T) {
+	var l *Limiter
+	a := l.NewAuthAttempt("ip:10.0.0.1")
+	assert.Nil(t, a)
+	assert.Zero(t, a.Start())
+	a.Pass()
+	a.Finish()
+	assert.Zero(t, l.Wait("ip:10.0.0.1"))
+}
+
+func TestAuthAttemptFromContext(t *testing.T) {
+	assert.Nil(t, AuthAttemptFromContext(context.Background()))
+	a := NewLimiter(1, 1).NewAuthAttempt("ip:10.0.0.1")
+	assert.Same(t, a, AuthAttemptFromContext(WithAuthAttempt(context.Background(), a)))
+}
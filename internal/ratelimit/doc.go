@@ -0,0 +1,11 @@
+// Package ratelimit ограничение частоты запросов клиентов сервера и соблюдение агентом
+// подсказки сервера о том, когда повторить отклоненный запрос.
+//
+// Сервер ведет для каждого клиента (агента или адреса) отдельный token bucket,
+// отклоненный запрос получает ответ 429 с заголовком Retry-After
+// или статус ResourceExhausted с RetryInfo в gRPC.
+//
+// Запросы, которые еще не прошли проверку агента, токен не тратят, но отклоняются,
+// если у клиента токенов не осталось. Не прошедший проверку запрос забирает токен клиента,
+// поэтому поток запросов с неверной подписью исчерпывает лимит и дальше отклоняется без проверки.
+package ratelimit
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ThrottledError статус ResourceExhausted с подсказкой RetryInfo, через сколько повторить запрос
+func ThrottledError(message string, retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, message)
+	if retryAfter <= 0 {
+		return st.Err()
+	}
+	withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// RetryAfterFromError пауза из статуса ResourceExhausted с RetryInfo,
+// false - ошибка не связана с ограничением частоты и повтор через паузу не поможет
+func RetryAfterFromError(err error) (time.Duration, bool) {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return 0, false
+	}
+	st := grpcErr.GRPCStatus()
+	if st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestThrottledError(t *testing.T) {
+	err := ThrottledError("rate limit exceeded", 3*time.Second)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	wait, ok := RetryAfterFromError(fmt.Errorf("SendMetrics error: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+}
+
+func TestRetryAfterFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		name   string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "without retry info", err: status.Error(codes.ResourceExhausted, "too many metrics"), wantOk: false},
+		{name: "other code", err: status.Error(codes.Unavailable, "unavailable"), wantOk: false},
+		{name: "not a status", err: errors.New("plain"), wantOk: false},
+		{name: "nil", err: nil, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := RetryAfterFromError(tt.err)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, wait)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// cleanupInterval как часто удаляются корзины клиентов, которые успели полностью восстановиться
+const cleanupInterval = time.Minute
+
+// DefaultLimiter ограничение частоты запросов HTTP сервера, nil - без ограничения
+var DefaultLimiter *Limiter
+
+// bucket корзина токенов одного клиента
+type bucket struct {
+	last   time.Time
+	tokens float64
+}
+
+// Limiter token bucket для каждого клиента, nil ограничитель пропускает все запросы
+type Limiter struct {
+	buckets     map[string]*bucket
+	now         func() time.Time
+	lastCleanup time.Time
+	rate        float64
+	burst       float64
+	mx          sync.Mutex
+}
+
+// NewLimiter создает ограничитель на rate запросов в секунду с запасом burst запросов,
+// при rate <= 0 возвращает nil, burst <= 0 равен rate
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		rate:    rate,
+		burst:   b,
+	}
+}
+
+// Allow забирает токен клиента key, если токена нет - возвращает время до появления следующего
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Wait время до появления токена клиента key без расхода токена, 0 - токен есть
+func (l *Limiter) Wait(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	tokens := math.Min(l.burst, b.tokens+l.now().Sub(b.last).Seconds()*l.rate)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// Len количество отслеживаемых клиентов
+func (l *Limiter) Len() int {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return len(l.buckets)
+}
+
+// cleanup удаляет корзины, которые уже восстановились до полного запаса, вызывается под мьютексом
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
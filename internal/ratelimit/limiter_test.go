@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLimiter(t *testing.T) {
+	assert.Nil(t, NewLimiter(0, 10))
+	assert.Equal(t, 3.0, NewLimiter(2.5, 0).burst)
+	assert.Equal(t, 10.0, NewLimiter(1, 10).burst)
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.Allow("agent-1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent-1")
+	assert.True(t, ok)
+	ok, wait := l.Allow("agent-1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// у другого клиента своя корзина
+	ok, _ = l.Allow("agent-2")
+	assert.True(t, ok)
+
+	// токены восстанавливаются со временем
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent-1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent-1")
+	assert.False(t, ok)
+}
+
+func TestLimiter_AllowNil(t *testing.T) {
+	var l *Limiter
+	ok, wait := l.Allow("agent-1")
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(1, 1)
+	l.now = func() time.Time { return now }
+
+	l.Allow("agent-1")
+	l.Allow("agent-2")
+	assert.Equal(t, 2, l.Len())
+
+	now = now.Add(2 * cleanupInterval)
+	l.Allow("agent-3")
+	assert.Equal(t, 1, l.Len())
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RetryAfterHeader заголовок с количеством секунд, через которое можно повторить запрос
+const RetryAfterHeader = "Retry-After"
+
+// DefaultRetryAfter пауза, если сервер отклонил запрос без подсказки
+const DefaultRetryAfter = time.Second
+
+// RetryAfterSeconds значение заголовка Retry-After, округляется вверх до целой секунды
+func RetryAfterSeconds(d time.Duration) string {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// ParseRetryAfter разбирает заголовок Retry-After в секундах или в виде даты,
+// пустое или некорректное значение дает DefaultRetryAfter
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return DefaultRetryAfter
+}
+
+// Backoff момент, до которого сервер просил не отправлять запросы, безопасен для горутин
+type Backoff struct {
+	until atomic.Int64
+}
+
+// Set откладывает отправку на d, более ранний момент не сокращает уже назначенную паузу
+func (b *Backoff) Set(d time.Duration) {
+	until := time.Now().Add(d).UnixNano()
+	for {
+		current := b.until.Load()
+		if current >= until || b.until.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
+// Remaining сколько еще нужно ждать до следующей отправки
+func (b *Backoff) Remaining() time.Duration {
+	if d := time.Until(time.Unix(0, b.until.Load())); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Reset снимает паузу
+func (b *Backoff) Reset() {
+	b.until.Store(0)
+}
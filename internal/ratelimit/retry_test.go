@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "1", RetryAfterSeconds(0))
+	assert.Equal(t, "1", RetryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, "3", RetryAfterSeconds(2100*time.Millisecond))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "seconds", value: "5", want: 5 * time.Second},
+		{name: "zero", value: "0", want: 0},
+		{name: "http date", value: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second},
+		{name: "date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "empty", value: "", want: DefaultRetryAfter},
+		{name: "invalid", value: "soon", want: DefaultRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseRetryAfter(tt.value, now))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var b Backoff
+	assert.Zero(t, b.Remaining())
+
+	b.Set(time.Minute)
+	assert.InDelta(t, time.Minute, b.Remaining(), float64(time.Second))
+
+	// более короткая пауза не сокращает назначенную
+	b.Set(time.Second)
+	assert.Greater(t, b.Remaining(), 30*time.Second)
+
+	b.Reset()
+	assert.Zero(t, b.Remaining())
+}
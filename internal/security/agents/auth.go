@@ -0,0 +1,76 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+const (
+	// AgentIDHeader http заголовок с идентификатором агента
+	AgentIDHeader = "X-Agent-ID"
+	// AgentIDMetadataKey ключ метаданных gRPC с идентификатором агента
+	AgentIDMetadataKey = "x-agent-id"
+	// AuthorizationHeader http заголовок с API токеном агента в виде "Bearer <token>"
+	AuthorizationHeader = "Authorization"
+	// AuthorizationMetadataKey ключ метаданных gRPC с API токеном агента
+	AuthorizationMetadataKey = "authorization"
+
+	// bearerPrefix префикс токена в заголовке авторизации
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// ErrMissingAgentID при заданном реестре агент не передал идентификатор
+	ErrMissingAgentID = errors.New("agent id is required")
+	// ErrIdentityMismatch идентификатор агента не совпадает с идентификатором из сертификата
+	ErrIdentityMismatch = errors.New("agent id does not match certificate")
+)
+
+// Authenticate проверяет агента и возвращает ключ, которым должен быть подписан его запрос.
+// Без реестра все агенты используют общий ключ sharedKey. Агенту, предъявившему верный токен,
+// подпись не нужна и возвращается пустой ключ, иначе возвращается ключ подписи агента
+func Authenticate(registry *Registry, sharedKey string, agentID string, token string) (string, error) {
+	if registry == nil {
+		return sharedKey, nil
+	}
+	if agentID == "" {
+		return "", ErrMissingAgentID
+	}
+	if token != "" {
+		return "", registry.CheckToken(agentID, token)
+	}
+	return registry.Secret(agentID)
+}
+
+// BearerToken токен из значения заголовка авторизации, без префикса Bearer токена нет
+func BearerToken(authorization string) string {
+	if len(authorization) < len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(bearerPrefix):])
+}
+
+// Enabled задан ли реестр агентов или общий ключ, то есть нужна ли проверка запросов
+func Enabled(registry *Registry, sharedKey string) bool {
+	return registry != nil || sharedKey != ""
+}
+
+// BindIdentity добавляет идентификатор проверенного агента в контекст, чтобы к нему применялась
+// политика доступа, агент с сертификатом должен передавать идентификатор из сертификата
+func BindIdentity(ctx context.Context, agentID string) (context.Context, error) {
+	if agentID == "" {
+		return ctx, nil
+	}
+	identity, ok := mtls.IdentityFromContext(ctx)
+	if !ok {
+		return mtls.WithIdentity(ctx, agentID), nil
+	}
+	if identity != agentID {
+		return ctx, fmt.Errorf("%w: agent %q, certificate %q", ErrIdentityMismatch, agentID, identity)
+	}
+	return ctx, nil
+}
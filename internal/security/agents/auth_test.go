@@ -0,0 +1,81 @@
+package agents
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/security/mtls"
+)
+
+func TestAuthenticate(t *testing.T) {
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+	credentials, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	_, err = registry.Add("agent-2")
+	require.NoError(t, err)
+	require.NoError(t, registry.Revoke("agent-2"))
+
+	tests := []struct {
+		wantErr  error
+		registry *Registry
+		name     string
+		agentID  string
+		token    string
+		wantKey  string
+	}{
+		{name: "shared key without registry", agentID: "agent-1", wantKey: "shared"},
+		{name: "agent secret", registry: registry, agentID: "agent-1", wantKey: credentials.Secret},
+		{name: "agent token", registry: registry, agentID: "agent-1", token: credentials.Token, wantKey: ""},
+		{name: "wrong token", registry: registry, agentID: "agent-1", token: "wrong", wantErr: ErrInvalidToken},
+		{name: "missing agent id", registry: registry, wantErr: ErrMissingAgentID},
+		{name: "unknown agent", registry: registry, agentID: "agent-3", wantErr: ErrUnknownAgent},
+		{name: "revoked agent", registry: registry, agentID: "agent-2", wantErr: ErrRevokedAgent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Authenticate(tt.registry, "shared", tt.agentID, tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKey, key)
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer abc"))
+	assert.Equal(t, "", BearerToken("Basic abc"))
+	assert.Equal(t, "", BearerToken(""))
+}
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Enabled(nil, ""))
+	assert.True(t, Enabled(nil, "shared"))
+	assert.True(t, Enabled(&Registry{}, ""))
+}
+
+func TestBindIdentity(t *testing.T) {
+	ctx, err := BindIdentity(context.Background(), "agent-1")
+	require.NoError(t, err)
+	identity, _ := mtls.IdentityFromContext(ctx)
+	assert.Equal(t, "agent-1", identity)
+
+	certCtx := mtls.WithIdentity(context.Background(), "agent-1")
+	_, err = BindIdentity(certCtx, "agent-1")
+	assert.NoError(t, err)
+	_, err = BindIdentity(certCtx, "agent-2")
+	assert.ErrorIs(t, err, ErrIdentityMismatch)
+
+	ctx, err = BindIdentity(context.Background(), "")
+	require.NoError(t, err)
+	_, ok := mtls.IdentityFromContext(ctx)
+	assert.False(t, ok)
+}
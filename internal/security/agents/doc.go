@@ -0,0 +1,8 @@
+// Package agents реестр агентов с отдельными учетными данными для каждого агента.
+//
+// Каждому агенту выдается свой ключ подписи запросов (HMAC) и API токен, поэтому утечка
+// ключа одного агента не раскрывает остальных, а агента можно отозвать, не меняя ключи парка.
+// Агент передает свой идентификатор в заголовке X-Agent-ID или в метаданных gRPC x-agent-id.
+// Проверенный идентификатор агента попадает в контекст запроса и используется политикой доступа.
+// Реестр хранится в JSON файле, изменения записываются сразу.
+package agents
@@ -0,0 +1,259 @@
+package agents
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// credentialSize размер ключа подписи и токена в байтах до кодирования в hex
+const credentialSize = 32
+
+var (
+	// ErrUnknownAgent агент не зарегистрирован
+	ErrUnknownAgent = errors.New("unknown agent")
+	// ErrRevokedAgent агент отозван
+	ErrRevokedAgent = errors.New("agent is revoked")
+	// ErrAgentExists агент уже зарегистрирован
+	ErrAgentExists = errors.New("agent already exists")
+	// ErrInvalidAgentID идентификатор агента пустой или содержит недопустимые символы
+	ErrInvalidAgentID = errors.New("invalid agent id")
+	// ErrInvalidToken токен не совпадает с выданным агенту
+	ErrInvalidToken = errors.New("invalid agent token")
+)
+
+// agentIDPattern допустимый идентификатор агента
+var agentIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// DefaultRegistry реестр агентов HTTP и gRPC серверов, nil - все агенты используют общий ключ
+var DefaultRegistry *Registry
+
+// Agent запись реестра, токен хранится только в виде хеша
+type Agent struct {
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ID        string     `json:"id"`
+	Secret    string     `json:"secret"`
+	TokenHash string     `json:"token_hash"`
+}
+
+// AgentInfo сведения об агенте без учетных данных
+type AgentInfo struct {
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ID        string     `json:"id"`
+}
+
+// Credentials учетные данные, выданные агенту, показываются один раз при добавлении
+type Credentials struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	Token  string `json:"token"`
+}
+
+// Registry реестр агентов в JSON файле
+type Registry struct {
+	agents map[string]*Agent
+	now    func() time.Time
+	path   string
+	mx     sync.RWMutex
+}
+
+// NewRegistry открывает реестр из файла path, файл создается при первом добавлении агента,
+// пустой путь - реестр не задан
+func NewRegistry(path string) (*Registry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	r := &Registry{
+		agents: make(map[string]*Agent),
+		now:    time.Now,
+		path:   path,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent registry %s: %w", path, err)
+	}
+	var agents []*Agent
+	if err = json.Unmarshal(data, &agents); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal agent registry %s: %w", path, err)
+	}
+	for _, agent := range agents {
+		r.agents[agent.ID] = agent
+	}
+	return r, nil
+}
+
+// Add регистрирует агента и выдает ему новые учетные данные,
+// отозванному агенту учетные данные выдаются заново
+func (r *Registry) Add(id string) (Credentials, error) {
+	if !agentIDPattern.MatchString(id) {
+		return Credentials{}, fmt.Errorf("%w: %q", ErrInvalidAgentID, id)
+	}
+	secret, err := newCredential()
+	if err != nil {
+		return Credentials{}, err
+	}
+	token, err := newCredential()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if agent, ok := r.agents[id]; ok && agent.RevokedAt == nil {
+		return Credentials{}, fmt.Errorf("%w: %q", ErrAgentExists, id)
+	}
+	previous := r.agents[id]
+	r.agents[id] = &Agent{
+		CreatedAt: r.now().UTC(),
+		ID:        id,
+		Secret:    secret,
+		TokenHash: hashToken(token),
+	}
+	if err = r.save(); err != nil {
+		r.restore(id, previous)
+		return Credentials{}, err
+	}
+	return Credentials{ID: id, Secret: secret, Token: token}, nil
+}
+
+// Revoke отзывает агента, его запросы больше не принимаются
+func (r *Registry) Revoke(id string) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	agent, ok := r.agents[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownAgent, id)
+	}
+	if agent.RevokedAt != nil {
+		return nil
+	}
+	revoked := *agent
+	revokedAt := r.now().UTC()
+	revoked.RevokedAt = &revokedAt
+	r.agents[id] = &revoked
+	if err := r.save(); err != nil {
+		r.agents[id] = agent
+		return err
+	}
+	return nil
+}
+
+// List список агентов без учетных данных, отсортированный по идентификатору
+func (r *Registry) List() []AgentInfo {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	list := make([]AgentInfo, 0, len(r.agents))
+	for _, agent := range r.agents {
+		list = append(list, AgentInfo{CreatedAt: agent.CreatedAt, RevokedAt: agent.RevokedAt, ID: agent.ID})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Secret ключ подписи запросов действующего агента
+func (r *Registry) Secret(id string) (string, error) {
+	agent, err := r.active(id)
+	if err != nil {
+		return "", err
+	}
+	return agent.Secret, nil
+}
+
+// CheckToken проверяет API токен действующего агента
+func (r *Registry) CheckToken(id string, token string) error {
+	agent, err := r.active(id)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(agent.TokenHash)) != 1 {
+		return fmt.Errorf("%w: agent %q", ErrInvalidToken, id)
+	}
+	return nil
+}
+
+// active действующий агент по идентификатору
+func (r *Registry) active(id string) (*Agent, error) {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	agent, ok := r.agents[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAgent, id)
+	}
+	if agent.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: %q", ErrRevokedAgent, id)
+	}
+	return agent, nil
+}
+
+// restore возвращает запись агента после неудачной записи файла, вызывается под мьютексом
+func (r *Registry) restore(id string, previous *Agent) {
+	if previous == nil {
+		delete(r.agents, id)
+		return
+	}
+	r.agents[id] = previous
+}
+
+// save записывает реестр во временный файл и подменяет им старый, вызывается под мьютексом
+func (r *Registry) save() error {
+	agents := make([]*Agent, 0, len(r.agents))
+	for _, agent := range r.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	data, err := json.MarshalIndent(agents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal agent registry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save agent registry %s: %w", r.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save agent registry %s: %w", r.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save agent registry %s: %w", r.path, err)
+	}
+	if err = os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("failed to save agent registry %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// newCredential случайный ключ или токен
+func newCredential() (string, error) {
+	b := make([]byte, credentialSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate credential: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken хеш токена для хранения в реестре
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistry(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte("{"), 0600))
+
+	registry, err := NewRegistry("")
+	assert.NoError(t, err)
+	assert.Nil(t, registry)
+
+	registry, err = NewRegistry(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, registry.List())
+
+	_, err = NewRegistry(bad)
+	assert.Error(t, err)
+}
+
+func TestRegistry_AddRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.json")
+	registry, err := NewRegistry(path)
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	credentials, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", credentials.ID)
+	assert.NotEmpty(t, credentials.Secret)
+	assert.NotEmpty(t, credentials.Token)
+
+	_, err = registry.Add("agent-1")
+	assert.ErrorIs(t, err, ErrAgentExists)
+	_, err = registry.Add("bad id")
+	assert.ErrorIs(t, err, ErrInvalidAgentID)
+
+	secret, err := registry.Secret("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, credentials.Secret, secret)
+	assert.NoError(t, registry.CheckToken("agent-1", credentials.Token))
+	assert.ErrorIs(t, registry.CheckToken("agent-1", "wrong"), ErrInvalidToken)
+	_, err = registry.Secret("agent-2")
+	assert.ErrorIs(t, err, ErrUnknownAgent)
+
+	// реестр читается из файла, токен в файле не хранится
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), credentials.Token)
+	reopened, err := NewRegistry(path)
+	require.NoError(t, err)
+	assert.NoError(t, reopened.CheckToken("agent-1", credentials.Token))
+
+	require.NoError(t, registry.Revoke("agent-1"))
+	_, err = registry.Secret("agent-1")
+	assert.ErrorIs(t, err, ErrRevokedAgent)
+	assert.ErrorIs(t, registry.CheckToken("agent-1", credentials.Token), ErrRevokedAgent)
+	assert.ErrorIs(t, registry.Revoke("agent-2"), ErrUnknownAgent)
+	assert.Equal(t, []AgentInfo{{CreatedAt: now, RevokedAt: &now, ID: "agent-1"}}, registry.List())
+
+	reopened, err = NewRegistry(path)
+	require.NoError(t, err)
+	_, err = reopened.Secret("agent-1")
+	assert.ErrorIs(t, err, ErrRevokedAgent)
+
+	// отозванному агенту выдаются новые учетные данные
+	reissued, err := registry.Add("agent-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, credentials.Secret, reissued.Secret)
+	assert.ErrorIs(t, registry.CheckToken("agent-1", credentials.Token), ErrInvalidToken)
+	assert.NoError(t, registry.CheckToken("agent-1", reissued.Token))
+}
+
+func TestRegistry_SaveError(t *testing.T) {
+	registry, err := NewRegistry(filepath.Join(t.TempDir(), "missing", "agents.json"))
+	require.NoError(t, err)
+
+	_, err = registry.Add("agent-1")
+	assert.Error(t, err)
+	assert.Empty(t, registry.List())
+}
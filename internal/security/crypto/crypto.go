@@ -94,3 +94,17 @@ func NewRSADecryptor(privateKeyPath string) (Decryptor, error) {
 	decryptor.PrivateKey, err = rsa.LoadPrivateKey(privateKeyPath)
 	return &decryptor, err
 }
+
+// NewEnvelopeEncryptor фабрика для шифрования конвертом (AES-256-GCM + RSA-OAEP)
+func NewEnvelopeEncryptor(publicKeyPath string) (Encryptor, error) {
+	var encryptor envelopeEncryptor
+	var err error
+	encryptor.PublicKey, err = rsa.LoadPublicKey(publicKeyPath)
+	return &encryptor, err
+}
+
+// NewNegotiatingDecryptor фабрика дешифровщика, принимающего конверты и старый формат RSA
+func NewNegotiatingDecryptor(privateKeyPath string) (Decryptor, error) {
+	privateKey, err := rsa.LoadPrivateKey(privateKeyPath)
+	return NewNegotiatingDecryptorWithKey(privateKey), err
+}
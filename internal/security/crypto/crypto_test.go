@@ -176,3 +176,35 @@ func TestNewCryptoManager(t *testing.T) {
 		})
 	}
 }
+
+func TestNewEnvelopeEncryptor_NewNegotiatingDecryptor(t *testing.T) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	dir := t.TempDir()
+
+	privateBytes, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	privateFile, _ := os.Create(dir + "/priv_test.pem")
+	_ = pem.Encode(privateFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privateBytes})
+	_ = privateFile.Close()
+
+	publicBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicFile, _ := os.Create(dir + "/pub_test.pem")
+	_ = pem.Encode(publicFile, &pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicBytes})
+	_ = publicFile.Close()
+
+	encryptor, err := NewEnvelopeEncryptor(dir + "/pub_test.pem")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeEnvelope, EncryptorScheme(encryptor))
+
+	decryptor, err := NewNegotiatingDecryptor(dir + "/priv_test.pem")
+	assert.NoError(t, err)
+	assert.Equal(t, "*crypto.NegotiatingDecryptor", reflect.ValueOf(decryptor).Type().String())
+
+	encrypted, err := encryptor.Encrypt([]byte("payload"))
+	assert.NoError(t, err)
+	decrypted, err := decryptor.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("payload"), decrypted)
+
+	_, err = NewEnvelopeEncryptor(dir + "/missing.pem")
+	assert.Error(t, err)
+}
@@ -1,5 +1,14 @@
 // Package crypto обеспечивает унифицированный интерфейс для операций шифрования.
 //
 // Поддерживаемые алгоритмы:
-// - RSA (OAEP)
+// - RSA (OAEP), поблочное шифрование (старый формат)
+// - конверт: случайный ключ AES-256-GCM, обернутый RSA-OAEP, с версионируемым заголовком
+//
+// Схема шифрования передается клиентом в заголовке X-Encryption-Scheme (метаданные x-encryption-scheme для gRPC),
+// без заголовка формат определяется по сигнатуре конверта.
+//
+// Для смены ключей сервер держит набор приватных ключей (KeyRing) из каталога и перечитывает его,
+// ключ выбирается по идентификатору из заголовка X-Encryption-Key-Id (метаданные x-encryption-key-id
+// или поле keyId сообщения для gRPC). Ключ, удаленный из каталога, принимается еще grace период.
+// Агент перечитывает публичный ключ при замене файла (ReloadingEncryptor).
 package crypto
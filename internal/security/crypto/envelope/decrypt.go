@@ -0,0 +1,49 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// EnvelopeDecryptor дешифровщик конвертов
+type EnvelopeDecryptor struct {
+	PrivateKey *rsa.PrivateKey
+}
+
+// Decrypt функция дешифровки
+func (envDec EnvelopeDecryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	if envDec.PrivateKey == nil {
+		return ciphertext, nil
+	}
+
+	h, rest, err := parseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, envDec.PrivateKey, h.wrappedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	if len(dataKey) != dataKeySize {
+		return nil, errors.New("corrupted envelope: bad data key size")
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("corrupted envelope: incomplete data")
+	}
+
+	nonce, sealed := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, h.marshal())
+	if err != nil {
+		return nil, fmt.Errorf("envelope authentication failed: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,60 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+)
+
+// EnvelopeEncryptor шифровальщик: данные шифруются случайным ключом AES-256-GCM,
+// ключ данных шифруется публичным ключом RSA-OAEP
+type EnvelopeEncryptor struct {
+	PublicKey *rsa.PublicKey
+}
+
+// Encrypt функция шифрования
+func (envEnc EnvelopeEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	if envEnc.PublicKey == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, envEnc.PublicKey, dataKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	result := header{version: Version1, wrappedKey: wrappedKey}.marshal()
+	aad := result
+	result = append(result, nonce...)
+	return gcm.Seal(result, nonce, plaintext, aad), nil
+}
+
+// newGCM создание AES-GCM по ключу данных
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return gcm, nil
+}
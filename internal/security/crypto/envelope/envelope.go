@@ -0,0 +1,62 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// Version1 версия формата: AES-256-GCM ключ данных, обернутый RSA-OAEP (SHA-256)
+	Version1 byte = 1
+	// dataKeySize размер ключа данных AES-256
+	dataKeySize = 32
+	// wrappedKeySizeLen размер поля длины обернутого ключа (2 байта для uint16)
+	wrappedKeySizeLen = 2
+)
+
+// magic сигнатура в начале зашифрованного конверта
+var magic = []byte("GMEV")
+
+// headerSize размер заголовка без обернутого ключа: сигнатура, версия и длина ключа
+var headerSize = len(magic) + 1 + wrappedKeySizeLen
+
+// IsEnvelope проверяет, что данные зашифрованы в формате конверта
+// старый формат начинается с длины RSA блока (0x00000100 для 2048 бит) и с сигнатурой не совпадает
+func IsEnvelope(data []byte) bool {
+	return len(data) >= headerSize && bytes.Equal(data[:len(magic)], magic)
+}
+
+// header заголовок конверта
+// формат: "GMEV" | версия (1 байт) | длина обернутого ключа (uint16) | обернутый ключ | nonce | шифротекст с тегом GCM
+type header struct {
+	wrappedKey []byte
+	version    byte
+}
+
+// marshal сериализация заголовка, он же используется как дополнительные данные GCM
+func (h header) marshal() []byte {
+	buf := make([]byte, 0, headerSize+len(h.wrappedKey))
+	buf = append(buf, magic...)
+	buf = append(buf, h.version)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.wrappedKey)))
+	return append(buf, h.wrappedKey...)
+}
+
+// parseHeader разбор заголовка, возвращает заголовок и остаток данных
+func parseHeader(data []byte) (header, []byte, error) {
+	if !IsEnvelope(data) {
+		return header{}, nil, errors.New("corrupted envelope: bad signature")
+	}
+	h := header{version: data[len(magic)]}
+	if h.version != Version1 {
+		return header{}, nil, errors.New("unsupported envelope version")
+	}
+
+	keySize := int(binary.BigEndian.Uint16(data[len(magic)+1 : headerSize]))
+	if len(data) < headerSize+keySize {
+		return header{}, nil, errors.New("corrupted envelope: incomplete wrapped key")
+	}
+	h.wrappedKey = data[headerSize : headerSize+keySize]
+	return h, data[headerSize+keySize:], nil
+}
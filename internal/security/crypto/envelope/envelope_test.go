@@ -0,0 +1,131 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateTestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEnvelope_EncryptDecrypt(t *testing.T) {
+	key := generateTestKey(t)
+	encryptor := EnvelopeEncryptor{PublicKey: &key.PublicKey}
+	decryptor := EnvelopeDecryptor{PrivateKey: key}
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{name: "empty", plaintext: []byte{}},
+		{name: "short", plaintext: []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)},
+		{name: "larger than rsa block", plaintext: bytes.Repeat([]byte("metric"), 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := encryptor.Encrypt(tt.plaintext)
+			require.NoError(t, err)
+			assert.True(t, IsEnvelope(encrypted))
+			assert.Equal(t, Version1, encrypted[len(magic)])
+			// конверт больше данных только на заголовок, nonce и тег
+			assert.Less(t, len(encrypted)-len(tt.plaintext), 300)
+
+			decrypted, err := decryptor.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.plaintext, append([]byte{}, decrypted...))
+		})
+	}
+}
+
+func TestEnvelope_NilKeys(t *testing.T) {
+	data := []byte("plain")
+
+	encrypted, err := EnvelopeEncryptor{}.Encrypt(data)
+	require.NoError(t, err)
+	assert.Equal(t, data, encrypted)
+
+	decrypted, err := EnvelopeDecryptor{}.Decrypt(data)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+}
+
+func TestEnvelopeDecryptor_DecryptErrors(t *testing.T) {
+	key := generateTestKey(t)
+	otherKey := generateTestKey(t)
+	encrypted, err := EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt([]byte("secret data"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		key         *rsa.PrivateKey
+		data        func() []byte
+		errContains string
+	}{
+		{
+			name:        "not an envelope",
+			key:         key,
+			data:        func() []byte { return []byte{0, 0, 1, 0, 1, 2, 3} },
+			errContains: "bad signature",
+		},
+		{
+			name: "unsupported version",
+			key:  key,
+			data: func() []byte {
+				data := append([]byte{}, encrypted...)
+				data[len(magic)] = 99
+				return data
+			},
+			errContains: "unsupported envelope version",
+		},
+		{
+			name:        "truncated wrapped key",
+			key:         key,
+			data:        func() []byte { return encrypted[:headerSize+10] },
+			errContains: "incomplete wrapped key",
+		},
+		{
+			name:        "truncated data",
+			key:         key,
+			data:        func() []byte { return encrypted[:headerSize+256+5] },
+			errContains: "incomplete data",
+		},
+		{
+			name: "tampered ciphertext",
+			key:  key,
+			data: func() []byte {
+				data := append([]byte{}, encrypted...)
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+			errContains: "authentication failed",
+		},
+		{
+			name:        "wrong private key",
+			key:         otherKey,
+			data:        func() []byte { return encrypted },
+			errContains: "failed to unwrap data key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := EnvelopeDecryptor{PrivateKey: tt.key}.Decrypt(tt.data())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errContains)
+		})
+	}
+}
+
+func TestIsEnvelope(t *testing.T) {
+	assert.False(t, IsEnvelope(nil))
+	assert.False(t, IsEnvelope([]byte("GMEV")))
+	assert.False(t, IsEnvelope([]byte{0, 0, 1, 0, 0, 0, 0, 0}))
+	assert.True(t, IsEnvelope([]byte("GMEV\x01\x00\x00")))
+}
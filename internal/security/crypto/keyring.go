@@ -0,0 +1,257 @@
+package crypto
+
+import (
+	"context"
+	stdrsa "crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/security/crypto/rsa"
+)
+
+const (
+	// KeyIDHeader http заголовок с идентификатором ключа, которым зашифровано тело запроса
+	KeyIDHeader = "X-Encryption-Key-Id"
+	// KeyIDMetadataKey ключ метаданных gRPC с идентификатором ключа
+	KeyIDMetadataKey = "x-encryption-key-id"
+	// keyIDSize размер идентификатора ключа в байтах до кодирования в hex
+	keyIDSize = 8
+)
+
+// ErrUnknownKey ключ с переданным идентификатором не загружен
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyDecryptor дешифровщик, выбирающий приватный ключ по идентификатору
+type KeyDecryptor interface {
+	SchemeDecryptor
+	DecryptKey(keyID string, scheme string, encrypted []byte) ([]byte, error)
+}
+
+// KeyID идентификатор ключа: начало SHA-256 от публичного ключа в формате PKIX,
+// агент и сервер вычисляют его независимо, поэтому договариваться об именах файлов не нужно
+func KeyID(publicKey *stdrsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:keyIDSize]), nil
+}
+
+// ringKey загруженный приватный ключ, retiredAt - время, когда ключ пропал из каталога
+type ringKey struct {
+	decryptor *NegotiatingDecryptor
+	retiredAt time.Time
+}
+
+// KeyRing набор приватных ключей сервера из файла или каталога с PEM файлами,
+// ключ, удаленный из каталога, принимается еще grace после перезагрузки
+type KeyRing struct {
+	keys  map[string]*ringKey
+	now   func() time.Time
+	path  string
+	grace time.Duration
+	mx    sync.RWMutex
+}
+
+// NewKeyRing загружает ключи из файла или каталога,
+// при ошибке чтения отдельных файлов возвращает набор с остальными ключами и ошибку
+func NewKeyRing(path string, grace time.Duration) (*KeyRing, error) {
+	kr := &KeyRing{
+		keys:  make(map[string]*ringKey),
+		now:   time.Now,
+		path:  path,
+		grace: grace,
+	}
+	if err := kr.Reload(); err != nil {
+		if len(kr.KeyIDs()) == 0 {
+			return nil, err
+		}
+		return kr, err
+	}
+	return kr, nil
+}
+
+// Reload перечитывает ключи, пропавшие ключи удаляются по истечении grace
+func (kr *KeyRing) Reload() error {
+	loaded, err := loadPrivateKeys(kr.path)
+	if len(loaded) == 0 && err != nil {
+		// каталог недоступен, оставляем ранее загруженные ключи
+		return err
+	}
+
+	kr.mx.Lock()
+	defer kr.mx.Unlock()
+
+	now := kr.now()
+	for keyID, key := range kr.keys {
+		if _, ok := loaded[keyID]; ok {
+			continue
+		}
+		if key.retiredAt.IsZero() {
+			key.retiredAt = now
+			logger.WriteInfoLog("encryption key retired", keyID)
+		}
+		if now.Sub(key.retiredAt) >= kr.grace {
+			delete(kr.keys, keyID)
+			logger.WriteInfoLog("encryption key removed", keyID)
+		}
+	}
+	for keyID, privateKey := range loaded {
+		if key, ok := kr.keys[keyID]; ok {
+			key.retiredAt = time.Time{}
+			continue
+		}
+		kr.keys[keyID] = &ringKey{decryptor: NewNegotiatingDecryptorWithKey(privateKey)}
+		logger.WriteInfoLog("encryption key loaded", keyID)
+	}
+	return err
+}
+
+// Watch перечитывает ключи по тикеру до отмены контекста
+func (kr *KeyRing) Watch(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := kr.Reload(); err != nil {
+				logger.WriteErrorLog(err.Error(), "KeyRing reload")
+			}
+		}
+	}
+}
+
+// KeyIDs идентификаторы загруженных ключей, включая выведенные из оборота до истечения grace
+func (kr *KeyRing) KeyIDs() []string {
+	kr.mx.RLock()
+	defer kr.mx.RUnlock()
+	ids := make([]string, 0, len(kr.keys))
+	for keyID := range kr.keys {
+		ids = append(ids, keyID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Decrypt дешифровка без идентификатора ключа, ключи перебираются по очереди
+func (kr *KeyRing) Decrypt(encrypted []byte) ([]byte, error) {
+	return kr.DecryptScheme("", encrypted)
+}
+
+// DecryptScheme дешифровка без идентификатора ключа по схеме, ключи перебираются по очереди,
+// нужна для агентов, которые еще не передают идентификатор
+func (kr *KeyRing) DecryptScheme(scheme string, encrypted []byte) ([]byte, error) {
+	var errs []error
+	for _, decryptor := range kr.decryptors() {
+		plaintext, err := decryptor.DecryptScheme(scheme, encrypted)
+		if err == nil {
+			return plaintext, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, ErrUnknownKey
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DecryptKey дешифровка ключом с переданным идентификатором, пустой идентификатор - перебор ключей
+func (kr *KeyRing) DecryptKey(keyID string, scheme string, encrypted []byte) ([]byte, error) {
+	if keyID == "" {
+		return kr.DecryptScheme(scheme, encrypted)
+	}
+	kr.mx.RLock()
+	key, ok := kr.keys[keyID]
+	kr.mx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return key.decryptor.DecryptScheme(scheme, encrypted)
+}
+
+// decryptors дешифровщики, сначала действующие ключи, затем выведенные из оборота
+func (kr *KeyRing) decryptors() []*NegotiatingDecryptor {
+	kr.mx.RLock()
+	defer kr.mx.RUnlock()
+
+	ids := make([]string, 0, len(kr.keys))
+	for keyID := range kr.keys {
+		ids = append(ids, keyID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ri, rj := kr.keys[ids[i]].retiredAt.IsZero(), kr.keys[ids[j]].retiredAt.IsZero()
+		if ri != rj {
+			return ri
+		}
+		return ids[i] < ids[j]
+	})
+
+	result := make([]*NegotiatingDecryptor, 0, len(ids))
+	for _, keyID := range ids {
+		result = append(result, kr.keys[keyID].decryptor)
+	}
+	return result
+}
+
+// loadPrivateKeys читает приватный ключ из файла или все *.pem файлы каталога
+func loadPrivateKeys(path string) (map[string]*stdrsa.PrivateKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	keys := make(map[string]*stdrsa.PrivateKey, len(files))
+	var errs []error
+	for _, file := range files {
+		privateKey, err := rsa.LoadPrivateKey(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load key %s: %w", file, err))
+			continue
+		}
+		keyID, err := KeyID(&privateKey.PublicKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load key %s: %w", file, err))
+			continue
+		}
+		keys[keyID] = privateKey
+	}
+	if len(keys) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no keys found in %s", path))
+	}
+	return keys, errors.Join(errs...)
+}
+
+// DecryptWithKey дешифровка с учетом идентификатора ключа и схемы, если дешифровщик их поддерживает
+func DecryptWithKey(decryptor Decryptor, keyID string, scheme string, encrypted []byte) ([]byte, error) {
+	if kd, ok := decryptor.(KeyDecryptor); ok {
+		return kd.DecryptKey(keyID, scheme, encrypted)
+	}
+	return DecryptWithScheme(decryptor, scheme, encrypted)
+}
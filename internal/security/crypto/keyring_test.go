@@ -0,0 +1,171 @@
+package crypto
+
+import (
+	"crypto/rand"
+	stdrsa "crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair записывает приватный и публичный ключи в PEM файлы
+func writeKeyPair(t *testing.T, privatePath, publicPath string) *stdrsa.PrivateKey {
+	t.Helper()
+	privateKey, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateBytes}), 0600))
+
+	publicBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}), 0600))
+	return privateKey
+}
+
+func TestKeyID(t *testing.T) {
+	first, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	second, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	firstID, err := KeyID(&first.PublicKey)
+	require.NoError(t, err)
+	secondID, err := KeyID(&second.PublicKey)
+	require.NoError(t, err)
+
+	assert.Len(t, firstID, keyIDSize*2)
+	assert.NotEqual(t, firstID, secondID)
+	again, _ := KeyID(&first.PublicKey)
+	assert.Equal(t, firstID, again)
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	keysDir := t.TempDir()
+	pubDir := t.TempDir()
+	oldPrivate := filepath.Join(keysDir, "old.pem")
+	oldPublic := filepath.Join(pubDir, "old.pub")
+	newPrivate := filepath.Join(keysDir, "new.pem")
+	newPublic := filepath.Join(pubDir, "new.pub")
+	writeKeyPair(t, oldPrivate, oldPublic)
+
+	keyRing, err := NewKeyRing(keysDir, time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+	keyRing.now = func() time.Time { return now }
+
+	oldEncryptor, err := NewReloadingEncryptor(oldPublic)
+	require.NoError(t, err)
+	oldEncrypted, oldID, err := oldEncryptor.EncryptKey([]byte("old"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldID}, keyRing.KeyIDs())
+
+	// новый ключ добавлен в каталог, агенты переходят на него постепенно
+	writeKeyPair(t, newPrivate, newPublic)
+	require.NoError(t, keyRing.Reload())
+	newEncryptor, err := NewReloadingEncryptor(newPublic)
+	require.NoError(t, err)
+	newEncrypted, newID, err := newEncryptor.EncryptKey([]byte("new"))
+	require.NoError(t, err)
+	assert.Len(t, keyRing.KeyIDs(), 2)
+
+	decrypted, err := keyRing.DecryptKey(newID, SchemeEnvelope, newEncrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(decrypted))
+	decrypted, err = keyRing.DecryptKey(oldID, SchemeEnvelope, oldEncrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(decrypted))
+
+	// старый ключ удален из каталога, но принимается до конца grace
+	require.NoError(t, os.Remove(oldPrivate))
+	require.NoError(t, keyRing.Reload())
+	decrypted, err = keyRing.DecryptKey(oldID, SchemeEnvelope, oldEncrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(decrypted))
+
+	now = now.Add(time.Hour)
+	require.NoError(t, keyRing.Reload())
+	assert.Equal(t, []string{newID}, keyRing.KeyIDs())
+	_, err = keyRing.DecryptKey(oldID, SchemeEnvelope, oldEncrypted)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// без идентификатора ключи перебираются
+	decrypted, err = keyRing.Decrypt(newEncrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(decrypted))
+}
+
+func TestKeyRing_ReturnedKey(t *testing.T) {
+	keysDir := t.TempDir()
+	private := filepath.Join(keysDir, "key.pem")
+	public := filepath.Join(t.TempDir(), "key.pub")
+	writeKeyPair(t, private, public)
+	data, err := os.ReadFile(private)
+	require.NoError(t, err)
+	writeKeyPair(t, filepath.Join(keysDir, "other.pem"), filepath.Join(t.TempDir(), "other.pub"))
+
+	keyRing, err := NewKeyRing(keysDir, time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+	keyRing.now = func() time.Time { return now }
+
+	require.NoError(t, os.Remove(private))
+	require.NoError(t, keyRing.Reload())
+	// ключ вернули в каталог до истечения grace, он снова действующий
+	require.NoError(t, os.WriteFile(private, data, 0600))
+	require.NoError(t, keyRing.Reload())
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, keyRing.Reload())
+	assert.Len(t, keyRing.KeyIDs(), 2)
+}
+
+func TestNewKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	private := filepath.Join(dir, "key.pem")
+	writeKeyPair(t, private, filepath.Join(dir, "key.pub"))
+
+	// путь до одного файла
+	keyRing, err := NewKeyRing(private, time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, keyRing.KeyIDs(), 1)
+
+	// битый файл в каталоге не мешает загрузке остальных
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("broken"), 0600))
+	keyRing, err = NewKeyRing(dir, time.Hour)
+	assert.Error(t, err)
+	require.NotNil(t, keyRing)
+	assert.Len(t, keyRing.KeyIDs(), 1)
+
+	_, err = NewKeyRing(t.TempDir(), time.Hour)
+	assert.Error(t, err)
+
+	_, err = NewKeyRing(filepath.Join(dir, "missing"), time.Hour)
+	assert.Error(t, err)
+}
+
+func TestDecryptWithKey(t *testing.T) {
+	dir := t.TempDir()
+	privateKey := writeKeyPair(t, filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pub"))
+	encryptor, err := NewReloadingEncryptor(filepath.Join(dir, "key.pub"))
+	require.NoError(t, err)
+	encrypted, keyID, err := EncryptWithKeyID(encryptor, []byte("data"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, keyID)
+
+	// дешифровщик без поддержки идентификаторов ключей
+	decrypted, err := DecryptWithKey(NewNegotiatingDecryptorWithKey(privateKey), keyID, SchemeEnvelope, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(decrypted))
+
+	keyRing, err := NewKeyRing(dir, time.Hour)
+	require.NoError(t, err)
+	_, err = DecryptWithKey(keyRing, "unknown", SchemeEnvelope, encrypted)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/security/crypto/rsa"
+)
+
+// KeyEncryptor шифровальщик, сообщающий идентификатор ключа, которым зашифрованы данные
+type KeyEncryptor interface {
+	Encryptor
+	EncryptKey(plaintext []byte) ([]byte, string, error)
+}
+
+// ReloadingEncryptor шифровальщик конвертов, перечитывающий публичный ключ при изменении файла,
+// так агент переходит на новый ключ без перезапуска
+type ReloadingEncryptor struct {
+	modTime   time.Time
+	encryptor *envelopeEncryptor
+	path      string
+	keyID     string
+	mx        sync.Mutex
+}
+
+// NewReloadingEncryptor фабрика шифровальщика с перечитыванием публичного ключа
+func NewReloadingEncryptor(publicKeyPath string) (*ReloadingEncryptor, error) {
+	e := &ReloadingEncryptor{path: publicKeyPath}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Encrypt функция шифрования
+func (e *ReloadingEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	encrypted, _, err := e.EncryptKey(plaintext)
+	return encrypted, err
+}
+
+// EncryptKey шифрует данные и возвращает идентификатор ключа, которым они зашифрованы
+func (e *ReloadingEncryptor) EncryptKey(plaintext []byte) ([]byte, string, error) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	if err := e.reload(); err != nil {
+		// новый ключ еще не записан до конца, продолжаем шифровать старым
+		logger.WriteErrorLog(err.Error(), "ReloadingEncryptor reload")
+	}
+	encrypted, err := e.encryptor.Encrypt(plaintext)
+	return encrypted, e.keyID, err
+}
+
+// Scheme схема шифрования
+func (e *ReloadingEncryptor) Scheme() string {
+	return SchemeEnvelope
+}
+
+// KeyID идентификатор текущего публичного ключа
+func (e *ReloadingEncryptor) KeyID() string {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return e.keyID
+}
+
+// reload читает ключ, если файл изменился с последнего чтения, вызывается под мьютексом
+func (e *ReloadingEncryptor) reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	if e.encryptor != nil && info.ModTime().Equal(e.modTime) {
+		return nil
+	}
+
+	publicKey, err := rsa.LoadPublicKey(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to load public key %s: %w", e.path, err)
+	}
+	keyID, err := KeyID(publicKey)
+	if err != nil {
+		return err
+	}
+
+	encryptor := &envelopeEncryptor{}
+	encryptor.PublicKey = publicKey
+	if e.keyID != "" && e.keyID != keyID {
+		logger.WriteInfoLog("encryption key switched", keyID)
+	}
+	e.encryptor = encryptor
+	e.keyID = keyID
+	e.modTime = info.ModTime()
+	return nil
+}
+
+// EncryptWithKeyID шифрование с идентификатором ключа, если шифровальщик его сообщает
+func EncryptWithKeyID(encryptor Encryptor, plaintext []byte) ([]byte, string, error) {
+	if ke, ok := encryptor.(KeyEncryptor); ok {
+		return ke.EncryptKey(plaintext)
+	}
+	encrypted, err := encryptor.Encrypt(plaintext)
+	return encrypted, "", err
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadingEncryptor(t *testing.T) {
+	dir := t.TempDir()
+	public := filepath.Join(dir, "agent.pub")
+	firstKey := writeKeyPair(t, filepath.Join(dir, "first.pem"), public)
+
+	encryptor, err := NewReloadingEncryptor(public)
+	require.NoError(t, err)
+	assert.Equal(t, SchemeEnvelope, EncryptorScheme(encryptor))
+	firstID := encryptor.KeyID()
+	wantFirstID, _ := KeyID(&firstKey.PublicKey)
+	assert.Equal(t, wantFirstID, firstID)
+
+	// публичный ключ заменен, агент переходит на него при следующей отправке
+	secondKey := writeKeyPair(t, filepath.Join(dir, "second.pem"), public)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(public, future, future))
+
+	encrypted, keyID, err := encryptor.EncryptKey([]byte("data"))
+	require.NoError(t, err)
+	wantSecondID, _ := KeyID(&secondKey.PublicKey)
+	assert.Equal(t, wantSecondID, keyID)
+	decrypted, err := NewNegotiatingDecryptorWithKey(secondKey).Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(decrypted))
+
+	// недописанный файл ключа не ломает шифрование
+	require.NoError(t, os.WriteFile(public, []byte("partial"), 0600))
+	later := future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(public, later, later))
+	_, keyID, err = encryptor.EncryptKey([]byte("data"))
+	require.NoError(t, err)
+	assert.Equal(t, wantSecondID, keyID)
+
+	_, err = NewReloadingEncryptor(filepath.Join(dir, "missing.pub"))
+	assert.Error(t, err)
+}
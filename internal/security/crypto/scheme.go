@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	stdrsa "crypto/rsa"
+	"errors"
+
+	"github.com/ramil063/gometrics/internal/security/crypto/envelope"
+	"github.com/ramil063/gometrics/internal/security/crypto/rsa"
+)
+
+const (
+	// SchemeHeader http заголовок со схемой шифрования тела запроса
+	SchemeHeader = "X-Encryption-Scheme"
+	// SchemeMetadataKey ключ метаданных gRPC со схемой шифрования
+	SchemeMetadataKey = "x-encryption-scheme"
+	// SchemeRSA старая схема: поблочное шифрование RSA-OAEP
+	SchemeRSA = "rsa-oaep"
+	// SchemeEnvelope схема конверта: AES-256-GCM ключ данных, обернутый RSA-OAEP
+	SchemeEnvelope = "envelope-v1"
+)
+
+// ErrUnknownScheme неизвестная схема шифрования
+var ErrUnknownScheme = errors.New("unknown encryption scheme")
+
+// Schemer шифровальщик, сообщающий свою схему шифрования
+type Schemer interface {
+	Scheme() string
+}
+
+// SchemeDecryptor дешифровщик, поддерживающий выбор схемы шифрования
+type SchemeDecryptor interface {
+	Decryptor
+	DecryptScheme(scheme string, encrypted []byte) ([]byte, error)
+}
+
+// envelopeEncryptor шифровальщик конвертов со схемой
+type envelopeEncryptor struct {
+	envelope.EnvelopeEncryptor
+}
+
+// Scheme схема шифрования, пустая если ключ не загружен и данные не шифруются
+func (e *envelopeEncryptor) Scheme() string {
+	if e.PublicKey == nil {
+		return ""
+	}
+	return SchemeEnvelope
+}
+
+// NegotiatingDecryptor принимает данные в формате конверта и в старом поблочном формате RSA
+type NegotiatingDecryptor struct {
+	envelope envelope.EnvelopeDecryptor
+	legacy   rsa.RsaDecryptor
+}
+
+// Decrypt дешифровка с определением формата по сигнатуре конверта
+func (d *NegotiatingDecryptor) Decrypt(encrypted []byte) ([]byte, error) {
+	if envelope.IsEnvelope(encrypted) {
+		return d.envelope.Decrypt(encrypted)
+	}
+	return d.legacy.Decrypt(encrypted)
+}
+
+// DecryptScheme дешифровка по схеме, переданной клиентом, пустая схема определяется по данным
+func (d *NegotiatingDecryptor) DecryptScheme(scheme string, encrypted []byte) ([]byte, error) {
+	switch scheme {
+	case "":
+		return d.Decrypt(encrypted)
+	case SchemeEnvelope:
+		return d.envelope.Decrypt(encrypted)
+	case SchemeRSA:
+		return d.legacy.Decrypt(encrypted)
+	}
+	return nil, ErrUnknownScheme
+}
+
+// NewNegotiatingDecryptorWithKey создание дешифровщика по загруженному приватному ключу
+func NewNegotiatingDecryptorWithKey(privateKey *stdrsa.PrivateKey) *NegotiatingDecryptor {
+	return &NegotiatingDecryptor{
+		envelope: envelope.EnvelopeDecryptor{PrivateKey: privateKey},
+		legacy:   rsa.RsaDecryptor{PrivateKey: privateKey},
+	}
+}
+
+// DecryptWithScheme дешифровка с учетом схемы, если дешифровщик поддерживает выбор схемы
+func DecryptWithScheme(decryptor Decryptor, scheme string, encrypted []byte) ([]byte, error) {
+	if sd, ok := decryptor.(SchemeDecryptor); ok {
+		return sd.DecryptScheme(scheme, encrypted)
+	}
+	return decryptor.Decrypt(encrypted)
+}
+
+// EncryptorScheme схема шифрования шифровальщика, для старых шифровальщиков SchemeRSA
+func EncryptorScheme(encryptor Encryptor) string {
+	if s, ok := encryptor.(Schemer); ok {
+		return s.Scheme()
+	}
+	return SchemeRSA
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"crypto/rand"
+	stdrsa "crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/security/crypto/envelope"
+	"github.com/ramil063/gometrics/internal/security/crypto/rsa"
+)
+
+func TestNegotiatingDecryptor(t *testing.T) {
+	key, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	plaintext := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	envelopeData, err := envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+	legacyData, err := rsa.RsaEncryptor{PublicKey: &key.PublicKey}.Encrypt(plaintext)
+	require.NoError(t, err)
+
+	decryptor := NewNegotiatingDecryptorWithKey(key)
+
+	tests := []struct {
+		name    string
+		scheme  string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "detect envelope", data: envelopeData},
+		{name: "detect legacy", data: legacyData},
+		{name: "envelope scheme", scheme: SchemeEnvelope, data: envelopeData},
+		{name: "rsa scheme", scheme: SchemeRSA, data: legacyData},
+		{name: "scheme mismatch", scheme: SchemeEnvelope, data: legacyData, wantErr: true},
+		{name: "unknown scheme", scheme: "rot13", data: envelopeData, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptWithScheme(decryptor, tt.scheme, tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, got)
+		})
+	}
+}
+
+func TestDecryptWithScheme_PlainDecryptor(t *testing.T) {
+	got, err := DecryptWithScheme(rsa.RsaDecryptor{}, SchemeEnvelope, []byte("data"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), got)
+}
+
+func TestEncryptorScheme(t *testing.T) {
+	key, err := stdrsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	assert.Equal(t, SchemeRSA, EncryptorScheme(&rsa.RsaEncryptor{PublicKey: &key.PublicKey}))
+	assert.Equal(t, SchemeEnvelope, EncryptorScheme(&envelopeEncryptor{envelope.EnvelopeEncryptor{PublicKey: &key.PublicKey}}))
+	assert.Equal(t, "", EncryptorScheme(&envelopeEncryptor{}))
+}
@@ -0,0 +1,7 @@
+// Package ipfilter проверка адреса клиента по спискам разрешенных и запрещенных подсетей IPv4 и IPv6.
+//
+// Заголовки X-Forwarded-For и X-Real-IP (метаданные x-forwarded-for и x-real-ip в gRPC) учитываются,
+// только если соединение пришло от доверенного прокси, иначе адрес клиента берется из соединения.
+// Списки можно дополнить JSON файлом, который перечитывается без перезапуска сервера.
+// Фильтр общий для HTTP, gRPC и StatsD серверов.
+package ipfilter
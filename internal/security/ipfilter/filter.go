@@ -0,0 +1,166 @@
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrForbidden адрес клиента не разрешен
+var ErrForbidden = errors.New("client ip is not allowed")
+
+// Config списки фильтра, элемент списка - подсеть CIDR или отдельный адрес
+// Allow разрешенные подсети, пустой список - разрешены все, кроме запрещенных
+// Deny запрещенные подсети, проверяются раньше разрешенных
+// TrustedProxies подсети прокси, которым доверяется передача адреса клиента в заголовках
+type Config struct {
+	Allow          []string `json:"allow"`
+	Deny           []string `json:"deny"`
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// Merge объединяет списки двух настроек
+func (cfg Config) Merge(other Config) Config {
+	return Config{
+		Allow:          append(append([]string{}, cfg.Allow...), other.Allow...),
+		Deny:           append(append([]string{}, cfg.Deny...), other.Deny...),
+		TrustedProxies: append(append([]string{}, cfg.TrustedProxies...), other.TrustedProxies...),
+	}
+}
+
+// Filter разобранные списки подсетей, nil фильтр пропускает всех
+type Filter struct {
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	proxies []*net.IPNet
+}
+
+// New создает фильтр из настроек
+func New(cfg Config) (*Filter, error) {
+	allow, err := parseNets(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	deny, err := parseNets(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	proxies, err := parseNets(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	return &Filter{allow: allow, deny: deny, proxies: proxies}, nil
+}
+
+// Restricted ограничивает ли фильтр адреса клиентов
+func (f *Filter) Restricted() bool {
+	return f != nil && (len(f.allow) > 0 || len(f.deny) > 0)
+}
+
+// Allowed разрешен ли адрес, запрещенные подсети важнее разрешенных
+func (f *Filter) Allowed(ip net.IP) bool {
+	if !f.Restricted() {
+		return true
+	}
+	if ip == nil || contains(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || contains(f.allow, ip)
+}
+
+// ClientIP адрес клиента с учетом доверенных прокси.
+// X-Forwarded-For разбирается справа налево до первого адреса, не принадлежащего доверенным прокси,
+// без него берется X-Real-IP, заголовки от остальных адресов игнорируются
+func (f *Filter) ClientIP(peer net.IP, realIP string, forwardedFor string) net.IP {
+	if f == nil || !contains(f.proxies, peer) {
+		return peer
+	}
+	if forwardedFor != "" {
+		client := peer
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !contains(f.proxies, ip) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// Check определяет адрес клиента и проверяет, что он разрешен
+func (f *Filter) Check(peer net.IP, realIP string, forwardedFor string) (net.IP, error) {
+	client := f.ClientIP(peer, realIP, forwardedFor)
+	if !f.Allowed(client) {
+		return client, fmt.Errorf("%w: %s", ErrForbidden, client)
+	}
+	return client, nil
+}
+
+// SplitList разбирает список подсетей через запятую
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// PeerIP адрес из адреса соединения вида host:port
+func PeerIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// parseNets разбирает подсети, отдельный адрес считается подсетью из одного адреса
+func parseNets(items []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				nets = append(nets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+				continue
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q: %w", item, err)
+		}
+		nets = append(nets, subnet)
+	}
+	return nets, nil
+}
+
+// contains входит ли адрес в одну из подсетей
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range nets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
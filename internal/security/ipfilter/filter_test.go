@@ -0,0 +1,117 @@
+package ipfilter
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "empty", cfg: Config{}},
+		{name: "ipv4 and ipv6 subnets", cfg: Config{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.0.0.1", "::1"}}},
+		{name: "invalid allow", cfg: Config{Allow: []string{"10.0.0.0/33"}}, wantErr: true},
+		{name: "invalid deny", cfg: Config{Deny: []string{"not an ip"}}, wantErr: true},
+		{name: "invalid proxy", cfg: Config{TrustedProxies: []string{"proxy"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestFilter_Allowed(t *testing.T) {
+	filter, err := New(Config{
+		Allow: []string{"192.168.1.0/24", "2001:db8::/32"},
+		Deny:  []string{"192.168.1.100", "2001:db8:dead::/48"},
+	})
+	require.NoError(t, err)
+	denyOnly, err := New(Config{Deny: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		filter *Filter
+		name   string
+		ip     string
+		want   bool
+	}{
+		{name: "nil filter", filter: nil, ip: "10.0.0.1", want: true},
+		{name: "allowed ipv4", filter: filter, ip: "192.168.1.10", want: true},
+		{name: "not allowed ipv4", filter: filter, ip: "192.168.2.10", want: false},
+		{name: "denied ipv4", filter: filter, ip: "192.168.1.100", want: false},
+		{name: "allowed ipv6", filter: filter, ip: "2001:db8::1", want: true},
+		{name: "denied ipv6", filter: filter, ip: "2001:db8:dead::1", want: false},
+		{name: "ipv4 mapped ipv6", filter: filter, ip: "::ffff:192.168.1.10", want: true},
+		{name: "deny only allows others", filter: denyOnly, ip: "192.168.1.10", want: true},
+		{name: "deny only", filter: denyOnly, ip: "10.1.2.3", want: false},
+		{name: "unknown ip", filter: filter, ip: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Allowed(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestFilter_ClientIP(t *testing.T) {
+	filter, err := New(Config{TrustedProxies: []string{"10.0.0.0/8", "fd00::/8"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		peer         string
+		realIP       string
+		forwardedFor string
+		want         string
+	}{
+		{name: "peer without headers", peer: "10.0.0.1", want: "10.0.0.1"},
+		{name: "untrusted peer headers ignored", peer: "203.0.113.1", realIP: "192.168.1.1", forwardedFor: "192.168.1.2", want: "203.0.113.1"},
+		{name: "real ip from proxy", peer: "10.0.0.1", realIP: "192.168.1.1", want: "192.168.1.1"},
+		{name: "forwarded for wins over real ip", peer: "10.0.0.1", realIP: "192.168.1.1", forwardedFor: "192.168.1.2", want: "192.168.1.2"},
+		{name: "forwarded chain skips trusted proxies", peer: "10.0.0.1", forwardedFor: "1.1.1.1, 192.168.1.2, 10.0.0.2", want: "192.168.1.2"},
+		{name: "spoofed leftmost entry ignored", peer: "10.0.0.1", forwardedFor: "192.168.1.1, 203.0.113.5", want: "203.0.113.5"},
+		{name: "all hops are proxies", peer: "10.0.0.1", forwardedFor: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+		{name: "invalid hop stops", peer: "10.0.0.1", forwardedFor: "192.168.1.1, bad, 10.0.0.2", want: "10.0.0.2"},
+		{name: "ipv6 proxy", peer: "fd00::1", forwardedFor: "2001:db8::5", want: "2001:db8::5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filter.ClientIP(net.ParseIP(tt.peer), tt.realIP, tt.forwardedFor)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestFilter_Check(t *testing.T) {
+	filter, err := New(Config{Allow: []string{"192.168.1.0/24"}, TrustedProxies: []string{"10.0.0.1"}})
+	require.NoError(t, err)
+
+	ip, err := filter.Check(net.ParseIP("10.0.0.1"), "192.168.1.5", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.5", ip.String())
+
+	ip, err = filter.Check(net.ParseIP("10.0.0.2"), "192.168.1.5", "")
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.Equal(t, "10.0.0.2", ip.String())
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Nil(t, SplitList(""))
+	assert.Equal(t, []string{"10.0.0.0/8", "::1"}, SplitList(" 10.0.0.0/8, ,::1 "))
+}
+
+func TestPeerIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.1", PeerIP("192.0.2.1:1234").String())
+	assert.Equal(t, "2001:db8::1", PeerIP("[2001:db8::1]:1234").String())
+	assert.Equal(t, "192.0.2.1", PeerIP("192.0.2.1").String())
+	assert.Nil(t, PeerIP("pipe"))
+}
@@ -0,0 +1,98 @@
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+)
+
+// DefaultFilter фильтр адресов клиентов HTTP сервера, nil - пропускаются все
+var DefaultFilter *Reloadable
+
+// Reloadable фильтр из настроек флагов, дополненных списками из JSON файла,
+// файл перечитывается при изменении, при ошибке остается прежний фильтр
+type Reloadable struct {
+	current atomic.Pointer[Filter]
+	modTime time.Time
+	base    Config
+	path    string
+	mx      sync.Mutex
+}
+
+// NewReloadable создает фильтр из настроек base и файла path, пустой путь - только настройки base
+func NewReloadable(base Config, path string) (*Reloadable, error) {
+	r := &Reloadable{base: base, path: path}
+	if path == "" {
+		filter, err := New(base)
+		if err != nil {
+			return nil, err
+		}
+		r.current.Store(filter)
+		return r, nil
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Filter текущий фильтр
+func (r *Reloadable) Filter() *Filter {
+	if r == nil {
+		return nil
+	}
+	return r.current.Load()
+}
+
+// Reload перечитывает файл, если он изменился с прошлой загрузки
+func (r *Reloadable) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat ip filter file %s: %w", r.path, err)
+	}
+	if r.current.Load() != nil && info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read ip filter file %s: %w", r.path, err)
+	}
+	var cfg Config
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal ip filter file %s: %w", r.path, err)
+	}
+	filter, err := New(r.base.Merge(cfg))
+	if err != nil {
+		return fmt.Errorf("ip filter file %s: %w", r.path, err)
+	}
+	r.current.Store(filter)
+	r.modTime = info.ModTime()
+	return nil
+}
+
+// Watch перечитывает файл по тикеру до отмены контекста
+func (r *Reloadable) Watch(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				logger.WriteErrorLog(err.Error(), "ip filter reload")
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ipfilter
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReloadable(t *testing.T) {
+	r, err := NewReloadable(Config{Allow: []string{"10.0.0.0/8"}}, "")
+	require.NoError(t, err)
+	assert.True(t, r.Filter().Allowed(net.ParseIP("10.0.0.1")))
+	assert.False(t, r.Filter().Allowed(net.ParseIP("192.168.1.1")))
+
+	_, err = NewReloadable(Config{Allow: []string{"bad"}}, "")
+	assert.Error(t, err)
+
+	_, err = NewReloadable(Config{}, filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	var nilFilter *Reloadable
+	assert.Nil(t, nilFilter.Filter())
+}
+
+func TestReloadable_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipfilter.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"deny":["10.0.0.1"]}`), 0o600))
+
+	r, err := NewReloadable(Config{Allow: []string{"10.0.0.0/8"}}, path)
+	require.NoError(t, err)
+	assert.True(t, r.Filter().Allowed(net.ParseIP("10.0.0.2")))
+	assert.False(t, r.Filter().Allowed(net.ParseIP("10.0.0.1")))
+
+	// новые списки подхватываются после изменения файла
+	require.NoError(t, os.WriteFile(path, []byte(`{"deny":["10.0.0.2"],"trusted_proxies":["127.0.0.1"]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	require.NoError(t, r.Reload())
+	assert.True(t, r.Filter().Allowed(net.ParseIP("10.0.0.1")))
+	assert.False(t, r.Filter().Allowed(net.ParseIP("10.0.0.2")))
+	assert.Equal(t, "10.0.0.5", r.Filter().ClientIP(net.ParseIP("127.0.0.1"), "10.0.0.5", "").String())
+
+	// при ошибке остается прежний фильтр
+	require.NoError(t, os.WriteFile(path, []byte(`{"deny":["bad"]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	assert.Error(t, r.Reload())
+	assert.False(t, r.Filter().Allowed(net.ParseIP("10.0.0.2")))
+}
+
+func TestReloadable_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipfilter.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"allow":["10.0.0.0/8"]}`), 0o600))
+	r, err := NewReloadable(Config{}, path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx, time.NewTicker(10*time.Millisecond))
+		close(done)
+	}()
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"allow":["192.168.1.0/24"]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.Eventually(t, func() bool {
+		return r.Filter().Allowed(net.ParseIP("192.168.1.1"))
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
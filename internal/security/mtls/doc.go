@@ -0,0 +1,6 @@
+// Package mtls настройка TLS для HTTP и gRPC серверов и клиентов агента.
+//
+// Сервер проверяет сертификат клиента по CA агентов (mTLS), агент проверяет сертификат сервера.
+// Идентификатор агента берется из CN сертификата клиента, без CN - из первого SAN (DNS, затем URI).
+// Политика доступа ограничивает, какие метрики может записывать каждый агент.
+package mtls
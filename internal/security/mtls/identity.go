@@ -0,0 +1,50 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+type identityKey struct{}
+
+// Identity идентификатор агента из проверенного сертификата клиента,
+// пустая строка если сертификат не передан
+func Identity(state *tls.ConnectionState) string {
+	if state == nil {
+		return ""
+	}
+	// идентификатор берем только из сертификата, прошедшего проверку по CA
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		return CertificateIdentity(state.VerifiedChains[0][0])
+	}
+	return ""
+}
+
+// CertificateIdentity идентификатор из CN сертификата, без CN - из первого DNS или URI SAN
+func CertificateIdentity(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+// WithIdentity добавляет идентификатор агента в контекст
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext идентификатор агента из контекста
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok && identity != ""
+}
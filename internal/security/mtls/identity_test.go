@@ -0,0 +1,53 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertificateIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://metrics/agent-3")
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{name: "common name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}, DNSNames: []string{"host"}}, want: "agent-1"},
+		{name: "dns san", cert: &x509.Certificate{DNSNames: []string{"agent-2.local"}}, want: "agent-2.local"},
+		{name: "uri san", cert: &x509.Certificate{URIs: []*url.URL{spiffe}}, want: "spiffe://metrics/agent-3"},
+		{name: "empty", cert: &x509.Certificate{}, want: ""},
+		{name: "nil", cert: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CertificateIdentity(tt.cert))
+		})
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}}
+
+	assert.Equal(t, "", Identity(nil))
+	// непроверенный сертификат не дает идентификатора
+	assert.Equal(t, "", Identity(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}))
+	assert.Equal(t, "agent-1", Identity(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}))
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = IdentityFromContext(WithIdentity(context.Background(), ""))
+	assert.False(t, ok)
+
+	identity, ok := IdentityFromContext(WithIdentity(context.Background(), "agent-1"))
+	assert.True(t, ok)
+	assert.Equal(t, "agent-1", identity)
+}
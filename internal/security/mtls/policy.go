@@ -0,0 +1,89 @@
+package mtls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// AnyAgent правило политики для агентов, не перечисленных явно
+const AnyAgent = "*"
+
+// DefaultPolicy политика доступа агентов HTTP сервера, nil - разрешено все
+var DefaultPolicy *Policy
+
+// ErrForbidden агенту запрещено записывать метрику
+var ErrForbidden = errors.New("metric is not allowed for agent")
+
+// Policy разрешенные для записи метрики по идентификатору агента,
+// шаблоны имен метрик в формате path.Match, например "Disk*"
+type Policy struct {
+	rules map[string][]string
+}
+
+// NewPolicy создает политику из набора правил
+func NewPolicy(rules map[string][]string) (*Policy, error) {
+	for identity, patterns := range rules {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("agent %s: invalid pattern %q: %w", identity, pattern, err)
+			}
+		}
+	}
+	return &Policy{rules: rules}, nil
+}
+
+// LoadPolicy загружает политику из JSON файла вида {"agent-1": ["Alloc", "Disk*"], "*": ["PollCount"]},
+// пустой путь - политика не задана и разрешено все
+func LoadPolicy(filePath string) (*Policy, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file %s: %w", filePath, err)
+	}
+	var rules map[string][]string
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy file %s: %w", filePath, err)
+	}
+	return NewPolicy(rules)
+}
+
+// Allowed проверяет, может ли агент записывать метрику с именем name,
+// без политики разрешено все, при заданной политике агент без сертификата ничего записать не может
+func (p *Policy) Allowed(identity, name string) bool {
+	if p == nil {
+		return true
+	}
+	if identity == "" {
+		return false
+	}
+	patterns, ok := p.rules[identity]
+	if !ok {
+		patterns = p.rules[AnyAgent]
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize проверяет, что агент из контекста может записывать все перечисленные метрики
+func (p *Policy) Authorize(ctx context.Context, names ...string) error {
+	if p == nil {
+		return nil
+	}
+	identity, _ := IdentityFromContext(ctx)
+	for _, name := range names {
+		if !p.Allowed(identity, name) {
+			return fmt.Errorf("%w: agent %q, metric %q", ErrForbidden, identity, name)
+		}
+	}
+	return nil
+}
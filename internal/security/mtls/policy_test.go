@@ -0,0 +1,75 @@
+package mtls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy, err := NewPolicy(map[string][]string{
+		"agent-1": {"Alloc", "Disk*"},
+		AnyAgent:  {"PollCount"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		identity string
+		metric   string
+		want     bool
+	}{
+		{name: "exact", policy: policy, identity: "agent-1", metric: "Alloc", want: true},
+		{name: "pattern", policy: policy, identity: "agent-1", metric: "DiskUsed", want: true},
+		{name: "not listed for agent", policy: policy, identity: "agent-1", metric: "PollCount", want: false},
+		{name: "any agent", policy: policy, identity: "agent-2", metric: "PollCount", want: true},
+		{name: "any agent forbidden", policy: policy, identity: "agent-2", metric: "Alloc", want: false},
+		{name: "no identity", policy: policy, identity: "", metric: "PollCount", want: false},
+		{name: "no policy", policy: nil, identity: "", metric: "Alloc", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Allowed(tt.identity, tt.metric))
+		})
+	}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	policy, err := NewPolicy(map[string][]string{"agent-1": {"Alloc"}})
+	require.NoError(t, err)
+	ctx := WithIdentity(context.Background(), "agent-1")
+
+	assert.NoError(t, policy.Authorize(ctx, "Alloc"))
+	assert.ErrorIs(t, policy.Authorize(ctx, "Alloc", "Frees"), ErrForbidden)
+	assert.ErrorIs(t, policy.Authorize(context.Background(), "Alloc"), ErrForbidden)
+
+	var empty *Policy
+	assert.NoError(t, empty.Authorize(context.Background(), "Alloc"))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "policy.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"agent-1": ["Alloc"]}`), 0600))
+	badPattern := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(badPattern, []byte(`{"agent-1": ["[Alloc"]}`), 0600))
+
+	policy, err := LoadPolicy("")
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = LoadPolicy(valid)
+	require.NoError(t, err)
+	assert.True(t, policy.Allowed("agent-1", "Alloc"))
+
+	_, err = LoadPolicy(badPattern)
+	assert.Error(t, err)
+
+	_, err = LoadPolicy(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package statsd
+
+import (
+	"math"
+	"sync"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Snapshot агрегированные за окно отправки значения, ключи с учетом меток (models.MetricKey)
+type Snapshot struct {
+	Gauges      map[string]float64 // Абсолютные значения gauge
+	GaugeDeltas map[string]float64 // Относительные изменения gauge, применяются к текущему значению
+	Counters    map[string]int64   // Приращения счетчиков
+}
+
+// Empty проверка отсутствия значений
+func (s Snapshot) Empty() bool {
+	return len(s.Gauges) == 0 && len(s.GaugeDeltas) == 0 && len(s.Counters) == 0
+}
+
+type gaugeValue struct {
+	value    float64
+	relative bool
+}
+
+type timerValue struct {
+	labels map[string]string
+	name   string
+	min    float64
+	max    float64
+	sum    float64
+	n      int
+	count  float64
+}
+
+// Aggregator накапливает значения StatsD между отправками
+type Aggregator struct {
+	counters map[string]float64
+	gauges   map[string]gaugeValue
+	timers   map[string]*timerValue
+	sets     map[string]map[string]struct{}
+	mx       sync.Mutex
+}
+
+// NewAggregator создание агрегатора
+func NewAggregator() *Aggregator {
+	a := &Aggregator{}
+	a.reset()
+	return a
+}
+
+// Add добавление значения в текущее окно
+func (a *Aggregator) Add(m Metric) {
+	key := models.MetricKey(m.Name, m.Labels)
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	switch m.Type {
+	case TypeCounter:
+		a.counters[key] += m.Value / m.SampleRate
+	case TypeGauge:
+		current, ok := a.gauges[key]
+		if m.Relative && ok {
+			current.value += m.Value
+			a.gauges[key] = current
+			return
+		}
+		a.gauges[key] = gaugeValue{value: m.Value, relative: m.Relative}
+	case TypeTimer, TypeHistogram:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timerValue{name: m.Name, labels: m.Labels, min: m.Value, max: m.Value}
+			a.timers[key] = t
+		}
+		t.min = math.Min(t.min, m.Value)
+		t.max = math.Max(t.max, m.Value)
+		t.sum += m.Value
+		t.n++
+		t.count += 1 / m.SampleRate
+	case TypeSet:
+		set, ok := a.sets[key]
+		if !ok {
+			set = make(map[string]struct{})
+			a.sets[key] = set
+		}
+		set[m.SetValue] = struct{}{}
+	}
+}
+
+// AddAll добавление нескольких значений
+func (a *Aggregator) AddAll(metrics []Metric) {
+	for _, m := range metrics {
+		a.Add(m)
+	}
+}
+
+// Flush получение агрегированных значений и начало нового окна
+func (a *Aggregator) Flush() Snapshot {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	snapshot := Snapshot{
+		Gauges:      make(map[string]float64),
+		GaugeDeltas: make(map[string]float64),
+		Counters:    make(map[string]int64),
+	}
+	for key, value := range a.counters {
+		snapshot.Counters[key] += int64(math.Round(value))
+	}
+	for key, g := range a.gauges {
+		if g.relative {
+			snapshot.GaugeDeltas[key] = g.value
+			continue
+		}
+		snapshot.Gauges[key] = g.value
+	}
+	for key, set := range a.sets {
+		snapshot.Gauges[key] = float64(len(set))
+	}
+	for _, t := range a.timers {
+		snapshot.Gauges[models.MetricKey(t.name+".min", t.labels)] = t.min
+		snapshot.Gauges[models.MetricKey(t.name+".max", t.labels)] = t.max
+		snapshot.Gauges[models.MetricKey(t.name+".mean", t.labels)] = t.sum / float64(t.n)
+		snapshot.Counters[models.MetricKey(t.name+".count", t.labels)] += int64(math.Round(t.count))
+	}
+
+	a.reset()
+	return snapshot
+}
+
+func (a *Aggregator) reset() {
+	a.counters = make(map[string]float64)
+	a.gauges = make(map[string]gaugeValue)
+	a.timers = make(map[string]*timerValue)
+	a.sets = make(map[string]map[string]struct{})
+}
@@ -0,0 +1,65 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, lines ...string) []Metric {
+	t.Helper()
+	metrics := make([]Metric, 0, len(lines))
+	for _, line := range lines {
+		m, err := Parse(line)
+		require.NoError(t, err)
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	a := NewAggregator()
+	a.AddAll(mustParse(t,
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"requests:1|c|#host:a",
+		"temp:10|g",
+		"temp:+5|g",
+		"delta:+2|g",
+		"delta:-0.5|g",
+		"latency:10|ms",
+		"latency:30|ms|@0.5",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	))
+
+	snapshot := a.Flush()
+	assert.Equal(t, map[string]int64{
+		"requests":           5,
+		`requests{host="a"}`: 1,
+		"latency.count":      3,
+	}, snapshot.Counters)
+	assert.Equal(t, map[string]float64{
+		"temp":         15,
+		"latency.min":  10,
+		"latency.max":  30,
+		"latency.mean": 20,
+		"users":        2,
+	}, snapshot.Gauges)
+	assert.Equal(t, map[string]float64{"delta": 1.5}, snapshot.GaugeDeltas)
+	assert.False(t, snapshot.Empty())
+
+	// после отправки окно начинается заново
+	assert.True(t, a.Flush().Empty())
+}
+
+func TestAggregator_AbsoluteGaugeResetsDelta(t *testing.T) {
+	a := NewAggregator()
+	a.AddAll(mustParse(t, "temp:+5|g", "temp:7|g"))
+
+	snapshot := a.Flush()
+	assert.Equal(t, map[string]float64{"temp": 7}, snapshot.Gauges)
+	assert.Empty(t, snapshot.GaugeDeltas)
+}
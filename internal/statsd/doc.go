@@ -0,0 +1,12 @@
+// Package statsd прием метрик по протоколу StatsD через UDP и Unix датаграммы, разбор строкового протокола
+// и агрегация значений в пределах окна отправки. Server записывает агрегированные значения в хранилище
+// сервера или в локальный прием агента.
+//
+// Поддерживаемые типы:
+// - c счетчик, с учетом частоты выборки @rate
+// - g gauge, в том числе относительное изменение +N/-N
+// - ms и h таймеры/гистограммы, агрегируются в gauge name.min, name.max, name.mean и counter name.count
+// - s множества, агрегируются в gauge с количеством уникальных значений
+//
+// Теги в формате DogStatsD (|#host:a,env:prod) сохраняются как метки метрики.
+package statsd
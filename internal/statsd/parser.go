@@ -0,0 +1,123 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ramil063/gometrics/internal/models"
+)
+
+// Типы метрик StatsD
+const (
+	TypeCounter   = "c"
+	TypeGauge     = "g"
+	TypeTimer     = "ms"
+	TypeHistogram = "h"
+	TypeSet       = "s"
+)
+
+// Metric одно значение из строки протокола StatsD
+type Metric struct {
+	Labels     map[string]string // Метки из тегов DogStatsD
+	Name       string            // Имя метрики
+	Type       string            // Тип метрики (c, g, ms, h, s)
+	SetValue   string            // Значение для множества
+	Value      float64           // Числовое значение
+	SampleRate float64           // Частота выборки, 1 если не указана
+	Relative   bool              // Относительное изменение gauge (+N/-N)
+}
+
+// Parse разбор строки вида name:value|type[|@rate][|#tag:value,...]
+func Parse(line string) (Metric, error) {
+	m := Metric{SampleRate: 1}
+
+	nameEnd := strings.LastIndexByte(strings.SplitN(line, "|", 2)[0], ':')
+	if nameEnd <= 0 {
+		return m, fmt.Errorf("invalid statsd line %q: no name", line)
+	}
+	m.Name = line[:nameEnd]
+
+	parts := strings.Split(line[nameEnd+1:], "|")
+	if len(parts) < 2 {
+		return m, fmt.Errorf("invalid statsd line %q: no type", line)
+	}
+	rawValue := parts[0]
+	m.Type = parts[1]
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("invalid sample rate in %q", line)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			m.Labels = parseTags(part[1:])
+		}
+	}
+	if err := models.ValidateMetricKey(m.Name, m.Labels); err != nil {
+		return m, fmt.Errorf("invalid statsd line %q: %w", line, err)
+	}
+
+	switch m.Type {
+	case TypeSet:
+		if rawValue == "" {
+			return m, fmt.Errorf("invalid statsd line %q: empty set value", line)
+		}
+		m.SetValue = rawValue
+		return m, nil
+	case TypeGauge:
+		m.Relative = strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-")
+	case TypeCounter, TypeTimer, TypeHistogram:
+	default:
+		return m, fmt.Errorf("invalid statsd line %q: unknown type %s", line, m.Type)
+	}
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return m, fmt.Errorf("invalid statsd line %q: %w", line, err)
+	}
+	m.Value = value
+	return m, nil
+}
+
+// ParsePacket разбор датаграммы, строки разделяются переводом строки
+// ошибочные строки пропускаются, ошибки объединяются
+func ParsePacket(data []byte) ([]Metric, error) {
+	lines := strings.Split(string(data), "\n")
+	metrics := make([]Metric, 0, len(lines))
+	var errs []error
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m, err := Parse(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// parseTags разбор тегов host:a,env:prod, тег без значения получает пустое значение
+func parseTags(tags string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		labels[name] = value
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
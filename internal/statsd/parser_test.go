@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Metric
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "requests:1|c",
+			want: Metric{Name: "requests", Type: TypeCounter, Value: 1, SampleRate: 1},
+		},
+		{
+			name: "counter with sample rate",
+			line: "requests:2|c|@0.5",
+			want: Metric{Name: "requests", Type: TypeCounter, Value: 2, SampleRate: 0.5},
+		},
+		{
+			name: "gauge",
+			line: "temp:42.5|g",
+			want: Metric{Name: "temp", Type: TypeGauge, Value: 42.5, SampleRate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "temp:-3|g",
+			want: Metric{Name: "temp", Type: TypeGauge, Value: -3, SampleRate: 1, Relative: true},
+		},
+		{
+			name: "timer with tags",
+			line: "api.latency:320|ms|@0.1|#host:a,env:prod",
+			want: Metric{
+				Name: "api.latency", Type: TypeTimer, Value: 320, SampleRate: 0.1,
+				Labels: map[string]string{"host": "a", "env": "prod"},
+			},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: Metric{Name: "users", Type: TypeSet, SetValue: "alice", SampleRate: 1},
+		},
+		{name: "no name", line: ":1|c", wantErr: true},
+		{name: "no type", line: "requests:1", wantErr: true},
+		{name: "unknown type", line: "requests:1|x", wantErr: true},
+		{name: "bad value", line: "requests:abc|c", wantErr: true},
+		{name: "bad sample rate", line: "requests:1|c|@2", wantErr: true},
+		{name: "empty set value", line: "users:|s", wantErr: true},
+		{name: "brace in name", line: "api{x}:1|c", wantErr: true},
+		{name: "bad tag name", line: "requests:1|c|#ho=st:a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	metrics, err := ParsePacket([]byte("a:1|c\n\nbad line\nb:2|g\n"))
+	assert.Error(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "a", metrics[0].Name)
+	assert.Equal(t, "b", metrics[1].Name)
+
+	metrics, err = ParsePacket([]byte("a:1|c"))
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
@@ -0,0 +1,150 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ramil063/gometrics/internal/logger"
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+)
+
+// MaxPacketSize максимальный размер принимаемой датаграммы
+const MaxPacketSize = 65535
+
+// Storage хранилище, в которое записываются агрегированные значения
+type Storage interface {
+	SetGauge(name string, value models.Gauge) error
+	GetGauge(name string) (float64, error)
+	AddCounter(name string, value models.Counter) error
+}
+
+// Server прием метрик StatsD
+type Server struct {
+	storage    Storage
+	aggregator *Aggregator
+	filter     *ipfilter.Reloadable
+}
+
+// NewServer создание сервера StatsD, nil фильтр отключает проверку адреса отправителя
+func NewServer(storage Storage, filter *ipfilter.Reloadable) *Server {
+	return &Server{
+		storage:    storage,
+		aggregator: NewAggregator(),
+		filter:     filter,
+	}
+}
+
+// Listen открытие сокета, network udp или unixgram
+// для unixgram оставшийся от прошлого запуска файл сокета удаляется
+func Listen(network string, address string) (net.PacketConn, error) {
+	if network == "unixgram" {
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return net.ListenPacket(network, address)
+}
+
+// ListenAndServe открытие сокета и запуск чтения датаграмм в отдельной горутине
+func (s *Server) ListenAndServe(ctx context.Context, network string, address string) error {
+	conn, err := Listen(network, address)
+	if err != nil {
+		return err
+	}
+	go s.Serve(ctx, conn)
+	return nil
+}
+
+// Serve чтение датаграмм до завершения контекста, соединение закрывается при выходе
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.WriteErrorLog(err.Error(), "statsd ReadFrom")
+			continue
+		}
+		s.HandlePacket(addr, buf[:n])
+	}
+}
+
+// HandlePacket разбор датаграммы от отправителя addr и добавление значений в окно
+func (s *Server) HandlePacket(addr net.Addr, data []byte) {
+	if !s.isTrusted(addr) {
+		logger.WriteDebugLog("statsd packet from untrusted address", addr.String())
+		return
+	}
+
+	metrics, err := ParsePacket(data)
+	if err != nil {
+		logger.WriteDebugLog(err.Error(), "statsd ParsePacket")
+	}
+	s.aggregator.AddAll(metrics)
+}
+
+// Run запись агрегированных значений в хранилище по тикеру, при завершении контекста выполняется последняя запись
+func (s *Server) Run(ctx context.Context, ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				logger.WriteErrorLog(err.Error(), "statsd Flush")
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				logger.WriteErrorLog(err.Error(), "statsd Flush")
+			}
+		}
+	}
+}
+
+// Flush запись значений текущего окна в хранилище
+func (s *Server) Flush() error {
+	snapshot := s.aggregator.Flush()
+
+	var errs []error
+	for key, value := range snapshot.Gauges {
+		errs = append(errs, s.storage.SetGauge(key, models.Gauge(value)))
+	}
+	for key, delta := range snapshot.GaugeDeltas {
+		// метрики еще нет в хранилище, изменение применяется к нулю
+		current, err := s.storage.GetGauge(key)
+		if err != nil {
+			current = 0
+		}
+		errs = append(errs, s.storage.SetGauge(key, models.Gauge(current+delta)))
+	}
+	for key, value := range snapshot.Counters {
+		errs = append(errs, s.storage.AddCounter(key, models.Counter(value)))
+	}
+	return errors.Join(errs...)
+}
+
+// isTrusted проверка адреса отправителя, Unix датаграммы приходят с локальной машины и всегда доверенные
+func (s *Server) isTrusted(addr net.Addr) bool {
+	filter := s.filter.Filter()
+	if !filter.Restricted() {
+		return true
+	}
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return filter.Allowed(a.IP)
+	case *net.UnixAddr, nil:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ramil063/gometrics/internal/models"
+	"github.com/ramil063/gometrics/internal/security/ipfilter"
+)
+
+// memStorage хранилище значений в памяти
+type memStorage struct {
+	gauges   map[string]models.Gauge
+	counters map[string]models.Counter
+	mu       sync.Mutex
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{
+		gauges:   make(map[string]models.Gauge),
+		counters: make(map[string]models.Counter),
+	}
+}
+
+func (s *memStorage) SetGauge(name string, value models.Gauge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gauges[name] = value
+	return nil
+}
+
+func (s *memStorage) GetGauge(name string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.gauges[name]
+	if !ok {
+		return 0, errors.New("gauge not found")
+	}
+	return float64(value), nil
+}
+
+func (s *memStorage) AddCounter(name string, value models.Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name] += value
+	return nil
+}
+
+func (s *memStorage) GetCounter(name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.counters[name]
+	if !ok {
+		return 0, errors.New("counter not found")
+	}
+	return int64(value), nil
+}
+
+// newTestFilter создает фильтр с разрешенными подсетями
+func newTestFilter(t *testing.T, allow ...string) *ipfilter.Reloadable {
+	filter, err := ipfilter.NewReloadable(ipfilter.Config{Allow: allow}, "")
+	require.NoError(t, err)
+	return filter
+}
+
+func TestNewServer(t *testing.T) {
+	s := NewServer(newMemStorage(), nil)
+	assert.True(t, s.isTrusted(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}))
+
+	s = NewServer(newMemStorage(), newTestFilter(t, "10.0.0.0/8"))
+	assert.True(t, s.isTrusted(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}))
+	assert.False(t, s.isTrusted(&net.UDPAddr{IP: net.ParseIP("192.168.1.1")}))
+}
+
+func TestServer_HandlePacketAndFlush(t *testing.T) {
+	ms := newMemStorage()
+	require.NoError(t, ms.SetGauge("temp", 10))
+	require.NoError(t, ms.AddCounter("requests", 5))
+
+	s := NewServer(ms, nil)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}
+	s.HandlePacket(addr, []byte("requests:1|c\nrequests:1|c\ntemp:+2.5|g\nnew:-1|g\ncpu:3|g|#core:0\nbad"))
+	require.NoError(t, s.Flush())
+
+	counter, err := ms.GetCounter("requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+
+	gauge, err := ms.GetGauge("temp")
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, gauge)
+
+	gauge, err = ms.GetGauge("new")
+	require.NoError(t, err)
+	assert.Equal(t, float64(-1), gauge)
+
+	gauge, err = ms.GetGauge(`cpu{core="0"}`)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), gauge)
+
+	// повторная отправка пустого окна не меняет значения
+	require.NoError(t, s.Flush())
+	counter, err = ms.GetCounter("requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+}
+
+func TestServer_isTrusted(t *testing.T) {
+	s := NewServer(newMemStorage(), newTestFilter(t, "192.168.1.0/24"))
+
+	tests := []struct {
+		addr net.Addr
+		name string
+		want bool
+	}{
+		{name: "trusted udp", addr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10")}, want: true},
+		{name: "untrusted udp", addr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1")}, want: false},
+		{name: "unix socket", addr: &net.UnixAddr{Name: "/tmp/app.sock", Net: "unixgram"}, want: true},
+		{name: "unnamed unix socket", addr: nil, want: true},
+		{name: "tcp", addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.10")}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.isTrusted(tt.addr))
+		})
+	}
+
+	ms := newMemStorage()
+	s = NewServer(ms, newTestFilter(t, "192.168.1.0/24"))
+	s.HandlePacket(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}, []byte("requests:1|c"))
+	require.NoError(t, s.Flush())
+	_, err := ms.GetCounter("requests")
+	assert.Error(t, err)
+}
+
+func TestServer_Serve(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		address string
+	}{
+		{name: "udp", network: "udp", address: "127.0.0.1:0"},
+		{name: "unixgram", network: "unixgram", address: filepath.Join(t.TempDir(), "statsd.sock")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newMemStorage()
+			s := NewServer(ms, newTestFilter(t, "127.0.0.0/8"))
+
+			conn, err := Listen(tt.network, tt.address)
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				s.Serve(ctx, conn)
+				close(done)
+			}()
+
+			client, err := net.Dial(tt.network, conn.LocalAddr().String())
+			require.NoError(t, err)
+			defer client.Close()
+			_, err = client.Write([]byte("hits:3|c"))
+			require.NoError(t, err)
+
+			assert.Eventually(t, func() bool {
+				require.NoError(t, s.Flush())
+				value, err := ms.GetCounter("hits")
+				return err == nil && value == 3
+			}, time.Second, 10*time.Millisecond)
+
+			cancel()
+			<-done
+		})
+	}
+}
+
+func TestServer_Run(t *testing.T) {
+	ms := newMemStorage()
+	s := NewServer(ms, nil)
+	s.HandlePacket(nil, []byte("hits:1|c"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// при завершении контекста выполняется последняя запись
+	s.Run(ctx, time.NewTicker(time.Hour))
+
+	value, err := ms.GetCounter("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+}